@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"cluster/infra/cluster/raft"
+	"cluster/infra/failover"
+)
+
+// handleNodeDrain handles /api/v1/nodes/{node}/drain.
+// POST starts a drain, GET reports its progress and DELETE ends it (uncordon).
+// Any agent accepts them: the drain is recorded through Raft and evacuated by the drained
+// node's agent, or by the leader when that node is down.
+func (s *Server) handleNodeDrain(w http.ResponseWriter, r *http.Request, nodeName string) {
+	if s.migrationManager == nil {
+		http.Error(w, "Migration manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		drain, exists := s.migrationManager.GetDrain(nodeName)
+		if !exists {
+			http.Error(w, "Node has not been drained", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, drainResponse(drain))
+		return
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		drain, err := s.migrationManager.UndrainNode(nodeName)
+		if errors.Is(err, failover.ErrNotDraining) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, drainResponse(drain))
+		return
+	}
+
+	var req struct {
+		Concurrency int `json:"concurrency"` // optional, default 2
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Concurrency < 0 {
+		http.Error(w, "concurrency must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	drain, err := s.migrationManager.DrainNode(nodeName, req.Concurrency)
+	if errors.Is(err, failover.ErrUnknownNode) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, failover.ErrDrainInProgress) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, drainResponse(drain))
+}
+
+// drainResponse converts a drain record to its API representation with a progress summary
+func drainResponse(drain *raft.DrainRecord) map[string]interface{} {
+	summary := map[string]int{
+		raft.DrainServicePending:   0,
+		raft.DrainServiceMigrating: 0,
+		raft.DrainServiceMigrated:  0,
+		raft.DrainServiceFailed:    0,
+		raft.DrainServiceUnmovable: 0,
+	}
+	unmovable := make([]raft.DrainService, 0)
+	for _, service := range drain.Services {
+		summary[service.Status]++
+		if service.Status == raft.DrainServiceUnmovable {
+			unmovable = append(unmovable, service)
+		}
+	}
+
+	return map[string]interface{}{
+		"node_name":    drain.NodeName,
+		"status":       drain.Status,
+		"cordoned":     drain.Cordoned(),
+		"concurrency":  drain.Concurrency,
+		"coordinator":  drain.Coordinator,
+		"started_at":   drain.StartedAt,
+		"updated_at":   drain.UpdatedAt,
+		"completed_at": drain.CompletedAt,
+		"services":     drain.Services,
+		"summary":      summary,
+		"unmovable":    unmovable, // Needs manual action
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// handleMigrationPlan handles POST /api/v1/migrations/plan. It evaluates a migration
+// the way POST /api/v1/migrations would start it and returns the plan without side effects.
+// Requests naming another source_node are forwarded to that node's agent.
+func (s *Server) handleMigrationPlan(w http.ResponseWriter, r *http.Request) {
+	if s.migrationManager == nil {
+		http.Error(w, "Migration manager not available", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		ServiceName   string  `json:"service_name"`
+		TargetNode    string  `json:"target_node,omitempty"`
+		SourceNode    string  `json:"source_node,omitempty"` // Node running the service (default: this node)
+		Priority      int     `json:"priority,omitempty"`
+		BandwidthMbps float64 `json:"bandwidth_mbps,omitempty"` // Link speed for the estimate (default 100)
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.ServiceName == "" {
+		http.Error(w, "service_name is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.SourceNode != "" && req.SourceNode != s.gossipCluster.GetNodeName() {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.forwardToNode(w, r, req.SourceNode)
+		return
+	}
+
+	liftDeadlines(w)
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	rule := s.manualMigrationRule(req.ServiceName, req.TargetNode, req.Priority)
+	plan, err := s.migrationManager.PlanMigration(ctx, rule, req.BandwidthMbps)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to plan migration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
@@ -3,14 +3,19 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"cluster/infra/cluster/gossip"
 	"cluster/infra/cluster/raft"
 	"cluster/infra/failover"
+	"cluster/infra/monitoring"
 )
 
 // Server provides REST API for cluster management
@@ -21,6 +26,14 @@ type Server struct {
 	wsServer         *WebSocketServer
 	port             int
 	server           *http.Server
+	// Optional: accepts migration payloads from other agents
+	migrationReceiver *failover.MigrationReceiver
+	// Optional: this node's resource usage for the metrics endpoint
+	metricsCollector *monitoring.MetricsCollector
+	// Optional: what this node's Traefik provider serves in place of a service that is down
+	fallbackStatus func(serviceName string) (string, bool)
+	// Optional: routers this node's Traefik provider leaves out, with the reason
+	droppedRouters func(serviceName string) map[string]string
 }
 
 // NewServer creates a new API server
@@ -34,6 +47,23 @@ func NewServer(gossipCluster *gossip.GossipCluster, consensusManager *raft.Conse
 	}
 }
 
+// SetMetricsCollector includes this node's detailed resource usage in the metrics endpoint
+func (s *Server) SetMetricsCollector(collector *monitoring.MetricsCollector) {
+	s.metricsCollector = collector
+}
+
+// SetFallbackStatus reports services that are down and the fallback served in their
+// place, as this node's Traefik provider routes them
+func (s *Server) SetFallbackStatus(status func(serviceName string) (string, bool)) {
+	s.fallbackStatus = status
+}
+
+// SetDroppedRouters reports the routers of a service this node's Traefik provider
+// leaves out of its configuration, with the reason
+func (s *Server) SetDroppedRouters(status func(serviceName string) map[string]string) {
+	s.droppedRouters = status
+}
+
 // Start starts the API server
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
@@ -55,14 +85,20 @@ func (s *Server) Start() error {
 	// Raft status
 	mux.HandleFunc("/api/v1/raft/status", s.handleRaftStatus)
 	mux.HandleFunc("/api/v1/raft/leader", s.handleRaftLeader)
+	mux.HandleFunc(raft.ForwardPath, s.handleRaftApply)
 
 	// Metrics
 	mux.HandleFunc("/api/v1/metrics", s.handleMetrics)
 
 	// Migrations
 	mux.HandleFunc("/api/v1/migrations", s.handleMigrations)
+	mux.HandleFunc("/api/v1/migrations/history", s.handleMigrationHistory)
+	mux.HandleFunc("/api/v1/migrations/plan", s.handleMigrationPlan)
 	mux.HandleFunc("/api/v1/migrations/", s.handleMigration)
 
+	// Agent-to-agent migration transport
+	mux.HandleFunc(failover.TransferPathPrefix, s.handleTransfer)
+
 	// WebSocket
 	if s.wsServer != nil {
 		mux.HandleFunc("/ws", s.wsServer.HandleWebSocket)
@@ -187,13 +223,18 @@ func (s *Server) handleNode(w http.ResponseWriter, r *http.Request) {
 	// Extract node name and operation from path
 	path := r.URL.Path[len("/api/v1/nodes/"):]
 
-	// Check for operations (cordon/uncordon)
+	// Check for operations (cordon/uncordon/drain)
 	if path != "" {
 		parts := splitPath(path)
 		if len(parts) == 2 {
 			nodeName := parts[0]
 			operation := parts[1]
 
+			if operation == "drain" {
+				s.handleNodeDrain(w, r, nodeName)
+				return
+			}
+
 			if r.Method == http.MethodPost {
 				if operation == "cordon" {
 					s.handleNodeCordon(w, r, nodeName)
@@ -238,13 +279,9 @@ func (s *Server) handleNode(w http.ResponseWriter, r *http.Request) {
 	nodeServices := make([]map[string]interface{}, 0)
 	for _, health := range allServices {
 		if health.NodeName == nodeName {
-			nodeServices = append(nodeServices, map[string]interface{}{
-				"service_name": health.ServiceName,
-				"healthy":      health.Healthy,
-				"checked_at":   health.CheckedAt.Format(time.RFC3339),
-				"endpoints":    health.Endpoints,
-				"networks":     health.Networks,
-			})
+			instance := serviceInstance(health)
+			instance["service_name"] = health.ServiceName
+			nodeServices = append(nodeServices, instance)
 		}
 	}
 
@@ -320,6 +357,13 @@ func (s *Server) handleNodeUncordon(w http.ResponseWriter, r *http.Request, node
 		capabilities = []string{}
 	}
 
+	// Uncordoning ends a drain, otherwise the drain record would keep the node cordoned
+	if s.migrationManager != nil {
+		if _, err := s.migrationManager.UndrainNode(nodeName); err != nil && !errors.Is(err, failover.ErrNotDraining) {
+			log.Printf("Warning: Failed to end drain of %s: %v", nodeName, err)
+		}
+	}
+
 	// Update node metadata to uncordoned
 	s.gossipCluster.UpdateNodeMetadata(false, capabilities)
 
@@ -354,6 +398,39 @@ func splitPath(path string) []string {
 	return parts
 }
 
+// serviceInstance describes a service on one node, with its damped health state,
+// Docker's status and the active probe result behind it
+func serviceInstance(health *gossip.ServiceHealth) map[string]interface{} {
+	instance := map[string]interface{}{
+		"healthy":           health.Healthy,
+		"effective_healthy": health.EffectiveHealthy(),
+		"state":             health.State,
+		"checked_at":        health.CheckedAt.Format(time.RFC3339),
+		"endpoints":         health.Endpoints,
+		"networks":          health.Networks,
+		"docker_status":     health.DockerStatus,
+	}
+	if health.Project != "" {
+		instance["project"] = health.Project
+	}
+	if health.Instance != "" {
+		instance["instance"] = health.Instance
+	}
+	if health.Probe != nil {
+		instance["probe"] = health.Probe
+	}
+	if health.HeldUntil != nil {
+		instance["held_until"] = health.HeldUntil.Format(time.RFC3339)
+	}
+	if len(health.Dependencies) > 0 {
+		instance["dependencies"] = health.Dependencies
+	}
+	if dependency := health.UnmetDependency(); dependency != nil {
+		instance["cause"] = fmt.Sprintf("dependency %s is %s", dependency.Service, dependency.Reason)
+	}
+	return instance
+}
+
 // handleServices handles service list requests
 func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
 	state := s.gossipCluster.GetState()
@@ -366,30 +443,29 @@ func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
 		if serviceMap[serviceName] == nil {
 			serviceMap[serviceName] = make([]map[string]interface{}, 0)
 		}
-		serviceMap[serviceName] = append(serviceMap[serviceName], map[string]interface{}{
-			"node_name":  health.NodeName,
-			"healthy":    health.Healthy,
-			"checked_at": health.CheckedAt.Format(time.RFC3339),
-			"endpoints":  health.Endpoints,
-			"networks":   health.Networks,
-		})
+		instance := serviceInstance(health)
+		instance["node_name"] = health.NodeName
+		serviceMap[serviceName] = append(serviceMap[serviceName], instance)
 	}
 
 	services := make([]map[string]interface{}, 0, len(serviceMap))
 	for serviceName, instances := range serviceMap {
+		// Instances Traefik routes to: passing their checks with dependencies met
 		healthyCount := 0
 		for _, inst := range instances {
-			if inst["healthy"].(bool) {
+			if inst["effective_healthy"].(bool) {
 				healthyCount++
 			}
 		}
 
-		services = append(services, map[string]interface{}{
+		service := map[string]interface{}{
 			"service_name":  serviceName,
 			"instances":     len(instances),
 			"healthy_count": healthyCount,
 			"nodes":         instances,
-		})
+		}
+		s.addRoutingStatus(service, serviceName)
+		services = append(services, service)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -409,31 +485,50 @@ func (s *Server) handleService(w http.ResponseWriter, r *http.Request) {
 	}
 
 	state := s.gossipCluster.GetState()
-	healthyNodes := state.GetHealthyServiceNodes(serviceName)
 
+	// Every healthy replica, including several on one node. Only those whose dependencies
+	// are met count as healthy, as only they are routed to.
 	instances := make([]map[string]interface{}, 0)
-	for _, nodeName := range healthyNodes {
-		health, exists := state.GetServiceHealth(serviceName, nodeName)
-		if !exists {
+	healthyCount := 0
+	for _, health := range state.GetAllServiceHealth() {
+		if health.ServiceName != serviceName || !health.Healthy {
 			continue
 		}
 
-		instances = append(instances, map[string]interface{}{
-			"node_name":  health.NodeName,
-			"healthy":    health.Healthy,
-			"checked_at": health.CheckedAt.Format(time.RFC3339),
-			"endpoints":  health.Endpoints,
-			"networks":   health.Networks,
-		})
+		instance := serviceInstance(health)
+		instance["node_name"] = health.NodeName
+		instances = append(instances, instance)
+		if health.EffectiveHealthy() {
+			healthyCount++
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	service := map[string]interface{}{
 		"service_name":  serviceName,
 		"instances":     instances,
-		"healthy_count": len(instances),
-	})
+		"healthy_count": healthyCount,
+	}
+	s.addRoutingStatus(service, serviceName)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(service)
+}
+
+// addRoutingStatus marks a service that is down and served by a fallback, and lists its
+// routers left out of the Traefik configuration
+func (s *Server) addRoutingStatus(service map[string]interface{}, serviceName string) {
+	if s.fallbackStatus != nil {
+		if fallback, ok := s.fallbackStatus(serviceName); ok {
+			service["status"] = "service down, serving fallback"
+			service["fallback"] = fallback
+		}
+	}
+	if s.droppedRouters != nil {
+		if dropped := s.droppedRouters(serviceName); len(dropped) > 0 {
+			service["dropped_routers"] = dropped
+		}
+	}
 }
 
 // handleRaftStatus handles Raft status requests
@@ -462,6 +557,39 @@ func (s *Server) handleRaftLeader(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleRaftApply applies a command forwarded from a follower to the leader
+func (s *Server) handleRaftApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.consensusManager.ForwardingEnabled() {
+		http.Error(w, "Raft forwarding disabled (no cluster token configured)", http.StatusServiceUnavailable)
+		return
+	}
+	if !s.consensusManager.AuthorizeForward(r.Header.Get("Authorization")) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, 4<<20))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.consensusManager.ApplyForwarded(data); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to apply command: %v", err), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"applied": true,
+	})
+}
+
 // handleMetrics handles metrics requests
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	state := s.gossipCluster.GetState()
@@ -488,13 +616,20 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	// Resource usage of every node, as last published through gossip
+	nodeResources := make(map[string]*gossip.NodeResources)
+	for _, node := range allNodes {
+		if node.Resources != nil {
+			nodeResources[node.Name] = node.Resources
+		}
+	}
+
+	response := map[string]interface{}{
 		"nodes": map[string]interface{}{
-			"total":    len(allNodes),
-			"healthy":  healthyNodes,
-			"cordoned": cordonedNodes,
+			"total":     len(allNodes),
+			"healthy":   healthyNodes,
+			"cordoned":  cordonedNodes,
+			"resources": nodeResources,
 		},
 		"services": map[string]interface{}{
 			"total":     len(allServices),
@@ -507,7 +642,16 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		},
 		"cluster_version": state.Version,
 		"timestamp":       time.Now().UTC().Format(time.RFC3339),
-	})
+	}
+	if s.metricsCollector != nil {
+		if local, ok := s.metricsCollector.LatestMetrics(); ok {
+			response["local"] = local
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
 }
 
 // handleMigrations handles migration list requests and migration creation
@@ -525,17 +669,7 @@ func (s *Server) handleMigrations(w http.ResponseWriter, r *http.Request) {
 
 		// Add active migrations
 		for _, migration := range activeMigrations {
-			mig := map[string]interface{}{
-				"service_name": migration.ServiceName,
-				"source_node":  migration.SourceNode,
-				"target_node":  migration.TargetNode,
-				"status":       string(migration.Status),
-				"started_at":   migration.StartedAt.Format(time.RFC3339),
-			}
-			if migration.CompletedAt != nil {
-				mig["completed_at"] = migration.CompletedAt.Format(time.RFC3339)
-			}
-			migrations = append(migrations, mig)
+			migrations = append(migrations, migrationResponse(migration))
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -563,21 +697,10 @@ func (s *Server) handleMigrations(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Create migration rule
-		rule := failover.MigrationRule{
-			ServiceName: req.ServiceName,
-			TargetNode:  req.TargetNode,
-			Priority:    req.Priority,
-			MaxRetries:  3,
-			RetryDelay:  5 * time.Second,
-			Trigger: failover.MigrationTrigger{
-				HealthCheckFailures: 0, // Manual trigger
-			},
-		}
+		rule := s.manualMigrationRule(req.ServiceName, req.TargetNode, req.Priority)
 
-		// Start migration
-		ctx := r.Context()
-		if err := s.migrationManager.StartMigration(ctx, rule); err != nil {
+		// Start migration detached from the request, which ends long before the migration does
+		if err := s.migrationManager.StartMigrationWithReason(context.Background(), rule, "api"); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to start migration: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -589,13 +712,7 @@ func (s *Server) handleMigrations(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		result := map[string]interface{}{
-			"service_name": migration.ServiceName,
-			"source_node":  migration.SourceNode,
-			"target_node":  migration.TargetNode,
-			"status":       string(migration.Status),
-			"started_at":   migration.StartedAt.Format(time.RFC3339),
-		}
+		result := migrationResponse(migration)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusAccepted)
@@ -606,6 +723,22 @@ func (s *Server) handleMigrations(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
+// manualMigrationRule builds the rule used for migrations triggered through the API
+func (s *Server) manualMigrationRule(serviceName, targetNode string, priority int) failover.MigrationRule {
+	rule := failover.MigrationRule{
+		ServiceName: serviceName,
+		TargetNode:  targetNode,
+		Priority:    priority,
+		MaxRetries:  3,
+		RetryDelay:  5 * time.Second,
+		Trigger: failover.MigrationTrigger{
+			HealthCheckFailures: 0, // Manual trigger
+		},
+	}
+	rule.PreHooks, rule.PostHooks = s.migrationManager.HooksFor(serviceName)
+	return rule
+}
+
 // handleMigration handles individual migration requests
 func (s *Server) handleMigration(w http.ResponseWriter, r *http.Request) {
 	if s.migrationManager == nil {
@@ -613,39 +746,284 @@ func (s *Server) handleMigration(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract service name from path
-	serviceName := r.URL.Path[len("/api/v1/migrations/"):]
-	if serviceName == "" {
+	// Extract service name and operation from path
+	parts := splitPath(r.URL.Path[len("/api/v1/migrations/"):])
+	if len(parts) == 0 || parts[0] == "" {
 		http.Error(w, "Service name required", http.StatusBadRequest)
 		return
 	}
+	serviceName := parts[0]
 
-	if r.Method == http.MethodGet {
+	if len(parts) == 2 && parts[1] == "rollback" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleMigrationRollback(w, r, serviceName)
+		return
+	}
+	if len(parts) > 1 {
+		http.Error(w, "Unknown migration operation", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
 		migration, exists := s.migrationManager.GetMigrationStatus(serviceName)
 		if !exists {
 			http.Error(w, "Migration not found", http.StatusNotFound)
 			return
 		}
 
-		result := map[string]interface{}{
-			"service_name": migration.ServiceName,
-			"source_node":  migration.SourceNode,
-			"target_node":  migration.TargetNode,
-			"status":       string(migration.Status),
-			"started_at":   migration.StartedAt.Format(time.RFC3339),
-		}
-		if migration.CompletedAt != nil {
-			result["completed_at"] = migration.CompletedAt.Format(time.RFC3339)
-		}
-		if migration.Error != nil {
-			result["error"] = migration.Error.Error()
-		}
+		result := migrationResponse(migration)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(result)
+	case http.MethodDelete:
+		s.handleMigrationCancel(w, r, serviceName)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleMigrationCancel cancels an in-flight migration, forwarding to the source node if needed
+func (s *Server) handleMigrationCancel(w http.ResponseWriter, r *http.Request, serviceName string) {
+	migration, err := s.migrationManager.CancelMigration(serviceName)
+	s.writeMigrationControlResult(w, r, migration, err)
+}
+
+// handleMigrationRollback rolls a migration back, forwarding to the source node if needed
+func (s *Server) handleMigrationRollback(w http.ResponseWriter, r *http.Request, serviceName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	migration, err := s.migrationManager.RollbackMigration(ctx, serviceName)
+	s.writeMigrationControlResult(w, r, migration, err)
+}
+
+// writeMigrationControlResult maps the outcome of a cancel or rollback to an HTTP response
+func (s *Server) writeMigrationControlResult(w http.ResponseWriter, r *http.Request, migration *failover.Migration, err error) {
+	switch {
+	case err == nil:
+		// A rollback of a migration off a node that is down runs once the node is back
+		status := http.StatusOK
+		if migration.PendingAction == raft.PendingRollback {
+			status = http.StatusAccepted
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(migrationResponse(migration))
+	case errors.Is(err, failover.ErrNotSourceNode):
+		s.forwardToNode(w, r, s.migrationManager.ControlNode(migration))
+	case errors.Is(err, failover.ErrMigrationNotFound):
+		http.Error(w, "Migration not found", http.StatusNotFound)
+	case errors.Is(err, failover.ErrMigrationNotActive), errors.Is(err, failover.ErrRollbackNotAllowed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// forwardedHeader marks requests proxied between agents to prevent forwarding loops
+const forwardedHeader = "X-Constellation-Forwarded"
+
+var forwardClient = &http.Client{Timeout: 3 * time.Minute}
+
+// forwardToNode proxies a request to the same endpoint on another node's agent.
+// All agents are assumed to serve the API on the same port.
+func (s *Server) forwardToNode(w http.ResponseWriter, r *http.Request, nodeName string) {
+	if r.Header.Get(forwardedHeader) != "" {
+		http.Error(w, "Request was already forwarded by another node", http.StatusLoopDetected)
 		return
 	}
 
-	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	node, exists := s.gossipCluster.GetState().GetNode(nodeName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Node %s not found in cluster", nodeName), http.StatusBadGateway)
+		return
+	}
+
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(node.TailscaleIP, strconv.Itoa(s.port)), r.URL.RequestURI())
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, url, r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build forwarded request: %v", err), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set(forwardedHeader, "1")
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := forwardClient.Do(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to forward request to %s: %v", nodeName, err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// handleMigrationHistory returns stored migration records, newest first.
+// Supports ?service=, ?status=, ?node=, ?limit= and ?offset= query parameters.
+func (s *Server) handleMigrationHistory(w http.ResponseWriter, r *http.Request) {
+	if s.migrationManager == nil {
+		http.Error(w, "Migration manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := parseQueryInt(query.Get("limit"), defaultHistoryLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	offset, err := parseQueryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	records, total := s.migrationManager.ListMigrationHistory(raft.MigrationFilter{
+		ServiceName: query.Get("service"),
+		Status:      query.Get("status"),
+		NodeName:    query.Get("node"),
+		Offset:      offset,
+		Limit:       limit,
+	})
+
+	migrations := make([]migrationRecordResponse, 0, len(records))
+	for _, record := range records {
+		migrations = append(migrations, newMigrationRecordResponse(record))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"migrations": migrations,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// parseQueryInt parses an integer query parameter, returning def when empty
+func parseQueryInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// migrationRecordResponse is a stored migration record as the history API returns it.
+// Of the progress, only the completed phases are listed.
+type migrationRecordResponse struct {
+	ID                string                     `json:"id"`
+	ServiceName       string                     `json:"service_name"`
+	SourceNode        string                     `json:"source_node"`
+	TargetNode        string                     `json:"target_node"`
+	SourceContainerID string                     `json:"source_container_id,omitempty"`
+	TargetContainerID string                     `json:"target_container_id,omitempty"`
+	Status            string                     `json:"status"`
+	Phase             string                     `json:"phase,omitempty"`
+	Attempt           int                        `json:"attempt,omitempty"`
+	FailedTargets     []string                   `json:"failed_targets,omitempty"`
+	Reason            string                     `json:"reason,omitempty"`
+	Error             string                     `json:"error,omitempty"`
+	StartedAt         time.Time                  `json:"started_at"`
+	UpdatedAt         time.Time                  `json:"updated_at"`
+	CompletedAt       *time.Time                 `json:"completed_at,omitempty"`
+	CleanupAt         *time.Time                 `json:"cleanup_at,omitempty"`
+	Coordinator       string                     `json:"coordinator,omitempty"`
+	PendingAction     string                     `json:"pending_action,omitempty"`
+	CompletedPhases   []string                   `json:"completed_phases,omitempty"`
+	Transitions       []raft.MigrationTransition `json:"transitions"`
+	Steps             []raft.MigrationStep       `json:"steps"`
+}
+
+// newMigrationRecordResponse converts a stored migration record to its API representation
+func newMigrationRecordResponse(record *raft.MigrationRecord) migrationRecordResponse {
+	response := migrationRecordResponse{
+		ID:                record.ID,
+		ServiceName:       record.ServiceName,
+		SourceNode:        record.SourceNode,
+		TargetNode:        record.TargetNode,
+		SourceContainerID: record.SourceContainerID,
+		TargetContainerID: record.TargetContainerID,
+		Status:            record.Status,
+		Phase:             record.Phase,
+		Attempt:           record.Attempt,
+		FailedTargets:     record.FailedTargets,
+		Reason:            record.Reason,
+		Error:             record.Error,
+		StartedAt:         record.StartedAt,
+		UpdatedAt:         record.UpdatedAt,
+		CompletedAt:       record.CompletedAt,
+		CleanupAt:         record.CleanupAt,
+		Coordinator:       record.Coordinator,
+		PendingAction:     record.PendingAction,
+		Transitions:       record.Transitions,
+		Steps:             record.Steps,
+	}
+	if record.Progress != nil {
+		response.CompletedPhases = record.Progress.CompletedPhases
+	}
+	return response
+}
+
+// migrationResponse converts a migration to its API representation
+func migrationResponse(migration *failover.Migration) map[string]interface{} {
+	result := map[string]interface{}{
+		"id":           migration.ID,
+		"service_name": migration.ServiceName,
+		"source_node":  migration.SourceNode,
+		"target_node":  migration.TargetNode,
+		"status":       string(migration.Status),
+		"phase":        string(migration.Phase),
+		"attempt":      migration.Attempt,
+		"reason":       migration.Reason,
+		"started_at":   migration.StartedAt.Format(time.RFC3339),
+		"transitions":  migration.Transitions,
+		"steps":        migration.Steps,
+	}
+	if migration.SourceContainerID != "" {
+		result["source_container_id"] = migration.SourceContainerID
+	}
+	if migration.TargetContainerID != "" {
+		result["target_container_id"] = migration.TargetContainerID
+	}
+	if migration.CompletedAt != nil {
+		result["completed_at"] = migration.CompletedAt.Format(time.RFC3339)
+	}
+	if migration.CleanupAt != nil {
+		result["cleanup_at"] = migration.CleanupAt.Format(time.RFC3339)
+	}
+	if migration.Coordinator != "" {
+		result["coordinator"] = migration.Coordinator
+	}
+	if migration.PendingAction != "" {
+		result["pending_action"] = migration.PendingAction
+	}
+	if migration.Error != nil {
+		result["error"] = migration.Error.Error()
+	}
+	return result
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -49,6 +50,9 @@ func createTestGossipCluster() *gossip.GossipCluster {
 	return cluster
 }
 
+// testClusterToken authenticates writes forwarded to the test consensus manager
+const testClusterToken = "test-cluster-token"
+
 func createTestConsensusManager() *raft.ConsensusManager {
 	// Create a temporary directory for Raft data with unique name
 	raftPort := getNextPort()
@@ -61,6 +65,7 @@ func createTestConsensusManager() *raft.ConsensusManager {
 		BindPort:  raftPort,
 		SeedNodes: []string{},
 		LogLevel:  "error", // Reduce noise in tests
+		Token:     testClusterToken,
 	}
 	manager, _ := raft.NewConsensusManager(config)
 	return manager
@@ -331,6 +336,243 @@ func TestServer_HandleService(t *testing.T) {
 	assert.Contains(t, response, "healthy_count")
 }
 
+func TestServer_HandleService_ReportsFallback(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+	server.SetFallbackStatus(func(serviceName string) (string, bool) {
+		return "503 Service Unavailable, Retry-After 30s", serviceName == "web"
+	})
+
+	state := gossipCluster.GetState()
+	state.UpdateServiceHealth(&gossip.ServiceHealth{ServiceName: "web", NodeName: "node1", Healthy: false})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/services/web", nil)
+	w := httptest.NewRecorder()
+
+	server.handleService(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.Equal(t, "service down, serving fallback", response["status"])
+	assert.Equal(t, "503 Service Unavailable, Retry-After 30s", response["fallback"])
+}
+
+func TestServer_HandleService_ReportsDroppedRouters(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+	server.SetDroppedRouters(func(serviceName string) map[string]string {
+		if serviceName != "web" {
+			return nil
+		}
+		return map[string]string{"web-with-failover": `middleware "auth" is not defined`}
+	})
+
+	state := gossipCluster.GetState()
+	state.UpdateServiceHealth(&gossip.ServiceHealth{ServiceName: "web", NodeName: "node1", Healthy: true})
+	state.UpdateServiceHealth(&gossip.ServiceHealth{ServiceName: "api", NodeName: "node1", Healthy: true})
+
+	for serviceName, want := range map[string]interface{}{
+		"web": map[string]interface{}{"web-with-failover": `middleware "auth" is not defined`},
+		"api": nil,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/services/"+serviceName, nil)
+		w := httptest.NewRecorder()
+		server.handleService(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, want, response["dropped_routers"], serviceName)
+	}
+}
+
+func TestServer_HandleService_ListsReplicas(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	// Two replicas of a compose service on the same node keep separate entries
+	state := gossipCluster.GetState()
+	state.UpdateServiceHealth(&gossip.ServiceHealth{ServiceName: "worker", NodeName: "node1", Project: "firecrawl", Healthy: false})
+	state.UpdateServiceHealth(&gossip.ServiceHealth{ServiceName: "worker", NodeName: "node1", Project: "firecrawl", Instance: "2", Healthy: true})
+	assert.Len(t, state.GetAllServiceHealth(), 2)
+	assert.Equal(t, []string{"node1"}, state.GetHealthyServiceNodes("worker"))
+
+	// Node lookups prefer a healthy replica
+	health, exists := state.GetServiceHealth("worker", "node1")
+	require.True(t, exists)
+	assert.True(t, health.Healthy)
+	assert.Equal(t, "2", health.Instance)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/services/worker", nil)
+	w := httptest.NewRecorder()
+	server.handleService(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		HealthyCount int `json:"healthy_count"`
+		Instances    []struct {
+			NodeName string `json:"node_name"`
+			Project  string `json:"project"`
+			Instance string `json:"instance"`
+		} `json:"instances"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.HealthyCount)
+	require.Len(t, response.Instances, 1)
+	assert.Equal(t, "firecrawl", response.Instances[0].Project)
+	assert.Equal(t, "2", response.Instances[0].Instance)
+}
+
+func TestServer_HandleServices_ShowsHealthDetails(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	// Docker considers the container healthy, but its HTTP probe gets a 502 and it
+	// flapped enough to be held out of rotation
+	heldUntil := time.Now().Add(5 * time.Minute)
+	gossipCluster.GetState().UpdateServiceHealth(&gossip.ServiceHealth{
+		ServiceName:  "api",
+		NodeName:     "node1",
+		Healthy:      false,
+		State:        "flapping",
+		HeldUntil:    &heldUntil,
+		DockerStatus: "healthy",
+		Probe: &gossip.ProbeStatus{
+			Type:    "http",
+			Target:  "http://172.18.0.5:8080/healthz",
+			Message: "unexpected status 502",
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/services", nil)
+	w := httptest.NewRecorder()
+	server.handleServices(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Services []struct {
+			ServiceName  string `json:"service_name"`
+			HealthyCount int    `json:"healthy_count"`
+			Nodes        []struct {
+				Healthy      bool                `json:"healthy"`
+				State        string              `json:"state"`
+				HeldUntil    string              `json:"held_until"`
+				DockerStatus string              `json:"docker_status"`
+				Probe        *gossip.ProbeStatus `json:"probe"`
+			} `json:"nodes"`
+		} `json:"services"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Services, 1)
+	assert.Equal(t, 0, response.Services[0].HealthyCount)
+	instance := response.Services[0].Nodes[0]
+	assert.False(t, instance.Healthy)
+	assert.Equal(t, "flapping", instance.State)
+	assert.Equal(t, heldUntil.Format(time.RFC3339), instance.HeldUntil)
+	assert.Equal(t, "healthy", instance.DockerStatus)
+	require.NotNil(t, instance.Probe)
+	assert.Equal(t, "http", instance.Probe.Type)
+	assert.Equal(t, "unexpected status 502", instance.Probe.Message)
+}
+
+func TestServer_HandleService_ShowsDependencyCause(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	// Firecrawl itself passes its healthcheck, but its redis on the node is down
+	gossipCluster.GetState().UpdateServiceHealth(&gossip.ServiceHealth{
+		ServiceName: "firecrawl",
+		NodeName:    "node1",
+		Healthy:     true,
+		State:       "healthy",
+		Dependencies: []gossip.DependencyHealth{
+			{Service: "nuq-postgres", Condition: "service_healthy", Met: true},
+			{Service: "redis", Condition: "service_healthy", Reason: "unhealthy"},
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/services/firecrawl", nil)
+	w := httptest.NewRecorder()
+	server.handleService(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		HealthyCount int `json:"healthy_count"`
+		Instances    []struct {
+			Healthy          bool                      `json:"healthy"`
+			EffectiveHealthy bool                      `json:"effective_healthy"`
+			Cause            string                    `json:"cause"`
+			Dependencies     []gossip.DependencyHealth `json:"dependencies"`
+		} `json:"instances"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	// Not routed to, so not counted as healthy
+	assert.Equal(t, 0, response.HealthyCount)
+	require.Len(t, response.Instances, 1)
+	instance := response.Instances[0]
+	assert.True(t, instance.Healthy)
+	assert.False(t, instance.EffectiveHealthy)
+	assert.Equal(t, "dependency redis is unhealthy", instance.Cause)
+	assert.Len(t, instance.Dependencies, 2)
+}
+
+func TestServer_HandleServices_CountsEffectiveHealth(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	state := gossipCluster.GetState()
+	state.UpdateServiceHealth(&gossip.ServiceHealth{ServiceName: "firecrawl", NodeName: "node1", Healthy: true})
+	state.UpdateServiceHealth(&gossip.ServiceHealth{
+		ServiceName:  "firecrawl",
+		NodeName:     "node2",
+		Healthy:      true,
+		Dependencies: []gossip.DependencyHealth{{Service: "redis", Condition: "service_healthy", Reason: "unhealthy"}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/services", nil)
+	w := httptest.NewRecorder()
+	server.handleServices(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Services []struct {
+			Instances    int `json:"instances"`
+			HealthyCount int `json:"healthy_count"`
+		} `json:"services"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Services, 1)
+	assert.Equal(t, 2, response.Services[0].Instances)
+	assert.Equal(t, 1, response.Services[0].HealthyCount)
+}
+
 func TestServer_HandleRaftStatus(t *testing.T) {
 	gossipCluster := createTestGossipCluster()
 	consensusManager := createTestConsensusManager()
@@ -389,8 +631,9 @@ func TestServer_HandleMetrics(t *testing.T) {
 		Cordoned: false,
 	})
 	state.UpdateNode(&gossip.NodeMetadata{
-		Name:     "node2",
-		Cordoned: true,
+		Name:      "node2",
+		Cordoned:  true,
+		Resources: &gossip.NodeResources{CPUPercent: 42, IOPressure: 7.5},
 	})
 	state.UpdateServiceHealth(&gossip.ServiceHealth{
 		ServiceName: "service1",
@@ -416,6 +659,14 @@ func TestServer_HandleMetrics(t *testing.T) {
 	assert.Contains(t, response, "nodes")
 	assert.Contains(t, response, "services")
 	assert.Contains(t, response, "raft")
+
+	// Resource usage published through gossip is reported per node
+	nodes := response["nodes"].(map[string]interface{})
+	resources := nodes["resources"].(map[string]interface{})
+	assert.NotContains(t, resources, "node1")
+	require.Contains(t, resources, "node2")
+	assert.Equal(t, 42.0, resources["node2"].(map[string]interface{})["cpu_percent"])
+	assert.Equal(t, 7.5, resources["node2"].(map[string]interface{})["io_pressure"])
 }
 
 func TestServer_HandleMigrations(t *testing.T) {
@@ -657,3 +908,270 @@ func TestServer_HandleNodeUncordon_OtherNode(t *testing.T) {
 
 	assert.Equal(t, http.StatusForbidden, w.Code)
 }
+
+func TestServer_HandleMigrationHistory(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	rule := failover.MigrationRule{ServiceName: "test-service", TargetNode: "target-node"}
+	require.NoError(t, migrationManager.StartMigration(context.Background(), rule))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/migrations/history?service=test-service&limit=10", nil)
+	w := httptest.NewRecorder()
+
+	server.handleMigrationHistory(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Migrations []raft.MigrationRecord `json:"migrations"`
+		Total      int                    `json:"total"`
+		Limit      int                    `json:"limit"`
+		Offset     int                    `json:"offset"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, 1, response.Total)
+	assert.Equal(t, 10, response.Limit)
+	require.Len(t, response.Migrations, 1)
+	assert.Equal(t, "test-service", response.Migrations[0].ServiceName)
+	assert.Equal(t, "manual", response.Migrations[0].Reason)
+	assert.NotEmpty(t, response.Migrations[0].ID)
+}
+
+func TestServer_HandleMigrationHistory_LeavesOutSpecs(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	rule := failover.MigrationRule{ServiceName: "test-service", TargetNode: "target-node"}
+	require.NoError(t, migrationManager.StartMigration(context.Background(), rule))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/migrations/history", nil)
+	w := httptest.NewRecorder()
+
+	server.handleMigrationHistory(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Len(t, response["migrations"], 1)
+
+	keys := make(map[string]bool)
+	collectJSONKeys(response, keys)
+	assert.True(t, keys["service_name"])
+	for _, key := range []string{"progress", "config", "env", "Env"} {
+		assert.False(t, keys[key], "history response includes %q", key)
+	}
+}
+
+// collectJSONKeys adds the keys of every object in a decoded JSON value to keys
+func collectJSONKeys(value interface{}, keys map[string]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			keys[key] = true
+			collectJSONKeys(nested, keys)
+		}
+	case []interface{}:
+		for _, nested := range value {
+			collectJSONKeys(nested, keys)
+		}
+	}
+}
+
+func TestServer_HandleMigrationHistory_InvalidLimit(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/migrations/history?limit=abc", nil)
+	w := httptest.NewRecorder()
+
+	server.handleMigrationHistory(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServer_HandleRaftApply_RejectsUnknownAction(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, nil, wsServer, 8080)
+
+	body := `{"action": "acquire", "lease_type": "dns_writer"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/raft/apply", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testClusterToken)
+	w := httptest.NewRecorder()
+
+	server.handleRaftApply(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestServer_HandleRaftApply_RequiresClusterToken(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, nil, wsServer, 8080)
+
+	for _, header := range []string{"", "Bearer wrong-token", testClusterToken} {
+		body := `{"action": "put_drain", "drain": {"node_name": "node1"}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/raft/apply", strings.NewReader(body))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+
+		server.handleRaftApply(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "Authorization %q", header)
+	}
+	_, ok := consensusManager.GetDrain("node1")
+	assert.False(t, ok)
+}
+
+func TestServer_HandleMigration_Cancel(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	// Unknown service
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/migrations/test-service", nil)
+	w := httptest.NewRecorder()
+	server.handleMigration(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Migration that already failed (no Docker client in tests)
+	rule := failover.MigrationRule{ServiceName: "test-service", TargetNode: "target-node"}
+	require.NoError(t, migrationManager.StartMigration(context.Background(), rule))
+	require.Eventually(t, func() bool {
+		migration, exists := migrationManager.GetMigrationStatus("test-service")
+		return exists && migration.Status == failover.MigrationStatusFailed
+	}, 2*time.Second, 10*time.Millisecond)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/migrations/test-service", nil)
+	w = httptest.NewRecorder()
+	server.handleMigration(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestServer_HandleMigration_Rollback(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/migrations/test-service/rollback", nil)
+	w := httptest.NewRecorder()
+	server.handleMigration(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/migrations/test-service/rollback", nil)
+	w = httptest.NewRecorder()
+	server.handleMigration(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServer_HandleNodeDrain(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	nodeName := gossipCluster.GetNodeName()
+
+	// No drain recorded yet
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/nodes/%s/drain", nodeName), nil)
+	w := httptest.NewRecorder()
+	server.handleNode(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Ending a drain that never started is a conflict
+	req = httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/nodes/%s/drain", nodeName), nil)
+	w = httptest.NewRecorder()
+	server.handleNode(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Nodes the cluster does not know cannot be drained
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/nodes/unknown-node/drain", nil)
+	w = httptest.NewRecorder()
+	server.handleNode(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Any agent records the drain, not only the drained node's
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/nodes/test-node/drain", strings.NewReader(`{"concurrency": 3}`))
+	w = httptest.NewRecorder()
+	server.handleNode(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/nodes/test-node/drain", nil)
+	w = httptest.NewRecorder()
+	server.handleNode(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var drain map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &drain))
+	assert.Equal(t, "draining", drain["status"])
+	assert.Equal(t, float64(3), drain["concurrency"])
+}
+
+func TestServer_HandleMigrationPlan(t *testing.T) {
+	gossipCluster := createTestGossipCluster()
+	defer gossipCluster.Shutdown()
+	consensusManager := createTestConsensusManager()
+	defer consensusManager.Shutdown()
+	migrationManager := createTestMigrationManager()
+	wsServer := NewWebSocketServer(gossipCluster, consensusManager)
+	server := NewServer(gossipCluster, consensusManager, migrationManager, wsServer, 8080)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/migrations/plan", nil)
+	w := httptest.NewRecorder()
+	server.handleMigrationPlan(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/migrations/plan", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	server.handleMigrationPlan(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/migrations/plan", strings.NewReader(`{"service_name":"test-service"}`))
+	w = httptest.NewRecorder()
+	server.handleMigrationPlan(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var plan failover.MigrationPlan
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&plan))
+	assert.Equal(t, "test-service", plan.ServiceName)
+	assert.False(t, plan.Feasible)
+	assert.NotEmpty(t, plan.Checks)
+
+	// Nothing was started
+	_, exists := migrationManager.GetMigrationStatus("test-service")
+	assert.False(t, exists)
+}
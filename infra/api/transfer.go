@@ -0,0 +1,332 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cluster/infra/failover"
+)
+
+// SetMigrationReceiver enables the agent-to-agent migration receive API
+func (s *Server) SetMigrationReceiver(receiver *failover.MigrationReceiver) {
+	s.migrationReceiver = receiver
+}
+
+// handleTransfer handles the migration receive API used by source agents during migrations.
+// Routes (relative to /api/v1/transfer/):
+//
+//	GET    ping
+//	POST   images                  stream an image tarball (docker save format)
+//	POST   images/pull             pull an image from its registry, optionally tagging it
+//	POST   preflight               check image, port, network and name availability for a migration plan
+//	HEAD   uploads/{id}            current offset of a resumable upload
+//	PATCH  uploads/{id}            append to an upload at the Upload-Offset header
+//	POST   volumes/{id}/commit     extract a completed upload into a volume
+//	POST   volumes/sync/{id}/plan      start a block-level volume sync, returns the files to send
+//	PUT    volumes/sync/{id}/files     apply a file delta (?path=relative/path)
+//	POST   volumes/sync/{id}/finalize  remove stale files and verify every checksum
+//	POST   containers              create a container from a ContainerConfig
+//	GET    containers/{id}         container status
+//	POST   containers/{id}/start   start a container
+//	POST   containers/{id}/stop    stop a container
+//	POST   containers/{id}/exec    run a migration hook inside a container
+//	DELETE containers/{id}         remove a container
+func (s *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	if s.migrationReceiver == nil || !s.migrationReceiver.Enabled() {
+		http.Error(w, "Migration receive API disabled (no cluster token configured)", http.StatusServiceUnavailable)
+		return
+	}
+	if !s.migrationReceiver.Authorize(r.Header.Get("Authorization")) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := splitPath(r.URL.Path[len(failover.TransferPathPrefix):])
+	if len(parts) == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "ping" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	case len(parts) == 1 && parts[0] == "images" && r.Method == http.MethodPost:
+		s.handleTransferImageLoad(w, r)
+	case len(parts) == 2 && parts[0] == "images" && parts[1] == "pull" && r.Method == http.MethodPost:
+		s.handleTransferImagePull(w, r)
+	case len(parts) == 1 && parts[0] == "preflight" && r.Method == http.MethodPost:
+		s.handleTransferPreflight(w, r)
+	case len(parts) == 2 && parts[0] == "uploads" && r.Method == http.MethodHead:
+		s.handleTransferUploadOffset(w, parts[1])
+	case len(parts) == 2 && parts[0] == "uploads" && r.Method == http.MethodPatch:
+		s.handleTransferUploadAppend(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "volumes" && parts[2] == "commit" && r.Method == http.MethodPost:
+		s.handleTransferVolumeCommit(w, r, parts[1])
+	case len(parts) == 4 && parts[0] == "volumes" && parts[1] == "sync":
+		s.handleTransferVolumeSync(w, r, parts[2], parts[3])
+	case len(parts) == 1 && parts[0] == "containers" && r.Method == http.MethodPost:
+		s.handleTransferContainerCreate(w, r)
+	case len(parts) >= 2 && parts[0] == "containers":
+		s.handleTransferContainer(w, r, parts[1], parts[2:])
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// liftDeadlines removes the server's read and write timeouts for long-running streams
+func liftDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	// Errors mean the writer does not support deadlines (e.g. in tests), which is fine
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
+
+// handleTransferImageLoad loads a streamed image tarball
+func (s *Server) handleTransferImageLoad(w http.ResponseWriter, r *http.Request) {
+	liftDeadlines(w)
+
+	if err := s.migrationReceiver.LoadImage(r.Context(), r.Body); err != nil {
+		log.Printf("Migration receive: image load failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"loaded": true})
+}
+
+// handleTransferImagePull pulls an image from its registry
+func (s *Server) handleTransferImagePull(w http.ResponseWriter, r *http.Request) {
+	liftDeadlines(w)
+
+	var req struct {
+		Image string `json:"image"`
+		Tag   string `json:"tag"` // Optional name to tag the pulled image with
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Image == "" {
+		http.Error(w, "image is required", http.StatusBadRequest)
+		return
+	}
+
+	imageID, err := s.migrationReceiver.PullImage(r.Context(), req.Image, req.Tag)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pulled": req.Image, "id": imageID})
+}
+
+// handleTransferPreflight reports whether this node can run a migrated container
+func (s *Server) handleTransferPreflight(w http.ResponseWriter, r *http.Request) {
+	var req failover.PreflightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.migrationReceiver.Preflight(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleTransferUploadOffset reports how much of an upload has been received
+func (s *Server) handleTransferUploadOffset(w http.ResponseWriter, uploadID string) {
+	offset, err := s.migrationReceiver.UploadOffset(uploadID)
+	if err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+	w.Header().Set(failover.UploadOffsetHeader, strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleTransferUploadAppend appends a chunk to a resumable upload
+func (s *Server) handleTransferUploadAppend(w http.ResponseWriter, r *http.Request, uploadID string) {
+	liftDeadlines(w)
+
+	offset, err := strconv.ParseInt(r.Header.Get(failover.UploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, fmt.Sprintf("%s header is required", failover.UploadOffsetHeader), http.StatusBadRequest)
+		return
+	}
+
+	newOffset, err := s.migrationReceiver.AppendUpload(uploadID, offset, r.Body)
+	w.Header().Set(failover.UploadOffsetHeader, strconv.FormatInt(newOffset, 10))
+	if err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadErrorStatus maps receiver upload errors to HTTP status codes
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, failover.ErrInvalidUploadID):
+		return http.StatusBadRequest
+	case errors.Is(err, failover.ErrUploadOffsetMismatch), errors.Is(err, failover.ErrUploadBusy):
+		return http.StatusConflict
+	case errors.Is(err, failover.ErrSyncNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, failover.ErrVolumeChecksumMismatch):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handleTransferVolumeCommit extracts a completed upload into its volume
+func (s *Server) handleTransferVolumeCommit(w http.ResponseWriter, r *http.Request, uploadID string) {
+	liftDeadlines(w)
+
+	var commit failover.VolumeCommit
+	if err := json.NewDecoder(r.Body).Decode(&commit); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.migrationReceiver.CommitVolume(r.Context(), uploadID, commit); err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"committed": uploadID})
+}
+
+// handleTransferVolumeSync handles the steps of a block-level volume sync
+func (s *Server) handleTransferVolumeSync(w http.ResponseWriter, r *http.Request, syncID, operation string) {
+	liftDeadlines(w)
+
+	switch {
+	case operation == "plan" && r.Method == http.MethodPost:
+		var req failover.VolumeSyncRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		plan, err := s.migrationReceiver.PlanVolumeSync(r.Context(), syncID, req)
+		if err != nil {
+			http.Error(w, err.Error(), uploadErrorStatus(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, plan)
+	case operation == "files" && r.Method == http.MethodPut:
+		filePath := r.URL.Query().Get("path")
+		if filePath == "" {
+			http.Error(w, "path is required", http.StatusBadRequest)
+			return
+		}
+		if err := s.migrationReceiver.ApplyVolumeDelta(syncID, filePath, r.Body); err != nil {
+			http.Error(w, err.Error(), uploadErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case operation == "finalize" && r.Method == http.MethodPost:
+		result, err := s.migrationReceiver.FinalizeVolumeSync(r.Context(), syncID)
+		if err != nil {
+			message := err.Error()
+			if result != nil && len(result.Mismatches) > 0 {
+				message = fmt.Sprintf("%s: %s", message, strings.Join(firstN(result.Mismatches, 10), "; "))
+			}
+			http.Error(w, message, uploadErrorStatus(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// firstN returns at most n leading items
+func firstN(items []string, n int) []string {
+	if len(items) > n {
+		return items[:n]
+	}
+	return items
+}
+
+// handleTransferContainerCreate creates a container from a migrated configuration
+func (s *Server) handleTransferContainerCreate(w http.ResponseWriter, r *http.Request) {
+	var config failover.ContainerConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	containerID, err := s.migrationReceiver.CreateContainer(r.Context(), &config)
+	if errors.Is(err, failover.ErrUnsupportedSpecVersion) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": containerID})
+}
+
+// handleTransferContainer handles status and lifecycle operations on a container
+func (s *Server) handleTransferContainer(w http.ResponseWriter, r *http.Request, containerID string, operation []string) {
+	ctx := r.Context()
+
+	var err error
+	switch {
+	case len(operation) == 0 && r.Method == http.MethodGet:
+		status, statusErr := s.migrationReceiver.ContainerStatus(ctx, containerID)
+		if statusErr != nil {
+			http.Error(w, statusErr.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+		return
+	case len(operation) == 0 && r.Method == http.MethodDelete:
+		err = s.migrationReceiver.RemoveContainer(ctx, containerID)
+	case len(operation) == 1 && operation[0] == "start" && r.Method == http.MethodPost:
+		err = s.migrationReceiver.StartContainer(ctx, containerID)
+	case len(operation) == 1 && operation[0] == "stop" && r.Method == http.MethodPost:
+		err = s.migrationReceiver.StopContainer(ctx, containerID)
+	case len(operation) == 1 && operation[0] == "exec" && r.Method == http.MethodPost:
+		s.handleTransferContainerExec(w, r, containerID)
+		return
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": containerID})
+}
+
+// handleTransferContainerExec runs a hook command inside a container and reports its exit status
+func (s *Server) handleTransferContainerExec(w http.ResponseWriter, r *http.Request, containerID string) {
+	liftDeadlines(w)
+
+	var hook failover.MigrationHook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil || len(hook.Command) == 0 {
+		http.Error(w, "command is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.migrationReceiver.ExecContainer(r.Context(), containerID, hook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
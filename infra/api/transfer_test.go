@@ -0,0 +1,141 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"cluster/infra/failover"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTransferTestServer(t *testing.T, token string) (*httptest.Server, *failover.TargetClient) {
+	receiver, err := failover.NewMigrationReceiver(nil, token, t.TempDir(), "")
+	require.NoError(t, err)
+
+	server := &Server{}
+	server.SetMigrationReceiver(receiver)
+	httpServer := httptest.NewServer(http.HandlerFunc(server.handleTransfer))
+	t.Cleanup(httpServer.Close)
+
+	host, portStr, err := net.SplitHostPort(httpServer.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	return httpServer, failover.NewTargetClient(host, port, token)
+}
+
+func TestTransfer_Unauthorized(t *testing.T) {
+	httpServer, _ := createTransferTestServer(t, "secret")
+
+	req, err := http.NewRequest(http.MethodGet, httpServer.URL+"/api/v1/transfer/ping", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer wrong")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestTransfer_DisabledWithoutToken(t *testing.T) {
+	_, client := createTransferTestServer(t, "")
+
+	err := client.Ping(context.Background())
+	var targetErr *failover.TargetError
+	require.ErrorAs(t, err, &targetErr)
+	assert.Equal(t, http.StatusServiceUnavailable, targetErr.StatusCode)
+}
+
+func TestTransfer_VolumeUploadAndCommit(t *testing.T) {
+	_, client := createTransferTestServer(t, "secret")
+	ctx := context.Background()
+
+	require.NoError(t, client.Ping(ctx))
+
+	// Archive shaped like CopyFromContainer output
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "data/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "data/app.db", Typeflag: tar.TypeReg, Mode: 0644, Size: 7}))
+	_, err := tw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	archivePath := filepath.Join(t.TempDir(), "volume.tar")
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0600))
+
+	require.NoError(t, client.UploadFile(ctx, "m1-0", archivePath))
+
+	offset, err := client.UploadOffset(ctx, "m1-0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), offset)
+
+	// Uploading again is a no-op once the target has every byte
+	require.NoError(t, client.UploadFile(ctx, "m1-0", archivePath))
+
+	dest := filepath.Join(t.TempDir(), "data")
+	err = client.CommitVolume(ctx, "m1-0", failover.VolumeCommit{Type: mount.TypeBind, Source: dest, Size: int64(buf.Len())})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(dest, "app.db"))
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(content))
+}
+
+func TestTransfer_UploadOffsetMismatch(t *testing.T) {
+	httpServer, _ := createTransferTestServer(t, "secret")
+
+	req, err := http.NewRequest(http.MethodPatch, httpServer.URL+"/api/v1/transfer/uploads/m1-0", bytes.NewReader([]byte("abc")))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set(failover.UploadOffsetHeader, "5")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get(failover.UploadOffsetHeader))
+}
+
+func TestTransfer_VolumeSyncUnknownSession(t *testing.T) {
+	_, client := createTransferTestServer(t, "secret")
+
+	_, err := client.FinalizeVolumeSync(context.Background(), "m1-0")
+	var targetErr *failover.TargetError
+	require.ErrorAs(t, err, &targetErr)
+	assert.Equal(t, http.StatusNotFound, targetErr.StatusCode)
+}
+
+func TestTransfer_ContainerExecRequiresCommand(t *testing.T) {
+	_, client := createTransferTestServer(t, "secret")
+
+	_, err := client.ExecContainer(context.Background(), "abc", failover.MigrationHook{Name: "empty"})
+	var targetErr *failover.TargetError
+	require.ErrorAs(t, err, &targetErr)
+	assert.Equal(t, http.StatusBadRequest, targetErr.StatusCode)
+}
+
+func TestTransfer_ContainerCreateRejectsNewerSpec(t *testing.T) {
+	_, client := createTransferTestServer(t, "secret")
+
+	_, err := client.CreateContainer(context.Background(), &failover.ContainerConfig{
+		Version: failover.ContainerSpecVersion + 1,
+		Name:    "app",
+		Image:   "nginx:latest",
+	})
+	var targetErr *failover.TargetError
+	require.ErrorAs(t, err, &targetErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, targetErr.StatusCode)
+}
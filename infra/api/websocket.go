@@ -12,6 +12,8 @@ import (
 
 	"cluster/infra/cluster/gossip"
 	"cluster/infra/cluster/raft"
+	"cluster/infra/failover"
+	"cluster/infra/traefik"
 
 	"github.com/gorilla/websocket"
 )
@@ -326,3 +328,34 @@ func (ws *WebSocketServer) BroadcastLeaderChange(leader string) {
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 	})
 }
+
+// BroadcastMigrationEvent broadcasts a migration status change
+func (ws *WebSocketServer) BroadcastMigrationEvent(event failover.MigrationEvent) {
+	message := map[string]interface{}{
+		"type":         event.Type,
+		"migration_id": event.MigrationID,
+		"service_name": event.ServiceName,
+		"source_node":  event.SourceNode,
+		"target_node":  event.TargetNode,
+		"status":       string(event.Status),
+		"timestamp":    event.Timestamp.UTC().Format(time.RFC3339),
+	}
+	if event.Message != "" {
+		message["message"] = event.Message
+	}
+	ws.Broadcast(message)
+}
+
+// BroadcastConfigChange broadcasts a change of the Traefik configuration this node serves
+func (ws *WebSocketServer) BroadcastConfigChange(change traefik.ConfigChange) {
+	message := map[string]interface{}{
+		"type":           "config_changed",
+		"config_id":      change.Revision.ID,
+		"gossip_version": change.Revision.GossipVersion,
+		"timestamp":      change.Revision.Timestamp.UTC().Format(time.RFC3339),
+	}
+	if change.Diff != nil {
+		message["diff"] = change.Diff
+	}
+	ws.Broadcast(message)
+}
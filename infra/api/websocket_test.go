@@ -11,6 +11,7 @@ import (
 
 	"cluster/infra/cluster/gossip"
 	"cluster/infra/cluster/raft"
+	"cluster/infra/traefik"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -403,6 +404,47 @@ func TestWebSocketServer_BroadcastLeaderChange(t *testing.T) {
 	assert.Equal(t, "new-leader", update["leader"])
 }
 
+func TestWebSocketServer_BroadcastConfigChange(t *testing.T) {
+	wsServer, cluster, consensusManager := createTestWebSocketServer()
+	defer cluster.Shutdown()
+	defer consensusManager.Shutdown()
+
+	server := httptest.NewServer(http.HandlerFunc(wsServer.HandleWebSocket))
+	defer server.Close()
+
+	url := "ws" + server.URL[4:] + "/ws"
+
+	dialer := websocket.Dialer{}
+	conn, _, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Discard initial state
+	time.Sleep(100 * time.Millisecond)
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	conn.ReadMessage()
+
+	wsServer.BroadcastConfigChange(traefik.ConfigChange{
+		Revision: traefik.ConfigRevision{ID: 2, GossipVersion: 17, Timestamp: time.Now()},
+		Diff: &traefik.ConfigDiff{
+			From: 1,
+			To:   2,
+			HTTP: traefik.HTTPSectionDiff{Routers: traefik.NameDiff{Removed: []string{"web-with-failover"}}},
+		},
+	})
+
+	conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+	_, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var update map[string]interface{}
+	json.Unmarshal(message, &update)
+	assert.Equal(t, "config_changed", update["type"])
+	assert.Equal(t, float64(2), update["config_id"])
+	assert.Equal(t, float64(17), update["gossip_version"])
+	assert.Contains(t, string(message), `"removed":["web-with-failover"]`)
+}
+
 func TestWebSocketServer_ConcurrentWrites(t *testing.T) {
 	wsServer, cluster, consensusManager := createTestWebSocketServer()
 	defer cluster.Shutdown()
@@ -3,6 +3,7 @@ package gossip
 import (
 	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/hashicorp/memberlist"
 )
@@ -30,7 +31,11 @@ func (gd *GossipDelegate) NodeMeta(limit int) []byte {
 		return []byte{}
 	}
 
-	data, err := json.Marshal(node)
+	// Resource usage changes constantly and travels with the full state sync instead
+	meta := *node
+	meta.Resources = nil
+
+	data, err := json.Marshal(&meta)
 	if err != nil {
 		log.Printf("Failed to marshal node metadata: %v", err)
 		return []byte{}
@@ -180,7 +185,7 @@ func (ed *EventDelegate) NotifyJoin(node *memberlist.Node) {
 		if err := json.Unmarshal(node.Meta, &nodeMeta); err != nil {
 			log.Printf("Failed to unmarshal node metadata for %s: %v", node.Name, err)
 		} else {
-			ed.state.UpdateNode(&nodeMeta)
+			ed.updateNode(&nodeMeta)
 		}
 	}
 }
@@ -201,7 +206,39 @@ func (ed *EventDelegate) NotifyUpdate(node *memberlist.Node) {
 		if err := json.Unmarshal(node.Meta, &nodeMeta); err != nil {
 			log.Printf("Failed to unmarshal node metadata for %s: %v", node.Name, err)
 		} else {
-			ed.state.UpdateNode(&nodeMeta)
+			ed.updateNode(&nodeMeta)
 		}
 	}
 }
+
+// updateNode stores metadata received from memberlist, keeping the resource usage
+// learned from state sync since memberlist metadata does not carry it
+func (ed *EventDelegate) updateNode(nodeMeta *NodeMetadata) {
+	if existing, ok := ed.state.GetNode(nodeMeta.Name); ok && nodeMeta.Resources == nil {
+		nodeMeta.Resources = existing.Resources
+	}
+	ed.state.UpdateNode(nodeMeta)
+}
+
+// PingDelegate implements memberlist.PingDelegate, recording the round trip of every
+// probe so traffic can prefer nearby nodes
+type PingDelegate struct {
+	state *ClusterState
+}
+
+// NewPingDelegate creates a new ping delegate
+func NewPingDelegate(state *ClusterState) *PingDelegate {
+	return &PingDelegate{
+		state: state,
+	}
+}
+
+// AckPayload is sent with every ack; round trips need none
+func (pd *PingDelegate) AckPayload() []byte {
+	return nil
+}
+
+// NotifyPingComplete is called when a probe of another node is acknowledged
+func (pd *PingDelegate) NotifyPingComplete(other *memberlist.Node, rtt time.Duration, payload []byte) {
+	pd.state.RecordRTT(other.Name, rtt)
+}
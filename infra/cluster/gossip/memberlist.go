@@ -58,6 +58,7 @@ func NewGossipCluster(config *Config) (*GossipCluster, error) {
 	mlConfig.AdvertiseAddr = config.TailscaleIP // Advertise Tailscale IP
 	mlConfig.Delegate = gossipDelegate
 	mlConfig.Events = eventDelegate
+	mlConfig.Ping = NewPingDelegate(state)
 
 	// Tune for Tailscale network
 	mlConfig.TCPTimeout = 10 * time.Second
@@ -160,17 +161,21 @@ func (gc *GossipCluster) GetHealthyNodes() []*memberlist.Node {
 
 // BroadcastServiceHealth broadcasts service health to the cluster
 func (gc *GossipCluster) BroadcastServiceHealth(serviceName string, healthy bool, endpoints map[string]string, networks []string) {
-	health := &ServiceHealth{
+	gc.ReportServiceHealth(&ServiceHealth{
 		ServiceName: serviceName,
-		NodeName:    gc.config.NodeName,
 		Healthy:     healthy,
-		CheckedAt:   time.Now(),
 		Endpoints:   endpoints,
 		Networks:    networks,
-	}
+	})
+}
+
+// ReportServiceHealth broadcasts the health of a service on this node, including how it was determined
+func (gc *GossipCluster) ReportServiceHealth(health *ServiceHealth) {
+	health.NodeName = gc.config.NodeName
+	health.CheckedAt = time.Now()
 
 	gc.state.UpdateServiceHealth(health)
-	log.Printf("Broadcasted service health: %s on %s (healthy: %v)", serviceName, gc.config.NodeName, healthy)
+	log.Printf("Broadcasted service health: %s on %s (healthy: %v)", health.ServiceName, gc.config.NodeName, health.Healthy)
 }
 
 // BroadcastWARPHealth broadcasts WARP gateway health to the cluster
@@ -205,6 +210,7 @@ func (gc *GossipCluster) UpdateNodeMetadata(cordoned bool, capabilities []string
 		Capabilities: node.Capabilities,
 		LastSeen:     time.Now(),
 		Cordoned:     cordoned,
+		Resources:    node.Resources,
 	}
 
 	if capabilities != nil {
@@ -217,6 +223,20 @@ func (gc *GossipCluster) UpdateNodeMetadata(cordoned bool, capabilities []string
 	log.Printf("Updated node metadata for %s (cordoned: %v)", gc.config.NodeName, cordoned)
 }
 
+// UpdateNodeResources publishes this node's latest resource usage
+func (gc *GossipCluster) UpdateNodeResources(resources *NodeResources) {
+	node, exists := gc.state.GetNode(gc.config.NodeName)
+	if !exists {
+		log.Printf("Warning: node %s not found in state", gc.config.NodeName)
+		return
+	}
+
+	// Copy the node rather than modifying the shared pointer
+	updatedNode := *node
+	updatedNode.Resources = resources
+	gc.state.UpdateNode(&updatedNode)
+}
+
 // GetServiceEndpoints returns endpoints for a service across the cluster
 func (gc *GossipCluster) GetServiceEndpoints(serviceName string) []string {
 	healthyNodes := gc.state.GetHealthyServiceNodes(serviceName)
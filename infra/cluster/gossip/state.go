@@ -2,32 +2,78 @@ package gossip
 
 import (
 	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
 	"sync"
 	"time"
 )
 
 // NodeMetadata represents metadata about a cluster node
 type NodeMetadata struct {
-	Name         string    `json:"name"`
-	PublicIP     string    `json:"public_ip"`
-	TailscaleIP  string    `json:"tailscale_ip"`
-	Priority     int       `json:"priority"` // Lower = higher priority
-	Capabilities []string  `json:"capabilities"`
-	LastSeen     time.Time `json:"last_seen"`
-	Cordoned     bool      `json:"cordoned"` // If true, don't route new traffic here
+	Name         string         `json:"name"`
+	PublicIP     string         `json:"public_ip"`
+	TailscaleIP  string         `json:"tailscale_ip"`
+	Priority     int            `json:"priority"` // Lower = higher priority
+	Capabilities []string       `json:"capabilities"`
+	LastSeen     time.Time      `json:"last_seen"`
+	Cordoned     bool           `json:"cordoned"` // If true, don't route new traffic here
+	Resources    *NodeResources `json:"resources,omitempty"`
+}
+
+// NodeResources is a node's latest resource usage, shared for scheduling and monitoring
+type NodeResources struct {
+	CPUPercent         float64   `json:"cpu_percent"`
+	MemoryPercent      float64   `json:"memory_percent"`
+	MemoryTotal        int64     `json:"memory_total"`
+	DiskPercent        float64   `json:"disk_percent"`
+	Load1              float64   `json:"load1"`
+	IOReadBytesPerSec  float64   `json:"io_read_bytes_per_sec"`
+	IOWriteBytesPerSec float64   `json:"io_write_bytes_per_sec"`
+	IOUtilPercent      float64   `json:"io_util_percent"`
+	CPUPressure        float64   `json:"cpu_pressure"`    // PSI some avg10, percent
+	MemoryPressure     float64   `json:"memory_pressure"` // PSI some avg10, percent
+	IOPressure         float64   `json:"io_pressure"`     // PSI some avg10, percent
+	CollectedAt        time.Time `json:"collected_at"`
 }
 
 // ServiceHealth represents health status of a service
 type ServiceHealth struct {
-	ServiceName         string            `json:"service_name"`
-	NodeName            string            `json:"node_name"`
-	Healthy             bool              `json:"healthy"`
-	CheckedAt           time.Time         `json:"checked_at"`
-	Endpoints           map[string]string `json:"endpoints"`                   // protocol -> endpoint (e.g., "http" -> "http://service:8080")
-	Networks            []string          `json:"networks"`                    // Which Docker networks this service is on
-	ConsecutiveFailures int               `json:"consecutive_failures"`        // Track consecutive health check failures
-	LastFailureTime     *time.Time        `json:"last_failure_time,omitempty"` // When the last failure occurred
-	LastSuccessTime     *time.Time        `json:"last_success_time,omitempty"` // When the last success occurred
+	ServiceName         string             `json:"service_name"`
+	NodeName            string             `json:"node_name"`
+	Project             string             `json:"project,omitempty"`    // Compose project or swarm stack the service belongs to
+	Instance            string             `json:"instance,omitempty"`   // Replica index, empty for the first or only replica on the node
+	Healthy             bool               `json:"healthy"`              // In rotation
+	State               string             `json:"state,omitempty"`      // healthy, degraded, unhealthy or flapping
+	HeldUntil           *time.Time         `json:"held_until,omitempty"` // Held out of rotation for flapping until then
+	CheckedAt           time.Time          `json:"checked_at"`
+	Endpoints           map[string]string  `json:"endpoints"`                   // protocol -> endpoint (e.g., "http" -> "http://service:8080")
+	Networks            []string           `json:"networks"`                    // Which Docker networks this service is on
+	Labels              map[string]string  `json:"labels,omitempty"`            // Routing labels of the container (traefik.*, constellation.middlewares*, constellation.transport.*, constellation.fallback*)
+	ConsecutiveFailures int                `json:"consecutive_failures"`        // Track consecutive health check failures
+	LastFailureTime     *time.Time         `json:"last_failure_time,omitempty"` // When the last failure occurred
+	LastSuccessTime     *time.Time         `json:"last_success_time,omitempty"` // When the last success occurred
+	DockerStatus        string             `json:"docker_status,omitempty"`     // Docker healthcheck status while running, otherwise the container state
+	Probe               *ProbeStatus       `json:"probe,omitempty"`             // Latest active probe result, for services that declare one
+	Dependencies        []DependencyHealth `json:"dependencies,omitempty"`      // Declared dependencies and whether each is met on the node
+}
+
+// DependencyHealth is whether one of a service's dependencies is met on its node
+type DependencyHealth struct {
+	Service   string `json:"service"`
+	Condition string `json:"condition"` // service_healthy or service_started
+	Met       bool   `json:"met"`
+	Reason    string `json:"reason,omitempty"` // Why the dependency is not met
+}
+
+// ProbeStatus is the latest result of a service's active health probe
+type ProbeStatus struct {
+	Type      string    `json:"type"` // http, tcp, grpc or redis
+	Target    string    `json:"target"`
+	Healthy   bool      `json:"healthy"`
+	Message   string    `json:"message,omitempty"`
+	LatencyMs float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
 }
 
 // WARPHealth represents the health status of the WARP gateway
@@ -43,9 +89,24 @@ type ClusterState struct {
 	Nodes         map[string]*NodeMetadata  // node name -> metadata
 	ServiceHealth map[string]*ServiceHealth // "service@node" -> health
 	WARPHealth    map[string]*WARPHealth    // node name -> WARP health
-	Version       uint64                    // Monotonic version for change detection
+	Version       uint64                    // Moves when anything routing depends on changes
+	// MetricsVersion moves when node resources or round trips change, which routing
+	// only weighs and may pick up lazily
+	MetricsVersion uint64
+
+	rtt            map[string]time.Duration // node name -> smoothed round trip from this node, not gossiped
+	changed        chan struct{}            // Closed and replaced when Version moves
+	metricsChanged chan struct{}            // Closed and replaced when MetricsVersion moves
 }
 
+const (
+	// rttSmoothing is the weight of a new round trip sample in the smoothed RTT
+	rttSmoothing = 0.2
+	// RTTResolution is the precision round trips are compared at; the metrics version
+	// moves when a node's round trip changes by at least this much
+	RTTResolution = 5 * time.Millisecond
+)
+
 // NewClusterState creates a new cluster state
 func NewClusterState() *ClusterState {
 	return &ClusterState{
@@ -53,6 +114,7 @@ func NewClusterState() *ClusterState {
 		ServiceHealth: make(map[string]*ServiceHealth),
 		WARPHealth:    make(map[string]*WARPHealth),
 		Version:       0,
+		rtt:           make(map[string]time.Duration),
 	}
 }
 
@@ -62,8 +124,9 @@ func (cs *ClusterState) UpdateNode(node *NodeMetadata) {
 	defer cs.mu.Unlock()
 
 	node.LastSeen = time.Now()
+	existing, exists := cs.Nodes[node.Name]
 	cs.Nodes[node.Name] = node
-	cs.Version++
+	cs.bumpNode(existing, exists, node)
 }
 
 // GetNode retrieves a node's metadata
@@ -81,7 +144,8 @@ func (cs *ClusterState) RemoveNode(name string) {
 	defer cs.mu.Unlock()
 
 	delete(cs.Nodes, name)
-	cs.Version++
+	delete(cs.rtt, name)
+	cs.bump()
 
 	// Remove all service health entries for this node
 	for key, health := range cs.ServiceHealth {
@@ -94,17 +158,156 @@ func (cs *ClusterState) RemoveNode(name string) {
 	delete(cs.WARPHealth, name)
 }
 
+// bump moves the state version and wakes those waiting for a change. The caller
+// holds cs.mu.
+func (cs *ClusterState) bump() {
+	cs.Version++
+	if cs.changed != nil {
+		close(cs.changed)
+		cs.changed = nil
+	}
+}
+
+// bumpMetrics moves the metrics version and wakes those waiting for a change. The
+// caller holds cs.mu.
+func (cs *ClusterState) bumpMetrics() {
+	cs.MetricsVersion++
+	if cs.metricsChanged != nil {
+		close(cs.metricsChanged)
+		cs.metricsChanged = nil
+	}
+}
+
+// bumpNode moves the versions a node update changes. The caller holds cs.mu.
+func (cs *ClusterState) bumpNode(existing *NodeMetadata, exists bool, node *NodeMetadata) {
+	if !exists || existing.Priority != node.Priority || existing.Cordoned != node.Cordoned ||
+		existing.TailscaleIP != node.TailscaleIP || existing.PublicIP != node.PublicIP {
+		cs.bump()
+	}
+	if !exists || !reflect.DeepEqual(existing.Resources, node.Resources) {
+		cs.bumpMetrics()
+	}
+}
+
+// routingChanged reports whether a service instance changed in a way routing depends
+// on. Check times, failure counts and probe latencies do not count.
+func routingChanged(existing, health *ServiceHealth) bool {
+	return existing.Healthy != health.Healthy ||
+		existing.EffectiveHealthy() != health.EffectiveHealthy() ||
+		existing.State != health.State ||
+		probeTarget(existing) != probeTarget(health) ||
+		!maps.Equal(existing.Endpoints, health.Endpoints) ||
+		!maps.Equal(existing.Labels, health.Labels) ||
+		!sameNetworks(existing.Networks, health.Networks)
+}
+
+// sameNetworks reports whether two network lists hold the same networks in any order
+func sameNetworks(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// probeTarget returns what a service's active probe checks, if it declares one
+func probeTarget(health *ServiceHealth) string {
+	if health.Probe == nil {
+		return ""
+	}
+	return health.Probe.Type + " " + health.Probe.Target
+}
+
+// GetVersion returns the state version
+func (cs *ClusterState) GetVersion() uint64 {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	return cs.Version
+}
+
+// GetMetricsVersion returns the metrics version
+func (cs *ClusterState) GetMetricsVersion() uint64 {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	return cs.MetricsVersion
+}
+
+// VersionChanged returns a channel that is closed once the state version is no
+// longer version
+func (cs *ClusterState) VersionChanged(version uint64) <-chan struct{} {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return changedChannel(cs.Version, version, &cs.changed)
+}
+
+// MetricsVersionChanged returns a channel that is closed once the metrics version
+// is no longer version
+func (cs *ClusterState) MetricsVersionChanged(version uint64) <-chan struct{} {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return changedChannel(cs.MetricsVersion, version, &cs.metricsChanged)
+}
+
+// changedChannel returns a closed channel if current is no longer version, otherwise
+// the channel closed on the next change. The caller holds cs.mu.
+func changedChannel(current, version uint64, changed *chan struct{}) <-chan struct{} {
+	if current != version {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	if *changed == nil {
+		*changed = make(chan struct{})
+	}
+	return *changed
+}
+
+// RecordRTT records a round trip to a node measured from this node. Samples are
+// smoothed so a single slow ping does not reshuffle traffic.
+func (cs *ClusterState) RecordRTT(nodeName string, rtt time.Duration) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.rtt == nil {
+		cs.rtt = make(map[string]time.Duration)
+	}
+	previous, ok := cs.rtt[nodeName]
+	if ok {
+		rtt = time.Duration(rttSmoothing*float64(rtt) + (1-rttSmoothing)*float64(previous))
+	}
+	cs.rtt[nodeName] = rtt
+	if !ok || rtt.Round(RTTResolution) != previous.Round(RTTResolution) {
+		cs.bumpMetrics()
+	}
+}
+
+// GetRTT returns the smoothed round trip from this node to a node, if measured
+func (cs *ClusterState) GetRTT(nodeName string) (time.Duration, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	rtt, ok := cs.rtt[nodeName]
+	return rtt, ok
+}
+
 // UpdateServiceHealth updates the health status of a service on a node
 func (cs *ClusterState) UpdateServiceHealth(health *ServiceHealth) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
-	key := health.ServiceName + "@" + health.NodeName
+	key := health.Key()
 	now := time.Now()
 	health.CheckedAt = now
 
 	// Track consecutive failures for migration triggers
-	if existing, exists := cs.ServiceHealth[key]; exists {
+	existing, exists := cs.ServiceHealth[key]
+	if exists {
 		if health.Healthy {
 			// Service is now healthy, reset failure count
 			health.ConsecutiveFailures = 0
@@ -134,16 +337,67 @@ func (cs *ClusterState) UpdateServiceHealth(health *ServiceHealth) {
 	}
 
 	cs.ServiceHealth[key] = health
-	cs.Version++
+	if !exists || routingChanged(existing, health) {
+		cs.bump()
+	}
 }
 
-// GetServiceHealth retrieves the health status of a service on a node
+// Key returns the state key of a service instance: "service@node", with "#instance"
+// appended for additional replicas on the node
+func (h *ServiceHealth) Key() string {
+	key := h.ServiceName + "@" + h.NodeName
+	if h.Instance != "" {
+		key += "#" + h.Instance
+	}
+	return key
+}
+
+// EffectiveHealthy reports whether the service is in rotation and all its dependencies
+// are met, i.e. whether it can serve traffic
+func (h *ServiceHealth) EffectiveHealthy() bool {
+	return h.Healthy && h.UnmetDependency() == nil
+}
+
+// UnmetDependency returns the first dependency that is not met, if any
+func (h *ServiceHealth) UnmetDependency() *DependencyHealth {
+	for i := range h.Dependencies {
+		if !h.Dependencies[i].Met {
+			return &h.Dependencies[i]
+		}
+	}
+	return nil
+}
+
+// GetServiceHealth retrieves the health status of a service on a node. With several
+// replicas on the node, a replica whose dependencies are met is preferred, then any
+// healthy replica.
 func (cs *ClusterState) GetServiceHealth(serviceName, nodeName string) (*ServiceHealth, bool) {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
+	rank := func(h *ServiceHealth) int {
+		switch {
+		case h.EffectiveHealthy():
+			return 2
+		case h.Healthy:
+			return 1
+		}
+		return 0
+	}
+
 	key := serviceName + "@" + nodeName
 	health, exists := cs.ServiceHealth[key]
+	if exists && health.EffectiveHealthy() {
+		return health, true
+	}
+	for _, replica := range cs.ServiceHealth {
+		if replica.ServiceName != serviceName || replica.NodeName != nodeName {
+			continue
+		}
+		if !exists || rank(replica) > rank(health) {
+			health, exists = replica, true
+		}
+	}
 	return health, exists
 }
 
@@ -153,8 +407,10 @@ func (cs *ClusterState) GetHealthyServiceNodes(serviceName string) []string {
 	defer cs.mu.RUnlock()
 
 	var healthyNodes []string
+	seen := make(map[string]bool)
 	for _, health := range cs.ServiceHealth {
-		if health.ServiceName == serviceName && health.Healthy {
+		if health.ServiceName == serviceName && health.Healthy && !seen[health.NodeName] {
+			seen[health.NodeName] = true
 			healthyNodes = append(healthyNodes, health.NodeName)
 		}
 	}
@@ -167,8 +423,11 @@ func (cs *ClusterState) UpdateWARPHealth(health *WARPHealth) {
 	defer cs.mu.Unlock()
 
 	health.CheckedAt = time.Now()
+	existing, exists := cs.WARPHealth[health.NodeName]
 	cs.WARPHealth[health.NodeName] = health
-	cs.Version++
+	if !exists || existing.Healthy != health.Healthy {
+		cs.bump()
+	}
 }
 
 // GetWARPHealth retrieves the WARP health for a node
@@ -252,6 +511,7 @@ func (cs *ClusterState) MergeState(incoming *ClusterState) {
 		localNode, exists := cs.Nodes[name]
 		if !exists || incomingNode.LastSeen.After(localNode.LastSeen) {
 			cs.Nodes[name] = incomingNode
+			cs.bumpNode(localNode, exists, incomingNode)
 		}
 	}
 
@@ -260,6 +520,9 @@ func (cs *ClusterState) MergeState(incoming *ClusterState) {
 		localHealth, exists := cs.ServiceHealth[key]
 		if !exists || incomingHealth.CheckedAt.After(localHealth.CheckedAt) {
 			cs.ServiceHealth[key] = incomingHealth
+			if !exists || routingChanged(localHealth, incomingHealth) {
+				cs.bump()
+			}
 		}
 	}
 
@@ -268,8 +531,9 @@ func (cs *ClusterState) MergeState(incoming *ClusterState) {
 		localWARP, exists := cs.WARPHealth[nodeName]
 		if !exists || incomingWARP.CheckedAt.After(localWARP.CheckedAt) {
 			cs.WARPHealth[nodeName] = incomingWARP
+			if !exists || localWARP.Healthy != incomingWARP.Healthy {
+				cs.bump()
+			}
 		}
 	}
-
-	cs.Version++
 }
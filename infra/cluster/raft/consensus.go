@@ -1,11 +1,17 @@
 package raft
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -21,10 +27,16 @@ type ConsensusManager struct {
 	dataDir   string
 	bindAddr  string
 	bindPort  int
+	apiPort   int    // REST API port on peers, used to forward writes to the leader
+	token     string // Cluster token authenticating forwarded writes
 	mu        sync.RWMutex
 	callbacks map[LeaseType][]func(bool) // Callbacks for lease changes
+	client    *http.Client
 }
 
+// ForwardPath is the REST API path on which the leader accepts forwarded commands
+const ForwardPath = "/api/v1/raft/apply"
+
 // Config holds configuration for the consensus manager
 type Config struct {
 	NodeName  string   // Name of this node
@@ -33,6 +45,8 @@ type Config struct {
 	BindPort  int      // Port to bind Raft to
 	SeedNodes []string // Initial seed nodes (format: "ip:port")
 	LogLevel  string   // Log level for Raft
+	APIPort   int      // REST API port of every node (for forwarding writes to the leader)
+	Token     string   // Cluster token; forwarding writes is disabled without it
 }
 
 // NewConsensusManager creates a new consensus manager
@@ -113,7 +127,10 @@ func NewConsensusManager(config *Config) (*ConsensusManager, error) {
 		dataDir:   config.DataDir,
 		bindAddr:  config.BindAddr,
 		bindPort:  config.BindPort,
+		apiPort:   config.APIPort,
+		token:     config.Token,
 		callbacks: make(map[LeaseType][]func(bool)),
+		client:    &http.Client{Timeout: 10 * time.Second},
 	}
 
 	// Bootstrap or join cluster
@@ -288,6 +305,173 @@ func (cm *ConsensusManager) ReleaseLease(leaseType LeaseType, leaseID string, te
 	return nil
 }
 
+// PutMigration stores a migration record in the replicated log.
+// Followers forward the write to the current leader.
+func (cm *ConsensusManager) PutMigration(record *MigrationRecord) error {
+	data, err := json.Marshal(MigrationCommand{
+		Action: "put_migration",
+		Record: record,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	if cm.raft.State() == raft.Leader {
+		return cm.applyLocal(data)
+	}
+	return cm.forwardToLeader(data)
+}
+
+// GetMigration returns a migration record from the local FSM replica
+func (cm *ConsensusManager) GetMigration(id string) (*MigrationRecord, bool) {
+	return cm.fsm.GetMigration(id)
+}
+
+// ListMigrations returns migration records from the local FSM replica
+func (cm *ConsensusManager) ListMigrations(filter MigrationFilter) ([]*MigrationRecord, int) {
+	return cm.fsm.ListMigrations(filter)
+}
+
+// PutDrain stores a node drain record in the replicated log.
+// Followers forward the write to the current leader.
+func (cm *ConsensusManager) PutDrain(drain *DrainRecord) error {
+	data, err := json.Marshal(DrainCommand{
+		Action: "put_drain",
+		Drain:  drain,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	if cm.raft.State() == raft.Leader {
+		return cm.applyLocal(data)
+	}
+	return cm.forwardToLeader(data)
+}
+
+// GetDrain returns the latest drain record of a node from the local FSM replica
+func (cm *ConsensusManager) GetDrain(nodeName string) (*DrainRecord, bool) {
+	return cm.fsm.GetDrain(nodeName)
+}
+
+// ListDrains returns the latest drain record of every node from the local FSM replica
+func (cm *ConsensusManager) ListDrains() []*DrainRecord {
+	return cm.fsm.ListDrains()
+}
+
+// PutWorkload stores a node's workload in the replicated log.
+// Followers forward the write to the current leader.
+func (cm *ConsensusManager) PutWorkload(workload *NodeWorkload) error {
+	data, err := json.Marshal(WorkloadCommand{
+		Action:   "put_workload",
+		Workload: workload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+
+	if cm.raft.State() == raft.Leader {
+		return cm.applyLocal(data)
+	}
+	return cm.forwardToLeader(data)
+}
+
+// GetWorkload returns the workload a node last published, from the local FSM replica
+func (cm *ConsensusManager) GetWorkload(nodeName string) (*NodeWorkload, bool) {
+	return cm.fsm.GetWorkload(nodeName)
+}
+
+// ApplyForwarded applies a command forwarded by a follower.
+// Lease commands are never accepted this way since they must carry the leader's own identity.
+func (cm *ConsensusManager) ApplyForwarded(data []byte) error {
+	var cmd struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return fmt.Errorf("failed to unmarshal command: %w", err)
+	}
+
+	if cmd.Action != "put_migration" && cmd.Action != "put_drain" && cmd.Action != "put_workload" {
+		return fmt.Errorf("action %q cannot be forwarded", cmd.Action)
+	}
+
+	if cm.raft.State() != raft.Leader {
+		return fmt.Errorf("not the leader, cannot apply forwarded command")
+	}
+
+	return cm.applyLocal(data)
+}
+
+// applyLocal applies a command to the Raft log (leader only)
+func (cm *ConsensusManager) applyLocal(data []byte) error {
+	future := cm.raft.Apply(data, 5*time.Second)
+	if err := future.Error(); err != nil {
+		return fmt.Errorf("failed to apply command: %w", err)
+	}
+
+	if err, ok := future.Response().(error); ok && err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// forwardToLeader sends a command to the leader's REST API
+func (cm *ConsensusManager) forwardToLeader(data []byte) error {
+	leader := string(cm.raft.Leader())
+	if leader == "" {
+		return fmt.Errorf("no Raft leader available")
+	}
+	if cm.apiPort == 0 {
+		return fmt.Errorf("API port not configured, cannot forward to leader %s", leader)
+	}
+
+	host, _, err := net.SplitHostPort(leader)
+	if err != nil {
+		return fmt.Errorf("invalid leader address %s: %w", leader, err)
+	}
+
+	if cm.token == "" {
+		return fmt.Errorf("no cluster token configured, cannot forward to leader %s", leader)
+	}
+
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, strconv.Itoa(cm.apiPort)), ForwardPath)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create forward request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cm.token)
+
+	resp, err := cm.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to forward command to leader %s: %w", leader, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("leader %s rejected forwarded command (status %d): %s", leader, resp.StatusCode, string(bytes.TrimSpace(body)))
+	}
+
+	return nil
+}
+
+// ForwardingEnabled reports whether forwarded writes are accepted (a cluster token is configured)
+func (cm *ConsensusManager) ForwardingEnabled() bool {
+	return cm.token != ""
+}
+
+// AuthorizeForward checks the Authorization header of a forwarded write against the
+// cluster token
+func (cm *ConsensusManager) AuthorizeForward(header string) bool {
+	if !cm.ForwardingEnabled() {
+		return false
+	}
+	expected := "Bearer " + cm.token
+	return subtle.ConstantTimeCompare([]byte(header), []byte(expected)) == 1
+}
+
 // IsLeader returns whether this node is the Raft leader
 func (cm *ConsensusManager) IsLeader() bool {
 	return cm.raft.State() == raft.Leader
@@ -0,0 +1,117 @@
+package raft
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var errInvalidDrainRecord = errors.New("drain record must have a node name")
+
+// ErrDrainEnded is returned when a drain that was already ended is written as active again
+var ErrDrainEnded = errors.New("drain was already ended")
+
+// Drain statuses
+const (
+	DrainStatusDraining   = "draining"   // Node cordoned, services being evacuated
+	DrainStatusDrained    = "drained"    // Evacuation finished, node stays cordoned
+	DrainStatusCancelled  = "cancelled"  // Uncordoned before evacuation finished
+	DrainStatusUncordoned = "uncordoned" // Uncordoned after evacuation finished
+)
+
+// Drain service statuses
+const (
+	DrainServicePending   = "pending"
+	DrainServiceMigrating = "migrating"
+	DrainServiceMigrated  = "migrated"
+	DrainServiceFailed    = "failed"
+	DrainServiceUnmovable = "unmovable" // Needs manual action (host devices, host networking, ...)
+)
+
+// DrainRecord is the replicated state of a node drain. A node with a draining or
+// drained record is cordoned cluster-wide and never selected as a migration target.
+type DrainRecord struct {
+	NodeName    string         `json:"node_name"`
+	Status      string         `json:"status"`
+	Concurrency int            `json:"concurrency"`
+	StartedAt   time.Time      `json:"started_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	Coordinator string         `json:"coordinator,omitempty"` // Node running the evacuation: the drained node, or a surviving node while it is down
+	Services    []DrainService `json:"services"`              // In evacuation order; empty until the coordinator lists them
+}
+
+// DrainService is the evacuation progress of one service on a draining node
+type DrainService struct {
+	ServiceName string `json:"service_name"`
+	Priority    int    `json:"priority"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"` // Why the service is unmovable or failed
+	MigrationID string `json:"migration_id,omitempty"`
+	TargetNode  string `json:"target_node,omitempty"`
+}
+
+// DrainCommand represents a command to store a drain record
+type DrainCommand struct {
+	Action string       `json:"action"` // "put_drain"
+	Drain  *DrainRecord `json:"drain"`
+}
+
+// Cordoned reports whether the drain keeps its node cordoned
+func (d *DrainRecord) Cordoned() bool {
+	return d.Status == DrainStatusDraining || d.Status == DrainStatusDrained
+}
+
+// Copy returns a deep copy of the record
+func (d *DrainRecord) Copy() *DrainRecord {
+	drainCopy := *d
+	if d.CompletedAt != nil {
+		completedAt := *d.CompletedAt
+		drainCopy.CompletedAt = &completedAt
+	}
+	drainCopy.Services = append([]DrainService(nil), d.Services...)
+	return &drainCopy
+}
+
+// putDrain stores a drain record (must be called with lock held)
+func (f *RaftFSM) putDrain(cmd *DrainCommand) error {
+	if cmd.Drain == nil || cmd.Drain.NodeName == "" {
+		return errInvalidDrainRecord
+	}
+
+	// A coordinator still running must not revive a drain ended from another node
+	if existing, exists := f.drains[cmd.Drain.NodeName]; exists && existing.StartedAt.Equal(cmd.Drain.StartedAt) &&
+		!existing.Cordoned() && cmd.Drain.Cordoned() {
+		return ErrDrainEnded
+	}
+
+	f.drains[cmd.Drain.NodeName] = cmd.Drain.Copy()
+	return nil
+}
+
+// ListDrains returns copies of the latest drain record of every node
+func (f *RaftFSM) ListDrains() []*DrainRecord {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	drains := make([]*DrainRecord, 0, len(f.drains))
+	for _, drain := range f.drains {
+		drains = append(drains, drain.Copy())
+	}
+	sort.Slice(drains, func(i, j int) bool {
+		return drains[i].NodeName < drains[j].NodeName
+	})
+	return drains
+}
+
+// GetDrain returns a copy of the drain record of a node
+func (f *RaftFSM) GetDrain(nodeName string) (*DrainRecord, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	drain, exists := f.drains[nodeName]
+	if !exists {
+		return nil, false
+	}
+	return drain.Copy(), true
+}
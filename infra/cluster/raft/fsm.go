@@ -35,16 +35,23 @@ type LeaseCommand struct {
 	Term      uint64    `json:"term"`
 }
 
-// RaftFSM implements the Raft FSM for managing leader leases
+// RaftFSM implements the Raft FSM for managing leader leases, migration records, node
+// drains and node workloads
 type RaftFSM struct {
-	mu     sync.RWMutex
-	leases map[LeaseType]*Lease // Current active leases
+	mu         sync.RWMutex
+	leases     map[LeaseType]*Lease        // Current active leases
+	migrations map[string]*MigrationRecord // Migration ID -> record
+	drains     map[string]*DrainRecord     // Node name -> latest drain
+	workloads  map[string]*NodeWorkload    // Node name -> published workload
 }
 
 // NewRaftFSM creates a new Raft FSM
 func NewRaftFSM() *RaftFSM {
 	return &RaftFSM{
-		leases: make(map[LeaseType]*Lease),
+		leases:     make(map[LeaseType]*Lease),
+		migrations: make(map[string]*MigrationRecord),
+		drains:     make(map[string]*DrainRecord),
+		workloads:  make(map[string]*NodeWorkload),
 	}
 }
 
@@ -63,6 +70,24 @@ func (f *RaftFSM) Apply(log *raft.Log) interface{} {
 		return f.acquireLease(&cmd, log.Index)
 	case "release":
 		return f.releaseLease(&cmd)
+	case "put_migration":
+		var migrationCmd MigrationCommand
+		if err := json.Unmarshal(log.Data, &migrationCmd); err != nil {
+			return fmt.Errorf("failed to unmarshal migration command: %w", err)
+		}
+		return f.putMigration(&migrationCmd)
+	case "put_drain":
+		var drainCmd DrainCommand
+		if err := json.Unmarshal(log.Data, &drainCmd); err != nil {
+			return fmt.Errorf("failed to unmarshal drain command: %w", err)
+		}
+		return f.putDrain(&drainCmd)
+	case "put_workload":
+		var workloadCmd WorkloadCommand
+		if err := json.Unmarshal(log.Data, &workloadCmd); err != nil {
+			return fmt.Errorf("failed to unmarshal workload command: %w", err)
+		}
+		return f.putWorkload(&workloadCmd)
 	default:
 		return fmt.Errorf("unknown action: %s", cmd.Action)
 	}
@@ -130,7 +155,25 @@ func (f *RaftFSM) Snapshot() (raft.FSMSnapshot, error) {
 		leasesCopy[k] = &leaseCopy
 	}
 
-	return &fsmSnapshot{leases: leasesCopy}, nil
+	// Create a copy of migration records
+	migrationsCopy := make(map[string]*MigrationRecord, len(f.migrations))
+	for k, v := range f.migrations {
+		migrationsCopy[k] = v.Copy()
+	}
+
+	// Create a copy of drain records
+	drainsCopy := make(map[string]*DrainRecord, len(f.drains))
+	for k, v := range f.drains {
+		drainsCopy[k] = v.Copy()
+	}
+
+	// Create a copy of node workloads
+	workloadsCopy := make(map[string]*NodeWorkload, len(f.workloads))
+	for k, v := range f.workloads {
+		workloadsCopy[k] = v.Copy()
+	}
+
+	return &fsmSnapshot{leases: leasesCopy, migrations: migrationsCopy, drains: drainsCopy, workloads: workloadsCopy}, nil
 }
 
 // Restore restores the FSM from a snapshot
@@ -139,7 +182,10 @@ func (f *RaftFSM) Restore(reader io.ReadCloser) error {
 	defer f.mu.Unlock()
 
 	var snapshotData struct {
-		Leases map[LeaseType]*Lease `json:"leases"`
+		Leases     map[LeaseType]*Lease        `json:"leases"`
+		Migrations map[string]*MigrationRecord `json:"migrations"`
+		Drains     map[string]*DrainRecord     `json:"drains"`
+		Workloads  map[string]*NodeWorkload    `json:"workloads"`
 	}
 
 	if err := json.NewDecoder(reader).Decode(&snapshotData); err != nil {
@@ -147,6 +193,23 @@ func (f *RaftFSM) Restore(reader io.ReadCloser) error {
 	}
 
 	f.leases = snapshotData.Leases
+	if f.leases == nil {
+		f.leases = make(map[LeaseType]*Lease)
+	}
+
+	// Snapshots taken before migration records existed have no migrations key
+	f.migrations = snapshotData.Migrations
+	if f.migrations == nil {
+		f.migrations = make(map[string]*MigrationRecord)
+	}
+	f.drains = snapshotData.Drains
+	if f.drains == nil {
+		f.drains = make(map[string]*DrainRecord)
+	}
+	f.workloads = snapshotData.Workloads
+	if f.workloads == nil {
+		f.workloads = make(map[string]*NodeWorkload)
+	}
 	return nil
 }
 
@@ -181,13 +244,19 @@ func (f *RaftFSM) GetAllLeases() map[LeaseType]*Lease {
 
 // fsmSnapshot implements raft.FSMSnapshot
 type fsmSnapshot struct {
-	leases map[LeaseType]*Lease
+	leases     map[LeaseType]*Lease
+	migrations map[string]*MigrationRecord
+	drains     map[string]*DrainRecord
+	workloads  map[string]*NodeWorkload
 }
 
 // Persist persists the snapshot to the given sink
 func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
 	data, err := json.Marshal(map[string]interface{}{
-		"leases": s.leases,
+		"leases":     s.leases,
+		"migrations": s.migrations,
+		"drains":     s.drains,
+		"workloads":  s.workloads,
 	})
 	if err != nil {
 		sink.Cancel()
@@ -0,0 +1,218 @@
+package raft
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// maxMigrationHistory bounds the number of migration records kept in the FSM.
+// Once exceeded, the oldest finished records are pruned first.
+const maxMigrationHistory = 1000
+
+var errInvalidMigrationRecord = errors.New("migration record must have an ID")
+
+// MigrationRecord is the replicated record of a single container migration
+type MigrationRecord struct {
+	ID                string                `json:"id"`
+	ServiceName       string                `json:"service_name"`
+	SourceNode        string                `json:"source_node"`
+	TargetNode        string                `json:"target_node"`
+	SourceContainerID string                `json:"source_container_id,omitempty"`
+	TargetContainerID string                `json:"target_container_id,omitempty"`
+	Status            string                `json:"status"`
+	Phase             string                `json:"phase,omitempty"`   // Current state machine phase
+	Attempt           int                   `json:"attempt,omitempty"` // 1-based attempt number
+	FailedTargets     []string              `json:"failed_targets,omitempty"`
+	Reason            string                `json:"reason,omitempty"` // What triggered the migration
+	Error             string                `json:"error,omitempty"`
+	StartedAt         time.Time             `json:"started_at"`
+	UpdatedAt         time.Time             `json:"updated_at"`
+	CompletedAt       *time.Time            `json:"completed_at,omitempty"`
+	CleanupAt         *time.Time            `json:"cleanup_at,omitempty"`     // When the source container is due to be stopped
+	Coordinator       string                `json:"coordinator,omitempty"`    // Node running the migration, when not the source (source node down)
+	PendingAction     string                `json:"pending_action,omitempty"` // Left for the source node to carry out when its agent is up
+	Progress          *MigrationProgress    `json:"progress,omitempty"`       // What the completed phases produced, to resume after a restart
+	Transitions       []MigrationTransition `json:"transitions"`
+	Steps             []MigrationStep       `json:"steps"`
+}
+
+// Actions a migration record can leave for its source node
+const (
+	PendingRestartSource = "restart_source" // Start the source container again
+	PendingRollback      = "rollback"       // Start the source container again, then remove the target container
+)
+
+// MigrationProgress is what a migration's completed phases produced, so its agent can
+// resume from the next phase after a restart instead of starting over. The exported
+// container spec holds secrets and stays on the agent running the migration.
+type MigrationProgress struct {
+	CompletedPhases   []string `json:"completed_phases,omitempty"`
+	PinnedTarget      string   `json:"pinned_target,omitempty"` // Target node chosen by whoever started the migration
+	ImageRef          string   `json:"image_ref,omitempty"`     // Digest reference the target pulled from the registry
+	SourceRunning     bool     `json:"source_running,omitempty"`
+	SourceStopped     bool     `json:"source_stopped,omitempty"`     // Stopped for the final volume sync
+	SourceUnreachable bool     `json:"source_unreachable,omitempty"` // Recreated from the spec its node published
+}
+
+// MigrationTransition records a status change of a migration
+type MigrationTransition struct {
+	Status  string    `json:"status"`
+	Phase   string    `json:"phase,omitempty"`
+	At      time.Time `json:"at"`
+	Message string    `json:"message,omitempty"`
+}
+
+// MigrationStep records the timing of a single migration step
+type MigrationStep struct {
+	Name        string     `json:"name"`
+	Attempt     int        `json:"attempt,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DurationMS  int64      `json:"duration_ms"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// MigrationCommand represents a command to store a migration record
+type MigrationCommand struct {
+	Action string           `json:"action"` // "put_migration"
+	Record *MigrationRecord `json:"record"`
+}
+
+// MigrationFilter selects migration records from the history
+type MigrationFilter struct {
+	ServiceName string // empty = all services
+	Status      string // empty = any status
+	NodeName    string // matches source or target node, empty = any node
+	Offset      int
+	Limit       int // 0 = no limit
+}
+
+// Copy returns a deep copy of the record
+func (r *MigrationRecord) Copy() *MigrationRecord {
+	recordCopy := *r
+	if r.CompletedAt != nil {
+		completedAt := *r.CompletedAt
+		recordCopy.CompletedAt = &completedAt
+	}
+	if r.CleanupAt != nil {
+		cleanupAt := *r.CleanupAt
+		recordCopy.CleanupAt = &cleanupAt
+	}
+	if r.Progress != nil {
+		progress := *r.Progress
+		progress.CompletedPhases = append([]string(nil), r.Progress.CompletedPhases...)
+		recordCopy.Progress = &progress
+	}
+	recordCopy.FailedTargets = append([]string(nil), r.FailedTargets...)
+	recordCopy.Transitions = append([]MigrationTransition(nil), r.Transitions...)
+	recordCopy.Steps = make([]MigrationStep, len(r.Steps))
+	for i, step := range r.Steps {
+		recordCopy.Steps[i] = step
+		if step.CompletedAt != nil {
+			completedAt := *step.CompletedAt
+			recordCopy.Steps[i].CompletedAt = &completedAt
+		}
+	}
+	return &recordCopy
+}
+
+// FilterMigrations applies a filter to a set of records, newest first.
+// It returns the requested page and the total number of matching records.
+func FilterMigrations(records []*MigrationRecord, filter MigrationFilter) ([]*MigrationRecord, int) {
+	matched := make([]*MigrationRecord, 0, len(records))
+	for _, record := range records {
+		if filter.ServiceName != "" && record.ServiceName != filter.ServiceName {
+			continue
+		}
+		if filter.Status != "" && record.Status != filter.Status {
+			continue
+		}
+		if filter.NodeName != "" && record.SourceNode != filter.NodeName && record.TargetNode != filter.NodeName {
+			continue
+		}
+		matched = append(matched, record)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].StartedAt.Equal(matched[j].StartedAt) {
+			return matched[i].ID > matched[j].ID
+		}
+		return matched[i].StartedAt.After(matched[j].StartedAt)
+	})
+
+	total := len(matched)
+	if filter.Offset > 0 {
+		if filter.Offset >= len(matched) {
+			return []*MigrationRecord{}, total
+		}
+		matched = matched[filter.Offset:]
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+
+	result := make([]*MigrationRecord, len(matched))
+	for i, record := range matched {
+		result[i] = record.Copy()
+	}
+	return result, total
+}
+
+// putMigration stores a migration record (must be called with lock held)
+func (f *RaftFSM) putMigration(cmd *MigrationCommand) error {
+	if cmd.Record == nil || cmd.Record.ID == "" {
+		return errInvalidMigrationRecord
+	}
+
+	f.migrations[cmd.Record.ID] = cmd.Record.Copy()
+	f.pruneMigrationsLocked()
+	return nil
+}
+
+// pruneMigrationsLocked drops the oldest finished records once the history
+// exceeds maxMigrationHistory (must be called with lock held)
+func (f *RaftFSM) pruneMigrationsLocked() {
+	excess := len(f.migrations) - maxMigrationHistory
+	if excess <= 0 {
+		return
+	}
+
+	finished := make([]*MigrationRecord, 0, len(f.migrations))
+	for _, record := range f.migrations {
+		if record.CompletedAt != nil {
+			finished = append(finished, record)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].CompletedAt.Before(*finished[j].CompletedAt)
+	})
+
+	for i := 0; i < excess && i < len(finished); i++ {
+		delete(f.migrations, finished[i].ID)
+	}
+}
+
+// GetMigration returns a copy of the migration record with the given ID
+func (f *RaftFSM) GetMigration(id string) (*MigrationRecord, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	record, exists := f.migrations[id]
+	if !exists {
+		return nil, false
+	}
+	return record.Copy(), true
+}
+
+// ListMigrations returns migration records matching the filter, newest first
+func (f *RaftFSM) ListMigrations(filter MigrationFilter) ([]*MigrationRecord, int) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	records := make([]*MigrationRecord, 0, len(f.migrations))
+	for _, record := range f.migrations {
+		records = append(records, record)
+	}
+	return FilterMigrations(records, filter)
+}
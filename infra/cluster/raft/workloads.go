@@ -0,0 +1,68 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var errInvalidWorkloadRecord = errors.New("workload record must have a node name")
+
+// NodeWorkload is the inventory of the services on a node, with the container specs
+// needed to recreate them elsewhere. Each agent publishes its own, so the cluster can
+// still evacuate a node after it went down.
+type NodeWorkload struct {
+	NodeName  string            `json:"node_name"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Services  []WorkloadService `json:"services"`
+}
+
+// WorkloadService is one service container of a node's workload
+type WorkloadService struct {
+	ServiceName string          `json:"service_name"`
+	ContainerID string          `json:"container_id,omitempty"`
+	Spec        json.RawMessage `json:"spec,omitempty"`         // Container spec, as exported for migrations, without its environment
+	SealedEnv   []byte          `json:"sealed_env,omitempty"`   // Environment of the spec, encrypted with the cluster token
+	EnvWithheld bool            `json:"env_withheld,omitempty"` // The spec has an environment that was not published (no cluster token)
+	Error       string          `json:"error,omitempty"`        // Why the container could not be exported
+}
+
+// WorkloadCommand represents a command to store a node's workload
+type WorkloadCommand struct {
+	Action   string        `json:"action"` // "put_workload"
+	Workload *NodeWorkload `json:"workload"`
+}
+
+// Copy returns a deep copy of the record
+func (w *NodeWorkload) Copy() *NodeWorkload {
+	workloadCopy := *w
+	workloadCopy.Services = make([]WorkloadService, len(w.Services))
+	for i, service := range w.Services {
+		workloadCopy.Services[i] = service
+		workloadCopy.Services[i].Spec = append(json.RawMessage(nil), service.Spec...)
+		workloadCopy.Services[i].SealedEnv = append([]byte(nil), service.SealedEnv...)
+	}
+	return &workloadCopy
+}
+
+// putWorkload stores a node's workload (must be called with lock held)
+func (f *RaftFSM) putWorkload(cmd *WorkloadCommand) error {
+	if cmd.Workload == nil || cmd.Workload.NodeName == "" {
+		return errInvalidWorkloadRecord
+	}
+
+	f.workloads[cmd.Workload.NodeName] = cmd.Workload.Copy()
+	return nil
+}
+
+// GetWorkload returns a copy of the workload a node last published
+func (f *RaftFSM) GetWorkload(nodeName string) (*NodeWorkload, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	workload, exists := f.workloads[nodeName]
+	if !exists {
+		return nil, false
+	}
+	return workload.Copy(), true
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -135,6 +136,16 @@ func main() {
 	}
 	defer gossipCluster.Shutdown()
 
+	// Agents authenticate to each other's API with a shared cluster token: writes forwarded
+	// to the Raft leader and migration payloads go through it
+	clusterToken := getEnv("CONSTELLATION_CLUSTER_TOKEN", "")
+	if clusterToken == "" {
+		clusterToken = readSecret(*secretsPath, "cluster-token.txt")
+	}
+	if clusterToken == "" {
+		log.Printf("Warning: No cluster token configured, Raft write forwarding and migration transfer API disabled")
+	}
+
 	// Initialize Raft consensus
 	log.Printf("Initializing Raft consensus...")
 	raftConfig := &raft.Config{
@@ -143,6 +154,8 @@ func main() {
 		BindAddr:  *bindAddr,
 		BindPort:  *raftPort,
 		SeedNodes: buildRaftSeedNodes(seedNodes, *raftPort),
+		APIPort:   *apiPort,
+		Token:     clusterToken,
 		LogLevel:  "info",
 	}
 
@@ -199,6 +212,12 @@ func main() {
 		domain,
 		*nodeName,
 	)
+	if err := httpProvider.SetDefaultMiddlewares(cfg.GetRouterMiddlewares()); err != nil {
+		log.Fatalf("Invalid Traefik middleware configuration: %v", err)
+	}
+	if err := httpProvider.SetFallback(cfg.Traefik.Fallback, cfg.Traefik.FallbackRetryAfter); err != nil {
+		log.Fatalf("Invalid Traefik fallback configuration: %v", err)
+	}
 
 	// Start HTTP provider server
 	go func() {
@@ -217,8 +236,45 @@ func main() {
 		log.Fatalf("Failed to create Docker client: %v", err)
 	}
 
-	// Start service health monitoring
-	go monitorServiceHealth(ctx, dockerClient, gossipCluster, *nodeName)
+	// Start service health monitoring from the Docker events stream
+	serviceMonitor := monitoring.NewServiceMonitor(dockerClient, func(status monitoring.ServiceStatus) {
+		health := &gossip.ServiceHealth{
+			ServiceName:  status.Service.Name,
+			Project:      status.Service.Project,
+			Instance:     status.Service.Instance,
+			Healthy:      status.Healthy,
+			State:        status.State,
+			Endpoints:    status.Endpoints,
+			Networks:     status.Networks,
+			Labels:       status.Labels,
+			DockerStatus: status.DockerStatus,
+		}
+		if !status.HeldUntil.IsZero() {
+			heldUntil := status.HeldUntil
+			health.HeldUntil = &heldUntil
+		}
+		if status.Probe != nil {
+			health.Probe = &gossip.ProbeStatus{
+				Type:      status.Probe.Type,
+				Target:    status.Probe.Target,
+				Healthy:   status.Probe.Healthy,
+				Message:   status.Probe.Message,
+				LatencyMs: float64(status.Probe.Latency) / float64(time.Millisecond),
+				CheckedAt: status.Probe.CheckedAt,
+			}
+		}
+		for _, dependency := range status.Dependencies {
+			health.Dependencies = append(health.Dependencies, gossip.DependencyHealth{
+				Service:   dependency.Service,
+				Condition: dependency.Condition,
+				Met:       dependency.Met,
+				Reason:    dependency.Reason,
+			})
+		}
+		gossipCluster.ReportServiceHealth(health)
+	})
+	serviceMonitor.SetResyncInterval(getEnvDuration("CONSTELLATION_HEALTH_RESYNC_INTERVAL", monitoring.DefaultServiceResyncInterval))
+	go serviceMonitor.Start(ctx)
 
 	// Start WARP health monitoring
 	warpMonitor := monitoring.NewWarpMonitor(dockerClient, func(healthy bool) {
@@ -236,6 +292,49 @@ func main() {
 	// Initialize migration manager for enhanced failover
 	log.Printf("Initializing migration manager...")
 	migrationManager := failover.NewMigrationManager(dockerClient, gossipCluster.GetState(), *nodeName)
+	migrationManager.SetMigrationStore(consensusManager)
+
+	hostRoot := getEnv("CONSTELLATION_HOST_ROOT", "")
+	migrationManager.SetTransferConfig(*apiPort, clusterToken, hostRoot)
+	if err := migrationManager.SetSpecDir(filepath.Join(*dataDir, "migrations")); err != nil {
+		log.Printf("Warning: %v (interrupted migrations will not resume after a restart)", err)
+	}
+
+	// Images move through a cluster registry when configured: "local" runs a registry on
+	// every node, anything else is the host:port of a shared registry
+	registryConfig := failover.RegistryConfig{
+		Port:     getEnvInt("CONSTELLATION_REGISTRY_PORT", failover.DefaultRegistryPort),
+		Username: getEnv("CONSTELLATION_REGISTRY_USERNAME", ""),
+		Password: getEnv("CONSTELLATION_REGISTRY_PASSWORD", ""),
+	}
+	if registryConfig.Password == "" && registryConfig.Username != "" {
+		registryConfig.Password = readSecret(*secretsPath, "registry-password.txt")
+	}
+	switch registry := getEnv("CONSTELLATION_REGISTRY", ""); registry {
+	case "":
+	case "local":
+		registryConfig.Local = true
+		if err := failover.EnsureLocalRegistry(ctx, dockerClient, registryConfig.Port, tailscaleIP); err != nil {
+			log.Printf("Warning: Failed to start local image registry: %v (images will be copied whole)", err)
+			registryConfig.Local = false
+		}
+	default:
+		registryConfig.Address = registry
+	}
+	migrationManager.SetImageRegistry(registryConfig)
+
+	// One collector serves triggers, gossip and the API, so CPU and IO deltas are shared
+	metricsCollector := monitoring.NewMetricsCollector()
+	metricsCollector.SetHostRoot(hostRoot)
+	migrationManager.SetMetricsCollector(metricsCollector)
+	go publishNodeResources(ctx, metricsCollector, gossipCluster)
+	migrationReceiver, err := failover.NewMigrationReceiver(dockerClient, clusterToken, filepath.Join(*dataDir, "transfers"), hostRoot)
+	if err != nil {
+		log.Printf("Warning: Failed to initialize migration receiver: %v", err)
+	} else {
+		migrationReceiver.PruneUploads(24 * time.Hour)
+		migrationReceiver.SetRegistry(registryConfig)
+	}
 
 	// Load migration rules from configuration
 	migrationRulesPath := getEnv("MIGRATION_RULES_PATH", "/opt/constellation/config/migration-rules.json")
@@ -247,16 +346,40 @@ func main() {
 		log.Printf("Loaded %d migration rule(s) from %s", len(migrationRules), migrationRulesPath)
 	}
 
+	// Drains use the rules for service priority and retry settings, and publish the
+	// node's cordon state through gossip
+	migrationManager.SetMigrationRules(migrationRules)
+	migrationManager.SetCordonHandler(func(cordoned bool) {
+		capabilities := []string{}
+		if node, exists := gossipCluster.GetState().GetNode(*nodeName); exists && node.Capabilities != nil {
+			capabilities = node.Capabilities
+		}
+		gossipCluster.UpdateNodeMetadata(cordoned, capabilities)
+	})
+
 	// Start migration monitoring with loaded rules
 	go migrationManager.MonitorAndMigrate(ctx, migrationRules)
 
+	// Drains are written through Raft by whichever agent received the request; every
+	// agent follows them to evacuate itself, or a down node when it is the leader
+	go migrationManager.FollowDrains(ctx)
+
 	// Initialize WebSocket server
 	log.Printf("Initializing WebSocket server...")
 	wsServer := api.NewWebSocketServer(gossipCluster, consensusManager)
+	migrationManager.SetEventHandler(wsServer.BroadcastMigrationEvent)
+	httpProvider.SetChangeHandler(wsServer.BroadcastConfigChange)
+	go httpProvider.WatchChanges(ctx)
 
 	// Initialize and start REST API server (includes WebSocket endpoint)
 	log.Printf("Initializing REST API server...")
 	apiServer := api.NewServer(gossipCluster, consensusManager, migrationManager, wsServer, *apiPort)
+	if migrationReceiver != nil {
+		apiServer.SetMigrationReceiver(migrationReceiver)
+	}
+	apiServer.SetMetricsCollector(metricsCollector)
+	apiServer.SetFallbackStatus(httpProvider.ServingFallback)
+	apiServer.SetDroppedRouters(httpProvider.DroppedRouters)
 	go func() {
 		if err := apiServer.Start(); err != nil {
 			log.Printf("API server failed: %v", err)
@@ -315,6 +438,15 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if result, err := time.ParseDuration(value); err == nil {
+			return result
+		}
+	}
+	return defaultValue
+}
+
 func getPublicIP() string {
 	// First check environment variable
 	if ip := getEnv("PUBLIC_IP", ""); ip != "" {
@@ -409,76 +541,43 @@ func readSecret(secretsPath, filename string) string {
 	return strings.TrimSpace(string(data))
 }
 
-func monitorServiceHealth(ctx context.Context, dockerClient *client.Client, cluster *gossip.GossipCluster, nodeName string) {
-	ticker := time.NewTicker(10 * time.Second)
+// publishNodeResources periodically collects this node's resource usage and shares it through gossip
+func publishNodeResources(ctx context.Context, collector *monitoring.MetricsCollector, cluster *gossip.GossipCluster) {
+	ticker := time.NewTicker(15 * time.Second)
 	defer ticker.Stop()
 
 	for {
+		metrics, err := collector.CollectMetrics(ctx)
+		if err != nil {
+			log.Printf("Warning: Failed to collect node metrics: %v", err)
+		} else {
+			resources := &gossip.NodeResources{
+				CPUPercent:         metrics.CPUPercent,
+				MemoryPercent:      metrics.MemoryPercent,
+				MemoryTotal:        metrics.MemoryTotal,
+				DiskPercent:        metrics.DiskPercent,
+				Load1:              metrics.Load1,
+				IOReadBytesPerSec:  metrics.IOReadBytesPerSec,
+				IOWriteBytesPerSec: metrics.IOWriteBytesPerSec,
+				IOUtilPercent:      metrics.IOUtilPercent,
+				CollectedAt:        metrics.Timestamp,
+			}
+			if metrics.CPUPressure != nil {
+				resources.CPUPressure = metrics.CPUPressure.Some
+			}
+			if metrics.MemoryPressure != nil {
+				resources.MemoryPressure = metrics.MemoryPressure.Some
+			}
+			if metrics.IOPressure != nil {
+				resources.IOPressure = metrics.IOPressure.Some
+			}
+			cluster.UpdateNodeResources(resources)
+		}
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			// Query all containers
-			containers, err := dockerClient.ContainerList(ctx, types.ContainerListOptions{
-				All: true,
-			})
-			if err != nil {
-				log.Printf("Failed to list containers for health check: %v", err)
-				continue
-			}
-
-			// Check health of each container
-			for _, container := range containers {
-				// Skip containers without names or system containers
-				if len(container.Names) == 0 {
-					continue
-				}
-
-				containerName := strings.TrimPrefix(container.Names[0], "/")
-
-				// Skip infrastructure containers
-				if strings.HasPrefix(containerName, "constellation-") ||
-					strings.HasPrefix(containerName, "traefik") ||
-					strings.HasPrefix(containerName, "warp-") {
-					continue
-				}
-
-				// Extract service name from container name (remove stack prefix if present)
-				serviceName := containerName
-				if idx := strings.LastIndex(containerName, "_"); idx > 0 {
-					serviceName = containerName[idx+1:]
-				}
-
-				// Get container details for endpoints, networks, and health
-				containerJSON, err := dockerClient.ContainerInspect(ctx, container.ID)
-				if err != nil {
-					log.Printf("Failed to inspect container %s: %v", containerName, err)
-					continue
-				}
-
-				// Determine health status
-				healthy := containerJSON.State.Running
-				if containerJSON.State.Running && containerJSON.State.Health != nil {
-					healthy = containerJSON.State.Health.Status == "healthy"
-				}
-
-				// Extract endpoints (ports)
-				endpoints := make(map[string]string)
-				for port, bindings := range containerJSON.NetworkSettings.Ports {
-					if len(bindings) > 0 {
-						endpoints[string(port)] = bindings[0].HostIP + ":" + bindings[0].HostPort
-					}
-				}
-
-				// Extract networks
-				networks := make([]string, 0, len(containerJSON.NetworkSettings.Networks))
-				for netName := range containerJSON.NetworkSettings.Networks {
-					networks = append(networks, netName)
-				}
-
-				// Broadcast service health
-				cluster.BroadcastServiceHealth(serviceName, healthy, endpoints, networks)
-			}
 		}
 	}
 }
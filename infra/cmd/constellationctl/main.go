@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cluster/infra/failover"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: constellationctl [-api URL] <command> [options]
+
+Commands:
+  plan <service>   Show what migrating a service would do, without migrating it
+
+Global options:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	apiURL := flag.String("api", getEnv("CONSTELLATION_API", "http://localhost:8080"), "Agent API URL (or CONSTELLATION_API)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "plan":
+		err = runPlan(*apiURL, flag.Args()[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runPlan requests a migration plan and prints it
+func runPlan(apiURL string, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	target := fs.String("target", "", "Target node (default: auto-select)")
+	source := fs.String("source", "", "Node currently running the service (default: the API node)")
+	bandwidth := fs.Float64("bandwidth", 0, "Link speed in Mbit/s used for the transfer estimate (default 100)")
+	asJSON := fs.Bool("json", false, "Print the raw plan as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: constellationctl plan [options] <service>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"service_name":   fs.Arg(0),
+		"target_node":    *target,
+		"source_node":    *source,
+		"bandwidth_mbps": *bandwidth,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Post(strings.TrimRight(apiURL, "/")+"/api/v1/migrations/plan", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to reach agent API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("agent returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if *asJSON {
+		os.Stdout.Write(data)
+		return nil
+	}
+
+	var plan failover.MigrationPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("failed to decode plan: %w", err)
+	}
+	printPlan(os.Stdout, &plan)
+
+	if !plan.Feasible {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// printPlan renders a migration plan for humans
+func printPlan(out io.Writer, plan *failover.MigrationPlan) {
+	result := "ready"
+	if !plan.Feasible {
+		result = "BLOCKED"
+	}
+
+	fmt.Fprintf(out, "Migration plan for %s\n", plan.ServiceName)
+	fmt.Fprintf(out, "  Source:  %s\n", plan.SourceNode)
+	if plan.TargetNode != "" {
+		fmt.Fprintf(out, "  Target:  %s (%s)\n", plan.TargetNode, plan.TargetReason)
+	} else {
+		fmt.Fprintf(out, "  Target:  none (%s)\n", plan.TargetReason)
+	}
+	fmt.Fprintf(out, "  Result:  %s\n", result)
+
+	if len(plan.Candidates) > 0 {
+		fmt.Fprintln(out, "\nTarget candidates:")
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, candidate := range plan.Candidates {
+			status := "eligible"
+			if !candidate.Eligible {
+				status = "skipped: " + candidate.Reason
+			}
+			marker := " "
+			if candidate.Node == plan.TargetNode {
+				marker = "*"
+			}
+			fmt.Fprintf(tw, "  %s %s\tpriority %d\t%s\n", marker, candidate.Node, candidate.Priority, status)
+		}
+		tw.Flush()
+	}
+
+	if plan.Image != nil {
+		fmt.Fprintln(out, "\nImage:")
+		availability := "unknown on target (target not reachable)"
+		if plan.Image.PresentOnTarget != nil {
+			if *plan.Image.PresentOnTarget {
+				availability = "present on target, not transferred"
+			} else {
+				availability = "missing on target, will be transferred"
+				if plan.Image.Method == "registry" {
+					availability = "missing on target, missing layers pulled from the cluster registry"
+				}
+			}
+		}
+		fmt.Fprintf(out, "  %s  %s  %s\n", plan.Image.Name, formatBytes(plan.Image.SizeBytes), availability)
+	}
+
+	if len(plan.Volumes) > 0 {
+		fmt.Fprintln(out, "\nVolumes:")
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, vol := range plan.Volumes {
+			size := "unknown size"
+			if vol.SizeBytes >= 0 {
+				size = formatBytes(vol.SizeBytes)
+			}
+			fmt.Fprintf(tw, "  %s\t%s %s\t%s\t%s\n", vol.Target, vol.Type, vol.Source, size, vol.Method)
+		}
+		tw.Flush()
+	}
+
+	fmt.Fprintf(out, "\nTransfer: %s, about %s at %.0f Mbit/s\n",
+		formatBytes(plan.TransferBytes), formatSeconds(plan.EstimatedTransferSeconds), plan.BandwidthMbps)
+
+	if len(plan.PortConflicts) > 0 {
+		fmt.Fprintf(out, "Port conflicts on target: %s\n", strings.Join(plan.PortConflicts, ", "))
+	}
+	if len(plan.MissingNetworks) > 0 {
+		fmt.Fprintf(out, "Networks missing on target: %s\n", strings.Join(plan.MissingNetworks, ", "))
+	}
+	if len(plan.PreHooks) > 0 || len(plan.PostHooks) > 0 {
+		fmt.Fprintf(out, "Hooks: pre [%s], post [%s]\n", strings.Join(plan.PreHooks, ", "), strings.Join(plan.PostHooks, ", "))
+	}
+
+	fmt.Fprintln(out, "\nChecks:")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, check := range plan.Checks {
+		mark := "ok"
+		if !check.Passed {
+			mark = "warn"
+			if check.Blocking {
+				mark = "FAIL"
+			}
+		}
+		fmt.Fprintf(tw, "  [%s]\t%s\t%s\n", mark, check.Name, check.Detail)
+	}
+	tw.Flush()
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatSeconds renders an estimate as a rounded duration
+func formatSeconds(seconds float64) string {
+	if seconds < 1 {
+		return "less than a second"
+	}
+	return (time.Duration(seconds) * time.Second).Round(time.Second).String()
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -35,6 +35,9 @@ func MigrateFromOldConfig(domain, stackName, configPath, secretsPath, rootPath s
 			ErrorPagesMiddleware: getEnv("TRAEFIK_ERROR_PAGES_MIDDLEWARE", "error-pages@file"),
 			CrowdsecMiddleware:   getEnv("TRAEFIK_CROWDSEC_MIDDLEWARE", "crowdsec@file"),
 			StripWWWMiddleware:   getEnv("TRAEFIK_STRIP_WWW_MIDDLEWARE", "strip-www@file"),
+			DefaultMiddlewares:   getEnvList("TRAEFIK_DEFAULT_MIDDLEWARES", []string{"compress"}),
+			Fallback:             getEnv("TRAEFIK_FALLBACK", "503"),
+			FallbackRetryAfter:   getEnvInt("TRAEFIK_FALLBACK_RETRY_AFTER", 30),
 			CertResolver:         getEnv("TRAEFIK_CERT_RESOLVER", "letsencrypt"),
 			HTTPProviderPort:     getEnvInt("TRAEFIK_HTTP_PROVIDER_PORT", 8081),
 			CloudflareTrustedIPs: getCloudflareTrustedIPs(),
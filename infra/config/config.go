@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -89,6 +90,7 @@ type ServiceConfig struct {
 	Build          *BuildConfig      `yaml:"build"`
 	Secrets        []SecretMount     `yaml:"secrets"`
 	Configs        []ConfigMount     `yaml:"configs"`
+	LoadBalancer   *LoadBalancerConfig `yaml:"load_balancer"` // Traefik load balancer options for the service's generated services
 }
 
 // PortMapping defines port mappings
@@ -137,6 +139,33 @@ type Healthcheck struct {
 	Retries     int      `yaml:"retries" default:"3"`
 }
 
+// LoadBalancerConfig holds the Traefik load balancer options of a service
+type LoadBalancerConfig struct {
+	HealthCheck      *LoadBalancerHealthCheck `yaml:"health_check"`
+	Sticky           *StickyCookieConfig      `yaml:"sticky"`
+	PassHostHeader   *bool                    `yaml:"pass_host_header"`  // Traefik's default is true
+	ServersTransport string                   `yaml:"servers_transport"` // e.g. "insecure@file"
+}
+
+// LoadBalancerHealthCheck defines how Traefik checks a service's servers
+type LoadBalancerHealthCheck struct {
+	Path           string            `yaml:"path" default:"/"`
+	Interval       string            `yaml:"interval" default:"30s"`
+	Timeout        string            `yaml:"timeout" default:"10s"`
+	Scheme         string            `yaml:"scheme"`
+	Port           int               `yaml:"port"`
+	ExpectedStatus int               `yaml:"expected_status"` // Any 2xx or 3xx passes when unset
+	Headers        map[string]string `yaml:"headers"`
+}
+
+// StickyCookieConfig pins clients to a server with a cookie
+type StickyCookieConfig struct {
+	Name     string `yaml:"name"`
+	Secure   bool   `yaml:"secure"`
+	HTTPOnly bool   `yaml:"http_only"`
+	SameSite string `yaml:"same_site"` // none, lax or strict
+}
+
 // TraefikConfig holds Traefik-specific configuration
 type TraefikConfig struct {
 	// Entry points
@@ -148,6 +177,14 @@ type TraefikConfig struct {
 	CrowdsecMiddleware   string `yaml:"crowdsec_middleware" env:"TRAEFIK_CROWDSEC_MIDDLEWARE" default:"crowdsec@file"`
 	StripWWWMiddleware   string `yaml:"strip_www_middleware" env:"TRAEFIK_STRIP_WWW_MIDDLEWARE" default:"strip-www@file"`
 
+	// Middlewares attached to every generated router after those above, e.g. "compress"
+	DefaultMiddlewares []string `yaml:"default_middlewares" env:"TRAEFIK_DEFAULT_MIDDLEWARES" default:"compress"`
+
+	// What routers of a service serve while no replica is healthy: "503" (with
+	// Retry-After), "none", the URL of a maintenance page or "service:<name>"
+	Fallback           string `yaml:"fallback" env:"TRAEFIK_FALLBACK" default:"503"`
+	FallbackRetryAfter int    `yaml:"fallback_retry_after" env:"TRAEFIK_FALLBACK_RETRY_AFTER" default:"30"` // Seconds
+
 	// TLS configuration
 	CertResolver string `yaml:"cert_resolver" env:"TRAEFIK_CERT_RESOLVER" default:"letsencrypt"`
 
@@ -223,6 +260,9 @@ func LoadConfig(configPath string) (*Config, error) {
 			ErrorPagesMiddleware: getEnv("TRAEFIK_ERROR_PAGES_MIDDLEWARE", "error-pages@file"),
 			CrowdsecMiddleware:   getEnv("TRAEFIK_CROWDSEC_MIDDLEWARE", "crowdsec@file"),
 			StripWWWMiddleware:   getEnv("TRAEFIK_STRIP_WWW_MIDDLEWARE", "strip-www@file"),
+			DefaultMiddlewares:   getEnvList("TRAEFIK_DEFAULT_MIDDLEWARES", []string{"compress"}),
+			Fallback:             getEnv("TRAEFIK_FALLBACK", "503"),
+			FallbackRetryAfter:   getEnvInt("TRAEFIK_FALLBACK_RETRY_AFTER", 30),
 			CertResolver:         getEnv("TRAEFIK_CERT_RESOLVER", "letsencrypt"),
 			HTTPProviderPort:     getEnvInt("TRAEFIK_HTTP_PROVIDER_PORT", 8081),
 			CloudflareTrustedIPs: getCloudflareTrustedIPs(),
@@ -334,6 +374,15 @@ func (c *Config) LoadFromYAML(path string) error {
 	if yamlConfig.Traefik.StripWWWMiddleware != "" {
 		c.Traefik.StripWWWMiddleware = yamlConfig.Traefik.StripWWWMiddleware
 	}
+	if len(yamlConfig.Traefik.DefaultMiddlewares) > 0 {
+		c.Traefik.DefaultMiddlewares = yamlConfig.Traefik.DefaultMiddlewares
+	}
+	if yamlConfig.Traefik.Fallback != "" {
+		c.Traefik.Fallback = yamlConfig.Traefik.Fallback
+	}
+	if yamlConfig.Traefik.FallbackRetryAfter != 0 {
+		c.Traefik.FallbackRetryAfter = yamlConfig.Traefik.FallbackRetryAfter
+	}
 	if yamlConfig.Traefik.CertResolver != "" {
 		c.Traefik.CertResolver = yamlConfig.Traefik.CertResolver
 	}
@@ -504,6 +553,21 @@ func (c *Config) Validate() error {
 		errors = append(errors, fmt.Sprintf("dns.provider '%s' is not supported (supported: cloudflare, route53)", c.DNS.Provider))
 	}
 
+	// Validate middleware references
+	for _, middleware := range c.GetRouterMiddlewares() {
+		if !isValidMiddlewareRef(middleware) {
+			errors = append(errors, fmt.Sprintf("traefik middleware '%s' is not a valid reference (name or name@provider)", middleware))
+		}
+	}
+
+	// Validate fallback
+	if !isValidFallback(c.Traefik.Fallback) {
+		errors = append(errors, fmt.Sprintf("traefik.fallback '%s' is not valid (503, none, an http(s) URL or service:<name>)", c.Traefik.Fallback))
+	}
+	if c.Traefik.FallbackRetryAfter < 0 {
+		errors = append(errors, fmt.Sprintf("traefik.fallback_retry_after must not be negative, got %d", c.Traefik.FallbackRetryAfter))
+	}
+
 	// Validate Cloudflare trusted IPs
 	for _, ip := range c.Traefik.CloudflareTrustedIPs {
 		if _, _, err := net.ParseCIDR(ip); err != nil {
@@ -562,6 +626,30 @@ func isValidStackName(name string) bool {
 	return true
 }
 
+func isValidMiddlewareRef(ref string) bool {
+	name, provider, qualified := strings.Cut(ref, "@")
+	if name == "" || (qualified && provider == "") || strings.Contains(provider, "@") {
+		return false
+	}
+	for _, r := range name + provider {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidFallback(fallback string) bool {
+	switch {
+	case fallback == "" || fallback == "503" || fallback == "none":
+		return true
+	case strings.HasPrefix(fallback, "service:"):
+		return isValidMiddlewareRef(strings.TrimPrefix(fallback, "service:"))
+	}
+	target, err := url.Parse(fallback)
+	return err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != ""
+}
+
 func isValidRegistry(registry string) bool {
 	if len(registry) == 0 {
 		return false
@@ -618,6 +706,16 @@ func (c *Config) GetTraefikMiddlewares() string {
 	return strings.Join(middlewares, ",")
 }
 
+// GetRouterMiddlewares returns the middleware chain the agent's HTTP provider attaches
+// to every router: the enabled middlewares above, then the default middlewares
+func (c *Config) GetRouterMiddlewares() []string {
+	middlewares := []string{}
+	if configured := c.GetTraefikMiddlewares(); configured != "" {
+		middlewares = append(middlewares, strings.Split(configured, ",")...)
+	}
+	return append(middlewares, c.Traefik.DefaultMiddlewares...)
+}
+
 // Helper functions
 func getEnv(key, defaultValue string) string {
 	if val := os.Getenv(key); val != "" {
@@ -638,6 +736,20 @@ func getEnvInt(key string, defaultValue int) int {
 	return result
 }
 
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getCloudflareTrustedIPs() []string {
 	// Default Cloudflare IP ranges
 	return []string{
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -261,3 +262,74 @@ func TestGetTraefikMiddlewares(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRouterMiddlewares(t *testing.T) {
+	cfg := &Config{
+		Middlewares: MiddlewareConfig{CrowdsecEnabled: true},
+		Traefik: TraefikConfig{
+			CrowdsecMiddleware: "crowdsec@file",
+			DefaultMiddlewares: []string{"compress", "headers@file"},
+		},
+	}
+
+	got := strings.Join(cfg.GetRouterMiddlewares(), ",")
+	if want := "crowdsec@file,compress,headers@file"; got != want {
+		t.Errorf("GetRouterMiddlewares() = %v, want %v", got, want)
+	}
+
+	cfg.Traefik.DefaultMiddlewares = []string{"compress@"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "compress@") {
+		t.Errorf("Expected validation error for middleware 'compress@', got %v", err)
+	}
+}
+
+func TestValidateTraefikFallback(t *testing.T) {
+	for _, fallback := range []string{"503", "none", "https://status.example.com", "service:error-pages@docker"} {
+		cfg := &Config{Traefik: TraefikConfig{Fallback: fallback}}
+		if err := cfg.Validate(); err != nil && strings.Contains(err.Error(), "fallback") {
+			t.Errorf("Unexpected validation error for fallback %q: %v", fallback, err)
+		}
+	}
+
+	for _, fallback := range []string{"502", "ftp://status.example.com", "service:"} {
+		cfg := &Config{Traefik: TraefikConfig{Fallback: fallback}}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "fallback") {
+			t.Errorf("Expected validation error for fallback %q, got %v", fallback, err)
+		}
+	}
+}
+
+func TestServiceConfigContainerLabels(t *testing.T) {
+	passHostHeader := false
+	svc := ServiceConfig{
+		Name: "app",
+		Labels: map[string]string{
+			"traefik.http.services.web.loadbalancer.server.port":      "3000",
+			"traefik.http.services.web.loadbalancer.healthcheck.path": "/ready",
+		},
+		LoadBalancer: &LoadBalancerConfig{
+			HealthCheck:    &LoadBalancerHealthCheck{Path: "/healthz", Interval: "10s", ExpectedStatus: 204},
+			Sticky:         &StickyCookieConfig{Name: "srv"},
+			PassHostHeader: &passHostHeader,
+		},
+	}
+
+	labels := svc.ContainerLabels()
+	want := map[string]string{
+		// Set explicitly, so not overridden
+		"traefik.http.services.web.loadbalancer.healthcheck.path":     "/ready",
+		"traefik.http.services.web.loadbalancer.healthcheck.interval": "10s",
+		"traefik.http.services.web.loadbalancer.healthcheck.status":   "204",
+		"traefik.http.services.web.loadbalancer.sticky.cookie":        "true",
+		"traefik.http.services.web.loadbalancer.sticky.cookie.name":   "srv",
+		"traefik.http.services.web.loadbalancer.passhostheader":       "false",
+	}
+	for k, v := range want {
+		if labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, labels[k], v)
+		}
+	}
+	if _, ok := labels["traefik.http.services.web.loadbalancer.serverstransport"]; ok {
+		t.Error("unset servers transport should not produce a label")
+	}
+}
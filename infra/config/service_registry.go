@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -212,10 +213,86 @@ func BuildTraefikLabels(cfg *Config, serviceName string, options TraefikLabelOpt
 	if options.Port != "" {
 		labels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", serviceNameLabel)] = options.Port
 	}
+
+	// Load balancer options
+	for k, v := range BuildLoadBalancerLabels(serviceNameLabel, options.LoadBalancer) {
+		labels[k] = v
+	}
 	
 	return labels
 }
 
+// BuildLoadBalancerLabels builds the Traefik labels setting a service's load balancer
+// options. The agent's HTTP provider reads them from every replica.
+func BuildLoadBalancerLabels(serviceName string, lb *LoadBalancerConfig) map[string]string {
+	labels := make(map[string]string)
+	if lb == nil {
+		return labels
+	}
+	prefix := fmt.Sprintf("traefik.http.services.%s.loadbalancer.", serviceName)
+	set := func(option, value string) {
+		if value != "" {
+			labels[prefix+option] = value
+		}
+	}
+
+	if hc := lb.HealthCheck; hc != nil {
+		set("healthcheck.path", hc.Path)
+		set("healthcheck.interval", hc.Interval)
+		set("healthcheck.timeout", hc.Timeout)
+		set("healthcheck.scheme", hc.Scheme)
+		if hc.Port > 0 {
+			set("healthcheck.port", strconv.Itoa(hc.Port))
+		}
+		if hc.ExpectedStatus > 0 {
+			set("healthcheck.status", strconv.Itoa(hc.ExpectedStatus))
+		}
+		for header, value := range hc.Headers {
+			set("healthcheck.headers."+header, value)
+		}
+	}
+	if sticky := lb.Sticky; sticky != nil {
+		labels[prefix+"sticky.cookie"] = "true"
+		set("sticky.cookie.name", sticky.Name)
+		if sticky.Secure {
+			set("sticky.cookie.secure", "true")
+		}
+		if sticky.HTTPOnly {
+			set("sticky.cookie.httponly", "true")
+		}
+		set("sticky.cookie.samesite", sticky.SameSite)
+	}
+	if lb.PassHostHeader != nil {
+		set("passhostheader", strconv.FormatBool(*lb.PassHostHeader))
+	}
+	set("serverstransport", lb.ServersTransport)
+	return labels
+}
+
+// ContainerLabels returns the service's labels together with the Traefik labels of its
+// load balancer options, set on the Traefik service its labels declare (or one named
+// after the service). Labels set explicitly take precedence.
+func (s ServiceConfig) ContainerLabels() map[string]string {
+	traefikService := s.Name
+	declared := make(map[string]bool)
+	for k := range s.Labels {
+		if strings.HasPrefix(k, "traefik.http.services.") {
+			declared[strings.Split(strings.TrimPrefix(k, "traefik.http.services."), ".")[0]] = true
+		}
+	}
+	if len(declared) == 1 {
+		for name := range declared {
+			traefikService = name
+		}
+	}
+
+	labels := BuildLoadBalancerLabels(traefikService, s.LoadBalancer)
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
 // TraefikLabelOptions configures Traefik label generation
 type TraefikLabelOptions struct {
 	RouterName string
@@ -225,5 +302,6 @@ type TraefikLabelOptions struct {
 	TLS        bool
 	Middlewares []string
 	Port       string
+	LoadBalancer *LoadBalancerConfig
 }
 
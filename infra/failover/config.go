@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"time"
 )
 
 // MigrationConfig represents migration rules loaded from configuration
@@ -29,13 +28,7 @@ func LoadMigrationRules(configPath string) ([]MigrationRule, error) {
 
 			// Validate and set defaults for rules
 			for i := range config.Rules {
-				rule := &config.Rules[i]
-				if rule.MaxRetries == 0 {
-					rule.MaxRetries = 3
-				}
-				if rule.RetryDelay == 0 {
-					rule.RetryDelay = 30 * time.Second
-				}
+				config.Rules[i] = config.Rules[i].withDefaults()
 			}
 
 			return config.Rules, nil
@@ -52,13 +45,7 @@ func LoadMigrationRules(configPath string) ([]MigrationRule, error) {
 
 		// Validate and set defaults
 		for i := range config.Rules {
-			rule := &config.Rules[i]
-			if rule.MaxRetries == 0 {
-				rule.MaxRetries = 3
-			}
-			if rule.RetryDelay == 0 {
-				rule.RetryDelay = 30 * time.Second
-			}
+			config.Rules[i] = config.Rules[i].withDefaults()
 		}
 
 		return config.Rules, nil
@@ -67,3 +54,14 @@ func LoadMigrationRules(configPath string) ([]MigrationRule, error) {
 	// Return empty rules if no configuration found
 	return []MigrationRule{}, nil
 }
+
+// withDefaults returns the rule with the retry settings it leaves unset filled in
+func (rule MigrationRule) withDefaults() MigrationRule {
+	if rule.MaxRetries == 0 {
+		rule.MaxRetries = defaultMaxRetries
+	}
+	if rule.RetryDelay == 0 {
+		rule.RetryDelay = defaultRetryDelay
+	}
+	return rule
+}
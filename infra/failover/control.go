@@ -0,0 +1,506 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"cluster/infra/cluster/raft"
+)
+
+var (
+	// ErrMigrationNotFound is returned when no migration exists for a service
+	ErrMigrationNotFound = errors.New("migration not found")
+	// ErrMigrationNotActive is returned when cancelling a migration that already finished
+	ErrMigrationNotActive = errors.New("migration is not in progress")
+	// ErrRollbackNotAllowed is returned when a migration is in a state that cannot be rolled back
+	ErrRollbackNotAllowed = errors.New("migration cannot be rolled back in its current state")
+	// ErrNotSourceNode is returned when a migration is owned by another node's agent
+	ErrNotSourceNode = errors.New("migration is managed by another node")
+)
+
+// cancelWaitTimeout bounds how long CancelMigration waits for the migration to stop
+const cancelWaitTimeout = 60 * time.Second
+
+// migrationHandle controls a running migration goroutine
+type migrationHandle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// MigrationEvent describes a migration status change
+type MigrationEvent struct {
+	Type        string // "migration_" + status, e.g. "migration_cancelled"
+	MigrationID string
+	ServiceName string
+	SourceNode  string
+	TargetNode  string
+	Status      MigrationStatus
+	Message     string
+	Timestamp   time.Time
+}
+
+// SetEventHandler registers a callback invoked on every migration status change
+func (mm *MigrationManager) SetEventHandler(handler func(MigrationEvent)) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.eventHandler = handler
+}
+
+// emit delivers an event to the registered handler, if any
+func (mm *MigrationManager) emit(event MigrationEvent) {
+	mm.mu.RLock()
+	handler := mm.eventHandler
+	mm.mu.RUnlock()
+
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// lookupMigration returns the latest migration for a service, preferring the
+// local in-memory migration and adopting stored records this node controls.
+// Returns ErrNotSourceNode along with the migration when another node controls it.
+func (mm *MigrationManager) lookupMigration(serviceName string) (*Migration, error) {
+	var latest *raft.MigrationRecord
+	if records, _ := mm.ListMigrationHistory(raft.MigrationFilter{ServiceName: serviceName, Limit: 1}); len(records) > 0 {
+		latest = records[0]
+	}
+
+	mm.mu.Lock()
+	local, exists := mm.migrations[serviceName]
+	if exists && (latest == nil || latest.ID == local.ID || !latest.StartedAt.After(local.StartedAt)) {
+		mm.mu.Unlock()
+		return local, nil
+	}
+	if latest == nil {
+		mm.mu.Unlock()
+		return nil, ErrMigrationNotFound
+	}
+
+	migration := migrationFromRecord(latest)
+	if mm.ControlNode(migration) != mm.nodeName {
+		mm.mu.Unlock()
+		return migration, ErrNotSourceNode
+	}
+
+	// Record written by this node before a restart, or left by an agent that is down
+	mm.migrations[serviceName] = migration
+	mm.mu.Unlock()
+	return migration, nil
+}
+
+// ControlNode returns the node whose agent cancels and rolls back a migration: the
+// agent running it, else its source node, else any agent when both are down
+func (mm *MigrationManager) ControlNode(migration *Migration) string {
+	if runner := migration.Runner(); mm.nodeAlive(runner) {
+		return runner
+	}
+	if mm.nodeAlive(migration.SourceNode) {
+		return migration.SourceNode
+	}
+	return mm.nodeName
+}
+
+// CancelMigration stops an in-flight migration and removes any container it created on the target
+func (mm *MigrationManager) CancelMigration(serviceName string) (*Migration, error) {
+	migration, err := mm.lookupMigration(serviceName)
+	if err != nil {
+		return migration, err
+	}
+
+	mm.mu.Lock()
+	if migration.Status != MigrationStatusPending && migration.Status != MigrationStatusRunning {
+		mm.mu.Unlock()
+		return nil, ErrMigrationNotActive
+	}
+	handle, running := mm.handles[serviceName]
+	migration.cancelRequested = true
+	mm.mu.Unlock()
+
+	if !running {
+		// Record left active by an agent that restarted or went down mid-migration
+		mm.cancelAbandoned(migration)
+		return mm.snapshot(migration), nil
+	}
+
+	handle.cancel()
+	select {
+	case <-handle.done:
+	case <-time.After(cancelWaitTimeout):
+		return nil, fmt.Errorf("timed out waiting for migration of %s to stop", serviceName)
+	}
+
+	return mm.snapshot(migration), nil
+}
+
+// finishCancel removes the target container of a cancelled migration, restarts a source
+// stopped for the final volume sync and records the cancellation
+func (mm *MigrationManager) finishCancel(migration *Migration, run *migrationRun) {
+	if run.target != nil && run.targetContainerID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		mm.beginStep(migration, "remove_target")
+		err := run.target.RemoveContainer(ctx, run.targetContainerID)
+		mm.endStep(migration, "remove_target", err)
+		if err != nil {
+			log.Printf("Warning: Failed to remove target container %s after cancelling migration of %s: %v", run.targetContainerID, migration.ServiceName, err)
+		} else {
+			run.targetContainerID = ""
+		}
+	}
+
+	mm.restartSource(migration, run)
+
+	mm.transition(migration, MigrationStatusCancelled, "cancelled via API")
+	log.Printf("Migration of %s cancelled", migration.ServiceName)
+}
+
+// cancelAbandoned cancels a migration no agent runs anymore: it removes what the migration
+// created on the target and has the source container started again, by the source agent
+// once it is back when the source node is down
+func (mm *MigrationManager) cancelAbandoned(migration *Migration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	mm.mu.RLock()
+	sourceNode := migration.SourceNode
+	sourceContainerID := migration.SourceContainerID
+	targetNode := migration.TargetNode
+	targetContainerID := migration.TargetContainerID
+	mm.mu.RUnlock()
+
+	message := "cancelled via API (migration was not running)"
+	if targetContainerID != "" {
+		mm.beginStep(migration, "remove_target")
+		err := mm.removeRemoteContainer(ctx, targetNode, targetContainerID)
+		mm.endStep(migration, "remove_target", err)
+		if err != nil {
+			log.Printf("Warning: Failed to remove target container %s on %s after cancelling migration of %s: %v", targetContainerID, targetNode, migration.ServiceName, err)
+		}
+	}
+
+	switch {
+	case sourceContainerID == "":
+	case sourceNode != mm.nodeName:
+		mm.mu.Lock()
+		migration.PendingAction = raft.PendingRestartSource
+		mm.mu.Unlock()
+		message = fmt.Sprintf("cancelled via API (migration was not running), source container restarts when %s is back", sourceNode)
+	case mm.dockerClient != nil:
+		mm.beginStep(migration, "restart_source")
+		err := mm.dockerClient.ContainerStart(ctx, sourceContainerID, types.ContainerStartOptions{})
+		mm.endStep(migration, "restart_source", err)
+		if err != nil {
+			log.Printf("Warning: Failed to restart source container %s: %v", sourceContainerID, err)
+		}
+	}
+
+	mm.transition(migration, MigrationStatusCancelled, message)
+}
+
+// RollbackMigration restarts the source container and removes the target container.
+// In-flight migrations are cancelled first. When the source node is down the rollback
+// is recorded and carried out by its agent once it is back.
+func (mm *MigrationManager) RollbackMigration(ctx context.Context, serviceName string) (*Migration, error) {
+	migration, err := mm.lookupMigration(serviceName)
+	if err != nil {
+		return migration, err
+	}
+
+	mm.mu.RLock()
+	status := migration.Status
+	mm.mu.RUnlock()
+
+	switch status {
+	case MigrationStatusPending, MigrationStatusRunning:
+		if _, err := mm.CancelMigration(serviceName); err != nil && !errors.Is(err, ErrMigrationNotActive) {
+			return nil, fmt.Errorf("failed to cancel migration before rollback: %w", err)
+		}
+	case MigrationStatusCompleted, MigrationStatusFailed, MigrationStatusCancelled:
+	default:
+		return nil, ErrRollbackNotAllowed
+	}
+
+	mm.mu.RLock()
+	sourceNode := migration.SourceNode
+	mm.mu.RUnlock()
+
+	if sourceNode != mm.nodeName {
+		mm.mu.Lock()
+		migration.PendingAction = raft.PendingRollback
+		mm.mu.Unlock()
+		mm.annotate(migration, fmt.Sprintf("rollback requested via API, runs when %s is back", sourceNode))
+		log.Printf("Rollback of %s deferred until %s is back", serviceName, sourceNode)
+		return mm.snapshot(migration), nil
+	}
+
+	return mm.rollback(ctx, migration)
+}
+
+// rollback restarts the source container on this node and removes the target container
+func (mm *MigrationManager) rollback(ctx context.Context, migration *Migration) (*Migration, error) {
+	if mm.dockerClient == nil {
+		return nil, fmt.Errorf("Docker client not available")
+	}
+
+	mm.stopCleanup(migration.ID)
+
+	mm.mu.RLock()
+	sourceContainerID := migration.SourceContainerID
+	targetNode := migration.TargetNode
+	targetContainerID := migration.TargetContainerID
+	serviceName := migration.ServiceName
+	mm.mu.RUnlock()
+
+	if sourceContainerID == "" {
+		return nil, fmt.Errorf("migration of %s has no source container to restart", serviceName)
+	}
+
+	// Restart the source first so the service is served again before the target goes away
+	mm.beginStep(migration, "restart_source")
+	err := mm.dockerClient.ContainerStart(ctx, sourceContainerID, types.ContainerStartOptions{})
+	mm.endStep(migration, "restart_source", err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restart source container: %w", err)
+	}
+
+	message := "rolled back via API"
+	if targetContainerID != "" {
+		mm.beginStep(migration, "remove_target")
+		err := mm.removeRemoteContainer(ctx, targetNode, targetContainerID)
+		mm.endStep(migration, "remove_target", err)
+		if err != nil {
+			log.Printf("Warning: Failed to remove target container %s on %s during rollback: %v", targetContainerID, targetNode, err)
+			message = fmt.Sprintf("rolled back via API, target container not removed: %v", err)
+		}
+	}
+
+	mm.mu.Lock()
+	migration.CleanupAt = nil
+	migration.PendingAction = ""
+	mm.mu.Unlock()
+	mm.transition(migration, MigrationStatusRolledBack, message)
+
+	log.Printf("Migration of %s rolled back to %s", serviceName, migration.SourceNode)
+	return mm.snapshot(migration), nil
+}
+
+// removeRemoteContainer force-removes a container on another node through its agent
+func (mm *MigrationManager) removeRemoteContainer(ctx context.Context, nodeName, containerID string) error {
+	node, exists := mm.gossipState.GetNode(nodeName)
+	if !exists {
+		return fmt.Errorf("node %s not found in cluster", nodeName)
+	}
+
+	if err := mm.newTargetClient(node.TailscaleIP).RemoveContainer(ctx, containerID); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", containerID, err)
+	}
+	return nil
+}
+
+// scheduleCleanup persists the cleanup deadline and stops the source container once it passes.
+// The deadline is stored in the migration record so ResumeCleanups can reschedule it after a restart.
+func (mm *MigrationManager) scheduleCleanup(migration *Migration, deadline time.Time) {
+	mm.mu.Lock()
+	if _, scheduled := mm.cleanups[migration.ID]; scheduled {
+		mm.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	mm.cleanups[migration.ID] = cancel
+	migration.CleanupAt = &deadline
+	record := migration.toRecord()
+	mm.mu.Unlock()
+
+	mm.persist(record)
+
+	go mm.runCleanup(ctx, migration, deadline)
+}
+
+// stopCleanup cancels a scheduled source cleanup
+func (mm *MigrationManager) stopCleanup(migrationID string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if cancel, scheduled := mm.cleanups[migrationID]; scheduled {
+		cancel()
+		delete(mm.cleanups, migrationID)
+	}
+}
+
+// runCleanup waits for the deadline and stops the source container if the target is healthy
+func (mm *MigrationManager) runCleanup(ctx context.Context, migration *Migration, deadline time.Time) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+	defer mm.stopCleanup(migration.ID)
+
+	mm.mu.RLock()
+	serviceName := migration.ServiceName
+	targetNode := migration.TargetNode
+	containerID := migration.SourceContainerID
+	mm.mu.RUnlock()
+
+	// Grace period expired, verify target is still healthy
+	targetHealth, exists := mm.gossipState.GetServiceHealth(serviceName, targetNode)
+	if !exists || !targetHealth.Healthy {
+		log.Printf("Target health check failed, keeping source container %s for rollback", containerID)
+		mm.clearCleanup(migration, "target unhealthy at end of grace period, source container kept")
+		return
+	}
+
+	if mm.dockerClient == nil {
+		mm.clearCleanup(migration, "Docker client not available, source container not stopped")
+		return
+	}
+
+	log.Printf("Grace period expired and target is healthy, stopping source container %s", containerID)
+	stopCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stopTimeoutSeconds := 30
+	mm.beginStep(migration, "stop_source")
+	err := mm.dockerClient.ContainerStop(stopCtx, containerID, container.StopOptions{Timeout: &stopTimeoutSeconds})
+	mm.endStep(migration, "stop_source", err)
+	if err != nil {
+		log.Printf("Warning: Failed to stop source container %s: %v", containerID, err)
+		mm.clearCleanup(migration, fmt.Sprintf("failed to stop source container: %v", err))
+		return
+	}
+
+	log.Printf("Source container %s stopped successfully after grace period", containerID)
+	mm.clearCleanup(migration, "source container stopped")
+}
+
+// clearCleanup marks the source cleanup as finished and records the outcome
+func (mm *MigrationManager) clearCleanup(migration *Migration, message string) {
+	mm.mu.Lock()
+	migration.CleanupAt = nil
+	mm.mu.Unlock()
+
+	mm.annotate(migration, message)
+}
+
+// annotate records a message in a migration's history without changing its status
+func (mm *MigrationManager) annotate(migration *Migration, message string) {
+	mm.mu.Lock()
+	migration.Transitions = append(migration.Transitions, raft.MigrationTransition{
+		Status:  string(migration.Status),
+		Phase:   string(migration.Phase),
+		At:      time.Now(),
+		Message: message,
+	})
+	record := migration.toRecord()
+	mm.mu.Unlock()
+
+	mm.persist(record)
+}
+
+// ResumeCleanups reschedules source cleanups recorded by this node before a restart.
+// It is safe to call repeatedly; already scheduled cleanups are skipped.
+func (mm *MigrationManager) ResumeCleanups() {
+	records, _ := mm.ListMigrationHistory(raft.MigrationFilter{
+		NodeName: mm.nodeName,
+		Status:   string(MigrationStatusCompleted),
+	})
+
+	for _, record := range records {
+		if record.SourceNode != mm.nodeName || record.CleanupAt == nil || record.PendingAction != "" {
+			continue
+		}
+
+		mm.mu.Lock()
+		if _, scheduled := mm.cleanups[record.ID]; scheduled {
+			mm.mu.Unlock()
+			continue
+		}
+		migration, exists := mm.migrations[record.ServiceName]
+		if !exists || migration.ID != record.ID {
+			migration = migrationFromRecord(record)
+			if !exists || mm.migrations[record.ServiceName].StartedAt.Before(migration.StartedAt) {
+				mm.migrations[record.ServiceName] = migration
+			}
+		}
+		mm.mu.Unlock()
+
+		log.Printf("Resuming source cleanup for migration %s of %s (due %s)", record.ID, record.ServiceName, record.CleanupAt.Format(time.RFC3339))
+		mm.scheduleCleanup(migration, *record.CleanupAt)
+	}
+}
+
+// ResumePendingActions carries out what was left for this node while it was down: the
+// source container of a migration cancelled elsewhere is started again, and rollbacks
+// requested meanwhile are run. It is safe to call repeatedly.
+func (mm *MigrationManager) ResumePendingActions(ctx context.Context) {
+	if mm.dockerClient == nil {
+		return
+	}
+	records, _ := mm.ListMigrationHistory(raft.MigrationFilter{NodeName: mm.nodeName})
+
+	for _, record := range records {
+		if record.SourceNode != mm.nodeName || record.PendingAction == "" {
+			continue
+		}
+
+		mm.mu.Lock()
+		migration, exists := mm.migrations[record.ServiceName]
+		if !exists || migration.ID != record.ID {
+			migration = migrationFromRecord(record)
+			if !exists || mm.migrations[record.ServiceName].StartedAt.Before(migration.StartedAt) {
+				mm.migrations[record.ServiceName] = migration
+			}
+		}
+		mm.mu.Unlock()
+
+		switch record.PendingAction {
+		case raft.PendingRollback:
+			log.Printf("Running rollback of %s requested while this node was down", record.ServiceName)
+			if _, err := mm.rollback(ctx, migration); err != nil {
+				log.Printf("Warning: Failed to roll back migration %s of %s: %v", record.ID, record.ServiceName, err)
+			}
+		case raft.PendingRestartSource:
+			mm.beginStep(migration, "restart_source")
+			err := mm.dockerClient.ContainerStart(ctx, record.SourceContainerID, types.ContainerStartOptions{})
+			mm.endStep(migration, "restart_source", err)
+			if err != nil {
+				log.Printf("Warning: Failed to restart source container %s of cancelled migration %s: %v", record.SourceContainerID, record.ID, err)
+				continue
+			}
+			mm.mu.Lock()
+			migration.PendingAction = ""
+			mm.mu.Unlock()
+			mm.annotate(migration, "source container restarted")
+		default:
+			log.Printf("Warning: Unknown pending action %q on migration %s", record.PendingAction, record.ID)
+		}
+	}
+}
+
+// snapshot returns a copy of a migration taken under the manager lock
+func (mm *MigrationManager) snapshot(migration *Migration) *Migration {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	return migration.copy()
+}
+
+// isCancelRequested reports whether CancelMigration was called for a migration
+func (mm *MigrationManager) isCancelRequested(migration *Migration) bool {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	return migration.cancelRequested
+}
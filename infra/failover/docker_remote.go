@@ -2,13 +2,13 @@ package failover
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
-	"net/http"
 	"os"
-	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -20,80 +20,76 @@ import (
 	"github.com/docker/go-connections/nat"
 )
 
-// RemoteDockerClient provides access to Docker API on remote nodes via Tailscale network
-type RemoteDockerClient struct {
-	host       string
-	httpClient *http.Client
-	apiVersion string
-}
-
-// NewRemoteDockerClient creates a client for accessing Docker API on a remote node
-// host should be the Tailscale IP or hostname of the target node
-// dockerPort is typically 2375 for unencrypted or 2376 for TLS
-func NewRemoteDockerClient(host string, dockerPort int, useTLS bool) (*RemoteDockerClient, error) {
-	scheme := "http"
-	if useTLS {
-		scheme = "https"
-	}
-
-	// Default to port 2375 if not specified
-	if dockerPort == 0 {
-		dockerPort = 2375
-	}
-
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-		},
-	}
-
-	return &RemoteDockerClient{
-		host:       fmt.Sprintf("%s://%s:%d", scheme, host, dockerPort),
-		httpClient: httpClient,
-		apiVersion: "1.44",
-	}, nil
-}
+// ContainerSpecVersion is the version of the ContainerConfig format written by this
+// agent. Receivers reject newer versions rather than silently dropping fields they
+// do not know; version 0 is the original format without network endpoints and host options.
+const ContainerSpecVersion = 2
 
-// CreateClient creates a Docker client for the remote host
-func (rdc *RemoteDockerClient) CreateClient(ctx context.Context) (*client.Client, error) {
-	// Create client with custom HTTP client pointing to remote Docker daemon
-	cli, err := client.NewClientWithOpts(
-		client.WithHost(rdc.host),
-		client.WithHTTPClient(rdc.httpClient),
-		client.WithVersion(rdc.apiVersion),
-		client.WithAPIVersionNegotiation(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create remote Docker client: %w", err)
-	}
-
-	// Test connection
-	_, err = cli.Ping(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to ping remote Docker daemon: %w", err)
-	}
-
-	return cli, nil
-}
+// ErrUnsupportedSpecVersion is returned when a container spec is newer than this agent understands
+var ErrUnsupportedSpecVersion = errors.New("unsupported container spec version")
 
 // ContainerConfig holds the configuration needed to recreate a container
 type ContainerConfig struct {
+	Version       int
 	Name          string
 	Image         string
 	Command       []string
+	Entrypoint    []string
 	Env           []string
+	WorkingDir    string
+	User          string
+	Hostname      string // Empty when Docker generated it from the container ID
+	Domainname    string
+	Tty           bool
+	OpenStdin     bool
+	StopSignal    string
+	StopTimeout   *int
 	ExposedPorts  nat.PortSet
 	PortBindings  nat.PortMap
 	Mounts        []mount.Mount
 	Networks      []string
+	Endpoints     map[string]*EndpointSpec // network name -> endpoint settings
 	Labels        map[string]string
 	RestartPolicy container.RestartPolicy
 	Healthcheck   *container.HealthConfig
-	Resources     container.Resources
+	Resources     container.Resources // Includes ulimits and device mappings
+	Host          HostSpec
+}
+
+// EndpointSpec holds the settings of a container's attachment to one network
+type EndpointSpec struct {
+	Aliases     []string
+	IPv4Address string // Static address from the IPAM config, empty when assigned dynamically
+	IPv6Address string
+	Links       []string
+	DriverOpts  map[string]string
+}
+
+// HostSpec holds the host configuration options of a container beyond ports, mounts and resources
+type HostSpec struct {
+	NetworkMode    container.NetworkMode
+	IpcMode        container.IpcMode
+	PidMode        container.PidMode
+	UTSMode        container.UTSMode
+	UsernsMode     container.UsernsMode
+	LogConfig      container.LogConfig
+	Sysctls        map[string]string
+	CapAdd         []string
+	CapDrop        []string
+	Privileged     bool
+	SecurityOpt    []string
+	ReadonlyRootfs bool
+	ExtraHosts     []string
+	DNS            []string
+	DNSSearch      []string
+	DNSOptions     []string
+	GroupAdd       []string
+	Tmpfs          map[string]string
+	ShmSize        int64
+	Init           *bool
+	Runtime        string
+	OomScoreAdj    int
+	VolumesFrom    []string
 }
 
 // ExportContainerConfig extracts container configuration for migration
@@ -102,14 +98,23 @@ func ExportContainerConfig(ctx context.Context, cli *client.Client, containerID
 	if err != nil {
 		return nil, fmt.Errorf("failed to inspect container: %w", err)
 	}
+	return containerConfigFromInspect(inspect), nil
+}
 
+// containerConfigFromInspect builds a container spec from inspect output
+func containerConfigFromInspect(inspect types.ContainerJSON) *ContainerConfig {
 	// Convert types.MountPoint to mount.Mount
 	// types.MountPoint is a read-only view from ContainerInspect, so we extract basic info
 	mounts := make([]mount.Mount, 0, len(inspect.Mounts))
 	for _, mp := range inspect.Mounts {
+		source := mp.Source
+		if mp.Type == mount.TypeVolume {
+			// Named volumes are recreated by name on the target, not by their host path
+			source = mp.Name
+		}
 		mounts = append(mounts, mount.Mount{
 			Type:     mount.Type(mp.Type),
-			Source:   mp.Source,
+			Source:   source,
 			Target:   mp.Destination,
 			ReadOnly: !mp.RW,
 			// Note: MountPoint from inspect doesn't include BindOptions/VolumeOptions/TmpfsOptions
@@ -118,47 +123,211 @@ func ExportContainerConfig(ctx context.Context, cli *client.Client, containerID
 	}
 
 	config := &ContainerConfig{
-		Name:         inspect.Name,
-		Image:        inspect.Config.Image,
-		Command:      inspect.Config.Cmd,
-		Env:          inspect.Config.Env,
-		ExposedPorts: inspect.Config.ExposedPorts,
-		PortBindings: inspect.HostConfig.PortBindings,
-		Mounts:       mounts,
-		Labels:       inspect.Config.Labels,
-		RestartPolicy: container.RestartPolicy{
-			Name:              inspect.HostConfig.RestartPolicy.Name,
-			MaximumRetryCount: inspect.HostConfig.RestartPolicy.MaximumRetryCount,
-		},
-		Healthcheck: inspect.Config.Healthcheck,
-		Resources: container.Resources{
-			Memory:    inspect.HostConfig.Memory,
-			CPUShares: inspect.HostConfig.CPUShares,
-			CPUQuota:  inspect.HostConfig.CPUQuota,
-			CPUPeriod: inspect.HostConfig.CPUPeriod,
-		},
+		Version: ContainerSpecVersion,
+		Name:    inspect.Name,
+		Mounts:  mounts,
+	}
+
+	if cfg := inspect.Config; cfg != nil {
+		config.Image = cfg.Image
+		config.Command = cfg.Cmd
+		config.Entrypoint = cfg.Entrypoint
+		config.Env = cfg.Env
+		config.WorkingDir = cfg.WorkingDir
+		config.User = cfg.User
+		config.Domainname = cfg.Domainname
+		config.Tty = cfg.Tty
+		config.OpenStdin = cfg.OpenStdin
+		config.StopSignal = cfg.StopSignal
+		config.StopTimeout = cfg.StopTimeout
+		config.ExposedPorts = cfg.ExposedPorts
+		config.Labels = cfg.Labels
+		config.Healthcheck = cfg.Healthcheck
+		// Docker names containers after their short ID unless a hostname was set
+		if cfg.Hostname != shortID(inspect.ID) {
+			config.Hostname = cfg.Hostname
+		}
+	}
+
+	if hc := inspect.HostConfig; hc != nil {
+		config.PortBindings = hc.PortBindings
+		config.RestartPolicy = container.RestartPolicy{
+			Name:              hc.RestartPolicy.Name,
+			MaximumRetryCount: hc.RestartPolicy.MaximumRetryCount,
+		}
+		config.Resources = hc.Resources
+		config.Host = HostSpec{
+			NetworkMode:    hc.NetworkMode,
+			IpcMode:        hc.IpcMode,
+			PidMode:        hc.PidMode,
+			UTSMode:        hc.UTSMode,
+			UsernsMode:     hc.UsernsMode,
+			LogConfig:      hc.LogConfig,
+			Sysctls:        hc.Sysctls,
+			CapAdd:         hc.CapAdd,
+			CapDrop:        hc.CapDrop,
+			Privileged:     hc.Privileged,
+			SecurityOpt:    hc.SecurityOpt,
+			ReadonlyRootfs: hc.ReadonlyRootfs,
+			ExtraHosts:     hc.ExtraHosts,
+			DNS:            hc.DNS,
+			DNSSearch:      hc.DNSSearch,
+			DNSOptions:     hc.DNSOptions,
+			GroupAdd:       hc.GroupAdd,
+			Tmpfs:          hc.Tmpfs,
+			ShmSize:        hc.ShmSize,
+			Init:           hc.Init,
+			Runtime:        hc.Runtime,
+			OomScoreAdj:    hc.OomScoreAdj,
+			VolumesFrom:    hc.VolumesFrom,
+		}
 	}
 
-	// Extract network names
-	for netName := range inspect.NetworkSettings.Networks {
-		config.Networks = append(config.Networks, netName)
+	// Extract networks with their aliases and static addresses
+	if inspect.NetworkSettings != nil {
+		config.Endpoints = make(map[string]*EndpointSpec, len(inspect.NetworkSettings.Networks))
+		for netName, settings := range inspect.NetworkSettings.Networks {
+			config.Networks = append(config.Networks, netName)
+			config.Endpoints[netName] = endpointSpecFromSettings(inspect.ID, settings)
+		}
+		sort.Strings(config.Networks)
 	}
 
-	return config, nil
+	return config
 }
 
-// CreateContainerOnRemote creates a container on a remote node with the given configuration
-func CreateContainerOnRemote(ctx context.Context, remoteCli *client.Client, config *ContainerConfig) (string, error) {
+// endpointSpecFromSettings keeps the user-defined parts of a network endpoint
+func endpointSpecFromSettings(containerID string, settings *network.EndpointSettings) *EndpointSpec {
+	spec := &EndpointSpec{}
+	if settings == nil {
+		return spec
+	}
+	for _, alias := range settings.Aliases {
+		// Docker adds the short container ID as an alias; the new container gets its own
+		if alias != shortID(containerID) {
+			spec.Aliases = append(spec.Aliases, alias)
+		}
+	}
+	if settings.IPAMConfig != nil {
+		spec.IPv4Address = settings.IPAMConfig.IPv4Address
+		spec.IPv6Address = settings.IPAMConfig.IPv6Address
+	}
+	spec.Links = settings.Links
+	spec.DriverOpts = settings.DriverOpts
+	return spec
+}
+
+// endpointSettings converts an endpoint spec back to Docker's endpoint settings
+func (e *EndpointSpec) endpointSettings() *network.EndpointSettings {
+	settings := &network.EndpointSettings{}
+	if e == nil {
+		return settings
+	}
+	settings.Aliases = e.Aliases
+	settings.Links = e.Links
+	settings.DriverOpts = e.DriverOpts
+	if e.IPv4Address != "" || e.IPv6Address != "" {
+		settings.IPAMConfig = &network.EndpointIPAMConfig{
+			IPv4Address: e.IPv4Address,
+			IPv6Address: e.IPv6Address,
+		}
+	}
+	return settings
+}
+
+// PortabilityIssues returns the parts of the spec that cannot be reproduced on another
+// node, such as host networking or host devices. A container with issues is not migrated.
+func (c *ContainerConfig) PortabilityIssues() []string {
+	var issues []string
+	host := c.Host
+	if host.NetworkMode.IsHost() {
+		issues = append(issues, "uses host networking (network_mode: host)")
+	}
+	if host.NetworkMode.IsContainer() {
+		issues = append(issues, fmt.Sprintf("shares the network of container %s", host.NetworkMode.ConnectedContainer()))
+	}
+	if host.IpcMode.IsContainer() {
+		issues = append(issues, fmt.Sprintf("shares the IPC namespace of container %s", host.IpcMode.Container()))
+	}
+	if host.PidMode.IsContainer() {
+		issues = append(issues, fmt.Sprintf("shares the PID namespace of container %s", host.PidMode.Container()))
+	}
+	if len(host.VolumesFrom) > 0 {
+		issues = append(issues, fmt.Sprintf("mounts volumes from containers: %s", strings.Join(host.VolumesFrom, ", ")))
+	}
+	if len(c.Resources.Devices) > 0 {
+		devices := make([]string, 0, len(c.Resources.Devices))
+		for _, device := range c.Resources.Devices {
+			devices = append(devices, device.PathOnHost)
+		}
+		issues = append(issues, fmt.Sprintf("uses host devices: %s", strings.Join(devices, ", ")))
+	}
+	if len(c.Resources.DeviceRequests) > 0 {
+		issues = append(issues, "requests host devices (e.g. GPUs)")
+	}
+	if len(c.Resources.BlkioWeightDevice) > 0 || len(c.Resources.BlkioDeviceReadBps) > 0 ||
+		len(c.Resources.BlkioDeviceWriteBps) > 0 || len(c.Resources.BlkioDeviceReadIOps) > 0 ||
+		len(c.Resources.BlkioDeviceWriteIOps) > 0 {
+		issues = append(issues, "sets I/O limits on host block devices")
+	}
+	for _, netName := range c.Networks {
+		if endpoint := c.Endpoints[netName]; endpoint != nil && len(endpoint.Links) > 0 {
+			issues = append(issues, fmt.Sprintf("uses legacy links on network %s: %s", netName, strings.Join(endpoint.Links, ", ")))
+		}
+	}
+	return issues
+}
+
+// checkSpecVersion rejects specs written by a newer agent, whose extra fields would be lost
+func checkSpecVersion(config *ContainerConfig) error {
+	if config.Version > ContainerSpecVersion {
+		return fmt.Errorf("%w: %d (this agent supports up to %d)", ErrUnsupportedSpecVersion, config.Version, ContainerSpecVersion)
+	}
+	return nil
+}
+
+// primaryNetwork returns the network the container is created on; the others are
+// connected after creation, since older Docker APIs accept only one network at create
+func (c *ContainerConfig) primaryNetwork() string {
+	if mode := string(c.Host.NetworkMode); mode != "" {
+		for _, netName := range c.Networks {
+			if netName == mode {
+				return netName
+			}
+		}
+	}
+	if len(c.Networks) > 0 {
+		return c.Networks[0]
+	}
+	return ""
+}
+
+// CreateContainerFromConfig creates a container with the given configuration
+func CreateContainerFromConfig(ctx context.Context, cli *client.Client, config *ContainerConfig) (string, error) {
+	if err := checkSpecVersion(config); err != nil {
+		return "", err
+	}
+
 	// Create container configuration
 	containerConfig := &container.Config{
 		Image:        config.Image,
 		Cmd:          config.Command,
+		Entrypoint:   config.Entrypoint,
 		Env:          config.Env,
+		WorkingDir:   config.WorkingDir,
+		User:         config.User,
+		Hostname:     config.Hostname,
+		Domainname:   config.Domainname,
+		Tty:          config.Tty,
+		OpenStdin:    config.OpenStdin,
+		StopSignal:   config.StopSignal,
+		StopTimeout:  config.StopTimeout,
 		ExposedPorts: config.ExposedPorts,
 		Labels:       config.Labels,
 		Healthcheck:  config.Healthcheck,
 	}
 
+	host := config.Host
 	hostConfig := &container.HostConfig{
 		PortBindings: config.PortBindings,
 		Mounts:       config.Mounts,
@@ -166,60 +335,85 @@ func CreateContainerOnRemote(ctx context.Context, remoteCli *client.Client, conf
 			Name:              config.RestartPolicy.Name,
 			MaximumRetryCount: config.RestartPolicy.MaximumRetryCount,
 		},
-		Resources: config.Resources,
+		Resources:      config.Resources,
+		NetworkMode:    host.NetworkMode,
+		IpcMode:        host.IpcMode,
+		PidMode:        host.PidMode,
+		UTSMode:        host.UTSMode,
+		UsernsMode:     host.UsernsMode,
+		LogConfig:      host.LogConfig,
+		Sysctls:        host.Sysctls,
+		CapAdd:         host.CapAdd,
+		CapDrop:        host.CapDrop,
+		Privileged:     host.Privileged,
+		SecurityOpt:    host.SecurityOpt,
+		ReadonlyRootfs: host.ReadonlyRootfs,
+		ExtraHosts:     host.ExtraHosts,
+		DNS:            host.DNS,
+		DNSSearch:      host.DNSSearch,
+		DNSOptions:     host.DNSOptions,
+		GroupAdd:       host.GroupAdd,
+		Tmpfs:          host.Tmpfs,
+		ShmSize:        host.ShmSize,
+		Init:           host.Init,
+		Runtime:        host.Runtime,
+		OomScoreAdj:    host.OomScoreAdj,
 	}
 
 	// Create network configuration
 	networkingConfig := &network.NetworkingConfig{
 		EndpointsConfig: make(map[string]*network.EndpointSettings),
 	}
-	for _, netName := range config.Networks {
-		networkingConfig.EndpointsConfig[netName] = &network.EndpointSettings{}
+	primary := config.primaryNetwork()
+	if primary != "" {
+		networkingConfig.EndpointsConfig[primary] = config.Endpoints[primary].endpointSettings()
+		if hostConfig.NetworkMode == "" {
+			hostConfig.NetworkMode = container.NetworkMode(primary)
+		}
 	}
 
 	// Create the container
-	createResp, err := remoteCli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, config.Name)
+	createResp, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, config.Name)
 	if err != nil {
-		return "", fmt.Errorf("failed to create container on remote node: %w", err)
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+
+	for _, netName := range config.Networks {
+		if netName == primary {
+			continue
+		}
+		if err := cli.NetworkConnect(ctx, netName, createResp.ID, config.Endpoints[netName].endpointSettings()); err != nil {
+			// A half-attached container would run with missing aliases or addresses
+			if removeErr := cli.ContainerRemove(ctx, createResp.ID, types.ContainerRemoveOptions{Force: true}); removeErr != nil {
+				log.Printf("Warning: Failed to remove container %s after network error: %v", createResp.ID, removeErr)
+			}
+			return "", fmt.Errorf("failed to connect container to network %s: %w", netName, err)
+		}
 	}
 
 	return createResp.ID, nil
 }
 
-// TransferVolumes transfers volume data from source to target node via Tailscale network
-// Uses docker cp to export volumes, transfers via tar over HTTP, and extracts on target
-// targetNodeIP is provided for potential SSH fallback or network diagnostics (Docker API is primary method)
-func TransferVolumes(ctx context.Context, sourceCli *client.Client, targetCli *client.Client, containerID string, volumes []mount.Mount, targetNodeIP string) error {
+// TransferVolumes transfers volume data from the source container to the target node.
+// Each bind mount or named volume is archived from the (stopped or running) source
+// container through the local Docker API, staged to a temporary file, uploaded with
+// resume support and extracted by the target agent.
+func TransferVolumes(ctx context.Context, sourceCli *client.Client, target *TargetClient, containerID string, volumes []mount.Mount, uploadPrefix string) error {
 	if len(volumes) == 0 {
 		return nil
 	}
 
 	log.Printf("Transferring %d volume(s) from source to target node", len(volumes))
 
-	for _, vol := range volumes {
-		// Skip volumes that don't need transfer (tmpfs, etc.)
-		if vol.Type != mount.TypeBind && vol.Type != mount.TypeVolume {
+	for i, vol := range volumes {
+		if !isTransferableMount(vol) {
 			log.Printf("Skipping volume %s (type: %s, not transferable)", vol.Target, vol.Type)
 			continue
 		}
 
-		// For bind mounts, we need to transfer the host path
-		// For named volumes, we need to copy from container
-		if vol.Type == mount.TypeBind {
-			if vol.Source == "" {
-				log.Printf("Warning: Bind mount %s has no source, skipping", vol.Target)
-				continue
-			}
-
-			// Transfer bind mount directory (uses temporary containers for host path access)
-			if err := transferBindMount(ctx, sourceCli, targetCli, containerID, vol, targetNodeIP); err != nil {
-				return fmt.Errorf("failed to transfer bind mount %s: %w", vol.Target, err)
-			}
-		} else if vol.Type == mount.TypeVolume {
-			// Transfer named volume data from container
-			if err := transferContainerVolume(ctx, sourceCli, targetCli, containerID, vol); err != nil {
-				return fmt.Errorf("failed to transfer volume %s: %w", vol.Target, err)
-			}
+		uploadID := fmt.Sprintf("%s-%d", uploadPrefix, i)
+		if err := transferVolume(ctx, sourceCli, target, containerID, vol, uploadID); err != nil {
+			return fmt.Errorf("failed to transfer volume %s: %w", vol.Target, err)
 		}
 	}
 
@@ -227,140 +421,34 @@ func TransferVolumes(ctx context.Context, sourceCli *client.Client, targetCli *c
 	return nil
 }
 
-// transferBindMount transfers a bind mount directory from source to target node
-func transferBindMount(ctx context.Context, sourceCli *client.Client, targetCli *client.Client, containerID string, vol mount.Mount, targetNodeIP string) error {
-	log.Printf("Transferring bind mount: %s -> %s", vol.Source, vol.Target)
-
-	// Create tar archive of source directory
-	// CopyFromContainer returns (io.ReadCloser, types.ContainerPathStat, error)
-	tarReader, stat, err := sourceCli.CopyFromContainer(ctx, containerID, vol.Source)
-	if err != nil {
-		// If CopyFromContainer fails (e.g., path doesn't exist in container),
-		// it's likely a bind mount to host path - use temporary container approach
-		log.Printf("Path not found in container, treating as host bind mount: %s", vol.Source)
-		return transferHostPath(ctx, vol.Source, vol.Target, sourceCli, targetCli, targetNodeIP)
-	}
-	_ = stat // Stat information available but not needed for transfer
-	defer tarReader.Close()
-
-	// Path exists in container, transfer normally
-	return extractTarToTarget(ctx, tarReader, vol.Target, targetCli, containerID)
-}
-
-// transferContainerVolume transfers volume data from container to target node
-func transferContainerVolume(ctx context.Context, sourceCli *client.Client, targetCli *client.Client, containerID string, vol mount.Mount) error {
-	log.Printf("Transferring container volume: %s", vol.Target)
-
-	// Copy volume data from container
-	// CopyFromContainer returns (io.ReadCloser, types.ContainerPathStat, error)
-	tarReader, stat, err := sourceCli.CopyFromContainer(ctx, containerID, vol.Target)
-	if err != nil {
-		return fmt.Errorf("failed to copy volume from container: %w", err)
-	}
-	_ = stat // Stat information available but not needed for transfer
-	defer tarReader.Close()
-
-	// Transfer and extract on target
-	return extractTarToTarget(ctx, tarReader, vol.Target, targetCli, containerID)
+// isTransferableMount reports whether a mount holds data that moves with the container
+// (bind mounts and volumes; tmpfs mounts and mounts without a source are skipped)
+func isTransferableMount(vol mount.Mount) bool {
+	return (vol.Type == mount.TypeBind || vol.Type == mount.TypeVolume) && vol.Source != ""
 }
 
-// transferHostPath transfers a host path directly using temporary containers and Docker API
-// This is used when CopyFromContainer fails (e.g., path is on host, not in container)
-// Uses a temporary container on source to access host path, transfers via Docker API,
-// and uses a temporary container on target to extract to host path
-func transferHostPath(ctx context.Context, sourcePath, targetPath string, sourceCli, targetCli *client.Client, targetNodeIP string) error {
-	// For bind mounts, the source path is on the host filesystem
-	// We use temporary containers to access host filesystem on both source and target
-
-	// Check if source path exists
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-		return fmt.Errorf("source path does not exist: %s", sourcePath)
-	}
-
-	log.Printf("Transferring host path %s to %s using temporary containers", sourcePath, targetPath)
-
-	// Step 1: Create temporary container on source node to access host path
-	// Use a minimal image that has tar (busybox or alpine)
-	tempSourceContainerName := fmt.Sprintf("volume-transfer-source-%d", time.Now().UnixNano())
-
-	// Create container config with host path mounted
-	sourceContainerConfig := &container.Config{
-		Image: "busybox:latest",
-		Cmd:   []string{"sleep", "3600"}, // Keep container running
-	}
-
-	sourceHostConfig := &container.HostConfig{
-		Binds:      []string{fmt.Sprintf("%s:/source:ro", sourcePath)},
-		AutoRemove: false, // Manual removal via defer ensures proper cleanup
-	}
-
-	// Create and start temporary source container
-	sourceCreateResp, err := sourceCli.ContainerCreate(ctx, sourceContainerConfig, sourceHostConfig, nil, nil, tempSourceContainerName)
-	if err != nil {
-		// If busybox not available, try alpine
-		sourceContainerConfig.Image = "alpine:latest"
-		sourceCreateResp, err = sourceCli.ContainerCreate(ctx, sourceContainerConfig, sourceHostConfig, nil, nil, tempSourceContainerName)
-		if err != nil {
-			return fmt.Errorf("failed to create temporary source container: %w", err)
+// hasTransferableMounts reports whether any mount needs its data transferred
+func hasTransferableMounts(mounts []mount.Mount) bool {
+	for _, vol := range mounts {
+		if isTransferableMount(vol) {
+			return true
 		}
 	}
+	return false
+}
 
-	if err := sourceCli.ContainerStart(ctx, sourceCreateResp.ID, types.ContainerStartOptions{}); err != nil {
-		sourceCli.ContainerRemove(ctx, sourceCreateResp.ID, types.ContainerRemoveOptions{Force: true})
-		return fmt.Errorf("failed to start temporary source container: %w", err)
-	}
-	defer func() {
-		sourceCli.ContainerStop(ctx, sourceCreateResp.ID, container.StopOptions{})
-		sourceCli.ContainerRemove(ctx, sourceCreateResp.ID, types.ContainerRemoveOptions{Force: true})
-	}()
+// transferVolume archives one mount from the source container and commits it on the target
+func transferVolume(ctx context.Context, sourceCli *client.Client, target *TargetClient, containerID string, vol mount.Mount, uploadID string) error {
+	log.Printf("Transferring %s volume %s (%s)", vol.Type, vol.Source, vol.Target)
 
-	// Step 2: Export data from temporary source container
-	log.Printf("Exporting data from temporary source container")
-	tarReader, _, err := sourceCli.CopyFromContainer(ctx, sourceCreateResp.ID, "/source")
+	// CopyFromContainer reads through the container's mounts, so no helper container is needed
+	tarReader, _, err := sourceCli.CopyFromContainer(ctx, containerID, vol.Target)
 	if err != nil {
-		return fmt.Errorf("failed to copy from temporary source container: %w", err)
+		return fmt.Errorf("failed to archive %s from container: %w", vol.Target, err)
 	}
 	defer tarReader.Close()
 
-	// Step 3: Create temporary container on target node to receive data
-	tempTargetContainerName := fmt.Sprintf("volume-transfer-target-%d", time.Now().UnixNano())
-
-	// Ensure target directory exists on host (create parent if needed)
-	targetDir := filepath.Dir(targetPath)
-
-	// Create container config with target path mounted
-	targetContainerConfig := &container.Config{
-		Image: "busybox:latest",
-		Cmd:   []string{"sleep", "3600"},
-	}
-
-	targetHostConfig := &container.HostConfig{
-		Binds:      []string{fmt.Sprintf("%s:/target", targetDir)},
-		AutoRemove: false,
-	}
-
-	// Create and start temporary target container
-	targetCreateResp, err := targetCli.ContainerCreate(ctx, targetContainerConfig, targetHostConfig, nil, nil, tempTargetContainerName)
-	if err != nil {
-		// If busybox not available, try alpine
-		targetContainerConfig.Image = "alpine:latest"
-		targetCreateResp, err = targetCli.ContainerCreate(ctx, targetContainerConfig, targetHostConfig, nil, nil, tempTargetContainerName)
-		if err != nil {
-			return fmt.Errorf("failed to create temporary target container: %w", err)
-		}
-	}
-
-	if err := targetCli.ContainerStart(ctx, targetCreateResp.ID, types.ContainerStartOptions{}); err != nil {
-		targetCli.ContainerRemove(ctx, targetCreateResp.ID, types.ContainerRemoveOptions{Force: true})
-		return fmt.Errorf("failed to start temporary target container: %w", err)
-	}
-	defer func() {
-		targetCli.ContainerStop(ctx, targetCreateResp.ID, container.StopOptions{})
-		targetCli.ContainerRemove(ctx, targetCreateResp.ID, types.ContainerRemoveOptions{Force: true})
-	}()
-
-	// Step 4: Transfer tar data to temporary target container
-	log.Printf("Transferring data to temporary target container")
+	// Stage locally so an interrupted upload can resume from the target's offset
 	tmpFile, err := os.CreateTemp("", "volume-transfer-*.tar")
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
@@ -368,161 +456,32 @@ func transferHostPath(ctx context.Context, sourcePath, targetPath string, source
 	defer os.Remove(tmpFile.Name())
 	defer tmpFile.Close()
 
-	// Write tar data to temp file
-	if _, err := io.Copy(tmpFile, tarReader); err != nil {
-		return fmt.Errorf("failed to write tar data: %w", err)
-	}
-	tmpFile.Close()
-
-	// Copy tar file into target container
-	tarFile, err := os.Open(tmpFile.Name())
+	size, err := io.Copy(tmpFile, tarReader)
 	if err != nil {
-		return fmt.Errorf("failed to reopen temp file: %w", err)
-	}
-	defer tarFile.Close()
-
-	tarPathInContainer := "/tmp/volume-transfer.tar"
-	copyOpts := types.CopyToContainerOptions{
-		AllowOverwriteDirWithFile: true,
-	}
-	if err := targetCli.CopyToContainer(ctx, targetCreateResp.ID, tarPathInContainer, tarFile, copyOpts); err != nil {
-		return fmt.Errorf("failed to copy tar to target container: %w", err)
-	}
-
-	// Step 5: Extract tar in target container to mounted host path
-	log.Printf("Extracting data to target path %s", targetPath)
-	baseName := filepath.Base(targetPath)
-	extractCmd := []string{
-		"sh", "-c",
-		fmt.Sprintf("cd /target && tar -xzf %s && mv %s %s 2>/dev/null || true", tarPathInContainer, baseName, baseName),
-	}
-
-	execConfig := types.ExecConfig{
-		Cmd:          extractCmd,
-		AttachStdout: true,
-		AttachStderr: true,
-	}
-
-	execResp, err := targetCli.ContainerExecCreate(ctx, targetCreateResp.ID, execConfig)
-	if err != nil {
-		return fmt.Errorf("failed to create exec: %w", err)
-	}
-
-	attachResp, err := targetCli.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{})
-	if err != nil {
-		return fmt.Errorf("failed to attach to exec: %w", err)
-	}
-	defer attachResp.Close()
-
-	// Wait for extraction to complete
-	inspectResp, err := targetCli.ContainerExecInspect(ctx, execResp.ID)
-	if err != nil {
-		return fmt.Errorf("failed to inspect exec: %w", err)
-	}
-
-	if inspectResp.ExitCode != 0 {
-		output, _ := io.ReadAll(attachResp.Reader)
-		return fmt.Errorf("tar extraction failed (exit code %d): %s", inspectResp.ExitCode, string(output))
-	}
-
-	// Clean up temp tar file in container
-	cleanupCmd := []string{"rm", "-f", tarPathInContainer}
-	cleanupExecConfig := types.ExecConfig{
-		Cmd: cleanupCmd,
-	}
-	cleanupExecResp, err := targetCli.ContainerExecCreate(ctx, targetCreateResp.ID, cleanupExecConfig)
-	if err == nil {
-		targetCli.ContainerExecAttach(ctx, cleanupExecResp.ID, types.ExecStartCheck{})
-	}
-
-	log.Printf("Successfully transferred host path %s to %s", sourcePath, targetPath)
-	return nil
-}
-
-// extractTarToTarget extracts tar archive to target container
-func extractTarToTarget(ctx context.Context, tarReader io.Reader, targetPath string, targetCli *client.Client, containerID string) error {
-	// Create a temporary file to store tar data
-	tmpFile, err := os.CreateTemp("", "volume-transfer-*.tar")
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
-
-	// Write tar data to temp file
-	if _, err := io.Copy(tmpFile, tarReader); err != nil {
 		return fmt.Errorf("failed to write tar data: %w", err)
 	}
-
-	// Close file before copying
 	tmpFile.Close()
 
-	// Copy tar file into target container
-	tarFile, err := os.Open(tmpFile.Name())
-	if err != nil {
-		return fmt.Errorf("failed to reopen temp file: %w", err)
+	if err := target.UploadFile(ctx, uploadID, tmpFile.Name()); err != nil {
+		return err
 	}
-	defer tarFile.Close()
 
-	// Use docker cp to copy tar into container
-	// We need to copy to a temp location first, then extract
-	copyOpts := types.CopyToContainerOptions{
-		AllowOverwriteDirWithFile: true,
-	}
-
-	// Copy tar to /tmp in container
-	tarPathInContainer := "/tmp/volume-transfer.tar"
-	if err := targetCli.CopyToContainer(ctx, containerID, tarPathInContainer, tarFile, copyOpts); err != nil {
-		return fmt.Errorf("failed to copy tar to container: %w", err)
-	}
-
-	// Extract tar in container using docker exec
-	extractCmd := []string{"tar", "-xzf", tarPathInContainer, "-C", filepath.Dir(targetPath), "--strip-components=0"}
-	execConfig := types.ExecConfig{
-		Cmd:          extractCmd,
-		AttachStdout: true,
-		AttachStderr: true,
-	}
-
-	execResp, err := targetCli.ContainerExecCreate(ctx, containerID, execConfig)
-	if err != nil {
-		return fmt.Errorf("failed to create exec: %w", err)
-	}
-
-	attachResp, err := targetCli.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{})
-	if err != nil {
-		return fmt.Errorf("failed to attach to exec: %w", err)
-	}
-	defer attachResp.Close()
-
-	// Wait for extraction to complete
-	inspectResp, err := targetCli.ContainerExecInspect(ctx, execResp.ID)
-	if err != nil {
-		return fmt.Errorf("failed to inspect exec: %w", err)
-	}
-
-	if inspectResp.ExitCode != 0 {
-		// Read error output
-		output, _ := io.ReadAll(attachResp.Reader)
-		return fmt.Errorf("tar extraction failed (exit code %d): %s", inspectResp.ExitCode, string(output))
-	}
-
-	// Clean up temp tar file in container
-	cleanupCmd := []string{"rm", "-f", tarPathInContainer}
-	cleanupExecConfig := types.ExecConfig{
-		Cmd: cleanupCmd,
-	}
-	cleanupExecResp, err := targetCli.ContainerExecCreate(ctx, containerID, cleanupExecConfig)
-	if err == nil {
-		targetCli.ContainerExecAttach(ctx, cleanupExecResp.ID, types.ExecStartCheck{})
-	}
-
-	log.Printf("Successfully extracted volume data to %s in target container", targetPath)
-	return nil
+	return target.CommitVolume(ctx, uploadID, VolumeCommit{
+		Type:   vol.Type,
+		Source: vol.Source,
+		Size:   size,
+	})
 }
 
-// VerifyContainerHealth verifies that a container is healthy on the target node
+// VerifyContainerHealth verifies that a local container becomes healthy within timeout
 func VerifyContainerHealth(ctx context.Context, cli *client.Client, containerID string, timeout time.Duration) error {
+	return waitContainerHealthy(ctx, timeout, func(ctx context.Context) (*ContainerStatus, error) {
+		return inspectContainerStatus(ctx, cli, containerID)
+	})
+}
+
+// waitContainerHealthy polls a container's status until it is healthy, fails, or the timeout expires
+func waitContainerHealthy(ctx context.Context, timeout time.Duration, getStatus func(context.Context) (*ContainerStatus, error)) error {
 	deadline := time.Now().Add(timeout)
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
@@ -532,33 +491,28 @@ func VerifyContainerHealth(ctx context.Context, cli *client.Client, containerID
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
-			inspect, err := cli.ContainerInspect(ctx, containerID)
+			status, err := getStatus(ctx)
 			if err != nil {
-				return fmt.Errorf("failed to inspect container: %w", err)
+				return err
 			}
 
 			// Check if container is running
-			if !inspect.State.Running {
-				return fmt.Errorf("container is not running (state: %s)", inspect.State.Status)
+			if !status.Running {
+				return fmt.Errorf("container is not running (state: %s)", status.State)
+			}
+
+			// No healthcheck configured, consider running as healthy
+			if !status.HasHealthcheck {
+				return nil
 			}
 
-			// Check health status if healthcheck is configured
-			if inspect.Config.Healthcheck != nil {
-				if inspect.State.Health != nil {
-					if inspect.State.Health.Status == "healthy" {
-						return nil // Container is healthy
-					}
-					if inspect.State.Health.Status == "unhealthy" {
-						return fmt.Errorf("container health check reports unhealthy")
-					}
-					// Status is "starting" or "none", continue waiting
-				}
-			} else {
-				// No healthcheck configured, consider running as healthy
-				if inspect.State.Running {
-					return nil
-				}
+			switch status.Health {
+			case "healthy":
+				return nil // Container is healthy
+			case "unhealthy":
+				return fmt.Errorf("container health check reports unhealthy")
 			}
+			// Status is "starting" or "none", continue waiting
 		}
 	}
 
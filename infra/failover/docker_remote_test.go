@@ -0,0 +1,116 @@
+package failover
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testContainerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// testInspect returns inspect output of a compose service attached to two networks
+func testInspect() types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:   testContainerID,
+			Name: "/app",
+			HostConfig: &container.HostConfig{
+				NetworkMode: "backend",
+				LogConfig:   container.LogConfig{Type: "json-file", Config: map[string]string{"max-size": "10m"}},
+				Sysctls:     map[string]string{"net.core.somaxconn": "1024"},
+				CapAdd:      []string{"NET_ADMIN"},
+				Resources: container.Resources{
+					Memory:  512 << 20,
+					Ulimits: []*units.Ulimit{{Name: "nofile", Soft: 65536, Hard: 65536}},
+				},
+			},
+		},
+		Config: &container.Config{
+			Hostname:   "0123456789ab",
+			Image:      "nginx:latest",
+			Entrypoint: []string{"/docker-entrypoint.sh"},
+			Cmd:        []string{"nginx", "-g", "daemon off;"},
+			WorkingDir: "/srv",
+			StopSignal: "SIGQUIT",
+			Labels:     map[string]string{"com.docker.compose.service": "app"},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"backend": {Aliases: []string{"app", "0123456789ab"}},
+				"warp-nat-net": {
+					Aliases:    []string{"app"},
+					IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "10.0.2.50"},
+					IPAddress:  "10.0.2.50",
+				},
+			},
+		},
+	}
+}
+
+func TestContainerConfigFromInspect_PreservesSpec(t *testing.T) {
+	config := containerConfigFromInspect(testInspect())
+
+	assert.Equal(t, ContainerSpecVersion, config.Version)
+	assert.Equal(t, []string{"/docker-entrypoint.sh"}, config.Entrypoint)
+	assert.Equal(t, "/srv", config.WorkingDir)
+	assert.Equal(t, "SIGQUIT", config.StopSignal)
+	assert.Empty(t, config.Hostname, "generated hostnames are not carried over")
+	assert.Equal(t, "app", config.Labels["com.docker.compose.service"])
+	assert.Equal(t, "10m", config.Host.LogConfig.Config["max-size"])
+	assert.Equal(t, "1024", config.Host.Sysctls["net.core.somaxconn"])
+	assert.Equal(t, []string{"NET_ADMIN"}, config.Host.CapAdd)
+	require.Len(t, config.Resources.Ulimits, 1)
+	assert.Equal(t, int64(65536), config.Resources.Ulimits[0].Soft)
+
+	// Networks keep their aliases (without the generated short ID) and static addresses
+	assert.Equal(t, []string{"backend", "warp-nat-net"}, config.Networks)
+	assert.Equal(t, []string{"app"}, config.Endpoints["backend"].Aliases)
+	assert.Empty(t, config.Endpoints["backend"].IPv4Address)
+	assert.Equal(t, "10.0.2.50", config.Endpoints["warp-nat-net"].IPv4Address)
+	assert.Equal(t, "backend", config.primaryNetwork())
+	assert.Empty(t, config.PortabilityIssues())
+
+	// The spec survives the trip to the target agent
+	data, err := json.Marshal(config)
+	require.NoError(t, err)
+	var received ContainerConfig
+	require.NoError(t, json.Unmarshal(data, &received))
+	assert.Equal(t, config, &received)
+
+	settings := received.Endpoints["warp-nat-net"].endpointSettings()
+	require.NotNil(t, settings.IPAMConfig)
+	assert.Equal(t, "10.0.2.50", settings.IPAMConfig.IPv4Address)
+	assert.Equal(t, []string{"app"}, settings.Aliases)
+	assert.Nil(t, received.Endpoints["backend"].endpointSettings().IPAMConfig)
+}
+
+func TestContainerConfig_PortabilityIssues(t *testing.T) {
+	inspect := testInspect()
+	inspect.HostConfig.NetworkMode = "host"
+	inspect.HostConfig.Resources.Devices = []container.DeviceMapping{{PathOnHost: "/dev/ttyUSB0", PathInContainer: "/dev/ttyUSB0"}}
+	inspect.HostConfig.VolumesFrom = []string{"data"}
+
+	issues := containerConfigFromInspect(inspect).PortabilityIssues()
+	require.Len(t, issues, 3)
+	assert.Contains(t, issues[0], "network_mode: host")
+	assert.Contains(t, issues[1], "data")
+	assert.Contains(t, issues[2], "/dev/ttyUSB0")
+
+	inspect = testInspect()
+	inspect.HostConfig.NetworkMode = "container:vpn"
+	issues = containerConfigFromInspect(inspect).PortabilityIssues()
+	require.Len(t, issues, 1)
+	assert.Contains(t, issues[0], "vpn")
+}
+
+func TestCheckSpecVersion(t *testing.T) {
+	assert.NoError(t, checkSpecVersion(&ContainerConfig{}), "specs from agents before versioning")
+	assert.NoError(t, checkSpecVersion(&ContainerConfig{Version: ContainerSpecVersion}))
+	assert.ErrorIs(t, checkSpecVersion(&ContainerConfig{Version: ContainerSpecVersion + 1}), ErrUnsupportedSpecVersion)
+}
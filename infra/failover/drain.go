@@ -0,0 +1,761 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cluster/infra/cluster/raft"
+)
+
+// MigratableLabel opts a container out of drains and migrations when set to "false"
+const MigratableLabel = "constellation.migratable"
+
+const (
+	defaultDrainConcurrency = 2
+	maxDrainConcurrency     = 10
+	drainPollInterval       = 2 * time.Second
+	// remoteDrainGrace is how long an agent waits after starting before it treats nodes
+	// missing from gossip as down, so it does not evacuate nodes it has not heard from yet
+	remoteDrainGrace = time.Minute
+)
+
+var (
+	// ErrDrainInProgress is returned when draining a node that is already being drained
+	ErrDrainInProgress = errors.New("node is already being drained")
+	// ErrNotDraining is returned when undraining a node without an active drain
+	ErrNotDraining = errors.New("node is not drained")
+	// ErrUnknownNode is returned when draining a node the cluster knows nothing about
+	ErrUnknownNode = errors.New("node not found in cluster")
+)
+
+// drainState tracks a drain coordinated by this node
+type drainState struct {
+	mu     sync.Mutex
+	record *raft.DrainRecord
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// SetMigrationRules sets the rules used for per-service settings (priority, retries) during drains
+func (mm *MigrationManager) SetMigrationRules(rules []MigrationRule) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.rules = rules
+}
+
+// SetCordonHandler registers a callback that publishes this node's cordon state to the cluster
+func (mm *MigrationManager) SetCordonHandler(handler func(cordoned bool)) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.cordonHandler = handler
+}
+
+// setCordoned publishes this node's cordon state, if a handler is registered
+func (mm *MigrationManager) setCordoned(cordoned bool) {
+	mm.mu.RLock()
+	handler := mm.cordonHandler
+	mm.mu.RUnlock()
+
+	if handler != nil {
+		handler(cordoned)
+	}
+}
+
+// ruleFor returns the migration rule of a service, or defaults when it has none
+func (mm *MigrationManager) ruleFor(serviceName string) MigrationRule {
+	if rule, ok := mm.configuredRule(serviceName); ok {
+		return rule.withDefaults()
+	}
+	return MigrationRule{ServiceName: serviceName}.withDefaults()
+}
+
+// configuredRule returns the migration rule configured for a service, if any
+func (mm *MigrationManager) configuredRule(serviceName string) (MigrationRule, bool) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	for _, rule := range mm.rules {
+		if rule.ServiceName == serviceName {
+			return rule, true
+		}
+	}
+	return MigrationRule{}, false
+}
+
+// GetDrain returns the latest drain record of a node
+func (mm *MigrationManager) GetDrain(nodeName string) (*raft.DrainRecord, bool) {
+	store := mm.migrationStore()
+	if store == nil {
+		return nil, false
+	}
+	return store.GetDrain(nodeName)
+}
+
+// migrationStore returns the configured store
+func (mm *MigrationManager) migrationStore() MigrationStore {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	return mm.store
+}
+
+// isDrained reports whether a node is cordoned by a drain recorded in store
+func isDrained(store MigrationStore, nodeName string) bool {
+	if store == nil {
+		return false
+	}
+	drain, exists := store.GetDrain(nodeName)
+	return exists && drain.Cordoned()
+}
+
+// isLeader reports whether this node coordinates the evacuation of nodes that are down.
+// Without a replicated store there is no one else to do it.
+func (mm *MigrationManager) isLeader() bool {
+	if leader, ok := mm.migrationStore().(leaderStore); ok {
+		return leader.IsLeader()
+	}
+	return true
+}
+
+// nodeAlive reports whether a node is a member of the gossip cluster
+func (mm *MigrationManager) nodeAlive(nodeName string) bool {
+	if nodeName == mm.nodeName {
+		return true
+	}
+	_, alive := mm.gossipState.GetNode(nodeName)
+	return alive
+}
+
+// DrainNode cordons a node cluster-wide, in consensus, and has every migratable service
+// moved off it in priority order, at most concurrency at once. Any node can be drained
+// from any agent: the drained node's agent evacuates it while it is up; when it is down,
+// the Raft leader recreates its stateless services from the specs the node published.
+// Services that cannot move are recorded as unmovable for manual action.
+func (mm *MigrationManager) DrainNode(nodeName string, concurrency int) (*raft.DrainRecord, error) {
+	store := mm.migrationStore()
+	if store == nil {
+		return nil, fmt.Errorf("migration store not available")
+	}
+	if concurrency <= 0 {
+		concurrency = defaultDrainConcurrency
+	}
+	if concurrency > maxDrainConcurrency {
+		concurrency = maxDrainConcurrency
+	}
+
+	if !mm.nodeAlive(nodeName) {
+		if _, published := store.GetWorkload(nodeName); !published {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownNode, nodeName)
+		}
+	}
+	if existing, exists := store.GetDrain(nodeName); exists && existing.Status == raft.DrainStatusDraining {
+		return nil, ErrDrainInProgress
+	}
+
+	now := time.Now()
+	drain := &raft.DrainRecord{
+		NodeName:    nodeName,
+		Status:      raft.DrainStatusDraining,
+		Concurrency: concurrency,
+		StartedAt:   now,
+		UpdatedAt:   now,
+		Services:    []raft.DrainService{},
+	}
+
+	// The record cordons the node for every agent before anything moves
+	if err := store.PutDrain(drain); err != nil {
+		return nil, fmt.Errorf("failed to store drain of %s: %w", nodeName, err)
+	}
+	log.Printf("Node %s cordoned for draining, concurrency %d", nodeName, concurrency)
+
+	// Start right away when this node is the one to evacuate it
+	mm.ReconcileDrains()
+	if current := mm.drainSnapshot(nodeName); current != nil {
+		return current, nil
+	}
+	return drain, nil
+}
+
+// UndrainNode ends the drain of a node and uncordons it. Migrations already running are
+// left to finish.
+func (mm *MigrationManager) UndrainNode(nodeName string) (*raft.DrainRecord, error) {
+	store := mm.migrationStore()
+	if store == nil {
+		return nil, ErrNotDraining
+	}
+
+	stored, exists := store.GetDrain(nodeName)
+	if !exists || !stored.Cordoned() {
+		return nil, ErrNotDraining
+	}
+
+	// Keep the progress of an evacuation this node was running
+	mm.stopDrain(nodeName)
+	if latest, exists := store.GetDrain(nodeName); exists && latest.StartedAt.Equal(stored.StartedAt) {
+		stored = latest
+	}
+
+	now := time.Now()
+	if stored.Status == raft.DrainStatusDraining {
+		stored.Status = raft.DrainStatusCancelled
+	} else {
+		stored.Status = raft.DrainStatusUncordoned
+	}
+	stored.UpdatedAt = now
+	stored.CompletedAt = &now
+	if err := store.PutDrain(stored); err != nil {
+		return nil, fmt.Errorf("failed to store end of drain of %s: %w", nodeName, err)
+	}
+
+	if nodeName == mm.nodeName {
+		mm.setCordoned(false)
+	}
+
+	log.Printf("Node %s uncordoned, drain ended", nodeName)
+	return stored, nil
+}
+
+// FollowDrains applies drain records written by any agent until ctx is done
+func (mm *MigrationManager) FollowDrains(ctx context.Context) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mm.ReconcileDrains()
+		}
+	}
+}
+
+// ReconcileDrains brings this node in line with the replicated drain records: it
+// publishes its own cordon state, evacuates itself while its drain is active, evacuates
+// nodes that are down when it is the Raft leader, and stops evacuations that ended or
+// were taken over. Safe to call repeatedly.
+func (mm *MigrationManager) ReconcileDrains() {
+	store := mm.migrationStore()
+	if store == nil {
+		return
+	}
+
+	active := make(map[string]*raft.DrainRecord)
+	for _, drain := range store.ListDrains() {
+		if drain.NodeName == mm.nodeName {
+			mm.syncCordon(drain)
+		}
+		if drain.Status == raft.DrainStatusDraining && mm.coordinates(drain.NodeName) {
+			active[drain.NodeName] = drain
+		}
+	}
+
+	mm.drainMu.Lock()
+	stale := make([]string, 0)
+	for nodeName, state := range mm.drains {
+		state.mu.Lock()
+		startedAt := state.record.StartedAt
+		state.mu.Unlock()
+		if drain, ok := active[nodeName]; !ok || !drain.StartedAt.Equal(startedAt) {
+			stale = append(stale, nodeName)
+		}
+	}
+	mm.drainMu.Unlock()
+
+	for _, nodeName := range stale {
+		mm.stopDrain(nodeName)
+	}
+	for _, drain := range active {
+		mm.startDrain(drain)
+	}
+}
+
+// syncCordon publishes this node's cordon state when it differs from its drain record
+func (mm *MigrationManager) syncCordon(drain *raft.DrainRecord) {
+	node, found := mm.gossipState.GetNode(mm.nodeName)
+	if found && node.Cordoned == drain.Cordoned() {
+		return
+	}
+	if !found && !drain.Cordoned() {
+		return
+	}
+	mm.setCordoned(drain.Cordoned())
+}
+
+// coordinates reports whether this node evacuates a node under drain: a node evacuates
+// itself while it is up, and the Raft leader evacuates nodes that are down
+func (mm *MigrationManager) coordinates(nodeName string) bool {
+	if nodeName == mm.nodeName {
+		return mm.dockerClient != nil
+	}
+	if mm.nodeAlive(nodeName) || time.Since(mm.startedAt) < remoteDrainGrace {
+		return false
+	}
+	return mm.isLeader()
+}
+
+// startDrain starts evacuating a node, unless this node already does. A drain no
+// coordinator has picked up yet gets its service list first.
+func (mm *MigrationManager) startDrain(drain *raft.DrainRecord) {
+	mm.drainMu.Lock()
+	if _, running := mm.drains[drain.NodeName]; running {
+		mm.drainMu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	state := &drainState{record: drain, cancel: cancel, done: make(chan struct{})}
+	mm.drains[drain.NodeName] = state
+	mm.drainMu.Unlock()
+
+	if drain.Coordinator == "" {
+		if drain.NodeName == mm.nodeName {
+			drain.Services = mm.drainServices(ctx)
+		} else {
+			drain.Services = mm.recoveryServices(drain.NodeName)
+		}
+		log.Printf("Draining node %s: %d service(s), concurrency %d", drain.NodeName, len(drain.Services), drain.Concurrency)
+	} else if drain.Coordinator != mm.nodeName {
+		log.Printf("Taking over drain of node %s from %s", drain.NodeName, drain.Coordinator)
+	} else {
+		log.Printf("Resuming drain of node %s", drain.NodeName)
+	}
+	drain.Coordinator = mm.nodeName
+	mm.persistDrain(state)
+
+	go mm.runDrain(ctx, state)
+}
+
+// stopDrain stops an evacuation this node runs and waits for it to return
+func (mm *MigrationManager) stopDrain(nodeName string) {
+	mm.drainMu.Lock()
+	state, running := mm.drains[nodeName]
+	delete(mm.drains, nodeName)
+	mm.drainMu.Unlock()
+
+	if running {
+		state.cancel()
+		<-state.done
+	}
+}
+
+// drainServices lists the services on this node in evacuation order (highest priority first)
+// and marks those that cannot be migrated
+func (mm *MigrationManager) drainServices(ctx context.Context) []raft.DrainService {
+	services := make([]raft.DrainService, 0)
+	seen := make(map[string]bool)
+	for _, health := range mm.gossipState.GetAllServiceHealth() {
+		if health.NodeName != mm.nodeName || seen[health.ServiceName] {
+			continue
+		}
+		seen[health.ServiceName] = true
+
+		service := raft.DrainService{
+			ServiceName: health.ServiceName,
+			Priority:    mm.ruleFor(health.ServiceName).Priority,
+			Status:      raft.DrainServicePending,
+		}
+		if reason, err := mm.checkMigratable(ctx, health.ServiceName); err != nil {
+			service.Status = raft.DrainServiceFailed
+			service.Reason = err.Error()
+		} else if reason != "" {
+			service.Status = raft.DrainServiceUnmovable
+			service.Reason = reason
+		}
+		services = append(services, service)
+	}
+
+	sortDrainServices(services)
+	return services
+}
+
+// recoveryServices lists the services a node that is down published in its workload, and
+// marks those that cannot be recreated from their spec alone
+func (mm *MigrationManager) recoveryServices(nodeName string) []raft.DrainService {
+	services := make([]raft.DrainService, 0)
+	workload, exists := mm.migrationStore().GetWorkload(nodeName)
+	if !exists {
+		log.Printf("Warning: Node %s published no workload, nothing to recover", nodeName)
+		return services
+	}
+
+	clusterToken := mm.transferToken()
+	for _, published := range workload.Services {
+		service := raft.DrainService{
+			ServiceName: published.ServiceName,
+			Priority:    mm.ruleFor(published.ServiceName).Priority,
+			Status:      raft.DrainServicePending,
+		}
+		if _, err := recoverableSpec(nodeName, published, clusterToken); err != nil {
+			service.Status = raft.DrainServiceUnmovable
+			service.Reason = err.Error()
+		}
+		services = append(services, service)
+	}
+
+	sortDrainServices(services)
+	return services
+}
+
+// recoverableSpec returns the container spec of a service on a node that is down, or why
+// it cannot be recreated elsewhere: only the spec survives, not the node's volumes
+func recoverableSpec(nodeName string, published raft.WorkloadService, clusterToken string) (*ContainerConfig, error) {
+	if published.Error != "" {
+		return nil, fmt.Errorf("no container spec recorded: %s", published.Error)
+	}
+	if len(published.Spec) == 0 {
+		return nil, fmt.Errorf("no container spec recorded")
+	}
+
+	config := &ContainerConfig{}
+	if err := json.Unmarshal(published.Spec, config); err != nil {
+		return nil, fmt.Errorf("invalid container spec: %w", err)
+	}
+	if err := checkSpecVersion(config); err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(config.Labels[MigratableLabel], "false") {
+		return nil, fmt.Errorf("opted out with %s=false", MigratableLabel)
+	}
+	if issues := config.PortabilityIssues(); len(issues) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(issues, "; "))
+	}
+	if hasTransferableMounts(config.Mounts) {
+		return nil, fmt.Errorf("volumes stay on %s, which is down", nodeName)
+	}
+	if published.EnvWithheld {
+		return nil, fmt.Errorf("environment not published, %s has no cluster token", nodeName)
+	}
+	if len(published.SealedEnv) > 0 {
+		env, err := openEnv(clusterToken, published.SealedEnv)
+		if err != nil {
+			return nil, err
+		}
+		config.Env = env
+	}
+	return config, nil
+}
+
+// sortDrainServices orders services by priority, highest first, then by name
+func sortDrainServices(services []raft.DrainService) {
+	sort.SliceStable(services, func(i, j int) bool {
+		if services[i].Priority != services[j].Priority {
+			return services[i].Priority > services[j].Priority
+		}
+		return services[i].ServiceName < services[j].ServiceName
+	})
+}
+
+// checkMigratable returns why a service's container cannot be moved to another node,
+// or an empty string when it can
+func (mm *MigrationManager) checkMigratable(ctx context.Context, serviceName string) (string, error) {
+	source, err := mm.findServiceContainer(ctx, serviceName, true)
+	if errors.Is(err, ErrContainerNotFound) || errors.Is(err, ErrAmbiguousContainer) {
+		return err.Error(), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	inspect, err := mm.dockerClient.ContainerInspect(ctx, source.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	if inspect.Config != nil && strings.EqualFold(inspect.Config.Labels[MigratableLabel], "false") {
+		return fmt.Sprintf("opted out with %s=false", MigratableLabel), nil
+	}
+	if issues := containerConfigFromInspect(inspect).PortabilityIssues(); len(issues) > 0 {
+		return strings.Join(issues, "; "), nil
+	}
+	return "", nil
+}
+
+// runDrain migrates pending services in order, bounded by the drain's concurrency
+func (mm *MigrationManager) runDrain(ctx context.Context, state *drainState) {
+	defer close(state.done)
+
+	state.mu.Lock()
+	concurrency := state.record.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultDrainConcurrency
+	}
+	pending := make([]int, 0, len(state.record.Services))
+	for i, service := range state.record.Services {
+		if service.Status == raft.DrainServicePending || service.Status == raft.DrainServiceMigrating {
+			pending = append(pending, i)
+		}
+	}
+	state.mu.Unlock()
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, index := range pending {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			mm.drainService(ctx, state, index)
+		}(index)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return // Ended or taken over; whoever stopped it records the outcome
+	}
+
+	state.mu.Lock()
+	now := time.Now()
+	state.record.Status = raft.DrainStatusDrained
+	state.record.CompletedAt = &now
+	nodeName := state.record.NodeName
+	state.mu.Unlock()
+	mm.persistDrain(state)
+
+	mm.drainMu.Lock()
+	if mm.drains[nodeName] == state {
+		delete(mm.drains, nodeName)
+	}
+	mm.drainMu.Unlock()
+
+	log.Printf("Drain of node %s finished", nodeName)
+}
+
+// drainService migrates one service and waits for the migration to finish
+func (mm *MigrationManager) drainService(ctx context.Context, state *drainState, index int) {
+	state.mu.Lock()
+	nodeName := state.record.NodeName
+	serviceName := state.record.Services[index].ServiceName
+	previousID := state.record.Services[index].MigrationID
+	state.mu.Unlock()
+
+	// A resumed or taken over drain may find the migration it started already running or finished
+	if previousID != "" {
+		if record, exists := mm.GetMigrationRecord(previousID); exists {
+			migration := migrationFromRecord(record)
+			switch {
+			case migration.Status == MigrationStatusCompleted:
+				mm.updateDrainService(state, index, raft.DrainServiceMigrated, "", migration)
+				return
+			case !migration.Status.IsTerminal() && mm.nodeAlive(migration.Runner()):
+				mm.awaitMigration(ctx, state, index, migration.ID)
+				return
+			case !migration.Status.IsTerminal():
+				// Its agent went down mid-migration; cancelling removes what it left on the target
+				if _, err := mm.CancelMigration(serviceName); err != nil && !errors.Is(err, ErrMigrationNotActive) {
+					log.Printf("Warning: Failed to cancel abandoned migration %s of %s: %v", previousID, serviceName, err)
+				}
+			}
+		}
+	}
+
+	rule := mm.ruleFor(serviceName)
+	rule.TargetNode = ""
+
+	// Migrations are not tied to the drain: undraining stops new migrations but lets running ones finish
+	var err error
+	if nodeName == mm.nodeName {
+		err = mm.StartMigrationWithReason(context.Background(), rule, "node drain")
+	} else {
+		err = mm.startRecovery(rule, nodeName)
+	}
+	migration, exists := mm.localMigration(serviceName)
+	if err != nil && (!exists || migration.Status.IsTerminal()) {
+		mm.updateDrainService(state, index, raft.DrainServiceFailed, err.Error(), nil)
+		return
+	}
+	mm.updateDrainService(state, index, raft.DrainServiceMigrating, "", migration)
+	mm.awaitMigration(ctx, state, index, migration.ID)
+}
+
+// startRecovery recreates a service of a node that is down on another node, from the
+// container spec the node published
+func (mm *MigrationManager) startRecovery(rule MigrationRule, nodeName string) error {
+	workload, exists := mm.migrationStore().GetWorkload(nodeName)
+	if !exists {
+		return fmt.Errorf("node %s published no workload", nodeName)
+	}
+	for _, published := range workload.Services {
+		if published.ServiceName != rule.ServiceName {
+			continue
+		}
+		config, err := recoverableSpec(nodeName, published, mm.transferToken())
+		if err != nil {
+			return err
+		}
+
+		run := newMigrationRun(rule)
+		run.config = config
+		run.containerID = published.ContainerID
+		run.sourceUnreachable = true
+		return mm.startMigration(context.Background(), rule, fmt.Sprintf("node drain (%s down)", nodeName), nodeName, run)
+	}
+	return fmt.Errorf("service %s not in the workload of %s", rule.ServiceName, nodeName)
+}
+
+// awaitMigration waits for a migration to finish and records its outcome in the drain
+func (mm *MigrationManager) awaitMigration(ctx context.Context, state *drainState, index int, migrationID string) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		record, exists := mm.GetMigrationRecord(migrationID)
+		if !exists {
+			continue
+		}
+		current := migrationFromRecord(record)
+		if !current.Status.IsTerminal() {
+			continue
+		}
+
+		if current.Status == MigrationStatusCompleted {
+			mm.updateDrainService(state, index, raft.DrainServiceMigrated, "", current)
+		} else {
+			reason := string(current.Status)
+			if current.Error != nil {
+				reason = current.Error.Error()
+			}
+			mm.updateDrainService(state, index, raft.DrainServiceFailed, reason, current)
+		}
+		return
+	}
+}
+
+// localMigration returns a copy of the latest migration of a service started on this node
+func (mm *MigrationManager) localMigration(serviceName string) (*Migration, bool) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	migration, exists := mm.migrations[serviceName]
+	if !exists {
+		return nil, false
+	}
+	return migration.copy(), true
+}
+
+// updateDrainService records the progress of one service and persists the drain
+func (mm *MigrationManager) updateDrainService(state *drainState, index int, status, reason string, migration *Migration) {
+	state.mu.Lock()
+	service := &state.record.Services[index]
+	service.Status = status
+	service.Reason = reason
+	if migration != nil {
+		service.MigrationID = migration.ID
+		service.TargetNode = migration.TargetNode
+	}
+	state.mu.Unlock()
+
+	mm.persistDrain(state)
+}
+
+// persistDrain writes a drain record to the store. A drain ended from another agent
+// is not revived; the evacuation stops instead.
+func (mm *MigrationManager) persistDrain(state *drainState) {
+	state.mu.Lock()
+	state.record.UpdatedAt = time.Now()
+	drain := state.record.Copy()
+	state.mu.Unlock()
+
+	store := mm.migrationStore()
+	if store == nil {
+		return
+	}
+	err := store.PutDrain(drain)
+	if err == nil {
+		return
+	}
+	if strings.Contains(err.Error(), raft.ErrDrainEnded.Error()) {
+		log.Printf("Drain of node %s was ended elsewhere, stopping its evacuation", drain.NodeName)
+		state.cancel()
+		return
+	}
+	log.Printf("Warning: Failed to persist drain of node %s: %v", drain.NodeName, err)
+}
+
+// drainSnapshot returns a copy of the drain of a node this node coordinates
+func (mm *MigrationManager) drainSnapshot(nodeName string) *raft.DrainRecord {
+	mm.drainMu.Lock()
+	state, running := mm.drains[nodeName]
+	mm.drainMu.Unlock()
+	if !running {
+		return nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.record.Copy()
+}
+
+// PublishWorkload records the services on this node with their container specs in the
+// cluster store, so they can be recreated elsewhere if this node goes down while drained.
+// Environments are encrypted with the cluster token (see publishSpec). The record is only
+// rewritten when it changed.
+func (mm *MigrationManager) PublishWorkload(ctx context.Context) {
+	store := mm.migrationStore()
+	if store == nil || mm.dockerClient == nil {
+		return
+	}
+
+	clusterToken := mm.transferToken()
+	previous := make(map[string]*raft.WorkloadService)
+	published, publishedExists := store.GetWorkload(mm.nodeName)
+	if publishedExists {
+		for i := range published.Services {
+			previous[published.Services[i].ServiceName] = &published.Services[i]
+		}
+	}
+
+	services := make([]raft.WorkloadService, 0)
+	seen := make(map[string]bool)
+	for _, health := range mm.gossipState.GetAllServiceHealth() {
+		if health.NodeName != mm.nodeName || seen[health.ServiceName] {
+			continue
+		}
+		seen[health.ServiceName] = true
+
+		service := raft.WorkloadService{ServiceName: health.ServiceName}
+		source, err := mm.findServiceContainer(ctx, health.ServiceName, true)
+		if err == nil {
+			service.ContainerID = source.ID
+			var config *ContainerConfig
+			if config, err = ExportContainerConfig(ctx, mm.dockerClient, source.ID); err == nil {
+				err = publishSpec(&service, config, clusterToken, previous[health.ServiceName])
+			}
+		}
+		if err != nil {
+			service.Error = err.Error()
+		}
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].ServiceName < services[j].ServiceName })
+
+	if publishedExists && reflect.DeepEqual(published.Services, services) {
+		return
+	}
+	workload := &raft.NodeWorkload{NodeName: mm.nodeName, UpdatedAt: time.Now(), Services: services}
+	if err := store.PutWorkload(workload); err != nil {
+		log.Printf("Warning: Failed to publish workload of %s: %v", mm.nodeName, err)
+	}
+}
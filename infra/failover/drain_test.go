@@ -0,0 +1,284 @@
+package failover
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+
+	"cluster/infra/cluster/gossip"
+	"cluster/infra/cluster/raft"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationManager_DrainNode(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	_, err := manager.DrainNode("unknown-node", 0)
+	assert.ErrorIs(t, err, ErrUnknownNode)
+
+	var cordonStates []bool
+	manager.SetCordonHandler(func(cordoned bool) { cordonStates = append(cordonStates, cordoned) })
+
+	// Without a Docker client nothing is evacuated, but the node is cordoned cluster-wide
+	drain, err := manager.DrainNode("test-node", 50)
+	require.NoError(t, err)
+	assert.Equal(t, raft.DrainStatusDraining, drain.Status)
+	assert.Equal(t, maxDrainConcurrency, drain.Concurrency)
+	assert.Equal(t, []bool{true}, cordonStates)
+
+	_, err = manager.DrainNode("test-node", 0)
+	assert.ErrorIs(t, err, ErrDrainInProgress)
+}
+
+func TestMigrationManager_DrainNode_DownNode(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+	require.NoError(t, manager.store.PutWorkload(&raft.NodeWorkload{NodeName: "node1"}))
+
+	// A node that left gossip can still be drained from the workload it published
+	drain, err := manager.DrainNode("node1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, defaultDrainConcurrency, drain.Concurrency)
+
+	stored, exists := manager.GetDrain("node1")
+	require.True(t, exists)
+	assert.True(t, stored.Cordoned())
+
+	// Ending it from any agent stops a coordinator from reviving it
+	_, err = manager.UndrainNode("node1")
+	require.NoError(t, err)
+	assert.ErrorIs(t, manager.store.PutDrain(stored), raft.ErrDrainEnded)
+}
+
+func TestMigrationManager_Coordinates(t *testing.T) {
+	manager, state := createTestMigrationManager()
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node1"})
+
+	// Needs Docker to evacuate itself
+	assert.False(t, manager.coordinates("test-node"))
+	// A node that is up evacuates itself
+	assert.False(t, manager.coordinates("node1"))
+	// Nodes missing right after startup may just not have been heard from yet
+	assert.False(t, manager.coordinates("node2"))
+
+	manager.startedAt = time.Now().Add(-2 * remoteDrainGrace)
+	assert.True(t, manager.coordinates("node2"))
+}
+
+func TestMigrationManager_SelectTargetNode_SkipsDrainedNodes(t *testing.T) {
+	manager, state := createTestMigrationManager()
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node1", Priority: 5})
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node2", Priority: 10})
+
+	// node1 is drained in consensus even though its gossip metadata is not cordoned yet
+	require.NoError(t, manager.store.PutDrain(&raft.DrainRecord{NodeName: "node1", Status: raft.DrainStatusDraining}))
+
+	target, err := manager.selectTargetNode("test-service")
+	require.NoError(t, err)
+	assert.Equal(t, "node2", target)
+
+	// A finished, uncordoned drain no longer excludes the node
+	require.NoError(t, manager.store.PutDrain(&raft.DrainRecord{NodeName: "node1", Status: raft.DrainStatusUncordoned}))
+	target, err = manager.selectTargetNode("test-service")
+	require.NoError(t, err)
+	assert.Equal(t, "node1", target)
+}
+
+func TestMigrationManager_EvaluateTargets_WhileStoreChanges(t *testing.T) {
+	manager, state := createTestMigrationManager()
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node1", Priority: 5})
+
+	// Drains are read from the store the caller passes, never from mm.store unlocked
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			manager.SetMigrationStore(newMemoryMigrationStore())
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := manager.selectTargetNode("test-service")
+		require.NoError(t, err)
+	}
+	<-done
+}
+
+func TestMigrationManager_UndrainNode(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	_, err := manager.UndrainNode("test-node")
+	assert.ErrorIs(t, err, ErrNotDraining)
+
+	var cordonStates []bool
+	manager.SetCordonHandler(func(cordoned bool) { cordonStates = append(cordonStates, cordoned) })
+	require.NoError(t, manager.store.PutDrain(&raft.DrainRecord{
+		NodeName:  "test-node",
+		Status:    raft.DrainStatusDrained,
+		StartedAt: time.Now(),
+	}))
+
+	drain, err := manager.UndrainNode("test-node")
+	require.NoError(t, err)
+	assert.Equal(t, raft.DrainStatusUncordoned, drain.Status)
+	assert.NotNil(t, drain.CompletedAt)
+	assert.Equal(t, []bool{false}, cordonStates)
+
+	stored, exists := manager.GetDrain("test-node")
+	require.True(t, exists)
+	assert.False(t, stored.Cordoned())
+
+	_, err = manager.UndrainNode("test-node")
+	assert.ErrorIs(t, err, ErrNotDraining)
+}
+
+func TestMigrationManager_ReconcileDrains_RestoresCordon(t *testing.T) {
+	manager, state := createTestMigrationManager()
+	state.UpdateNode(&gossip.NodeMetadata{Name: "test-node"})
+
+	var cordonStates []bool
+	manager.SetCordonHandler(func(cordoned bool) { cordonStates = append(cordonStates, cordoned) })
+
+	// Nothing to restore without a drain record
+	manager.ReconcileDrains()
+	assert.Empty(t, cordonStates)
+
+	require.NoError(t, manager.store.PutDrain(&raft.DrainRecord{NodeName: "test-node", Status: raft.DrainStatusDrained}))
+	manager.ReconcileDrains()
+	assert.Equal(t, []bool{true}, cordonStates)
+}
+
+func TestMigrationManager_RuleFor(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+	manager.SetMigrationRules([]MigrationRule{{ServiceName: "db", Priority: 10, MaxRetries: 5}})
+
+	assert.Equal(t, 10, manager.ruleFor("db").Priority)
+	assert.Equal(t, 5, manager.ruleFor("db").MaxRetries)
+
+	defaults := manager.ruleFor("web")
+	assert.Equal(t, "web", defaults.ServiceName)
+	assert.Equal(t, 0, defaults.Priority)
+	assert.Equal(t, defaultMaxRetries, defaults.MaxRetries)
+}
+
+func TestRecoverableSpec(t *testing.T) {
+	spec := func(config ContainerConfig) json.RawMessage {
+		data, err := json.Marshal(config)
+		require.NoError(t, err)
+		return data
+	}
+	sealed := func(clusterToken string) []byte {
+		data, err := sealEnv(clusterToken, []string{"API_KEY=secret"})
+		require.NoError(t, err)
+		return data
+	}
+
+	tests := []struct {
+		name      string
+		published raft.WorkloadService
+		wantErr   string
+	}{
+		{
+			name:      "stateless",
+			published: raft.WorkloadService{ServiceName: "web", Spec: spec(ContainerConfig{Image: "nginx"})},
+		},
+		{
+			name: "sealed environment",
+			published: raft.WorkloadService{ServiceName: "web", Spec: spec(ContainerConfig{Image: "nginx"}),
+				SealedEnv: sealed("cluster-token")},
+		},
+		{
+			name:      "export failed",
+			published: raft.WorkloadService{ServiceName: "web", Error: "container not found"},
+			wantErr:   "no container spec recorded: container not found",
+		},
+		{
+			name:      "no spec",
+			published: raft.WorkloadService{ServiceName: "web"},
+			wantErr:   "no container spec recorded",
+		},
+		{
+			name: "opted out",
+			published: raft.WorkloadService{ServiceName: "web", Spec: spec(ContainerConfig{
+				Image:  "nginx",
+				Labels: map[string]string{MigratableLabel: "false"},
+			})},
+			wantErr: "opted out",
+		},
+		{
+			name: "host networking",
+			published: raft.WorkloadService{ServiceName: "web", Spec: spec(ContainerConfig{
+				Image: "nginx",
+				Host:  HostSpec{NetworkMode: "host"},
+			})},
+			wantErr: "host networking",
+		},
+		{
+			name: "volumes",
+			published: raft.WorkloadService{ServiceName: "db", Spec: spec(ContainerConfig{
+				Image:  "postgres",
+				Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: "pgdata", Target: "/var/lib/postgresql/data"}},
+			})},
+			wantErr: "volumes stay on node1, which is down",
+		},
+		{
+			name: "environment withheld",
+			published: raft.WorkloadService{ServiceName: "web", Spec: spec(ContainerConfig{Image: "nginx"}),
+				EnvWithheld: true},
+			wantErr: "environment not published, node1 has no cluster token",
+		},
+		{
+			name: "environment sealed with another token",
+			published: raft.WorkloadService{ServiceName: "web", Spec: spec(ContainerConfig{Image: "nginx"}),
+				SealedEnv: sealed("other-token")},
+			wantErr: "failed to decrypt environment",
+		},
+		{
+			name:      "newer spec",
+			published: raft.WorkloadService{ServiceName: "web", Spec: spec(ContainerConfig{Version: ContainerSpecVersion + 1})},
+			wantErr:   ErrUnsupportedSpecVersion.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := recoverableSpec("node1", tt.published, "cluster-token")
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "nginx", config.Image)
+		})
+	}
+}
+
+func TestMigrationManager_RecoveryServices(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+	manager.SetMigrationRules([]MigrationRule{{ServiceName: "api", Priority: 10}})
+
+	assert.Empty(t, manager.recoveryServices("node1"))
+
+	stateless, err := json.Marshal(ContainerConfig{Image: "nginx"})
+	require.NoError(t, err)
+	require.NoError(t, manager.store.PutWorkload(&raft.NodeWorkload{
+		NodeName: "node1",
+		Services: []raft.WorkloadService{
+			{ServiceName: "web", Spec: stateless},
+			{ServiceName: "broken", Error: "container not found"},
+			{ServiceName: "api", Spec: stateless},
+		},
+	}))
+
+	services := manager.recoveryServices("node1")
+	require.Len(t, services, 3)
+	assert.Equal(t, "api", services[0].ServiceName) // Highest priority first
+	assert.Equal(t, raft.DrainServicePending, services[0].Status)
+	assert.Equal(t, "broken", services[1].ServiceName)
+	assert.Equal(t, raft.DrainServiceUnmovable, services[1].Status)
+	assert.Equal(t, "web", services[2].ServiceName)
+	assert.Equal(t, raft.DrainServicePending, services[2].Status)
+}
@@ -0,0 +1,244 @@
+package failover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Container labels that define migration hooks. Hook commands run through "sh -c";
+// several hooks are defined with numbered labels (e.g. constellation.migration.pre-hook.1)
+// and run in suffix order.
+const (
+	PreMigrationHookLabel     = "constellation.migration.pre-hook"
+	PostMigrationHookLabel    = "constellation.migration.post-hook"
+	MigrationHookTimeoutLabel = "constellation.migration.hook-timeout"
+)
+
+const (
+	defaultHookTimeout = time.Minute
+	maxHookTimeout     = 30 * time.Minute
+	maxHookOutput      = 4096
+)
+
+// MigrationHook is a command run inside a service container during a migration.
+// A non-zero exit status fails the migration attempt.
+type MigrationHook struct {
+	Name    string        `json:"name"`
+	Command []string      `json:"command"`
+	Timeout time.Duration `json:"timeout,omitempty"` // default 1m
+}
+
+// HookResult is the outcome of a hook command
+type HookResult struct {
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output"` // combined stdout and stderr, truncated to the last 4KiB
+}
+
+// hookTimeout returns how long a hook may run
+func hookTimeout(hook MigrationHook) time.Duration {
+	if hook.Timeout <= 0 {
+		return defaultHookTimeout
+	}
+	if hook.Timeout > maxHookTimeout {
+		return maxHookTimeout
+	}
+	return hook.Timeout
+}
+
+// migrationHooks returns the hooks for a migration. Hooks configured on the rule take
+// precedence over hooks defined in container labels.
+func migrationHooks(rule MigrationRule, labels map[string]string) (pre, post []MigrationHook) {
+	pre = rule.PreHooks
+	if len(pre) == 0 {
+		pre = hooksFromLabels(labels, PreMigrationHookLabel)
+	}
+	post = rule.PostHooks
+	if len(post) == 0 {
+		post = hooksFromLabels(labels, PostMigrationHookLabel)
+	}
+	return pre, post
+}
+
+// HooksFor returns the hooks configured on a service's migration rule
+func (mm *MigrationManager) HooksFor(serviceName string) (pre, post []MigrationHook) {
+	rule := mm.ruleFor(serviceName)
+	return rule.PreHooks, rule.PostHooks
+}
+
+// hooksFromLabels parses the hooks defined under a label prefix
+func hooksFromLabels(labels map[string]string, prefix string) []MigrationHook {
+	timeout := defaultHookTimeout
+	if value, ok := labels[MigrationHookTimeoutLabel]; ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: Ignoring invalid %s label %q", MigrationHookTimeoutLabel, value)
+		} else {
+			timeout = parsed
+		}
+	}
+
+	type labelHook struct {
+		order int
+		hook  MigrationHook
+	}
+	var found []labelHook
+	for key, value := range labels {
+		order := 0
+		if key != prefix {
+			suffix, ok := strings.CutPrefix(key, prefix+".")
+			if !ok {
+				continue
+			}
+			n, err := strconv.Atoi(suffix)
+			if err != nil || n < 0 {
+				log.Printf("Warning: Ignoring migration hook label %s: suffix must be a number", key)
+				continue
+			}
+			order = n
+		}
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		found = append(found, labelHook{
+			order: order,
+			hook: MigrationHook{
+				Name:    key,
+				Command: []string{"sh", "-c", value},
+				Timeout: timeout,
+			},
+		})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].order != found[j].order {
+			return found[i].order < found[j].order
+		}
+		return found[i].hook.Name < found[j].hook.Name
+	})
+
+	hooks := make([]MigrationHook, len(found))
+	for i, f := range found {
+		hooks[i] = f.hook
+	}
+	return hooks
+}
+
+// execInContainer runs a command inside a running container and waits for it to exit
+func execInContainer(ctx context.Context, cli *client.Client, containerID string, command []string, timeout time.Duration) (*HookResult, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("hook command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	exec, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          command,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach exec: %w", err)
+	}
+	defer resp.Close()
+
+	// Closing the connection when the context ends unblocks the copy below
+	stop := context.AfterFunc(ctx, resp.Close)
+	defer stop()
+
+	output := &tailBuffer{limit: maxHookOutput}
+	if _, err := stdcopy.StdCopy(output, output, resp.Reader); err != nil && ctx.Err() == nil {
+		return nil, fmt.Errorf("failed to read exec output: %w", err)
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("hook timed out after %v", timeout)
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+
+	return &HookResult{ExitCode: inspect.ExitCode, Output: output.String()}, nil
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	if extra := t.buf.Len() - t.limit; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return t.buf.String()
+}
+
+// hookError describes a failed hook, including the tail of its output
+func hookError(hook MigrationHook, result *HookResult) error {
+	output := strings.TrimSpace(result.Output)
+	if len(output) > 512 {
+		output = "..." + output[len(output)-512:]
+	}
+	if output == "" {
+		return fmt.Errorf("hook %s exited with status %d", hook.Name, result.ExitCode)
+	}
+	return fmt.Errorf("hook %s exited with status %d: %s", hook.Name, result.ExitCode, output)
+}
+
+// runHooks runs hooks in order, recording each as a migration step. The first
+// failing hook stops the run.
+func (mm *MigrationManager) runHooks(migration *Migration, stage string, hooks []MigrationHook, exec func(MigrationHook) (*HookResult, error)) error {
+	for _, hook := range hooks {
+		step := fmt.Sprintf("%s_hook:%s", stage, hook.Name)
+		log.Printf("Running %s-migration hook %s for %s", stage, hook.Name, migration.ServiceName)
+
+		mm.beginStep(migration, step)
+		result, err := exec(hook)
+		if err == nil && result.ExitCode != 0 {
+			err = hookError(hook, result)
+		}
+		mm.endStep(migration, step, err)
+		if err != nil {
+			return fmt.Errorf("%s-migration hook failed: %w", stage, err)
+		}
+	}
+	return nil
+}
+
+// runPreHooks runs the pre-migration hooks inside the source container
+func (mm *MigrationManager) runPreHooks(ctx context.Context, migration *Migration, run *migrationRun) error {
+	pre, _ := migrationHooks(run.rule, run.config.Labels)
+	return mm.runHooks(migration, "pre", pre, func(hook MigrationHook) (*HookResult, error) {
+		return execInContainer(ctx, mm.dockerClient, run.containerID, hook.Command, hookTimeout(hook))
+	})
+}
+
+// runPostHooks runs the post-migration hooks inside the target container
+func (mm *MigrationManager) runPostHooks(ctx context.Context, migration *Migration, run *migrationRun) error {
+	_, post := migrationHooks(run.rule, run.config.Labels)
+	return mm.runHooks(migration, "post", post, func(hook MigrationHook) (*HookResult, error) {
+		return run.target.ExecContainer(ctx, run.targetContainerID, hook)
+	})
+}
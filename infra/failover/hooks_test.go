@@ -0,0 +1,66 @@
+package failover
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooksFromLabels(t *testing.T) {
+	labels := map[string]string{
+		PreMigrationHookLabel + ".2":  "redis-cli BGSAVE",
+		PreMigrationHookLabel:         "sync",
+		PreMigrationHookLabel + ".10": "echo done",
+		PreMigrationHookLabel + ".x":  "ignored",
+		PostMigrationHookLabel:        "redis-cli PING",
+		MigrationHookTimeoutLabel:     "5m",
+		"other":                       "value",
+	}
+
+	pre := hooksFromLabels(labels, PreMigrationHookLabel)
+	require.Len(t, pre, 3)
+	assert.Equal(t, []string{"sh", "-c", "sync"}, pre[0].Command)
+	assert.Equal(t, []string{"sh", "-c", "redis-cli BGSAVE"}, pre[1].Command)
+	assert.Equal(t, []string{"sh", "-c", "echo done"}, pre[2].Command)
+	assert.Equal(t, 5*time.Minute, pre[0].Timeout)
+
+	post := hooksFromLabels(labels, PostMigrationHookLabel)
+	require.Len(t, post, 1)
+	assert.Equal(t, PostMigrationHookLabel, post[0].Name)
+}
+
+func TestMigrationHooks_RuleOverridesLabels(t *testing.T) {
+	labels := map[string]string{
+		PreMigrationHookLabel:  "from-label",
+		PostMigrationHookLabel: "from-label",
+	}
+	rule := MigrationRule{
+		PreHooks: []MigrationHook{{Name: "checkpoint", Command: []string{"pg_checkpoint"}}},
+	}
+
+	pre, post := migrationHooks(rule, labels)
+	require.Len(t, pre, 1)
+	assert.Equal(t, "checkpoint", pre[0].Name)
+	require.Len(t, post, 1)
+	assert.Equal(t, []string{"sh", "-c", "from-label"}, post[0].Command)
+}
+
+func TestHookTimeout(t *testing.T) {
+	assert.Equal(t, defaultHookTimeout, hookTimeout(MigrationHook{}))
+	assert.Equal(t, 10*time.Second, hookTimeout(MigrationHook{Timeout: 10 * time.Second}))
+	assert.Equal(t, maxHookTimeout, hookTimeout(MigrationHook{Timeout: 24 * time.Hour}))
+}
+
+func TestTailBuffer(t *testing.T) {
+	buf := &tailBuffer{limit: 8}
+	buf.Write([]byte("hello "))
+	buf.Write([]byte("world"))
+	assert.Equal(t, "lo world", buf.String())
+
+	err := hookError(MigrationHook{Name: "save"}, &HookResult{ExitCode: 1, Output: strings.Repeat("x", 600) + "\n"})
+	assert.Contains(t, err.Error(), "status 1")
+	assert.Less(t, len(err.Error()), 600)
+}
@@ -0,0 +1,62 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+
+	"cluster/infra/monitoring"
+)
+
+var (
+	// ErrContainerNotFound is returned when no container on this node is an instance of a service
+	ErrContainerNotFound = errors.New("container not found on node")
+	// ErrAmbiguousContainer is returned when several containers on this node are instances of a service
+	ErrAmbiguousContainer = errors.New("several containers match the service")
+)
+
+// findServiceContainer returns the container of a service on this node. Containers are
+// matched by the identity service monitoring derives from their labels, so a service is
+// found whatever its container is named and never confused with one whose name contains
+// it. With all, stopped containers are considered too.
+func (mm *MigrationManager) findServiceContainer(ctx context.Context, serviceName string, all bool) (*types.Container, error) {
+	if mm.dockerClient == nil {
+		return nil, fmt.Errorf("Docker client not available")
+	}
+
+	containers, err := mm.dockerClient.ContainerList(ctx, types.ContainerListOptions{All: all})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	return matchServiceContainer(containers, serviceName)
+}
+
+// matchServiceContainer picks the only container that is an instance of a service
+func matchServiceContainer(containers []types.Container, serviceName string) (*types.Container, error) {
+	matches := make([]types.Container, 0, 1)
+	for _, c := range containers {
+		name := ""
+		if len(c.Names) > 0 {
+			name = c.Names[0]
+		}
+		if identity, ok := monitoring.ResolveServiceIdentity(name, c.Labels); ok && identity.Name == serviceName {
+			matches = append(matches, c)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrContainerNotFound, serviceName)
+	case 1:
+		return &matches[0], nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, c := range matches {
+		names = append(names, containerName(c))
+	}
+	return nil, fmt.Errorf("%w %s: %s", ErrAmbiguousContainer, serviceName, strings.Join(names, ", "))
+}
@@ -0,0 +1,47 @@
+package failover
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchServiceContainer(t *testing.T) {
+	containers := []types.Container{
+		{ID: "a1", Names: []string{"/redis-commander"}},
+		{ID: "b2", Names: []string{"/cache-redis-1"}, Labels: map[string]string{
+			"com.docker.compose.project": "cache",
+			"com.docker.compose.service": "redis",
+		}},
+		{ID: "c3", Names: []string{"/api-blue"}, Labels: map[string]string{"constellation.service": "api"}},
+		{ID: "d4", Names: []string{"/api-green"}, Labels: map[string]string{"constellation.service": "api"}},
+		{ID: "e5", Names: []string{"/worker"}, Labels: map[string]string{"constellation.enable": "false"}},
+	}
+
+	tests := []struct {
+		name    string
+		service string
+		wantID  string
+		wantErr error
+	}{
+		{name: "compose service, not a name substring", service: "redis", wantID: "b2"},
+		{name: "container name", service: "redis-commander", wantID: "a1"},
+		{name: "several instances", service: "api", wantErr: ErrAmbiguousContainer},
+		{name: "compose container name is not the service", service: "cache-redis-1", wantErr: ErrContainerNotFound},
+		{name: "monitoring disabled", service: "worker", wantErr: ErrContainerNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchServiceContainer(containers, tt.service)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantID, got.ID)
+		})
+	}
+}
@@ -3,17 +3,17 @@ package failover
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/google/uuid"
 
 	"cluster/infra/cluster/gossip"
+	"cluster/infra/cluster/raft"
 	"cluster/infra/monitoring"
 )
 
@@ -23,25 +23,54 @@ type MigrationManager struct {
 	gossipState  *gossip.ClusterState
 	nodeName     string
 	mu           sync.RWMutex
-	migrations   map[string]*Migration // service name -> active migration
-	// Remote Docker access configuration
-	remoteDockerPort int  // Port for remote Docker API access (default 2375)
-	remoteDockerTLS  bool // Whether to use TLS for remote Docker access
+	migrations   map[string]*Migration         // service name -> active migration
+	store        MigrationStore                // Durable, cluster-wide migration records
+	handles      map[string]*migrationHandle   // service name -> running migration goroutine
+	cleanups     map[string]context.CancelFunc // migration ID -> scheduled source cleanup
+	eventHandler func(MigrationEvent)
+	// Node drain
+	rules         []MigrationRule     // Per-service settings used when draining
+	cordonHandler func(cordoned bool) // Publishes this node's cordon state
+	drainMu       sync.Mutex
+	drains        map[string]*drainState // node name -> drain coordinated by this node
+	startedAt     time.Time
+	// Agent-to-agent transfer configuration
+	targetAPIPort int            // API port of target agents (migration receive API)
+	clusterToken  string         // Shared token authenticating transfer requests
+	hostRoot      string         // Prefix for host paths when the agent runs in a container (e.g. /host)
+	registry      RegistryConfig // Cluster registry for image distribution; save/load when disabled
+	specDir       string         // Where exported container specs are kept until their migration ends
 	// Metrics collection
 	metricsCollector *monitoring.MetricsCollector
 	lastMetrics      *monitoring.NodeMetrics
+	triggers         map[string]*resourceTrigger // service name -> resource trigger state
 	metricsMu        sync.RWMutex
 }
 
 // Migration represents an active container migration
 type Migration struct {
-	ServiceName string
-	SourceNode  string
-	TargetNode  string
-	Status      MigrationStatus
-	StartedAt   time.Time
-	CompletedAt *time.Time
-	Error       error
+	ID                string
+	ServiceName       string
+	SourceNode        string
+	TargetNode        string
+	SourceContainerID string
+	TargetContainerID string
+	Status            MigrationStatus
+	Phase             MigrationPhase
+	Attempt           int      // 1-based attempt number
+	FailedTargets     []string // Targets abandoned after repeated failures
+	Reason            string   // What triggered the migration
+	StartedAt         time.Time
+	CompletedAt       *time.Time
+	CleanupAt         *time.Time              // When the source container is due to be stopped
+	Coordinator       string                  // Node running the migration when the source node is down
+	PendingAction     string                  // Left for the source node (raft.PendingRestartSource, raft.PendingRollback)
+	Progress          *raft.MigrationProgress // What the completed phases produced
+	Error             error
+	Transitions       []raft.MigrationTransition
+	Steps             []raft.MigrationStep
+
+	cancelRequested bool
 }
 
 // MigrationStatus represents the status of a migration
@@ -52,22 +81,36 @@ const (
 	MigrationStatusRunning   MigrationStatus = "running"
 	MigrationStatusCompleted MigrationStatus = "completed"
 	MigrationStatusFailed    MigrationStatus = "failed"
+	MigrationStatusCancelled MigrationStatus = "cancelled"
+	// MigrationStatusRolledBack means the source container was restarted and the target removed
+	MigrationStatusRolledBack MigrationStatus = "rolled_back"
 )
 
 // MigrationRule defines when and how to migrate containers
 type MigrationRule struct {
 	ServiceName string
 	Trigger     MigrationTrigger
-	TargetNode  string // empty = auto-select
-	Priority    int    // higher = more important
-	MaxRetries  int
-	RetryDelay  time.Duration
+	TargetNode  string        // empty = auto-select
+	Priority    int           // higher = more important
+	MaxRetries  int           // retries after the first attempt
+	RetryDelay  time.Duration // base delay, doubled after each failed attempt
+	// MaxTargetFailures is the number of failed attempts on one auto-selected
+	// target before falling back to another node (default 2)
+	MaxTargetFailures int
+	// CleanupGracePeriod is how long the source container keeps running after
+	// cutover before it is stopped (default 5m)
+	CleanupGracePeriod time.Duration
+	// PreHooks run in the source container before it is frozen for the final sync,
+	// PostHooks in the target container once it is healthy. They override hooks
+	// defined in container labels.
+	PreHooks  []MigrationHook
+	PostHooks []MigrationHook
 }
 
 // MigrationTrigger defines what triggers a migration
 type MigrationTrigger struct {
 	HealthCheckFailures int    // migrate after N consecutive failures
-	ResourceThreshold   string // e.g., "cpu>80%" or "memory>90%"
+	ResourceThreshold   string // e.g., "cpu>80%" or "cpu>85% for 5m || (memory>=90% && disk>80%)"
 	NodeUnhealthy       bool   // migrate if node becomes unhealthy
 }
 
@@ -78,20 +121,103 @@ func NewMigrationManager(dockerClient *client.Client, gossipState *gossip.Cluste
 		gossipState:      gossipState,
 		nodeName:         nodeName,
 		migrations:       make(map[string]*Migration),
-		remoteDockerPort: 2375,  // Default Docker API port
-		remoteDockerTLS:  false, // Default to no TLS (can be configured)
+		store:            newMemoryMigrationStore(),
+		handles:          make(map[string]*migrationHandle),
+		cleanups:         make(map[string]context.CancelFunc),
+		drains:           make(map[string]*drainState),
+		startedAt:        time.Now(),
+		targetAPIPort:    8080,
 		metricsCollector: monitoring.NewMetricsCollector(),
+		triggers:         make(map[string]*resourceTrigger),
+	}
+}
+
+// SetMigrationStore replaces the default in-memory store with a durable one
+func (mm *MigrationManager) SetMigrationStore(store MigrationStore) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.store = store
+}
+
+// SetTransferConfig configures how the source agent reaches target agents and
+// where it reads volume data from
+func (mm *MigrationManager) SetTransferConfig(apiPort int, clusterToken, hostRoot string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.targetAPIPort = apiPort
+	mm.clusterToken = clusterToken
+	mm.hostRoot = hostRoot
+}
+
+// SetSpecDir keeps the container specs of running migrations in dir, so they can be
+// resumed after an agent restart. Specs hold environment secrets and never leave the agent.
+func (mm *MigrationManager) SetSpecDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create migration spec directory: %w", err)
 	}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.specDir = dir
+	return nil
+}
+
+// SetImageRegistry distributes images through a cluster registry instead of copying
+// whole images to the target
+func (mm *MigrationManager) SetImageRegistry(config RegistryConfig) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.registry = config
+}
+
+// SetMetricsCollector sets the collector used for resource triggers, so CPU and IO
+// deltas are shared with the agent's other metrics consumers
+func (mm *MigrationManager) SetMetricsCollector(collector *monitoring.MetricsCollector) {
+	mm.metricsMu.Lock()
+	defer mm.metricsMu.Unlock()
+
+	mm.metricsCollector = collector
+}
+
+// newTargetClient creates a client for the migration receive API of the agent at host
+func (mm *MigrationManager) newTargetClient(host string) *TargetClient {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	return NewTargetClient(host, mm.targetAPIPort, mm.clusterToken)
+}
+
+// transferToken returns the cluster token shared by the agents
+func (mm *MigrationManager) transferToken() string {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	return mm.clusterToken
 }
 
 // StartMigration starts migrating a container to another node
 func (mm *MigrationManager) StartMigration(ctx context.Context, rule MigrationRule) error {
+	return mm.StartMigrationWithReason(ctx, rule, "manual")
+}
+
+// StartMigrationWithReason starts a migration and records what triggered it
+func (mm *MigrationManager) StartMigrationWithReason(ctx context.Context, rule MigrationRule, reason string) error {
+	return mm.startMigration(ctx, rule, reason, mm.nodeName, newMigrationRun(rule))
+}
+
+// startMigration starts a migration of a service off sourceNode, run by this node's agent.
+// A run for another source node comes with the container spec it recorded.
+func (mm *MigrationManager) startMigration(ctx context.Context, rule MigrationRule, reason, sourceNode string, run *migrationRun) error {
 	mm.mu.Lock()
-	defer mm.mu.Unlock()
 
 	// Check if migration already in progress
 	if existing, exists := mm.migrations[rule.ServiceName]; exists {
 		if existing.Status == MigrationStatusRunning || existing.Status == MigrationStatusPending {
+			mm.mu.Unlock()
 			return fmt.Errorf("migration already in progress for service %s", rule.ServiceName)
 		}
 	}
@@ -100,334 +226,527 @@ func (mm *MigrationManager) StartMigration(ctx context.Context, rule MigrationRu
 	targetNode := rule.TargetNode
 	if targetNode == "" {
 		var err error
-		targetNode, err = mm.selectTargetNode(rule.ServiceName)
+		targetNode, err = mm.selectTargetNodeExcluding(mm.store, rule.ServiceName, sourceNode, nil)
 		if err != nil {
+			mm.mu.Unlock()
 			return fmt.Errorf("failed to select target node: %w", err)
 		}
 	}
 
 	// Create migration record
+	now := time.Now()
 	migration := &Migration{
+		ID:          uuid.New().String(),
 		ServiceName: rule.ServiceName,
-		SourceNode:  mm.nodeName,
+		SourceNode:  sourceNode,
 		TargetNode:  targetNode,
 		Status:      MigrationStatusPending,
-		StartedAt:   time.Now(),
+		Phase:       PhasePending,
+		Reason:      reason,
+		StartedAt:   now,
+		Progress:    run.progress(),
+		Transitions: []raft.MigrationTransition{
+			{Status: string(MigrationStatusPending), Phase: string(PhasePending), At: now, Message: reason},
+		},
+	}
+	if sourceNode != mm.nodeName {
+		migration.Coordinator = mm.nodeName
+		migration.SourceContainerID = run.containerID
 	}
 
-	mm.migrations[rule.ServiceName] = migration
+	runCtx, handle := mm.registerMigration(ctx, migration)
+	record := migration.toRecord()
+	mm.mu.Unlock()
+
+	// A recovery starts with the spec its source node published
+	if run.config != nil {
+		mm.saveSpec(migration.ID, run.config)
+	}
+	mm.persist(record)
+	mm.emit(migrationEvent(migration, record.Status, reason))
 
 	// Start migration in background
-	go mm.executeMigration(ctx, migration, rule)
+	go mm.runMigration(runCtx, handle, migration, run)
 
 	return nil
 }
 
-// selectTargetNode selects the best target node for migration
-func (mm *MigrationManager) selectTargetNode(serviceName string) (string, error) {
-	state := mm.gossipState
-	allNodes := state.GetAllNodes()
+// registerMigration makes a migration the active one of its service, with a handle to
+// control the goroutine that runs it (caller must hold mm.mu)
+func (mm *MigrationManager) registerMigration(ctx context.Context, migration *Migration) (context.Context, *migrationHandle) {
+	runCtx, cancel := context.WithCancel(ctx)
+	handle := &migrationHandle{cancel: cancel, done: make(chan struct{})}
 
-	// Filter to healthy, non-cordoned nodes (excluding current node)
-	candidates := make([]*gossip.NodeMetadata, 0)
-	for _, node := range allNodes {
-		if node.Name == mm.nodeName {
-			continue // Skip current node
-		}
-		if node.Cordoned {
-			continue // Skip cordoned nodes
-		}
+	mm.migrations[migration.ServiceName] = migration
+	mm.handles[migration.ServiceName] = handle
+	return runCtx, handle
+}
 
-		// Check if node already has this service
-		health, exists := state.GetServiceHealth(serviceName, node.Name)
-		if exists && health.Healthy {
-			continue // Skip nodes that already have healthy instance
-		}
+// runMigration executes a registered migration and releases its handle
+func (mm *MigrationManager) runMigration(ctx context.Context, handle *migrationHandle, migration *Migration, run *migrationRun) {
+	defer close(handle.done)
+	defer handle.cancel()
 
-		candidates = append(candidates, node)
-	}
+	mm.executeMigration(ctx, migration, run)
 
-	if len(candidates) == 0 {
-		return "", fmt.Errorf("no suitable target nodes available")
-	}
-
-	// Select node with lowest priority (fastest nodes first)
-	bestNode := candidates[0]
-	for _, node := range candidates[1:] {
-		if node.Priority < bestNode.Priority {
-			bestNode = node
-		}
+	mm.mu.Lock()
+	if mm.handles[migration.ServiceName] == handle {
+		delete(mm.handles, migration.ServiceName)
 	}
-
-	return bestNode.Name, nil
+	mm.mu.Unlock()
 }
 
-// executeMigration performs the actual container migration from source to target node
-func (mm *MigrationManager) executeMigration(ctx context.Context, migration *Migration, rule MigrationRule) {
-	mm.mu.Lock()
-	migration.Status = MigrationStatusRunning
-	mm.mu.Unlock()
+// ResumeMigrations continues the migrations this node's agent was running when it
+// stopped, from the phase after the last one they completed. It is safe to call
+// repeatedly; migrations already running are skipped.
+func (mm *MigrationManager) ResumeMigrations(ctx context.Context) {
+	records, _ := mm.ListMigrationHistory(raft.MigrationFilter{})
 
-	log.Printf("Starting migration of %s from %s to %s", migration.ServiceName, migration.SourceNode, migration.TargetNode)
+	for _, record := range records {
+		migration := migrationFromRecord(record)
+		if migration.Status.IsTerminal() || migration.Runner() != mm.nodeName {
+			continue
+		}
 
-	// Step 1: Validate container exists and is running on source node
-	if mm.dockerClient == nil {
 		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("Docker client not available")
+		if _, running := mm.handles[migration.ServiceName]; running {
+			mm.mu.Unlock()
+			continue
+		}
+		if existing, exists := mm.migrations[migration.ServiceName]; exists && existing.StartedAt.After(migration.StartedAt) {
+			mm.mu.Unlock()
+			continue
+		}
+		mm.migrations[migration.ServiceName] = migration
 		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: Docker client not available", migration.ServiceName)
-		return
-	}
 
-	// Find container on source node
-	containers, err := mm.dockerClient.ContainerList(ctx, types.ContainerListOptions{
-		All: true,
-		Filters: filters.NewArgs(
-			filters.Arg("name", migration.ServiceName),
-		),
-	})
-	if err != nil {
+		run, err := mm.resumeRun(migration)
+		if err != nil {
+			mm.failMigration(migration, fmt.Errorf("cannot resume after agent restart: %w", err))
+			continue
+		}
+
 		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("failed to list containers: %w", err)
+		runCtx, handle := mm.registerMigration(ctx, migration)
 		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
-		return
+
+		next := PhaseExporting
+		for _, phase := range migrationPhases {
+			if !run.done[phase] {
+				next = phase
+				break
+			}
+		}
+		log.Printf("Resuming migration %s of %s at the %s phase after agent restart", migration.ID, migration.ServiceName, next)
+		mm.annotate(migration, fmt.Sprintf("resumed at the %s phase after agent restart", next))
+		go mm.runMigration(runCtx, handle, migration, run)
 	}
+}
 
-	if len(containers) == 0 {
-		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("container %s not found on source node", migration.ServiceName)
-		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: container not found", migration.ServiceName)
-		return
+// selectTargetNode selects the best target node for migration
+func (mm *MigrationManager) selectTargetNode(serviceName string) (string, error) {
+	return mm.selectTargetNodeExcluding(mm.migrationStore(), serviceName, mm.nodeName, nil)
+}
+
+// TargetCandidate is a node considered as a migration target
+type TargetCandidate struct {
+	Node     string `json:"node"`
+	Priority int    `json:"priority"`
+	Eligible bool   `json:"eligible"`
+	Reason   string `json:"reason,omitempty"` // Why the node was skipped
+}
+
+// evaluateTargets checks every node but the source as a migration target for a service.
+// It must not take mm.mu, because StartMigrationWithReason holds it: callers pass the
+// store drains are read from.
+func (mm *MigrationManager) evaluateTargets(store MigrationStore, serviceName, sourceNode string, exclude map[string]bool) []TargetCandidate {
+	state := mm.gossipState
+	allNodes := state.GetAllNodes()
+
+	candidates := make([]TargetCandidate, 0, len(allNodes))
+	for _, node := range allNodes {
+		if node.Name == sourceNode {
+			continue
+		}
+
+		candidate := TargetCandidate{Node: node.Name, Priority: node.Priority}
+		if health, exists := state.GetServiceHealth(serviceName, node.Name); exists && health.Healthy {
+			candidate.Reason = "already runs a healthy instance"
+		}
+		switch {
+		case node.Cordoned:
+			candidate.Reason = "cordoned"
+		case isDrained(store, node.Name):
+			candidate.Reason = "drained"
+		case exclude[node.Name]:
+			candidate.Reason = "already failed this migration"
+		}
+		candidate.Eligible = candidate.Reason == ""
+		candidates = append(candidates, candidate)
 	}
 
-	containerID := containers[0].ID
-	log.Printf("Found container %s on source node", containerID)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Node < candidates[j].Node
+	})
+	return candidates
+}
 
-	// Step 2: Inspect container to get full configuration
-	containerConfig, err := ExportContainerConfig(ctx, mm.dockerClient, containerID)
-	if err != nil {
-		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("failed to export container config: %w", err)
-		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
-		return
+// bestTarget returns the eligible candidate with the lowest priority (fastest nodes first)
+func bestTarget(candidates []TargetCandidate) (string, bool) {
+	best := -1
+	for i, candidate := range candidates {
+		if candidate.Eligible && (best < 0 || candidate.Priority < candidates[best].Priority) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
 	}
+	return candidates[best].Node, true
+}
 
-	// Step 3: Get target node information from gossip state
-	state := mm.gossipState
-	targetNode, exists := state.GetNode(migration.TargetNode)
-	if !exists {
-		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("target node %s not found in cluster", migration.TargetNode)
-		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: target node not found", migration.ServiceName)
-		return
+// selectTargetNodeExcluding selects the best target node, skipping the excluded nodes
+func (mm *MigrationManager) selectTargetNodeExcluding(store MigrationStore, serviceName, sourceNode string, exclude map[string]bool) (string, error) {
+	target, ok := bestTarget(mm.evaluateTargets(store, serviceName, sourceNode, exclude))
+	if !ok {
+		return "", fmt.Errorf("no suitable target nodes available")
 	}
+	return target, nil
+}
 
-	// Step 4: Create remote Docker client for target node
-	remoteDocker, err := NewRemoteDockerClient(targetNode.TailscaleIP, mm.remoteDockerPort, mm.remoteDockerTLS)
-	if err != nil {
-		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("failed to create remote Docker client: %w", err)
-		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
-		return
+// executeMigration drives the migration state machine, retrying failed attempts
+// with exponential backoff and falling back to another target when one keeps failing
+func (mm *MigrationManager) executeMigration(ctx context.Context, migration *Migration, run *migrationRun) {
+	mm.mu.RLock()
+	status := migration.Status
+	firstAttempt := migration.Attempt // Non-zero when resumed after a restart
+	mm.mu.RUnlock()
+	if status != MigrationStatusRunning {
+		mm.transition(migration, MigrationStatusRunning, "")
+	}
+	if firstAttempt < 1 {
+		firstAttempt = 1
 	}
 
-	remoteCli, err := remoteDocker.CreateClient(ctx)
-	if err != nil {
+	log.Printf("Starting migration of %s from %s to %s", migration.ServiceName, migration.SourceNode, migration.TargetNode)
+
+	rule := run.rule
+
+	targetFailures := make(map[string]int)
+	maxAttempts := rule.MaxRetries + 1
+
+	for attempt := firstAttempt; ; attempt++ {
 		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("failed to connect to remote Docker daemon: %w", err)
+		migration.Attempt = attempt
+		targetNode := migration.TargetNode
 		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
-		return
-	}
-	defer remoteCli.Close()
 
-	log.Printf("Connected to Docker daemon on target node %s", migration.TargetNode)
+		err := mm.runAttempt(ctx, migration, run)
+		if err == nil {
+			break
+		}
 
-	// Step 5: Ensure image exists on target node (pull if needed)
-	log.Printf("Ensuring image %s exists on target node", containerConfig.Image)
-	imageReader, err := ExportContainerImage(ctx, mm.dockerClient, containerConfig.Image)
-	if err != nil {
-		log.Printf("Warning: Failed to export image from source, attempting to pull on target: %v", err)
-		// Try to pull image on target instead
-		pullResp, pullErr := remoteCli.ImagePull(ctx, containerConfig.Image, types.ImagePullOptions{})
-		if pullErr != nil {
-			mm.mu.Lock()
-			migration.Status = MigrationStatusFailed
-			migration.Error = fmt.Errorf("failed to ensure image on target: %w (pull error: %v)", err, pullErr)
-			mm.mu.Unlock()
-			log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
+		if mm.isCancelRequested(migration) {
+			mm.finishCancel(migration, run)
 			return
 		}
-		io.Copy(io.Discard, pullResp)
-		pullResp.Close()
-	} else {
-		// Transfer image to target
-		defer imageReader.Close()
-		if err := LoadContainerImage(ctx, remoteCli, imageReader); err != nil {
-			log.Printf("Warning: Failed to load image on target, attempting pull: %v", err)
-			// Fallback to pull
-			pullResp, pullErr := remoteCli.ImagePull(ctx, containerConfig.Image, types.ImagePullOptions{})
-			if pullErr != nil {
-				mm.mu.Lock()
-				migration.Status = MigrationStatusFailed
-				migration.Error = fmt.Errorf("failed to transfer image: %w (pull error: %v)", err, pullErr)
-				mm.mu.Unlock()
-				log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
+
+		// Serve from the source again while waiting for the next attempt
+		mm.restartSource(migration, run)
+
+		if isPermanent(err) || attempt >= maxAttempts {
+			mm.failMigration(migration, err)
+			return
+		}
+
+		targetFailures[targetNode]++
+		if rule.TargetNode == "" && targetFailures[targetNode] >= maxTargetFailures(rule) {
+			mm.fallbackTarget(migration, run, targetNode)
+		}
+		mm.saveProgress(migration, run)
+
+		delay := retryBackoff(rule.RetryDelay, attempt)
+		log.Printf("Migration of %s attempt %d/%d failed, retrying in %v: %v", migration.ServiceName, attempt, maxAttempts, delay, err)
+		mm.transition(migration, MigrationStatusRunning, fmt.Sprintf("attempt %d failed, retrying in %v: %v", attempt, delay, err))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			if mm.isCancelRequested(migration) {
+				mm.finishCancel(migration, run)
 				return
 			}
-			io.Copy(io.Discard, pullResp)
-			pullResp.Close()
+			mm.failMigration(migration, fmt.Errorf("migration cancelled while waiting to retry: %w", ctx.Err()))
+			return
 		}
 	}
 
-	// Step 6: Transfer volumes (if any)
-	if len(containerConfig.Mounts) > 0 {
-		log.Printf("Transferring %d volume(s) to target node", len(containerConfig.Mounts))
-		if err := TransferVolumes(ctx, mm.dockerClient, remoteCli, containerID, containerConfig.Mounts, targetNode.TailscaleIP); err != nil {
-			log.Printf("Warning: Volume transfer failed (continuing anyway): %v", err)
-			// Continue migration even if volume transfer fails (volumes may be shared or not critical)
-		}
+	mm.transition(migration, MigrationStatusCompleted, "")
+
+	log.Printf("Migration of %s from %s to %s completed successfully", migration.ServiceName, migration.SourceNode, migration.TargetNode)
+}
+
+// fallbackTarget switches the migration to another node after repeated failures on failedTarget.
+// The current target is kept when no alternate node is available.
+func (mm *MigrationManager) fallbackTarget(migration *Migration, run *migrationRun, failedTarget string) {
+	mm.mu.Lock()
+	migration.FailedTargets = append(migration.FailedTargets, failedTarget)
+	exclude := make(map[string]bool, len(migration.FailedTargets))
+	for _, name := range migration.FailedTargets {
+		exclude[name] = true
 	}
+	mm.mu.Unlock()
 
-	// Step 7: Create container on target node
-	log.Printf("Creating container on target node %s", migration.TargetNode)
-	targetContainerID, err := CreateContainerOnRemote(ctx, remoteCli, containerConfig)
+	nextTarget, err := mm.selectTargetNodeExcluding(mm.migrationStore(), migration.ServiceName, migration.SourceNode, exclude)
 	if err != nil {
-		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("failed to create container on target: %w", err)
-		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
+		log.Printf("Warning: No alternate target for %s after repeated failures on %s, retrying same target: %v", migration.ServiceName, failedTarget, err)
 		return
 	}
 
-	log.Printf("Container created on target node: %s", targetContainerID)
+	mm.mu.Lock()
+	migration.TargetNode = nextTarget
+	mm.mu.Unlock()
+	run.resetTarget()
 
-	// Step 8: Start container on target node
-	log.Printf("Starting container on target node")
-	if err := remoteCli.ContainerStart(ctx, targetContainerID, types.ContainerStartOptions{}); err != nil {
-		// Cleanup: remove failed container
-		remoteCli.ContainerRemove(ctx, targetContainerID, types.ContainerRemoveOptions{Force: true})
-		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("failed to start container on target: %w", err)
-		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
-		return
+	log.Printf("Falling back to target %s for %s after repeated failures on %s", nextTarget, migration.ServiceName, failedTarget)
+	mm.transition(migration, MigrationStatusRunning, fmt.Sprintf("falling back from %s to %s", failedTarget, nextTarget))
+}
+
+// transition moves a migration to a new status and persists the change
+func (mm *MigrationManager) transition(migration *Migration, status MigrationStatus, message string) {
+	mm.mu.Lock()
+	now := time.Now()
+	migration.Status = status
+	migration.Transitions = append(migration.Transitions, raft.MigrationTransition{
+		Status:  string(status),
+		Phase:   string(migration.Phase),
+		At:      now,
+		Message: message,
+	})
+	if status.IsTerminal() {
+		migration.CompletedAt = &now
 	}
+	record := migration.toRecord()
+	event := migrationEvent(migration, record.Status, message)
+	mm.mu.Unlock()
 
-	// Step 9: Verify container health on target node
-	log.Printf("Verifying container health on target node")
-	healthTimeout := 60 * time.Second
-	if containerConfig.Healthcheck != nil {
-		// Wait longer if healthcheck is configured
-		healthTimeout = time.Duration(containerConfig.Healthcheck.Interval) * time.Duration(containerConfig.Healthcheck.Retries+1) * time.Second
-		if healthTimeout < 30*time.Second {
-			healthTimeout = 30 * time.Second
-		}
+	mm.persist(record)
+	mm.emit(event)
+
+	if status.IsTerminal() {
+		mm.removeSpec(migration.ID)
 	}
+}
 
-	if err := VerifyContainerHealth(ctx, remoteCli, targetContainerID, healthTimeout); err != nil {
-		// Container started but health check failed - rollback
-		log.Printf("Container health check failed, rolling back migration")
-		remoteCli.ContainerStop(ctx, targetContainerID, container.StopOptions{})
-		remoteCli.ContainerRemove(ctx, targetContainerID, types.ContainerRemoveOptions{Force: true})
-		mm.mu.Lock()
-		migration.Status = MigrationStatusFailed
-		migration.Error = fmt.Errorf("container health check failed on target: %w", err)
-		mm.mu.Unlock()
-		log.Printf("Migration of %s failed: %v", migration.ServiceName, migration.Error)
-		return
+// migrationEvent builds an event for a migration status change (caller must hold mm.mu)
+func migrationEvent(migration *Migration, status, message string) MigrationEvent {
+	return MigrationEvent{
+		Type:        "migration_" + status,
+		MigrationID: migration.ID,
+		ServiceName: migration.ServiceName,
+		SourceNode:  migration.SourceNode,
+		TargetNode:  migration.TargetNode,
+		Status:      MigrationStatus(status),
+		Message:     message,
+		Timestamp:   time.Now(),
 	}
+}
 
-	log.Printf("Container is healthy on target node")
+// IsTerminal reports whether a migration in this status has finished
+func (s MigrationStatus) IsTerminal() bool {
+	switch s {
+	case MigrationStatusCompleted, MigrationStatusFailed, MigrationStatusCancelled, MigrationStatusRolledBack:
+		return true
+	}
+	return false
+}
 
-	// Step 10: Update gossip state to reflect new service location
-	// The service health monitoring will detect the new container automatically
-	// but we can proactively update the state
-	log.Printf("Migration of %s completed successfully", migration.ServiceName)
+// failMigration marks a migration as failed with the given error
+func (mm *MigrationManager) failMigration(migration *Migration, err error) {
+	mm.mu.Lock()
+	migration.Error = err
+	mm.mu.Unlock()
 
-	// Step 11: Source container management
-	// The source container is kept running initially for rollback capability.
-	// After a grace period and verification that the target is stable, it can be stopped.
-	// This allows for quick rollback if issues are detected on the target node.
-	// The grace period and cleanup can be configured via migration rules or environment variables.
-	gracePeriod := 5 * time.Minute // Default grace period before cleanup
-	if rule.RetryDelay > 0 {
-		gracePeriod = rule.RetryDelay * 10 // Use retry delay as basis for grace period
-	}
+	mm.transition(migration, MigrationStatusFailed, err.Error())
+	log.Printf("Migration of %s failed: %v", migration.ServiceName, err)
+}
 
-	// Schedule source container cleanup after grace period
-	go func() {
-		cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), gracePeriod)
-		defer cleanupCancel()
+// enterPhase moves a migration to the next state machine phase and persists the change
+func (mm *MigrationManager) enterPhase(migration *Migration, phase MigrationPhase) {
+	mm.mu.Lock()
+	migration.Phase = phase
+	migration.Transitions = append(migration.Transitions, raft.MigrationTransition{
+		Status: string(migration.Status),
+		Phase:  string(phase),
+		At:     time.Now(),
+	})
+	record := migration.toRecord()
+	mm.mu.Unlock()
 
-		select {
-		case <-cleanupCtx.Done():
-			// Grace period expired, verify target is still healthy
-			targetHealth, exists := mm.gossipState.GetServiceHealth(migration.ServiceName, migration.TargetNode)
-			if exists && targetHealth.Healthy {
-				// Target is healthy, stop source container
-				log.Printf("Grace period expired and target is healthy, stopping source container %s", containerID)
-				stopTimeoutSeconds := 30
-				stopTimeout := time.Duration(stopTimeoutSeconds) * time.Second
-				if err := mm.dockerClient.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &stopTimeoutSeconds}); err != nil {
-					log.Printf("Warning: Failed to stop source container %s: %v", containerID, err)
-				} else {
-					log.Printf("Source container %s stopped successfully after grace period (%v)", containerID, stopTimeout)
-				}
-			} else {
-				log.Printf("Target health check failed, keeping source container %s for rollback", containerID)
-			}
-		case <-ctx.Done():
-			// Migration context cancelled, keep source container
-			return
-		}
-	}()
+	mm.persist(record)
+}
 
-	log.Printf("Source container %s will be stopped after grace period (%v) if target remains healthy", containerID, gracePeriod)
+// beginStep records the start of a migration step
+func (mm *MigrationManager) beginStep(migration *Migration, name string) {
+	mm.mu.Lock()
+	migration.Steps = append(migration.Steps, raft.MigrationStep{
+		Name:      name,
+		Attempt:   migration.Attempt,
+		StartedAt: time.Now(),
+	})
+	mm.mu.Unlock()
+}
 
+// endStep records the outcome of the most recent step with the given name and persists it
+func (mm *MigrationManager) endStep(migration *Migration, name string, err error) {
 	mm.mu.Lock()
-	migration.Status = MigrationStatusCompleted
-	now := time.Now()
-	migration.CompletedAt = &now
+	for i := len(migration.Steps) - 1; i >= 0; i-- {
+		step := &migration.Steps[i]
+		if step.Name != name || step.CompletedAt != nil {
+			continue
+		}
+		now := time.Now()
+		step.CompletedAt = &now
+		step.DurationMS = now.Sub(step.StartedAt).Milliseconds()
+		if err != nil {
+			step.Error = err.Error()
+		}
+		break
+	}
+	record := migration.toRecord()
 	mm.mu.Unlock()
 
-	log.Printf("Migration of %s from %s to %s completed successfully", migration.ServiceName, migration.SourceNode, migration.TargetNode)
+	mm.persist(record)
 }
 
-// GetMigrationStatus returns the status of a migration
-func (mm *MigrationManager) GetMigrationStatus(serviceName string) (*Migration, bool) {
+// persist writes a migration record to the store, logging failures
+func (mm *MigrationManager) persist(record *raft.MigrationRecord) {
 	mm.mu.RLock()
-	defer mm.mu.RUnlock()
+	store := mm.store
+	mm.mu.RUnlock()
+
+	if store == nil {
+		return
+	}
+	if err := store.PutMigration(record); err != nil {
+		log.Printf("Warning: Failed to persist migration record %s for %s: %v", record.ID, record.ServiceName, err)
+	}
+}
+
+// toRecord converts a migration to its replicated record (caller must hold mm.mu)
+func (m *Migration) toRecord() *raft.MigrationRecord {
+	record := &raft.MigrationRecord{
+		ID:                m.ID,
+		ServiceName:       m.ServiceName,
+		SourceNode:        m.SourceNode,
+		TargetNode:        m.TargetNode,
+		SourceContainerID: m.SourceContainerID,
+		TargetContainerID: m.TargetContainerID,
+		Status:            string(m.Status),
+		Phase:             string(m.Phase),
+		Attempt:           m.Attempt,
+		FailedTargets:     m.FailedTargets,
+		Reason:            m.Reason,
+		StartedAt:         m.StartedAt,
+		UpdatedAt:         time.Now(),
+		CompletedAt:       m.CompletedAt,
+		CleanupAt:         m.CleanupAt,
+		Coordinator:       m.Coordinator,
+		PendingAction:     m.PendingAction,
+		Progress:          m.Progress,
+		Transitions:       m.Transitions,
+		Steps:             m.Steps,
+	}
+	if m.Error != nil {
+		record.Error = m.Error.Error()
+	}
+	return record.Copy()
+}
 
+// migrationFromRecord converts a stored record back to a migration
+func migrationFromRecord(record *raft.MigrationRecord) *Migration {
+	migration := &Migration{
+		ID:                record.ID,
+		ServiceName:       record.ServiceName,
+		SourceNode:        record.SourceNode,
+		TargetNode:        record.TargetNode,
+		SourceContainerID: record.SourceContainerID,
+		TargetContainerID: record.TargetContainerID,
+		Status:            MigrationStatus(record.Status),
+		Phase:             MigrationPhase(record.Phase),
+		Attempt:           record.Attempt,
+		FailedTargets:     record.FailedTargets,
+		Reason:            record.Reason,
+		StartedAt:         record.StartedAt,
+		CompletedAt:       record.CompletedAt,
+		CleanupAt:         record.CleanupAt,
+		Coordinator:       record.Coordinator,
+		PendingAction:     record.PendingAction,
+		Progress:          record.Progress,
+		Transitions:       record.Transitions,
+		Steps:             record.Steps,
+	}
+	if record.Error != "" {
+		migration.Error = fmt.Errorf("%s", record.Error)
+	}
+	return migration
+}
+
+// Runner returns the node whose agent runs the migration
+func (m *Migration) Runner() string {
+	if m.Coordinator != "" {
+		return m.Coordinator
+	}
+	return m.SourceNode
+}
+
+// copy returns a snapshot of the migration (caller must hold mm.mu)
+func (m *Migration) copy() *Migration {
+	return migrationFromRecord(m.toRecord())
+}
+
+// GetMigrationStatus returns the status of a migration.
+// Falls back to the latest stored record when the migration did not run on this node.
+func (mm *MigrationManager) GetMigrationStatus(serviceName string) (*Migration, bool) {
+	mm.mu.RLock()
 	migration, exists := mm.migrations[serviceName]
-	if !exists {
+	if exists {
+		// Return a copy
+		result := migration.copy()
+		mm.mu.RUnlock()
+		return result, true
+	}
+	mm.mu.RUnlock()
+
+	records, _ := mm.ListMigrationHistory(raft.MigrationFilter{ServiceName: serviceName, Limit: 1})
+	if len(records) == 0 {
 		return nil, false
 	}
+	return migrationFromRecord(records[0]), true
+}
 
-	// Return a copy
-	return &Migration{
-		ServiceName: migration.ServiceName,
-		SourceNode:  migration.SourceNode,
-		TargetNode:  migration.TargetNode,
-		Status:      migration.Status,
-		StartedAt:   migration.StartedAt,
-		CompletedAt: migration.CompletedAt,
-		Error:       migration.Error,
-	}, true
+// GetMigrationRecord returns a stored migration record by ID
+func (mm *MigrationManager) GetMigrationRecord(id string) (*raft.MigrationRecord, bool) {
+	mm.mu.RLock()
+	store := mm.store
+	mm.mu.RUnlock()
+
+	if store == nil {
+		return nil, false
+	}
+	return store.GetMigration(id)
+}
+
+// ListMigrationHistory returns stored migration records, newest first, and the total match count
+func (mm *MigrationManager) ListMigrationHistory(filter raft.MigrationFilter) ([]*raft.MigrationRecord, int) {
+	mm.mu.RLock()
+	store := mm.store
+	mm.mu.RUnlock()
+
+	if store == nil {
+		return []*raft.MigrationRecord{}, 0
+	}
+	return store.ListMigrations(filter)
 }
 
 // MonitorAndMigrate monitors services and triggers migrations based on rules
@@ -435,11 +754,18 @@ func (mm *MigrationManager) MonitorAndMigrate(ctx context.Context, rules []Migra
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
+	// Pick up migrations interrupted by a restart; the ticks retry once Raft caught up
+	mm.ResumeMigrations(ctx)
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			mm.ResumeMigrations(ctx)
+			mm.ResumePendingActions(ctx)
+			mm.ResumeCleanups()
+			mm.PublishWorkload(ctx)
 			mm.CheckAndMigrate(ctx, rules)
 		}
 	}
@@ -449,6 +775,7 @@ func (mm *MigrationManager) MonitorAndMigrate(ctx context.Context, rules []Migra
 // This is exported for testing purposes
 func (mm *MigrationManager) CheckAndMigrate(ctx context.Context, rules []MigrationRule) {
 	state := mm.gossipState
+	var nodeMetrics *monitoring.NodeMetrics
 
 	for _, rule := range rules {
 		// Check if service is unhealthy on this node
@@ -459,37 +786,38 @@ func (mm *MigrationManager) CheckAndMigrate(ctx context.Context, rules []Migrati
 
 		// Check trigger conditions
 		shouldMigrate := false
+		reason := ""
 
 		if rule.Trigger.HealthCheckFailures > 0 {
 			// Use tracked consecutive failures from service health
 			if health.ConsecutiveFailures >= rule.Trigger.HealthCheckFailures {
 				shouldMigrate = true
+				reason = fmt.Sprintf("health check failures: %d consecutive (threshold %d)", health.ConsecutiveFailures, rule.Trigger.HealthCheckFailures)
 				log.Printf("Service %s has %d consecutive failures (threshold: %d)", rule.ServiceName, health.ConsecutiveFailures, rule.Trigger.HealthCheckFailures)
 			}
 		}
 
 		if rule.Trigger.ResourceThreshold != "" {
-			// Collect current node metrics
-			mm.metricsMu.Lock()
-			metrics, err := mm.metricsCollector.CollectMetrics(ctx)
-			if err != nil {
-				log.Printf("Warning: Failed to collect metrics for threshold check: %v", err)
-				mm.metricsMu.Unlock()
-				continue
+			// Node metrics are collected once per check and shared by all rules. When the
+			// threshold cannot be checked, the other triggers still apply.
+			var err error
+			if nodeMetrics == nil {
+				nodeMetrics, err = mm.collectNodeMetrics(ctx)
 			}
-			mm.lastMetrics = metrics
-			mm.metricsMu.Unlock()
 
-			// Evaluate resource threshold
-			thresholdExceeded, err := monitoring.EvaluateResourceThreshold(metrics, rule.Trigger.ResourceThreshold)
+			// Evaluate resource threshold over the rule's sample window
+			thresholdExceeded := false
 			if err != nil {
+				log.Printf("Warning: Failed to collect metrics for threshold check: %v", err)
+			} else if thresholdExceeded, err = mm.evaluateResourceTrigger(ctx, rule, nodeMetrics); err != nil {
 				log.Printf("Warning: Failed to evaluate resource threshold %s for %s: %v", rule.Trigger.ResourceThreshold, rule.ServiceName, err)
-				continue
 			}
 
 			if thresholdExceeded {
-				log.Printf("Resource threshold exceeded for %s: %s (current: CPU=%.2f%%, Memory=%.2f%%)", rule.ServiceName, rule.Trigger.ResourceThreshold, metrics.CPUPercent, metrics.MemoryPercent)
+				log.Printf("Resource threshold exceeded for %s: %s (current: CPU=%.2f%%, Memory=%.2f%%, Disk=%.2f%%, Load=%.2f)",
+					rule.ServiceName, rule.Trigger.ResourceThreshold, nodeMetrics.CPUPercent, nodeMetrics.MemoryPercent, nodeMetrics.DiskPercent, nodeMetrics.Load1)
 				shouldMigrate = true
+				reason = fmt.Sprintf("resource threshold exceeded: %s", rule.Trigger.ResourceThreshold)
 			}
 		}
 
@@ -498,6 +826,7 @@ func (mm *MigrationManager) CheckAndMigrate(ctx context.Context, rules []Migrati
 			node, exists := state.GetNode(mm.nodeName)
 			if exists && node.Cordoned {
 				shouldMigrate = true
+				reason = "node cordoned"
 			}
 		}
 
@@ -510,7 +839,7 @@ func (mm *MigrationManager) CheckAndMigrate(ctx context.Context, rules []Migrati
 
 			if !inProgress {
 				log.Printf("Triggering migration of %s due to rule: %+v", rule.ServiceName, rule.Trigger)
-				if err := mm.StartMigration(ctx, rule); err != nil {
+				if err := mm.StartMigrationWithReason(ctx, rule, reason); err != nil {
 					log.Printf("Failed to start migration of %s: %v", rule.ServiceName, err)
 				}
 			}
@@ -526,15 +855,7 @@ func (mm *MigrationManager) GetActiveMigrations() []*Migration {
 	result := make([]*Migration, 0, len(mm.migrations))
 	for _, migration := range mm.migrations {
 		if migration.Status == MigrationStatusRunning || migration.Status == MigrationStatusPending {
-			result = append(result, &Migration{
-				ServiceName: migration.ServiceName,
-				SourceNode:  migration.SourceNode,
-				TargetNode:  migration.TargetNode,
-				Status:      migration.Status,
-				StartedAt:   migration.StartedAt,
-				CompletedAt: migration.CompletedAt,
-				Error:       migration.Error,
-			})
+			result = append(result, migration.copy())
 		}
 	}
 
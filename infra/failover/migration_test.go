@@ -2,10 +2,16 @@ package failover
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"cluster/infra/cluster/gossip"
+	"cluster/infra/cluster/raft"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -293,6 +299,46 @@ func TestMigrationManager_CheckAndMigrate_HealthBased(t *testing.T) {
 	assert.Equal(t, "target-node", migration.TargetNode)
 }
 
+func TestMigrationManager_CheckAndMigrate_HealthBasedWithoutThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold string
+		timeout   time.Duration
+	}{
+		// The first collection waits for a second sample, which outlasts the check
+		{name: "metrics unavailable", threshold: "cpu>80%", timeout: 10 * time.Millisecond},
+		{name: "invalid threshold", threshold: "cpu>>80%", timeout: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, state := createTestMigrationManager()
+			state.UpdateNode(&gossip.NodeMetadata{Name: "target-node", Priority: 10})
+			state.UpdateServiceHealth(&gossip.ServiceHealth{
+				ServiceName: "unhealthy-service",
+				NodeName:    "test-node",
+				Healthy:     false,
+			})
+
+			rule := MigrationRule{
+				ServiceName: "unhealthy-service",
+				TargetNode:  "target-node",
+				Trigger:     MigrationTrigger{HealthCheckFailures: 1, ResourceThreshold: tt.threshold},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			// The threshold cannot be checked, the health trigger still fires
+			manager.CheckAndMigrate(ctx, []MigrationRule{rule})
+
+			migration, exists := manager.GetMigrationStatus("unhealthy-service")
+			require.True(t, exists)
+			assert.Contains(t, migration.Reason, "health check failures")
+		})
+	}
+}
+
 func TestMigrationManager_CheckAndMigrate_NodeUnhealthy(t *testing.T) {
 	manager, state := createTestMigrationManager()
 
@@ -440,3 +486,521 @@ func TestMigrationStatus_Constants(t *testing.T) {
 	assert.Equal(t, MigrationStatus("completed"), MigrationStatusCompleted)
 	assert.Equal(t, MigrationStatus("failed"), MigrationStatusFailed)
 }
+
+func TestMigrationManager_History_RecordsFailedMigration(t *testing.T) {
+	manager, state := createTestMigrationManager()
+
+	state.UpdateNode(&gossip.NodeMetadata{
+		Name:     "target-node",
+		Priority: 10,
+	})
+
+	rule := MigrationRule{
+		ServiceName: "test-service",
+		TargetNode:  "target-node",
+	}
+
+	err := manager.StartMigrationWithReason(context.Background(), rule, "node cordoned")
+	require.NoError(t, err)
+
+	// Without a Docker client the migration fails on its first step
+	require.Eventually(t, func() bool {
+		records, _ := manager.ListMigrationHistory(raft.MigrationFilter{ServiceName: "test-service"})
+		return len(records) == 1 && records[0].Status == string(MigrationStatusFailed)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	records, total := manager.ListMigrationHistory(raft.MigrationFilter{ServiceName: "test-service"})
+	require.Equal(t, 1, total)
+	record := records[0]
+	assert.NotEmpty(t, record.ID)
+	assert.Equal(t, "node cordoned", record.Reason)
+	assert.Equal(t, "test-node", record.SourceNode)
+	assert.Equal(t, "target-node", record.TargetNode)
+	assert.Contains(t, record.Error, "Docker client not available")
+	assert.NotNil(t, record.CompletedAt)
+
+	require.NotEmpty(t, record.Transitions)
+	assert.Equal(t, "pending", record.Transitions[0].Status)
+	assert.Equal(t, "failed", record.Transitions[len(record.Transitions)-1].Status)
+	assert.Equal(t, string(PhaseExporting), record.Phase)
+
+	stored, exists := manager.GetMigrationRecord(record.ID)
+	require.True(t, exists)
+	assert.Equal(t, record.ID, stored.ID)
+}
+
+func TestMigrationManager_GetMigrationStatus_FallsBackToStore(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	completedAt := time.Now()
+	err := manager.store.PutMigration(&raft.MigrationRecord{
+		ID:          "migration-1",
+		ServiceName: "remote-service",
+		SourceNode:  "other-node",
+		TargetNode:  "target-node",
+		Status:      string(MigrationStatusCompleted),
+		StartedAt:   completedAt.Add(-time.Minute),
+		CompletedAt: &completedAt,
+	})
+	require.NoError(t, err)
+
+	migration, exists := manager.GetMigrationStatus("remote-service")
+	require.True(t, exists)
+	assert.Equal(t, "migration-1", migration.ID)
+	assert.Equal(t, MigrationStatusCompleted, migration.Status)
+	assert.Equal(t, "other-node", migration.SourceNode)
+}
+
+func TestFilterMigrations_Pagination(t *testing.T) {
+	base := time.Now()
+	records := []*raft.MigrationRecord{
+		{ID: "a", ServiceName: "web", SourceNode: "n1", TargetNode: "n2", Status: "failed", StartedAt: base},
+		{ID: "b", ServiceName: "web", SourceNode: "n2", TargetNode: "n3", Status: "completed", StartedAt: base.Add(time.Minute)},
+		{ID: "c", ServiceName: "db", SourceNode: "n1", TargetNode: "n3", Status: "completed", StartedAt: base.Add(2 * time.Minute)},
+	}
+
+	page, total := raft.FilterMigrations(records, raft.MigrationFilter{Limit: 2})
+	assert.Equal(t, 3, total)
+	require.Len(t, page, 2)
+	assert.Equal(t, "c", page[0].ID)
+	assert.Equal(t, "b", page[1].ID)
+
+	page, total = raft.FilterMigrations(records, raft.MigrationFilter{Offset: 2, Limit: 2})
+	assert.Equal(t, 3, total)
+	require.Len(t, page, 1)
+	assert.Equal(t, "a", page[0].ID)
+
+	page, total = raft.FilterMigrations(records, raft.MigrationFilter{ServiceName: "web", Status: "completed"})
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "b", page[0].ID)
+
+	page, total = raft.FilterMigrations(records, raft.MigrationFilter{NodeName: "n3"})
+	assert.Equal(t, 2, total)
+	assert.Len(t, page, 2)
+}
+
+func TestMigrationManager_PermanentFailureIsNotRetried(t *testing.T) {
+	manager, state := createTestMigrationManager()
+
+	state.UpdateNode(&gossip.NodeMetadata{Name: "target-node", Priority: 10})
+
+	rule := MigrationRule{
+		ServiceName: "test-service",
+		TargetNode:  "target-node",
+		MaxRetries:  3,
+		RetryDelay:  time.Hour,
+	}
+	require.NoError(t, manager.StartMigration(context.Background(), rule))
+
+	// A missing Docker client is permanent, so the migration fails without waiting for a retry
+	require.Eventually(t, func() bool {
+		migration, exists := manager.GetMigrationStatus("test-service")
+		return exists && migration.Status == MigrationStatusFailed
+	}, 2*time.Second, 10*time.Millisecond)
+
+	migration, _ := manager.GetMigrationStatus("test-service")
+	assert.Equal(t, 1, migration.Attempt)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Second, retryBackoff(5*time.Second, 1))
+	assert.Equal(t, 10*time.Second, retryBackoff(5*time.Second, 2))
+	assert.Equal(t, 20*time.Second, retryBackoff(5*time.Second, 3))
+	assert.Equal(t, defaultRetryDelay, retryBackoff(0, 1))
+	assert.Equal(t, maxRetryBackoff, retryBackoff(time.Minute, 20))
+}
+
+func TestIsPermanent(t *testing.T) {
+	err := fmt.Errorf("exporting phase failed: %w", permanent(errors.New("no client")))
+	assert.True(t, isPermanent(err))
+	assert.Contains(t, err.Error(), "no client")
+	assert.False(t, isPermanent(errors.New("connection refused")))
+}
+
+func TestMigrationManager_FallbackTarget(t *testing.T) {
+	manager, state := createTestMigrationManager()
+
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node-a", Priority: 1})
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node-b", Priority: 5})
+
+	migration := &Migration{ID: "m1", ServiceName: "test-service", TargetNode: "node-a"}
+	run := newMigrationRun(MigrationRule{ServiceName: "test-service"})
+	run.done[PhaseExporting] = true
+	run.done[PhaseTransferring] = true
+
+	manager.fallbackTarget(migration, run, "node-a")
+
+	assert.Equal(t, "node-b", migration.TargetNode)
+	assert.Equal(t, []string{"node-a"}, migration.FailedTargets)
+	// Exported config is reused, target-specific progress is discarded
+	assert.True(t, run.done[PhaseExporting])
+	assert.False(t, run.done[PhaseTransferring])
+
+	// No alternate left: keep the current target
+	manager.fallbackTarget(migration, run, "node-b")
+	assert.Equal(t, "node-b", migration.TargetNode)
+	assert.Equal(t, []string{"node-a", "node-b"}, migration.FailedTargets)
+}
+
+func TestMigrationManager_CancelMigration_Running(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	var eventsMu sync.Mutex
+	var events []MigrationEvent
+	manager.SetEventHandler(func(event MigrationEvent) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		events = append(events, event)
+	})
+
+	migration := &Migration{
+		ID:          "m1",
+		ServiceName: "test-service",
+		SourceNode:  "test-node",
+		TargetNode:  "target-node",
+		Status:      MigrationStatusRunning,
+		StartedAt:   time.Now(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	handle := &migrationHandle{cancel: cancel, done: make(chan struct{})}
+	manager.migrations["test-service"] = migration
+	manager.handles["test-service"] = handle
+
+	// Stand-in for executeMigration blocked in a phase
+	go func() {
+		defer close(handle.done)
+		<-ctx.Done()
+		if manager.isCancelRequested(migration) {
+			manager.finishCancel(migration, newMigrationRun(MigrationRule{ServiceName: "test-service"}))
+		}
+	}()
+
+	result, err := manager.CancelMigration("test-service")
+	require.NoError(t, err)
+	assert.Equal(t, MigrationStatusCancelled, result.Status)
+	assert.NotNil(t, result.CompletedAt)
+
+	records, _ := manager.ListMigrationHistory(raft.MigrationFilter{ServiceName: "test-service"})
+	require.Len(t, records, 1)
+	assert.Equal(t, string(MigrationStatusCancelled), records[0].Status)
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	require.NotEmpty(t, events)
+	assert.Equal(t, "migration_cancelled", events[len(events)-1].Type)
+}
+
+func TestMigrationManager_CancelMigration_NotActive(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	_, err := manager.CancelMigration("nonexistent")
+	assert.ErrorIs(t, err, ErrMigrationNotFound)
+
+	manager.migrations["test-service"] = &Migration{
+		ID:          "m1",
+		ServiceName: "test-service",
+		SourceNode:  "test-node",
+		Status:      MigrationStatusFailed,
+	}
+	_, err = manager.CancelMigration("test-service")
+	assert.ErrorIs(t, err, ErrMigrationNotActive)
+}
+
+func TestMigrationManager_CancelMigration_StaleRecord(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	// Record left running by this node before a restart
+	require.NoError(t, manager.store.PutMigration(&raft.MigrationRecord{
+		ID:          "m1",
+		ServiceName: "test-service",
+		SourceNode:  "test-node",
+		TargetNode:  "target-node",
+		Status:      string(MigrationStatusRunning),
+		StartedAt:   time.Now(),
+	}))
+
+	result, err := manager.CancelMigration("test-service")
+	require.NoError(t, err)
+	assert.Equal(t, MigrationStatusCancelled, result.Status)
+}
+
+func TestMigrationManager_ControlOtherSourceNode(t *testing.T) {
+	manager, state := createTestMigrationManager()
+	state.UpdateNode(&gossip.NodeMetadata{Name: "other-node"})
+
+	require.NoError(t, manager.store.PutMigration(&raft.MigrationRecord{
+		ID:          "m1",
+		ServiceName: "test-service",
+		SourceNode:  "other-node",
+		TargetNode:  "target-node",
+		Status:      string(MigrationStatusRunning),
+		StartedAt:   time.Now(),
+	}))
+
+	migration, err := manager.CancelMigration("test-service")
+	assert.ErrorIs(t, err, ErrNotSourceNode)
+	require.NotNil(t, migration)
+	assert.Equal(t, "other-node", migration.SourceNode)
+
+	_, err = manager.RollbackMigration(context.Background(), "test-service")
+	assert.ErrorIs(t, err, ErrNotSourceNode)
+}
+
+func TestMigrationManager_ControlDownSourceNode(t *testing.T) {
+	manager, state := createTestMigrationManager()
+	state.UpdateNode(&gossip.NodeMetadata{Name: "coordinator"})
+
+	running := &raft.MigrationRecord{
+		ID:                "m1",
+		ServiceName:       "test-service",
+		SourceNode:        "other-node",
+		TargetNode:        "target-node",
+		SourceContainerID: "abc123",
+		Coordinator:       "coordinator",
+		Status:            string(MigrationStatusRunning),
+		StartedAt:         time.Now(),
+	}
+	require.NoError(t, manager.store.PutMigration(running))
+
+	// The node running it is up, so it controls the migration
+	migration, err := manager.CancelMigration("test-service")
+	assert.ErrorIs(t, err, ErrNotSourceNode)
+	assert.Equal(t, "coordinator", manager.ControlNode(migration))
+
+	// With both the coordinator and the source down, any agent cancels it; the source
+	// container is restarted once its node is back
+	state.RemoveNode("coordinator")
+	result, err := manager.CancelMigration("test-service")
+	require.NoError(t, err)
+	assert.Equal(t, MigrationStatusCancelled, result.Status)
+	assert.Equal(t, raft.PendingRestartSource, result.PendingAction)
+
+	completed := *running
+	completed.ID = "m2"
+	completed.Status = string(MigrationStatusCompleted)
+	completed.StartedAt = time.Now().Add(time.Second)
+	require.NoError(t, manager.store.PutMigration(&completed))
+
+	// A rollback is recorded for the source node instead of failing
+	result, err = manager.RollbackMigration(context.Background(), "test-service")
+	require.NoError(t, err)
+	assert.Equal(t, MigrationStatusCompleted, result.Status)
+	assert.Equal(t, raft.PendingRollback, result.PendingAction)
+
+	stored, exists := manager.GetMigrationRecord("m2")
+	require.True(t, exists)
+	assert.Equal(t, raft.PendingRollback, stored.PendingAction)
+}
+
+func TestMigrationManager_RollbackMigration_NotAllowed(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	manager.migrations["test-service"] = &Migration{
+		ID:          "m1",
+		ServiceName: "test-service",
+		SourceNode:  "test-node",
+		Status:      MigrationStatusRolledBack,
+	}
+
+	_, err := manager.RollbackMigration(context.Background(), "test-service")
+	assert.ErrorIs(t, err, ErrRollbackNotAllowed)
+}
+
+func TestMigrationManager_ResumeCleanups(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	cleanupAt := time.Now().Add(time.Hour)
+	completedAt := time.Now()
+	require.NoError(t, manager.store.PutMigration(&raft.MigrationRecord{
+		ID:                "m1",
+		ServiceName:       "test-service",
+		SourceNode:        "test-node",
+		TargetNode:        "target-node",
+		SourceContainerID: "abc123",
+		Status:            string(MigrationStatusCompleted),
+		StartedAt:         completedAt.Add(-time.Minute),
+		CompletedAt:       &completedAt,
+		CleanupAt:         &cleanupAt,
+	}))
+	require.NoError(t, manager.store.PutMigration(&raft.MigrationRecord{
+		ID:          "m2",
+		ServiceName: "other-service",
+		SourceNode:  "other-node",
+		TargetNode:  "test-node",
+		Status:      string(MigrationStatusCompleted),
+		StartedAt:   completedAt,
+		CleanupAt:   &cleanupAt,
+	}))
+
+	manager.ResumeCleanups()
+	manager.ResumeCleanups() // idempotent
+
+	manager.mu.RLock()
+	_, scheduled := manager.cleanups["m1"]
+	_, otherScheduled := manager.cleanups["m2"]
+	count := len(manager.cleanups)
+	manager.mu.RUnlock()
+
+	assert.True(t, scheduled)
+	assert.False(t, otherScheduled, "cleanups owned by other nodes must not be scheduled")
+	assert.Equal(t, 1, count)
+
+	migration, exists := manager.GetMigrationStatus("test-service")
+	require.True(t, exists)
+	require.NotNil(t, migration.CleanupAt)
+
+	manager.stopCleanup("m1")
+	manager.mu.RLock()
+	assert.Empty(t, manager.cleanups)
+	manager.mu.RUnlock()
+}
+
+func TestMigrationRun_ProgressRoundTrip(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+	require.NoError(t, manager.SetSpecDir(t.TempDir()))
+
+	run := newMigrationRun(MigrationRule{ServiceName: "test-service", TargetNode: "pinned-node"})
+	run.containerID = "abc123"
+	run.config = &ContainerConfig{Version: ContainerSpecVersion, Image: "redis:7", Env: []string{"REDIS_PASSWORD=hunter2"}}
+	run.imageRef = "registry:5000/redis@sha256:0123"
+	run.sourceRunning = true
+	run.sourceStopped = true
+	run.targetContainerID = "def456"
+	for _, phase := range []MigrationPhase{PhaseExporting, PhaseTransferring, PhaseSyncing, PhaseStarting} {
+		run.done[phase] = true
+	}
+
+	migration := &Migration{ID: "m1", ServiceName: "test-service", SourceNode: "test-node", SourceContainerID: "abc123"}
+	manager.saveProgress(migration, run)
+
+	// The progress survives the round trip through the store
+	record, exists := manager.GetMigrationRecord("m1")
+	require.True(t, exists)
+	require.NotNil(t, record.Progress)
+	assert.Equal(t, []string{"exporting", "transferring", "syncing", "starting"}, record.Progress.CompletedPhases)
+	assert.Equal(t, "pinned-node", record.Progress.PinnedTarget)
+	assert.Equal(t, "def456", record.TargetContainerID)
+
+	// The spec stays on the agent, readable by it alone
+	encoded, err := json.Marshal(record)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "hunter2")
+	info, err := os.Stat(manager.specPath("m1"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	resumed, err := manager.resumeRun(migrationFromRecord(record))
+	require.NoError(t, err)
+	assert.Equal(t, run.config, resumed.config)
+	assert.Equal(t, run.imageRef, resumed.imageRef)
+	assert.Equal(t, "abc123", resumed.containerID)
+	assert.Equal(t, "def456", resumed.targetContainerID)
+	assert.Equal(t, "pinned-node", resumed.rule.TargetNode)
+	assert.True(t, resumed.sourceRunning)
+	assert.True(t, resumed.sourceStopped)
+	assert.True(t, resumed.done[PhaseStarting])
+	assert.False(t, resumed.done[PhaseVerifying])
+	assert.Equal(t, defaultMaxRetries, resumed.rule.MaxRetries)
+}
+
+func TestMigrationManager_ResumeRun_MissingConfig(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+	require.NoError(t, manager.SetSpecDir(t.TempDir()))
+
+	migration := &Migration{
+		ID:          "m1",
+		ServiceName: "test-service",
+		Progress:    &raft.MigrationProgress{CompletedPhases: []string{string(PhaseExporting)}},
+	}
+	_, err := manager.resumeRun(migration)
+	assert.Error(t, err)
+
+	// A recovery has nothing to export from
+	migration.Progress = &raft.MigrationProgress{SourceUnreachable: true}
+	_, err = manager.resumeRun(migration)
+	assert.Error(t, err)
+
+	// Nothing completed: start over, towards the pinned target
+	migration.Progress = &raft.MigrationProgress{PinnedTarget: "pinned-node"}
+	run, err := manager.resumeRun(migration)
+	require.NoError(t, err)
+	assert.Empty(t, run.done)
+	assert.Equal(t, "pinned-node", run.rule.TargetNode)
+}
+
+func TestMigrationManager_StartMigration_PinsTarget(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	rule := MigrationRule{ServiceName: "test-service", TargetNode: "target-node"}
+	require.NoError(t, manager.StartMigration(context.Background(), rule))
+
+	// The pinned target is recorded before any phase completes
+	migration, exists := manager.GetMigrationStatus("test-service")
+	require.True(t, exists)
+	record, exists := manager.GetMigrationRecord(migration.ID)
+	require.True(t, exists)
+	require.NotNil(t, record.Progress)
+	assert.Equal(t, "target-node", record.Progress.PinnedTarget)
+}
+
+func TestMigrationManager_ResumeMigrations(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+	require.NoError(t, manager.SetSpecDir(t.TempDir()))
+
+	manager.saveSpec("m1", &ContainerConfig{Version: ContainerSpecVersion, Image: "redis:7"})
+	progress := &raft.MigrationProgress{
+		CompletedPhases: []string{"exporting", "transferring", "syncing", "starting", "verifying", "cutover"},
+		SourceStopped:   true,
+	}
+	require.NoError(t, manager.store.PutMigration(&raft.MigrationRecord{
+		ID:                "m1",
+		ServiceName:       "test-service",
+		SourceNode:        "test-node",
+		TargetNode:        "target-node",
+		SourceContainerID: "abc123",
+		TargetContainerID: "def456",
+		Status:            string(MigrationStatusRunning),
+		Phase:             string(PhaseCleanup),
+		Attempt:           2,
+		StartedAt:         time.Now(),
+		Progress:          progress,
+	}))
+	// Run by another agent
+	require.NoError(t, manager.store.PutMigration(&raft.MigrationRecord{
+		ID:          "m2",
+		ServiceName: "other-service",
+		SourceNode:  "other-node",
+		TargetNode:  "test-node",
+		Status:      string(MigrationStatusRunning),
+		StartedAt:   time.Now(),
+	}))
+
+	manager.ResumeMigrations(context.Background())
+
+	// Only the cleanup phase was left, so no Docker client or target is needed to finish
+	require.Eventually(t, func() bool {
+		record, exists := manager.GetMigrationRecord("m1")
+		return exists && record.Status == string(MigrationStatusCompleted)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	record, _ := manager.GetMigrationRecord("m1")
+	assert.Equal(t, 2, record.Attempt)
+	assert.Equal(t, "def456", record.TargetContainerID)
+
+	// The spec is removed once the migration has finished
+	_, err := os.Stat(manager.specPath("m1"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	other, _ := manager.GetMigrationRecord("m2")
+	assert.Equal(t, string(MigrationStatusRunning), other.Status)
+}
+
+func TestMigrationRule_WithDefaults(t *testing.T) {
+	rule := MigrationRule{ServiceName: "db"}.withDefaults()
+	assert.Equal(t, defaultMaxRetries, rule.MaxRetries)
+	assert.Equal(t, defaultRetryDelay, rule.RetryDelay)
+
+	rule = MigrationRule{ServiceName: "db", MaxRetries: 5, RetryDelay: time.Second}.withDefaults()
+	assert.Equal(t, 5, rule.MaxRetries)
+	assert.Equal(t, time.Second, rule.RetryDelay)
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package failover
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the user and group IDs of a file
+func fileOwner(info os.FileInfo) (int, int) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid)
+	}
+	return 0, 0
+}
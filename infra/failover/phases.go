@@ -0,0 +1,735 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+
+	"cluster/infra/cluster/raft"
+)
+
+// MigrationPhase is a step of the migration state machine
+type MigrationPhase string
+
+const (
+	PhasePending      MigrationPhase = "pending"
+	PhaseExporting    MigrationPhase = "exporting"    // Locate the source container and export its config
+	PhaseTransferring MigrationPhase = "transferring" // Connect to the target, copy the image and pre-copy volumes
+	PhaseSyncing      MigrationPhase = "syncing"      // Run pre hooks, stop the source and run the final volume sync
+	PhaseStarting     MigrationPhase = "starting"     // Create and start the container on the target
+	PhaseVerifying    MigrationPhase = "verifying"    // Wait for the target container to become healthy, run post hooks
+	PhaseCutover      MigrationPhase = "cutover"      // Target becomes the serving instance
+	PhaseCleanup      MigrationPhase = "cleanup"      // Schedule the source container to stop after the grace period
+)
+
+// migrationPhases is the order in which phases run
+var migrationPhases = []MigrationPhase{
+	PhaseExporting,
+	PhaseTransferring,
+	PhaseSyncing,
+	PhaseStarting,
+	PhaseVerifying,
+	PhaseCutover,
+	PhaseCleanup,
+}
+
+const (
+	defaultMaxRetries         = 3
+	defaultRetryDelay         = 30 * time.Second
+	maxRetryBackoff           = 10 * time.Minute
+	defaultMaxTargetFailures  = 2
+	defaultCleanupGracePeriod = 5 * time.Minute
+)
+
+// permanentError marks a migration failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so the migration fails without further attempts
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// isPermanent reports whether err should not be retried
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// retryBackoff returns the delay before the next attempt: RetryDelay * 2^(attempt-1), capped
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultRetryDelay
+	}
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxRetryBackoff {
+			return maxRetryBackoff
+		}
+	}
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
+
+// maxTargetFailures returns the failed attempts allowed on one target before falling back
+func maxTargetFailures(rule MigrationRule) int {
+	if rule.MaxTargetFailures > 0 {
+		return rule.MaxTargetFailures
+	}
+	return defaultMaxTargetFailures
+}
+
+// cleanupGracePeriod returns how long the source keeps running after cutover
+func cleanupGracePeriod(rule MigrationRule) time.Duration {
+	if rule.CleanupGracePeriod > 0 {
+		return rule.CleanupGracePeriod
+	}
+	return defaultCleanupGracePeriod
+}
+
+// migrationRun holds progress that survives between attempts so completed
+// phases are not repeated when a migration is retried
+type migrationRun struct {
+	rule              MigrationRule
+	containerID       string
+	config            *ContainerConfig
+	target            *TargetClient
+	targetContainerID string
+	imageRef          string                            // Digest reference pulled by the target, when distributed through the registry
+	sourceRunning     bool                              // Source was running when the migration started
+	sourceStopped     bool                              // Source stopped for the final volume sync
+	sourceUnreachable bool                              // Source node is down; the container is recreated from its published spec
+	volumeScans       map[string]map[string]VolumeEntry // sync ID -> last scan, to reuse checksums
+	done              map[MigrationPhase]bool
+}
+
+// newMigrationRun creates empty progress for a migration
+func newMigrationRun(rule MigrationRule) *migrationRun {
+	return &migrationRun{
+		rule:        rule,
+		volumeScans: make(map[string]map[string]VolumeEntry),
+		done:        make(map[MigrationPhase]bool),
+	}
+}
+
+// resetTarget discards progress tied to the current target node
+func (run *migrationRun) resetTarget() {
+	run.target = nil
+	run.targetContainerID = ""
+	run.imageRef = ""
+	delete(run.done, PhaseTransferring)
+	delete(run.done, PhaseSyncing)
+	delete(run.done, PhaseStarting)
+	delete(run.done, PhaseVerifying)
+}
+
+// progress returns what the completed phases produced, to be saved in the migration record.
+// The container config is kept on this agent instead, see saveSpec.
+func (run *migrationRun) progress() *raft.MigrationProgress {
+	progress := &raft.MigrationProgress{
+		PinnedTarget:      run.rule.TargetNode,
+		ImageRef:          run.imageRef,
+		SourceRunning:     run.sourceRunning,
+		SourceStopped:     run.sourceStopped,
+		SourceUnreachable: run.sourceUnreachable,
+	}
+	for _, phase := range migrationPhases {
+		if run.done[phase] {
+			progress.CompletedPhases = append(progress.CompletedPhases, string(phase))
+		}
+	}
+	return progress
+}
+
+// resumeRun rebuilds the progress of a migration from its record and the spec kept on
+// this agent, so it continues from the phase after the last one completed
+func (mm *MigrationManager) resumeRun(migration *Migration) (*migrationRun, error) {
+	rule := mm.ruleFor(migration.ServiceName)
+	rule.TargetNode = ""
+	progress := migration.Progress
+	if progress != nil {
+		rule.TargetNode = progress.PinnedTarget
+	}
+	run := newMigrationRun(rule)
+	run.containerID = migration.SourceContainerID
+	if progress == nil {
+		return run, nil
+	}
+
+	for _, phase := range progress.CompletedPhases {
+		run.done[MigrationPhase(phase)] = true
+	}
+	run.imageRef = progress.ImageRef
+	run.sourceRunning = progress.SourceRunning
+	run.sourceStopped = progress.SourceStopped
+	run.sourceUnreachable = progress.SourceUnreachable
+	if run.done[PhaseStarting] {
+		run.targetContainerID = migration.TargetContainerID
+	}
+
+	config, err := mm.loadSpec(migration.ID)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil && (run.done[PhaseExporting] || run.sourceUnreachable) {
+		return nil, fmt.Errorf("no container spec kept on this agent for migration %s", migration.ID)
+	}
+	run.config = config
+	return run, nil
+}
+
+// saveProgress records what the completed phases produced in the migration record
+func (mm *MigrationManager) saveProgress(migration *Migration, run *migrationRun) {
+	if run.config != nil {
+		mm.saveSpec(migration.ID, run.config)
+	}
+
+	mm.mu.Lock()
+	migration.Progress = run.progress()
+	migration.TargetContainerID = run.targetContainerID
+	record := migration.toRecord()
+	mm.mu.Unlock()
+
+	mm.persist(record)
+}
+
+// specPath returns where the container spec of a migration is kept, or "" when specs
+// are not kept
+func (mm *MigrationManager) specPath(migrationID string) string {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	if mm.specDir == "" {
+		return ""
+	}
+	return filepath.Join(mm.specDir, migrationID+".json")
+}
+
+// saveSpec keeps the exported container spec of a migration on this agent. Unlike the
+// replicated record, it may hold environment secrets, so it is only readable by the agent.
+func (mm *MigrationManager) saveSpec(migrationID string, config *ContainerConfig) {
+	path := mm.specPath(migrationID)
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err == nil {
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to keep the container spec of migration %s, it cannot be resumed after a restart: %v", migrationID, err)
+	}
+}
+
+// loadSpec reads the container spec kept for a migration, or nil when there is none
+func (mm *MigrationManager) loadSpec(migrationID string) (*ContainerConfig, error) {
+	path := mm.specPath(migrationID)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container spec: %w", err)
+	}
+	config := &ContainerConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid container spec: %w", err)
+	}
+	if err := checkSpecVersion(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// removeSpec deletes the container spec kept for a migration that has finished
+func (mm *MigrationManager) removeSpec(migrationID string) {
+	path := mm.specPath(migrationID)
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: Failed to remove the container spec of migration %s: %v", migrationID, err)
+	}
+}
+
+// runAttempt runs every phase that has not completed yet
+func (mm *MigrationManager) runAttempt(ctx context.Context, migration *Migration, run *migrationRun) error {
+	for _, phase := range migrationPhases {
+		if run.done[phase] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// A migration resumed after a restart reconnects to the target it was moving to
+		needsTarget := phase == PhaseSyncing || phase == PhaseStarting || phase == PhaseVerifying
+		if needsTarget && run.target == nil && run.done[PhaseTransferring] {
+			if err := mm.connectTarget(ctx, migration, run); err != nil {
+				return fmt.Errorf("%s phase failed: %w", phase, err)
+			}
+		}
+
+		mm.enterPhase(migration, phase)
+
+		var err error
+		switch phase {
+		case PhaseExporting:
+			err = mm.phaseExport(ctx, migration, run)
+		case PhaseTransferring:
+			err = mm.phaseTransfer(ctx, migration, run)
+		case PhaseSyncing:
+			err = mm.phaseSync(ctx, migration, run)
+		case PhaseStarting:
+			err = mm.phaseStart(ctx, migration, run)
+		case PhaseVerifying:
+			err = mm.phaseVerify(ctx, migration, run)
+		case PhaseCutover:
+			err = mm.phaseCutover(migration, run)
+		case PhaseCleanup:
+			err = mm.phaseCleanup(migration, run)
+		}
+		if err != nil {
+			return fmt.Errorf("%s phase failed: %w", phase, err)
+		}
+
+		run.done[phase] = true
+		mm.saveProgress(migration, run)
+	}
+
+	return nil
+}
+
+// phaseExport locates the source container and exports its configuration
+func (mm *MigrationManager) phaseExport(ctx context.Context, migration *Migration, run *migrationRun) error {
+	if run.sourceUnreachable {
+		// The source node is down: its published spec is all there is to export
+		mm.beginStep(migration, "recorded_config")
+		mm.endStep(migration, "recorded_config", nil)
+		log.Printf("Using the recorded config of container %s, source node %s is down", run.containerID, migration.SourceNode)
+		return nil
+	}
+	if mm.dockerClient == nil {
+		return permanent(fmt.Errorf("Docker client not available"))
+	}
+
+	// Find container on source node
+	mm.beginStep(migration, "locate_container")
+	source, err := mm.findServiceContainer(ctx, migration.ServiceName, true)
+	mm.endStep(migration, "locate_container", err)
+	if errors.Is(err, ErrContainerNotFound) || errors.Is(err, ErrAmbiguousContainer) {
+		return permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	run.containerID = source.ID
+	run.sourceRunning = source.State == "running"
+	mm.mu.Lock()
+	migration.SourceContainerID = run.containerID
+	mm.mu.Unlock()
+	log.Printf("Found container %s on source node", run.containerID)
+
+	// Inspect container to get full configuration
+	mm.beginStep(migration, "export_config")
+	run.config, err = ExportContainerConfig(ctx, mm.dockerClient, run.containerID)
+	mm.endStep(migration, "export_config", err)
+	if err != nil {
+		return fmt.Errorf("failed to export container config: %w", err)
+	}
+
+	// Recreating a container without what ties it to this host would change its behavior
+	mm.beginStep(migration, "check_portability")
+	if issues := run.config.PortabilityIssues(); len(issues) > 0 {
+		err = fmt.Errorf("container cannot be recreated on another node: %s", strings.Join(issues, "; "))
+		mm.endStep(migration, "check_portability", err)
+		return permanent(err)
+	}
+	mm.endStep(migration, "check_portability", nil)
+
+	return nil
+}
+
+// phaseTransfer connects to the target node and copies the image and volumes
+func (mm *MigrationManager) phaseTransfer(ctx context.Context, migration *Migration, run *migrationRun) error {
+	if err := mm.connectTarget(ctx, migration, run); err != nil {
+		return err
+	}
+
+	if run.sourceUnreachable && hasTransferableMounts(run.config.Mounts) {
+		return permanent(fmt.Errorf("volumes cannot be copied from %s, which is down", migration.SourceNode))
+	}
+
+	// Ensure image exists on target node
+	log.Printf("Ensuring image %s exists on target node", run.config.Image)
+	if err := mm.distributeImage(ctx, migration, run); err != nil {
+		return err
+	}
+
+	// Pre-copy volumes while the source keeps serving, so the final sync only sends what changed
+	if hasTransferableMounts(run.config.Mounts) {
+		log.Printf("Pre-copying %d volume(s) to target node", len(run.config.Mounts))
+		mm.beginStep(migration, "precopy_volumes")
+		err := mm.syncVolumes(ctx, migration, run, false)
+		mm.endStep(migration, "precopy_volumes", err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// connectTarget connects to the migration receive API of the target node's agent
+func (mm *MigrationManager) connectTarget(ctx context.Context, migration *Migration, run *migrationRun) error {
+	mm.mu.RLock()
+	targetName := migration.TargetNode
+	mm.mu.RUnlock()
+
+	// Get target node information from gossip state
+	targetNode, exists := mm.gossipState.GetNode(targetName)
+	if !exists {
+		return fmt.Errorf("target node %s not found in cluster", targetName)
+	}
+
+	mm.beginStep(migration, "connect_target")
+	target := mm.newTargetClient(targetNode.TailscaleIP)
+	err := target.Ping(ctx)
+	mm.endStep(migration, "connect_target", err)
+	if err != nil {
+		return fmt.Errorf("failed to connect to agent on target node: %w", err)
+	}
+	run.target = target
+
+	log.Printf("Connected to agent on target node %s", targetName)
+	return nil
+}
+
+// distributeImage makes the container's image available on the target. With a cluster
+// registry the image is pushed and pulled by digest, so only layers the target is missing
+// move; otherwise, or when the registry fails, the whole image is copied.
+func (mm *MigrationManager) distributeImage(ctx context.Context, migration *Migration, run *migrationRun) error {
+	mm.mu.RLock()
+	registry := mm.registry
+	mm.mu.RUnlock()
+
+	run.imageRef = ""
+	if run.sourceUnreachable {
+		// Nothing to copy from, the target has to pull the image itself
+		mm.beginStep(migration, "pull_image")
+		err := run.target.PullImage(ctx, run.config.Image)
+		mm.endStep(migration, "pull_image", err)
+		return err
+	}
+	if registry.Enabled() {
+		ref, err := mm.distributeViaRegistry(ctx, migration, run, registry)
+		if err == nil {
+			run.imageRef = ref
+			return nil
+		}
+		log.Printf("Warning: Registry distribution of %s failed, copying the whole image: %v", run.config.Image, err)
+	}
+
+	mm.beginStep(migration, "transfer_image")
+	err := transferImage(ctx, mm.dockerClient, run.target, run.config.Image)
+	mm.endStep(migration, "transfer_image", err)
+	return err
+}
+
+// distributeViaRegistry pushes the image to the cluster registry, has the target pull it
+// by digest and checks that both nodes hold the same image. It returns the pinned reference.
+func (mm *MigrationManager) distributeViaRegistry(ctx context.Context, migration *Migration, run *migrationRun, registry RegistryConfig) (string, error) {
+	image := run.config.Image
+
+	mm.beginStep(migration, "push_image")
+	imageID, digest, err := pushImageToRegistry(ctx, mm.dockerClient, registry, image)
+	mm.endStep(migration, "push_image", err)
+	if err != nil {
+		return "", err
+	}
+
+	sourceHost := ""
+	if node, exists := mm.gossipState.GetNode(mm.nodeName); exists {
+		sourceHost = node.TailscaleIP
+	}
+	if registry.Local && sourceHost == "" {
+		return "", fmt.Errorf("source node address unknown, target cannot reach the local registry")
+	}
+	ref, err := pinnedReference(registry.pullAddress(sourceHost), image, digest)
+	if err != nil {
+		return "", err
+	}
+
+	// Keep the original name on the target too, unless the image was already pinned
+	tag := ""
+	if !strings.Contains(image, "@") {
+		tag = image
+	}
+
+	mm.beginStep(migration, "pull_image")
+	targetImageID, err := run.target.PullPinnedImage(ctx, ref, tag)
+	if err == nil && targetImageID != imageID {
+		err = fmt.Errorf("target pulled image %s, expected %s", targetImageID, imageID)
+	}
+	mm.endStep(migration, "pull_image", err)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("Image %s distributed through the registry as %s", image, ref)
+	return ref, nil
+}
+
+// transferImage copies an image from the source to the target, pulling on the target as a fallback
+func transferImage(ctx context.Context, sourceCli *client.Client, target *TargetClient, image string) error {
+	pullOnTarget := func(cause error) error {
+		if pullErr := target.PullImage(ctx, image); pullErr != nil {
+			return fmt.Errorf("failed to ensure image on target: %w (pull error: %v)", cause, pullErr)
+		}
+		return nil
+	}
+
+	imageReader, err := ExportContainerImage(ctx, sourceCli, image)
+	if err != nil {
+		log.Printf("Warning: Failed to export image from source, attempting to pull on target: %v", err)
+		return pullOnTarget(err)
+	}
+	defer imageReader.Close()
+
+	if err := target.LoadImage(ctx, imageReader); err != nil {
+		log.Printf("Warning: Failed to load image on target, attempting pull: %v", err)
+		return pullOnTarget(err)
+	}
+
+	return nil
+}
+
+// phaseSync runs the pre-migration hooks, then stops the source container and runs
+// the final volume sync, so the target starts from a complete, verified copy. Services without volumes keep the source
+// running until cleanup.
+func (mm *MigrationManager) phaseSync(ctx context.Context, migration *Migration, run *migrationRun) error {
+	// Let the application flush its state before it is frozen
+	if run.sourceRunning && !run.sourceStopped {
+		if err := mm.runPreHooks(ctx, migration, run); err != nil {
+			return err
+		}
+	}
+
+	if !hasTransferableMounts(run.config.Mounts) {
+		return nil
+	}
+
+	if run.sourceRunning && !run.sourceStopped {
+		log.Printf("Stopping source container %s for the final volume sync", run.containerID)
+		stopTimeoutSeconds := 30
+		mm.beginStep(migration, "stop_source")
+		err := mm.dockerClient.ContainerStop(ctx, run.containerID, container.StopOptions{Timeout: &stopTimeoutSeconds})
+		mm.endStep(migration, "stop_source", err)
+		if err != nil {
+			return fmt.Errorf("failed to stop source container: %w", err)
+		}
+		run.sourceStopped = true
+	}
+
+	mm.beginStep(migration, "sync_volumes")
+	err := mm.syncVolumes(ctx, migration, run, true)
+	mm.endStep(migration, "sync_volumes", err)
+	return err
+}
+
+// syncVolumes copies the container's volumes to the target. Directories the agent can
+// read are synced block by block; other mounts are archived through the Docker API and
+// copied in full during the final pass.
+func (mm *MigrationManager) syncVolumes(ctx context.Context, migration *Migration, run *migrationRun, final bool) error {
+	mm.mu.RLock()
+	hostRoot := mm.hostRoot
+	mm.mu.RUnlock()
+
+	for i, vol := range run.config.Mounts {
+		if !isTransferableMount(vol) {
+			continue
+		}
+		syncID := fmt.Sprintf("%s-%d", migration.ID, i)
+
+		root, err := localVolumePath(ctx, mm.dockerClient, hostRoot, vol)
+		if err != nil {
+			if !final {
+				log.Printf("Volume %s will be copied in full after the source stops: %v", vol.Target, err)
+				continue
+			}
+			if err := transferVolume(ctx, mm.dockerClient, run.target, run.containerID, vol, syncID); err != nil {
+				return fmt.Errorf("failed to transfer volume %s: %w", vol.Target, err)
+			}
+			continue
+		}
+
+		if err := syncVolume(ctx, run.target, root, syncID, vol, run.volumeScans, final); err != nil {
+			return fmt.Errorf("failed to sync volume %s: %w", vol.Target, err)
+		}
+	}
+
+	return nil
+}
+
+// restartSource starts the source container again after a failed attempt stopped it for the final sync
+func (mm *MigrationManager) restartSource(migration *Migration, run *migrationRun) {
+	if !run.sourceStopped {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	mm.beginStep(migration, "restart_source")
+	err := mm.dockerClient.ContainerStart(ctx, run.containerID, types.ContainerStartOptions{})
+	mm.endStep(migration, "restart_source", err)
+	if err != nil {
+		log.Printf("Warning: Failed to restart source container %s: %v", run.containerID, err)
+		return
+	}
+
+	run.sourceStopped = false
+	delete(run.done, PhaseSyncing)
+	log.Printf("Restarted source container %s", run.containerID)
+}
+
+// phaseStart creates and starts the container on the target node
+func (mm *MigrationManager) phaseStart(ctx context.Context, migration *Migration, run *migrationRun) error {
+	mm.mu.RLock()
+	targetName := migration.TargetNode
+	mm.mu.RUnlock()
+
+	log.Printf("Creating container on target node %s", targetName)
+	mm.beginStep(migration, "create_container")
+	config := run.config
+	if run.imageRef != "" {
+		// Run exactly the image the source pushed, not whatever the tag points to
+		pinned := *run.config
+		pinned.Image = run.imageRef
+		config = &pinned
+	}
+	targetContainerID, err := run.target.CreateContainer(ctx, config)
+	mm.endStep(migration, "create_container", err)
+	if err != nil {
+		return fmt.Errorf("failed to create container on target: %w", err)
+	}
+
+	run.targetContainerID = targetContainerID
+	mm.mu.Lock()
+	migration.TargetContainerID = targetContainerID
+	mm.mu.Unlock()
+	log.Printf("Container created on target node: %s", targetContainerID)
+
+	log.Printf("Starting container on target node")
+	mm.beginStep(migration, "start_container")
+	err = run.target.StartContainer(ctx, targetContainerID)
+	mm.endStep(migration, "start_container", err)
+	if err != nil {
+		// Cleanup: remove failed container
+		run.target.RemoveContainer(ctx, targetContainerID)
+		run.targetContainerID = ""
+		return fmt.Errorf("failed to start container on target: %w", err)
+	}
+
+	return nil
+}
+
+// phaseVerify waits for the target container to become healthy and runs the post-migration hooks
+func (mm *MigrationManager) phaseVerify(ctx context.Context, migration *Migration, run *migrationRun) error {
+	log.Printf("Verifying container health on target node")
+	healthTimeout := 60 * time.Second
+	if run.config.Healthcheck != nil {
+		// Wait longer if healthcheck is configured
+		healthTimeout = time.Duration(run.config.Healthcheck.Interval) * time.Duration(run.config.Healthcheck.Retries+1) * time.Second
+		if healthTimeout < 30*time.Second {
+			healthTimeout = 30 * time.Second
+		}
+	}
+
+	mm.beginStep(migration, "verify_health")
+	err := run.target.WaitHealthy(ctx, run.targetContainerID, healthTimeout)
+	mm.endStep(migration, "verify_health", err)
+	if err != nil {
+		// Container started but health check failed - remove it so the next attempt starts fresh
+		log.Printf("Container health check failed, removing target container %s", run.targetContainerID)
+		run.target.StopContainer(ctx, run.targetContainerID)
+		run.target.RemoveContainer(ctx, run.targetContainerID)
+		run.targetContainerID = ""
+		delete(run.done, PhaseStarting)
+		return fmt.Errorf("container health check failed on target: %w", err)
+	}
+	log.Printf("Container is healthy on target node")
+
+	if err := mm.runPostHooks(ctx, migration, run); err != nil {
+		// Same as a failed health check: the next attempt starts from a fresh container
+		run.target.StopContainer(ctx, run.targetContainerID)
+		run.target.RemoveContainer(ctx, run.targetContainerID)
+		run.targetContainerID = ""
+		delete(run.done, PhaseStarting)
+		return err
+	}
+
+	return nil
+}
+
+// phaseCutover marks the target container as the serving instance.
+// Service health monitoring on the target picks up the new container and
+// gossip routes traffic to it.
+func (mm *MigrationManager) phaseCutover(migration *Migration, run *migrationRun) error {
+	mm.mu.RLock()
+	targetName := migration.TargetNode
+	mm.mu.RUnlock()
+
+	log.Printf("Cutover: %s now served by container %s on %s", migration.ServiceName, run.targetContainerID, targetName)
+	return nil
+}
+
+// phaseCleanup schedules the source container to stop after the grace period.
+// The source is kept running meanwhile so the migration can be rolled back quickly.
+func (mm *MigrationManager) phaseCleanup(migration *Migration, run *migrationRun) error {
+	if run.sourceStopped {
+		log.Printf("Source container %s was stopped for the final volume sync, no cleanup needed", run.containerID)
+		return nil
+	}
+	if run.sourceUnreachable {
+		// The source agent stops its container once it is back; see ResumeCleanups
+		now := time.Now()
+		mm.mu.Lock()
+		migration.CleanupAt = &now
+		record := migration.toRecord()
+		mm.mu.Unlock()
+		mm.persist(record)
+		log.Printf("Source container %s will be stopped when %s comes back", run.containerID, migration.SourceNode)
+		return nil
+	}
+
+	gracePeriod := cleanupGracePeriod(run.rule)
+	mm.scheduleCleanup(migration, time.Now().Add(gracePeriod))
+
+	log.Printf("Source container %s will be stopped after grace period (%v) if target remains healthy", run.containerID, gracePeriod)
+	return nil
+}
@@ -0,0 +1,459 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// DefaultPlanBandwidthMbps is the link speed assumed when estimating transfer time
+const DefaultPlanBandwidthMbps = 100
+
+// Volume copy methods reported in a migration plan
+const (
+	PlanVolumeBlockSync = "block-sync" // Read from the host and synced block by block
+	PlanVolumeArchive   = "archive"    // Archived through Docker and copied in full after the source stops
+)
+
+// MigrationPlan describes what a migration would do, without doing it
+type MigrationPlan struct {
+	ServiceName     string            `json:"service_name"`
+	SourceNode      string            `json:"source_node"`
+	TargetNode      string            `json:"target_node,omitempty"`
+	TargetReason    string            `json:"target_reason"`
+	Feasible        bool              `json:"feasible"` // Every blocking check passed
+	Candidates      []TargetCandidate `json:"candidates,omitempty"`
+	Image           *PlanImage        `json:"image,omitempty"`
+	Volumes         []PlanVolume      `json:"volumes"`
+	PortConflicts   []string          `json:"port_conflicts"`
+	MissingNetworks []string          `json:"missing_networks"`
+	PreHooks        []string          `json:"pre_hooks"`
+	PostHooks       []string          `json:"post_hooks"`
+	// TransferBytes counts the image (unless already on the target) and every volume of known size
+	TransferBytes            int64       `json:"transfer_bytes"`
+	BandwidthMbps            float64     `json:"bandwidth_mbps"`
+	EstimatedTransferSeconds float64     `json:"estimated_transfer_seconds"`
+	Checks                   []PlanCheck `json:"checks"`
+}
+
+// PlanImage describes how the image reaches the target
+type PlanImage struct {
+	Name            string `json:"name"`
+	SizeBytes       int64  `json:"size_bytes"`
+	PresentOnTarget *bool  `json:"present_on_target,omitempty"` // nil when the target could not be asked
+	Method          string `json:"method"`                      // registry (missing layers, pinned by digest) or save_load (whole image)
+}
+
+// PlanVolume describes one mount whose data moves with the container
+type PlanVolume struct {
+	Target    string `json:"target"`
+	Type      string `json:"type"`
+	Source    string `json:"source"`
+	SizeBytes int64  `json:"size_bytes"` // -1 when the size is unknown
+	Method    string `json:"method"`
+}
+
+// PlanCheck is one constraint or rule evaluated for the plan
+type PlanCheck struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Blocking bool   `json:"blocking"` // A failed blocking check would make the migration fail
+	Detail   string `json:"detail,omitempty"`
+}
+
+// PreflightRequest asks a target agent whether it can run a container
+type PreflightRequest struct {
+	Image         string   `json:"image"`
+	ContainerName string   `json:"container_name"`
+	Ports         []string `json:"ports"` // Published host ports, e.g. "8080/tcp"
+	Networks      []string `json:"networks"`
+}
+
+// PreflightResult reports what the target is missing or what conflicts with the container
+type PreflightResult struct {
+	ImagePresent    bool     `json:"image_present"`
+	PortConflicts   []string `json:"port_conflicts"`
+	MissingNetworks []string `json:"missing_networks"`
+	NameConflict    string   `json:"name_conflict,omitempty"` // ID of an existing container with the same name
+}
+
+// addCheck records an evaluated constraint
+func (p *MigrationPlan) addCheck(name string, passed, blocking bool, detail string) {
+	p.Checks = append(p.Checks, PlanCheck{Name: name, Passed: passed, Blocking: blocking, Detail: detail})
+	if !passed && blocking {
+		p.Feasible = false
+	}
+}
+
+// PlanMigration evaluates a migration with the same decisions StartMigration and
+// executeMigration would make, and returns a plan without changing anything
+func (mm *MigrationManager) PlanMigration(ctx context.Context, rule MigrationRule, bandwidthMbps float64) (*MigrationPlan, error) {
+	if bandwidthMbps <= 0 {
+		bandwidthMbps = DefaultPlanBandwidthMbps
+	}
+	plan := &MigrationPlan{
+		ServiceName:     rule.ServiceName,
+		SourceNode:      mm.nodeName,
+		Feasible:        true,
+		Volumes:         []PlanVolume{},
+		PortConflicts:   []string{},
+		MissingNetworks: []string{},
+		PreHooks:        []string{},
+		PostHooks:       []string{},
+		BandwidthMbps:   bandwidthMbps,
+	}
+
+	ruleSource := "defaults for manual migrations"
+	if _, configured := mm.configuredRule(rule.ServiceName); configured {
+		ruleSource = "configured rule"
+	}
+	plan.addCheck("migration_rule", true, false, fmt.Sprintf("%s: %d retries, %v base delay, priority %d",
+		ruleSource, rule.MaxRetries, rule.RetryDelay, rule.Priority))
+
+	if existing, exists := mm.GetMigrationStatus(rule.ServiceName); exists && !existing.Status.IsTerminal() {
+		plan.addCheck("no_active_migration", false, true, fmt.Sprintf("migration %s is %s", existing.ID, existing.Status))
+	} else {
+		plan.addCheck("no_active_migration", true, true, "")
+	}
+
+	mm.planTarget(plan, rule)
+
+	if mm.dockerClient == nil {
+		plan.addCheck("docker_available", false, true, "Docker client not available")
+		return plan, nil
+	}
+
+	// Source container, as located by the exporting phase
+	source, err := mm.findServiceContainer(ctx, rule.ServiceName, true)
+	if errors.Is(err, ErrContainerNotFound) || errors.Is(err, ErrAmbiguousContainer) {
+		plan.addCheck("source_container", false, true, fmt.Sprintf("%v on %s", err, mm.nodeName))
+		return plan, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	plan.addCheck("source_container", true, true, fmt.Sprintf("%s (%s)", shortID(source.ID), source.State))
+
+	config, err := ExportContainerConfig(ctx, mm.dockerClient, source.ID)
+	if err != nil {
+		plan.addCheck("export_config", false, true, err.Error())
+		return plan, nil
+	}
+
+	if issues := config.PortabilityIssues(); len(issues) > 0 {
+		plan.addCheck("portable_spec", false, true, strings.Join(issues, "; "))
+	} else {
+		plan.addCheck("portable_spec", true, true, fmt.Sprintf("spec version %d", config.Version))
+	}
+	if strings.EqualFold(config.Labels[MigratableLabel], "false") {
+		plan.addCheck("migratable", false, false, fmt.Sprintf("opted out with %s=false (skipped by node drains)", MigratableLabel))
+	} else {
+		plan.addCheck("migratable", true, false, "")
+	}
+
+	pre, post := migrationHooks(rule, config.Labels)
+	for _, hook := range pre {
+		plan.PreHooks = append(plan.PreHooks, hook.Name)
+	}
+	for _, hook := range post {
+		plan.PostHooks = append(plan.PostHooks, hook.Name)
+	}
+
+	mm.mu.RLock()
+	registry := mm.registry
+	mm.mu.RUnlock()
+	plan.Image = &PlanImage{Name: config.Image, Method: "save_load"}
+	if registry.Enabled() {
+		plan.Image.Method = "registry"
+	}
+	if image, _, err := mm.dockerClient.ImageInspectWithRaw(ctx, config.Image); err == nil {
+		plan.Image.SizeBytes = image.Size
+	}
+
+	mm.planVolumes(ctx, plan, config.Mounts)
+	mm.planPreflight(ctx, plan, config)
+
+	if plan.Image.PresentOnTarget == nil || !*plan.Image.PresentOnTarget {
+		plan.TransferBytes += plan.Image.SizeBytes
+	}
+	for _, vol := range plan.Volumes {
+		if vol.SizeBytes > 0 {
+			plan.TransferBytes += vol.SizeBytes
+		}
+	}
+	plan.EstimatedTransferSeconds = estimateTransferSeconds(plan.TransferBytes, bandwidthMbps)
+
+	return plan, nil
+}
+
+// planTarget picks the target node the way StartMigrationWithReason would
+func (mm *MigrationManager) planTarget(plan *MigrationPlan, rule MigrationRule) {
+	plan.Candidates = mm.evaluateTargets(mm.migrationStore(), rule.ServiceName, mm.nodeName, nil)
+
+	if rule.TargetNode == "" {
+		target, ok := bestTarget(plan.Candidates)
+		if !ok {
+			plan.TargetReason = "no eligible node"
+			plan.addCheck("target_selection", false, true, "no suitable target nodes available")
+			return
+		}
+		plan.TargetNode = target
+		for _, candidate := range plan.Candidates {
+			if candidate.Node == target {
+				plan.TargetReason = fmt.Sprintf("auto-selected: lowest priority (%d) among eligible nodes", candidate.Priority)
+			}
+		}
+		plan.addCheck("target_selection", true, true, plan.TargetReason)
+		return
+	}
+
+	plan.TargetNode = rule.TargetNode
+	plan.TargetReason = "requested explicitly"
+	if rule.TargetNode == mm.nodeName {
+		plan.addCheck("target_selection", false, true, "target is the source node")
+		return
+	}
+	if _, exists := mm.gossipState.GetNode(rule.TargetNode); !exists {
+		plan.addCheck("target_selection", false, true, fmt.Sprintf("target node %s not found in cluster", rule.TargetNode))
+		return
+	}
+	for _, candidate := range plan.Candidates {
+		if candidate.Node == rule.TargetNode && !candidate.Eligible {
+			// Explicit targets bypass auto-selection filters, so this only warns
+			plan.addCheck("target_selection", true, true, fmt.Sprintf("requested explicitly, although the node is %s", candidate.Reason))
+			return
+		}
+	}
+	plan.addCheck("target_selection", true, true, plan.TargetReason)
+}
+
+// planVolumes sizes every transferable mount and reports how it would be copied
+func (mm *MigrationManager) planVolumes(ctx context.Context, plan *MigrationPlan, mounts []mount.Mount) {
+	mm.mu.RLock()
+	hostRoot := mm.hostRoot
+	mm.mu.RUnlock()
+
+	unreadable := 0
+	for _, vol := range mounts {
+		if !isTransferableMount(vol) {
+			continue
+		}
+
+		planned := PlanVolume{Target: vol.Target, Type: string(vol.Type), Source: vol.Source, SizeBytes: -1, Method: PlanVolumeBlockSync}
+		root, err := localVolumePath(ctx, mm.dockerClient, hostRoot, vol)
+		if err == nil {
+			if size, err := directorySize(root); err == nil {
+				planned.SizeBytes = size
+			}
+		} else {
+			planned.Method = PlanVolumeArchive
+			unreadable++
+			if vol.Type == mount.TypeBind {
+				if info, err := os.Stat(filepath.Join(hostRoot, vol.Source)); err == nil && !info.IsDir() {
+					planned.SizeBytes = info.Size()
+				}
+			}
+		}
+		plan.Volumes = append(plan.Volumes, planned)
+	}
+
+	if unreadable > 0 {
+		plan.addCheck("volumes_readable", false, false, fmt.Sprintf("%d volume(s) will be copied in full after the source stops", unreadable))
+	} else {
+		plan.addCheck("volumes_readable", true, false, "")
+	}
+}
+
+// planPreflight asks the target agent about the image, ports, networks and container name
+func (mm *MigrationManager) planPreflight(ctx context.Context, plan *MigrationPlan, config *ContainerConfig) {
+	if plan.TargetNode == "" {
+		return
+	}
+	node, exists := mm.gossipState.GetNode(plan.TargetNode)
+	if !exists {
+		return
+	}
+
+	target := mm.newTargetClient(node.TailscaleIP)
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	result, err := target.Preflight(ctx, PreflightRequest{
+		Image:         config.Image,
+		ContainerName: config.Name,
+		Ports:         publishedPorts(config.PortBindings),
+		Networks:      config.Networks,
+	})
+	if err != nil {
+		plan.addCheck("target_agent", false, true, err.Error())
+		return
+	}
+	plan.addCheck("target_agent", true, true, "")
+
+	present := result.ImagePresent
+	plan.Image.PresentOnTarget = &present
+	if present {
+		plan.addCheck("image_on_target", true, false, "image already present, no transfer needed")
+	} else {
+		if plan.Image.Method == "registry" {
+			plan.addCheck("image_on_target", false, false, "image will be pushed to the cluster registry and pulled by digest (only missing layers)")
+		} else {
+			plan.addCheck("image_on_target", false, false, "image will be copied from the source (or pulled as a fallback)")
+		}
+	}
+
+	plan.PortConflicts = append(plan.PortConflicts, result.PortConflicts...)
+	plan.addCheck("port_conflicts", len(result.PortConflicts) == 0, true, strings.Join(result.PortConflicts, ", "))
+
+	plan.MissingNetworks = append(plan.MissingNetworks, result.MissingNetworks...)
+	plan.addCheck("networks", len(result.MissingNetworks) == 0, true, missingNetworksDetail(result.MissingNetworks))
+
+	if result.NameConflict != "" {
+		plan.addCheck("container_name", false, true, fmt.Sprintf("container %s already exists on the target (%s)", config.Name, shortID(result.NameConflict)))
+	} else {
+		plan.addCheck("container_name", true, true, "")
+	}
+}
+
+// missingNetworksDetail describes networks absent on the target
+func missingNetworksDetail(missing []string) string {
+	if len(missing) == 0 {
+		return ""
+	}
+	return "missing on target: " + strings.Join(missing, ", ")
+}
+
+// publishedPorts lists the host ports a container publishes, as "port/proto"
+func publishedPorts(bindings nat.PortMap) []string {
+	ports := make([]string, 0)
+	seen := make(map[string]bool)
+	for port, hostBindings := range bindings {
+		for _, binding := range hostBindings {
+			if binding.HostPort == "" {
+				continue
+			}
+			key := fmt.Sprintf("%s/%s", binding.HostPort, port.Proto())
+			if !seen[key] {
+				seen[key] = true
+				ports = append(ports, key)
+			}
+		}
+	}
+	sort.Strings(ports)
+	return ports
+}
+
+// directorySize returns the total size of the regular files under root
+func directorySize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// estimateTransferSeconds returns how long bytes take at the given link speed
+func estimateTransferSeconds(bytes int64, bandwidthMbps float64) float64 {
+	if bytes <= 0 || bandwidthMbps <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / (bandwidthMbps * 1e6)
+}
+
+// shortID abbreviates a container ID
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// preflight checks whether this node can run a container with the given image, ports, networks and name
+func preflight(ctx context.Context, cli *client.Client, req PreflightRequest) (*PreflightResult, error) {
+	result := &PreflightResult{PortConflicts: []string{}, MissingNetworks: []string{}}
+
+	if req.Image != "" {
+		if _, _, err := cli.ImageInspectWithRaw(ctx, req.Image); err == nil {
+			result.ImagePresent = true
+		} else if !client.IsErrNotFound(err) {
+			return nil, fmt.Errorf("failed to inspect image: %w", err)
+		}
+	}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(req.Ports))
+	for _, port := range req.Ports {
+		wanted[port] = true
+	}
+	name := strings.TrimPrefix(req.ContainerName, "/")
+	for _, c := range containers {
+		for _, cName := range c.Names {
+			if name != "" && strings.TrimPrefix(cName, "/") == name {
+				result.NameConflict = c.ID
+			}
+		}
+		if c.State != "running" {
+			continue
+		}
+		for _, port := range c.Ports {
+			key := fmt.Sprintf("%d/%s", port.PublicPort, port.Type)
+			if port.PublicPort != 0 && wanted[key] {
+				result.PortConflicts = append(result.PortConflicts, fmt.Sprintf("%s (used by %s)", key, containerName(c)))
+				delete(wanted, key)
+			}
+		}
+	}
+	sort.Strings(result.PortConflicts)
+
+	if len(req.Networks) > 0 {
+		networks, err := cli.NetworkList(ctx, types.NetworkListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list networks: %w", err)
+		}
+		existing := make(map[string]bool, len(networks))
+		for _, n := range networks {
+			existing[n.Name] = true
+		}
+		for _, n := range req.Networks {
+			if !existing[n] {
+				result.MissingNetworks = append(result.MissingNetworks, n)
+			}
+		}
+		sort.Strings(result.MissingNetworks)
+	}
+
+	return result, nil
+}
+
+// containerName returns a container's primary name without the leading slash
+func containerName(c types.Container) string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return shortID(c.ID)
+}
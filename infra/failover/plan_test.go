@@ -0,0 +1,82 @@
+package failover
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cluster/infra/cluster/gossip"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checkByName(plan *MigrationPlan, name string) (PlanCheck, bool) {
+	for _, check := range plan.Checks {
+		if check.Name == name {
+			return check, true
+		}
+	}
+	return PlanCheck{}, false
+}
+
+func TestMigrationManager_PlanMigration_ExplainsTarget(t *testing.T) {
+	manager, state := createTestMigrationManager()
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node1", Priority: 5})
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node2", Priority: 1, Cordoned: true})
+	state.UpdateNode(&gossip.NodeMetadata{Name: "node3", Priority: 10})
+
+	plan, err := manager.PlanMigration(context.Background(), MigrationRule{ServiceName: "test-service"}, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, "node1", plan.TargetNode)
+	assert.Contains(t, plan.TargetReason, "lowest priority")
+	require.Len(t, plan.Candidates, 3)
+	assert.False(t, plan.Candidates[1].Eligible)
+	assert.Equal(t, "cordoned", plan.Candidates[1].Reason)
+	assert.Equal(t, float64(DefaultPlanBandwidthMbps), plan.BandwidthMbps)
+
+	// Without a Docker client the source cannot be inspected, so the plan is blocked
+	assert.False(t, plan.Feasible)
+	check, ok := checkByName(plan, "docker_available")
+	require.True(t, ok)
+	assert.False(t, check.Passed)
+}
+
+func TestMigrationManager_PlanMigration_ExplicitTarget(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+
+	plan, err := manager.PlanMigration(context.Background(), MigrationRule{ServiceName: "test-service", TargetNode: "missing"}, 0)
+	require.NoError(t, err)
+
+	check, ok := checkByName(plan, "target_selection")
+	require.True(t, ok)
+	assert.False(t, check.Passed)
+	assert.Contains(t, check.Detail, "not found")
+}
+
+func TestPublishedPorts(t *testing.T) {
+	ports := publishedPorts(nat.PortMap{
+		"6379/tcp": {{HostPort: "6379"}, {HostIP: "::", HostPort: "6379"}},
+		"53/udp":   {{HostPort: "5353"}},
+		"9000/tcp": {{HostPort: ""}},
+	})
+	assert.Equal(t, []string{"5353/udp", "6379/tcp"}, ports)
+}
+
+func TestDirectorySizeAndEstimate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), make([]byte, 1000), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 24), 0644))
+
+	size, err := directorySize(dir)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024), size)
+
+	// 12.5 MB at 100 Mbit/s takes one second
+	assert.InDelta(t, 1.0, estimateTransferSeconds(12_500_000, 100), 0.0001)
+	assert.Zero(t, estimateTransferSeconds(0, 100))
+}
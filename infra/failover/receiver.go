@@ -0,0 +1,509 @@
+package failover
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// TransferPathPrefix is the agent endpoint prefix of the migration receive API
+const TransferPathPrefix = "/api/v1/transfer/"
+
+// UploadOffsetHeader carries the byte offset of a resumable upload
+const UploadOffsetHeader = "Upload-Offset"
+
+var (
+	// ErrUploadOffsetMismatch is returned when an upload chunk does not start at the current offset
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match received size")
+	// ErrUploadBusy is returned when another request is already writing the same upload
+	ErrUploadBusy = errors.New("upload is being written by another request")
+	// ErrInvalidUploadID is returned for upload IDs that are not safe file names
+	ErrInvalidUploadID = errors.New("invalid upload ID")
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// MigrationReceiver applies migration payloads sent by other agents to the local
+// Docker daemon, so no node needs access to another node's Docker socket
+type MigrationReceiver struct {
+	dockerClient *client.Client
+	token        string
+	stagingDir   string         // Where partial uploads are kept until committed
+	hostRoot     string         // Prefix for host paths when the agent runs in a container (e.g. /host)
+	registry     RegistryConfig // Cluster registry, for credentials on pinned pulls
+
+	mu      sync.Mutex
+	uploads map[string]*sync.Mutex        // upload ID -> writer lock
+	syncs   map[string]*volumeSyncSession // sync ID -> block-level volume sync
+}
+
+// VolumeCommit describes where a staged volume archive is extracted
+type VolumeCommit struct {
+	Type   mount.Type `json:"type"`   // bind or volume
+	Source string     `json:"source"` // Host path for bind mounts, volume name for named volumes
+	Size   int64      `json:"size"`   // Expected archive size in bytes
+}
+
+// ContainerStatus is the state of a container reported by the receive API
+type ContainerStatus struct {
+	ID             string `json:"id"`
+	Running        bool   `json:"running"`
+	State          string `json:"state"`
+	HasHealthcheck bool   `json:"has_healthcheck"`
+	Health         string `json:"health,omitempty"` // starting, healthy or unhealthy
+}
+
+// NewMigrationReceiver creates a receiver that stages uploads in stagingDir
+func NewMigrationReceiver(dockerClient *client.Client, token, stagingDir, hostRoot string) (*MigrationReceiver, error) {
+	if err := os.MkdirAll(stagingDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create transfer staging directory: %w", err)
+	}
+
+	return &MigrationReceiver{
+		dockerClient: dockerClient,
+		token:        token,
+		stagingDir:   stagingDir,
+		hostRoot:     hostRoot,
+		uploads:      make(map[string]*sync.Mutex),
+		syncs:        make(map[string]*volumeSyncSession),
+	}, nil
+}
+
+// Enabled reports whether the receiver accepts requests (a cluster token is configured)
+func (r *MigrationReceiver) Enabled() bool {
+	return r.token != ""
+}
+
+// Authorize checks an Authorization header against the cluster token
+func (r *MigrationReceiver) Authorize(header string) bool {
+	if !r.Enabled() {
+		return false
+	}
+	expected := "Bearer " + r.token
+	return subtle.ConstantTimeCompare([]byte(header), []byte(expected)) == 1
+}
+
+// LoadImage loads an image tarball (as produced by docker save) into the local daemon
+func (r *MigrationReceiver) LoadImage(ctx context.Context, reader io.Reader) error {
+	if r.dockerClient == nil {
+		return fmt.Errorf("Docker client not available")
+	}
+
+	resp, err := r.dockerClient.ImageLoad(ctx, reader, true)
+	if err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return readDockerStream(resp.Body)
+}
+
+// SetRegistry sets the cluster registry that pinned images are pulled from
+func (r *MigrationReceiver) SetRegistry(config RegistryConfig) {
+	r.registry = config
+}
+
+// PullImage pulls an image from its registry on the local daemon, optionally tags it
+// (e.g. with its original name after a pull by digest) and returns its image ID
+func (r *MigrationReceiver) PullImage(ctx context.Context, image, tag string) (string, error) {
+	if r.dockerClient == nil {
+		return "", fmt.Errorf("Docker client not available")
+	}
+
+	auth, err := r.registry.authFor(image)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.dockerClient.ImagePull(ctx, image, types.ImagePullOptions{RegistryAuth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	defer resp.Close()
+
+	if err := readDockerStream(resp); err != nil {
+		return "", err
+	}
+
+	inspect, _, err := r.dockerClient.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect pulled image %s: %w", image, err)
+	}
+	if tag != "" {
+		if err := r.dockerClient.ImageTag(ctx, image, tag); err != nil {
+			return "", fmt.Errorf("failed to tag image as %s: %w", tag, err)
+		}
+	}
+	return inspect.ID, nil
+}
+
+// readDockerStream drains a Docker JSON progress stream and returns the first error it reports
+func readDockerStream(stream io.Reader) error {
+	decoder := json.NewDecoder(stream)
+	for {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read Docker response: %w", err)
+		}
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+	}
+}
+
+// uploadPath returns the staging file for an upload
+func (r *MigrationReceiver) uploadPath(uploadID string) (string, error) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return "", ErrInvalidUploadID
+	}
+	return filepath.Join(r.stagingDir, uploadID+".part"), nil
+}
+
+// UploadOffset returns how many bytes of an upload have been received
+func (r *MigrationReceiver) UploadOffset(uploadID string) (int64, error) {
+	path, err := r.uploadPath(uploadID)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat upload: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// AppendUpload appends data to an upload starting at offset and returns the new offset.
+// Data is written as it streams in, so an interrupted request keeps its progress.
+func (r *MigrationReceiver) AppendUpload(uploadID string, offset int64, body io.Reader) (int64, error) {
+	path, err := r.uploadPath(uploadID)
+	if err != nil {
+		return 0, err
+	}
+
+	lock := r.uploadLock(uploadID)
+	if !lock.TryLock() {
+		return 0, ErrUploadBusy
+	}
+	defer lock.Unlock()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to seek upload: %w", err)
+	}
+	if size != offset {
+		return size, ErrUploadOffsetMismatch
+	}
+
+	written, err := io.Copy(file, body)
+	if err != nil {
+		return size + written, fmt.Errorf("upload interrupted: %w", err)
+	}
+	return size + written, nil
+}
+
+// uploadLock returns the writer lock of an upload
+func (r *MigrationReceiver) uploadLock(uploadID string) *sync.Mutex {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock, exists := r.uploads[uploadID]
+	if !exists {
+		lock = &sync.Mutex{}
+		r.uploads[uploadID] = lock
+	}
+	return lock
+}
+
+// CommitVolume extracts a completed volume archive into its host path or named volume
+func (r *MigrationReceiver) CommitVolume(ctx context.Context, uploadID string, commit VolumeCommit) error {
+	path, err := r.uploadPath(uploadID)
+	if err != nil {
+		return err
+	}
+
+	lock := r.uploadLock(uploadID)
+	if !lock.TryLock() {
+		return ErrUploadBusy
+	}
+	defer lock.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("upload %s not found: %w", uploadID, err)
+	}
+	if commit.Size > 0 && info.Size() != commit.Size {
+		return fmt.Errorf("upload %s is incomplete: have %d of %d bytes", uploadID, info.Size(), commit.Size)
+	}
+
+	dest, err := r.volumeDestination(ctx, commit)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	if err := extractTar(file, dest); err != nil {
+		return fmt.Errorf("failed to extract volume archive to %s: %w", dest, err)
+	}
+
+	file.Close()
+	os.Remove(path)
+	r.mu.Lock()
+	delete(r.uploads, uploadID)
+	r.mu.Unlock()
+
+	log.Printf("Committed volume archive %s to %s", uploadID, dest)
+	return nil
+}
+
+// volumeDestination resolves where a volume archive is extracted on this host
+func (r *MigrationReceiver) volumeDestination(ctx context.Context, commit VolumeCommit) (string, error) {
+	switch commit.Type {
+	case mount.TypeBind:
+		if !filepath.IsAbs(commit.Source) {
+			return "", fmt.Errorf("bind mount source must be an absolute path: %q", commit.Source)
+		}
+		return filepath.Join(r.hostRoot, filepath.Clean(commit.Source)), nil
+	case mount.TypeVolume:
+		if r.dockerClient == nil {
+			return "", fmt.Errorf("Docker client not available")
+		}
+		if commit.Source == "" || strings.ContainsAny(commit.Source, "/\\") {
+			return "", fmt.Errorf("invalid volume name: %q", commit.Source)
+		}
+		// Creating an existing volume returns it unchanged
+		vol, err := r.dockerClient.VolumeCreate(ctx, volume.CreateOptions{Name: commit.Source})
+		if err != nil {
+			return "", fmt.Errorf("failed to create volume %s: %w", commit.Source, err)
+		}
+		return filepath.Join(r.hostRoot, vol.Mountpoint), nil
+	default:
+		return "", fmt.Errorf("unsupported mount type %q", commit.Type)
+	}
+}
+
+// PruneUploads removes staged uploads that have not been touched for maxAge
+func (r *MigrationReceiver) PruneUploads(maxAge time.Duration) {
+	entries, err := os.ReadDir(r.stagingDir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !strings.HasSuffix(entry.Name(), ".part") {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(r.stagingDir, entry.Name()))
+		}
+	}
+}
+
+// Preflight reports whether this node can run a container with the requested image, ports, networks and name
+func (r *MigrationReceiver) Preflight(ctx context.Context, req PreflightRequest) (*PreflightResult, error) {
+	if r.dockerClient == nil {
+		return nil, fmt.Errorf("Docker client not available")
+	}
+	return preflight(ctx, r.dockerClient, req)
+}
+
+// CreateContainer creates a container from a migrated configuration
+func (r *MigrationReceiver) CreateContainer(ctx context.Context, config *ContainerConfig) (string, error) {
+	if err := checkSpecVersion(config); err != nil {
+		return "", err
+	}
+	if r.dockerClient == nil {
+		return "", fmt.Errorf("Docker client not available")
+	}
+	return CreateContainerFromConfig(ctx, r.dockerClient, config)
+}
+
+// StartContainer starts a container
+func (r *MigrationReceiver) StartContainer(ctx context.Context, containerID string) error {
+	if r.dockerClient == nil {
+		return fmt.Errorf("Docker client not available")
+	}
+	return r.dockerClient.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+}
+
+// StopContainer stops a container
+func (r *MigrationReceiver) StopContainer(ctx context.Context, containerID string) error {
+	if r.dockerClient == nil {
+		return fmt.Errorf("Docker client not available")
+	}
+	return r.dockerClient.ContainerStop(ctx, containerID, container.StopOptions{})
+}
+
+// RemoveContainer force-removes a container
+func (r *MigrationReceiver) RemoveContainer(ctx context.Context, containerID string) error {
+	if r.dockerClient == nil {
+		return fmt.Errorf("Docker client not available")
+	}
+	return r.dockerClient.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: true})
+}
+
+// ExecContainer runs a hook command inside a running container
+func (r *MigrationReceiver) ExecContainer(ctx context.Context, containerID string, hook MigrationHook) (*HookResult, error) {
+	if r.dockerClient == nil {
+		return nil, fmt.Errorf("Docker client not available")
+	}
+	return execInContainer(ctx, r.dockerClient, containerID, hook.Command, hookTimeout(hook))
+}
+
+// ContainerStatus reports the running and health state of a container
+func (r *MigrationReceiver) ContainerStatus(ctx context.Context, containerID string) (*ContainerStatus, error) {
+	if r.dockerClient == nil {
+		return nil, fmt.Errorf("Docker client not available")
+	}
+	return inspectContainerStatus(ctx, r.dockerClient, containerID)
+}
+
+// inspectContainerStatus builds a ContainerStatus from docker inspect
+func inspectContainerStatus(ctx context.Context, cli *client.Client, containerID string) (*ContainerStatus, error) {
+	inspect, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	status := &ContainerStatus{
+		ID:             inspect.ID,
+		Running:        inspect.State.Running,
+		State:          inspect.State.Status,
+		HasHealthcheck: inspect.Config.Healthcheck != nil,
+	}
+	if inspect.State.Health != nil {
+		status.Health = inspect.State.Health.Status
+	}
+	return status, nil
+}
+
+// extractTar extracts an archive produced by CopyFromContainer into dest.
+// The archive's top-level entry (the copied directory or file) maps to dest itself.
+func extractTar(reader io.Reader, dest string) error {
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		target, err := archiveTarget(dest, header.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", target, err)
+			}
+			if err := writeArchiveFile(target, tr, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", target, err)
+			}
+		case tar.TypeLink:
+			linkSource, err := archiveTarget(dest, header.Linkname)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Link(linkSource, target); err != nil {
+				return fmt.Errorf("failed to create hard link %s: %w", target, err)
+			}
+		default:
+			log.Printf("Skipping unsupported archive entry %s (type %c)", header.Name, header.Typeflag)
+			continue
+		}
+
+		// Ownership is best effort: it fails when the agent does not run as root
+		os.Lchown(target, header.Uid, header.Gid)
+		if header.Typeflag != tar.TypeSymlink {
+			os.Chtimes(target, header.ModTime, header.ModTime)
+		}
+	}
+}
+
+// archiveTarget maps an archive entry name to a path under dest, stripping the
+// top-level component and rejecting entries that escape dest
+func archiveTarget(dest, name string) (string, error) {
+	name = filepath.ToSlash(filepath.Clean(name))
+	if strings.HasPrefix(name, "/") || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("archive entry %q escapes destination", name)
+	}
+
+	// Strip the top-level component: CopyFromContainer names entries after the copied path
+	rel := ""
+	if idx := strings.Index(name, "/"); idx >= 0 {
+		rel = name[idx+1:]
+	}
+
+	target, err := volumePath(dest, rel)
+	if err != nil {
+		return "", fmt.Errorf("archive entry %q: %w", name, err)
+	}
+	return target, nil
+}
+
+// writeArchiveFile writes a regular file from an archive
+func writeArchiveFile(target string, reader io.Reader, mode os.FileMode) error {
+	os.Remove(target)
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", target, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, reader); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package failover
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTar creates an archive shaped like CopyFromContainer output
+func buildTar(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range entries {
+		if strings.HasSuffix(name, "/") {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}))
+			continue
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func newTestReceiver(t *testing.T) *MigrationReceiver {
+	receiver, err := NewMigrationReceiver(nil, "secret", t.TempDir(), "")
+	require.NoError(t, err)
+	return receiver
+}
+
+func TestMigrationReceiver_Authorize(t *testing.T) {
+	receiver := newTestReceiver(t)
+	assert.True(t, receiver.Authorize("Bearer secret"))
+	assert.False(t, receiver.Authorize("Bearer wrong"))
+	assert.False(t, receiver.Authorize(""))
+
+	disabled, err := NewMigrationReceiver(nil, "", t.TempDir(), "")
+	require.NoError(t, err)
+	assert.False(t, disabled.Enabled())
+	assert.False(t, disabled.Authorize("Bearer "))
+}
+
+func TestMigrationReceiver_ResumableUpload(t *testing.T) {
+	receiver := newTestReceiver(t)
+
+	offset, err := receiver.UploadOffset("m1-0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+
+	offset, err = receiver.AppendUpload("m1-0", 0, strings.NewReader("hello "))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), offset)
+
+	// A chunk that does not continue at the received size is rejected
+	offset, err = receiver.AppendUpload("m1-0", 0, strings.NewReader("hello "))
+	assert.ErrorIs(t, err, ErrUploadOffsetMismatch)
+	assert.Equal(t, int64(6), offset)
+
+	offset, err = receiver.AppendUpload("m1-0", 6, strings.NewReader("world"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), offset)
+
+	_, err = receiver.UploadOffset("../escape")
+	assert.ErrorIs(t, err, ErrInvalidUploadID)
+}
+
+func TestMigrationReceiver_CommitBindVolume(t *testing.T) {
+	receiver := newTestReceiver(t)
+	dest := filepath.Join(t.TempDir(), "data")
+
+	archive := buildTar(t, map[string]string{
+		"data/":            "",
+		"data/config.yml":  "key: value\n",
+		"data/sub/":        "",
+		"data/sub/file.db": "payload",
+	})
+	_, err := receiver.AppendUpload("m1-0", 0, bytes.NewReader(archive))
+	require.NoError(t, err)
+
+	// Size mismatch means the upload is incomplete
+	err = receiver.CommitVolume(context.Background(), "m1-0", VolumeCommit{Type: mount.TypeBind, Source: dest, Size: int64(len(archive) + 1)})
+	assert.Error(t, err)
+
+	err = receiver.CommitVolume(context.Background(), "m1-0", VolumeCommit{Type: mount.TypeBind, Source: dest, Size: int64(len(archive))})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(dest, "config.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, "key: value\n", string(content))
+	content, err = os.ReadFile(filepath.Join(dest, "sub", "file.db"))
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(content))
+
+	// Staged upload is removed after commit
+	offset, err := receiver.UploadOffset("m1-0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+}
+
+func TestExtractTar_RejectsEscapingEntries(t *testing.T) {
+	dest := t.TempDir()
+	archive := buildTar(t, map[string]string{
+		"data/../../etc/passwd": "owned",
+	})
+
+	err := extractTar(bytes.NewReader(archive), dest)
+	assert.Error(t, err)
+}
+
+func TestMigrationReceiver_PruneUploads(t *testing.T) {
+	receiver := newTestReceiver(t)
+
+	_, err := receiver.AppendUpload("old", 0, strings.NewReader("x"))
+	require.NoError(t, err)
+	_, err = receiver.AppendUpload("new", 0, strings.NewReader("x"))
+	require.NoError(t, err)
+
+	oldPath, _ := receiver.uploadPath("old")
+	past := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(oldPath, past, past))
+
+	receiver.PruneUploads(24 * time.Hour)
+
+	_, err = os.Stat(oldPath)
+	assert.True(t, os.IsNotExist(err))
+	newPath, _ := receiver.uploadPath("new")
+	_, err = os.Stat(newPath)
+	assert.NoError(t, err)
+}
+
+func TestWaitContainerHealthy(t *testing.T) {
+	calls := 0
+	err := waitContainerHealthy(context.Background(), 10*time.Second, func(_ context.Context) (*ContainerStatus, error) {
+		calls++
+		if calls < 2 {
+			return &ContainerStatus{Running: true, HasHealthcheck: true, Health: "starting"}, nil
+		}
+		return &ContainerStatus{Running: true, HasHealthcheck: true, Health: "healthy"}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	err = waitContainerHealthy(context.Background(), 10*time.Second, func(_ context.Context) (*ContainerStatus, error) {
+		return &ContainerStatus{Running: false, State: "exited"}, nil
+	})
+	assert.ErrorContains(t, err, "exited")
+}
@@ -0,0 +1,239 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	// LocalRegistryContainer is the name of the per-node registry run by agents in local mode
+	LocalRegistryContainer = "constellation-registry"
+	// LocalRegistryImage is the registry image run in local mode
+	LocalRegistryImage = "registry:2"
+	// DefaultRegistryPort is the port local registries listen on
+	DefaultRegistryPort = 5000
+	// registryRepositoryPrefix namespaces migrated images in the cluster registry
+	registryRepositoryPrefix = "constellation"
+)
+
+// RegistryConfig configures the cluster registry images are distributed through during
+// migrations. The source pushes the image and the target pulls it by digest, so only
+// layers the target is missing cross the network.
+type RegistryConfig struct {
+	Address  string // host:port of a shared registry (unused in local mode)
+	Local    bool   // Every agent runs its own registry; targets pull from the source node's
+	Port     int    // Port of local registries (default 5000)
+	Username string
+	Password string
+}
+
+// Enabled reports whether images are distributed through a registry
+func (c RegistryConfig) Enabled() bool {
+	return c.Local || c.Address != ""
+}
+
+// port returns the port of local registries
+func (c RegistryConfig) port() int {
+	if c.Port > 0 {
+		return c.Port
+	}
+	return DefaultRegistryPort
+}
+
+// pushAddress returns the registry the source daemon pushes to
+func (c RegistryConfig) pushAddress() string {
+	if c.Local {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(c.port()))
+	}
+	return c.Address
+}
+
+// pullAddress returns the registry the target daemon pulls from, given the source node's address
+func (c RegistryConfig) pullAddress(sourceHost string) string {
+	if c.Local {
+		return net.JoinHostPort(sourceHost, strconv.Itoa(c.port()))
+	}
+	return c.Address
+}
+
+// authFor returns the encoded credentials for pushing or pulling ref. Credentials are
+// only sent to the cluster registry, never to the registry an image originally came from.
+func (c RegistryConfig) authFor(ref string) (string, error) {
+	auth := registry.AuthConfig{}
+	if c.Username != "" && !c.Local {
+		if named, err := reference.ParseNormalizedNamed(ref); err == nil && reference.Domain(named) == c.Address {
+			auth.Username = c.Username
+			auth.Password = c.Password
+			auth.ServerAddress = c.Address
+		}
+	}
+	encoded, err := registry.EncodeAuthConfig(auth)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode registry credentials: %w", err)
+	}
+	return encoded, nil
+}
+
+// registryRepository returns the cluster registry repository for an image, keeping its
+// original path so images stay recognizable (e.g. nginx -> <registry>/constellation/library/nginx)
+func registryRepository(registryAddress, image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %w", image, err)
+	}
+	path := reference.Path(named)
+	// Images that already came through a cluster registry keep their repository
+	if reference.Domain(named) != "docker.io" {
+		path = strings.TrimPrefix(path, registryRepositoryPrefix+"/")
+	}
+	return registryAddress + "/" + registryRepositoryPrefix + "/" + path, nil
+}
+
+// pushImageToRegistry pushes a local image to the cluster registry and returns the
+// image ID and the digest of the pushed manifest. The image is tagged with its short
+// ID, so pushing the same image again is a no-op for the registry.
+func pushImageToRegistry(ctx context.Context, cli *client.Client, config RegistryConfig, image string) (imageID, digest string, err error) {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+
+	repository, err := registryRepository(config.pushAddress(), image)
+	if err != nil {
+		return "", "", err
+	}
+	tagged := repository + ":" + shortID(strings.TrimPrefix(inspect.ID, "sha256:"))
+	if err := cli.ImageTag(ctx, image, tagged); err != nil {
+		return "", "", fmt.Errorf("failed to tag image for the registry: %w", err)
+	}
+
+	auth, err := config.authFor(tagged)
+	if err != nil {
+		return "", "", err
+	}
+	stream, err := cli.ImagePush(ctx, tagged, types.ImagePushOptions{RegistryAuth: auth})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to push image to %s: %w", config.pushAddress(), err)
+	}
+	defer stream.Close()
+
+	digest, err = readPushDigest(stream)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to push image to %s: %w", config.pushAddress(), err)
+	}
+	return inspect.ID, digest, nil
+}
+
+// readPushDigest drains a Docker push progress stream and returns the manifest digest
+// reported in its final aux message
+func readPushDigest(stream io.Reader) (string, error) {
+	decoder := json.NewDecoder(stream)
+	digest := ""
+	for {
+		var message struct {
+			Error string `json:"error"`
+			Aux   *struct {
+				Digest string `json:"Digest"`
+			} `json:"aux"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", fmt.Errorf("failed to read push progress: %w", err)
+		}
+		if message.Error != "" {
+			return "", fmt.Errorf("%s", message.Error)
+		}
+		if message.Aux != nil && message.Aux.Digest != "" {
+			digest = message.Aux.Digest
+		}
+	}
+	if digest == "" {
+		return "", fmt.Errorf("registry did not report a manifest digest")
+	}
+	return digest, nil
+}
+
+// pinnedReference returns the digest reference the target pulls and runs, so it gets
+// exactly the bits the source pushed
+func pinnedReference(pullAddress, image, digest string) (string, error) {
+	repository, err := registryRepository(pullAddress, image)
+	if err != nil {
+		return "", err
+	}
+	return repository + "@" + digest, nil
+}
+
+// EnsureLocalRegistry starts this node's registry container for local mode, creating it
+// when missing. It listens on loopback for pushes and on bindIP for pulls by other nodes.
+func EnsureLocalRegistry(ctx context.Context, cli *client.Client, port int, bindIP string) error {
+	if port <= 0 {
+		port = DefaultRegistryPort
+	}
+
+	inspect, err := cli.ContainerInspect(ctx, LocalRegistryContainer)
+	if err == nil {
+		if inspect.State != nil && inspect.State.Running {
+			return nil
+		}
+		if err := cli.ContainerStart(ctx, inspect.ID, types.ContainerStartOptions{}); err != nil {
+			return fmt.Errorf("failed to start registry container: %w", err)
+		}
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to inspect registry container: %w", err)
+	}
+
+	log.Printf("Creating local image registry %s on port %d", LocalRegistryContainer, port)
+	pull, err := cli.ImagePull(ctx, LocalRegistryImage, types.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", LocalRegistryImage, err)
+	}
+	err = readDockerStream(pull)
+	pull.Close()
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", LocalRegistryImage, err)
+	}
+
+	hostPort := strconv.Itoa(port)
+	bindings := []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: hostPort}}
+	if bindIP != "" && bindIP != "127.0.0.1" {
+		bindings = append(bindings, nat.PortBinding{HostIP: bindIP, HostPort: hostPort})
+	}
+
+	created, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:        LocalRegistryImage,
+			ExposedPorts: nat.PortSet{"5000/tcp": struct{}{}},
+			// Registry containers are node infrastructure and never migrated
+			Labels: map[string]string{MigratableLabel: "false"},
+		},
+		&container.HostConfig{
+			PortBindings:  nat.PortMap{"5000/tcp": bindings},
+			Binds:         []string{LocalRegistryContainer + "-data:/var/lib/registry"},
+			RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+		},
+		nil, nil, LocalRegistryContainer)
+	if err != nil {
+		return fmt.Errorf("failed to create registry container: %w", err)
+	}
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("failed to start registry container: %w", err)
+	}
+	return nil
+}
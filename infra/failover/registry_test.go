@@ -0,0 +1,87 @@
+package failover
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryRepository(t *testing.T) {
+	cases := map[string]string{
+		"nginx":              "registry:5000/constellation/library/nginx",
+		"nginx:1.25":         "registry:5000/constellation/library/nginx",
+		"ghcr.io/org/app:v1": "registry:5000/constellation/org/app",
+		"quay.io/org/app@sha256:" + strings.Repeat("a", 64): "registry:5000/constellation/org/app",
+		// An image pinned by an earlier migration keeps its repository on the next hop
+		"100.64.0.2:5000/constellation/library/nginx@sha256:" + strings.Repeat("b", 64): "registry:5000/constellation/library/nginx",
+	}
+	for image, expected := range cases {
+		repository, err := registryRepository("registry:5000", image)
+		require.NoError(t, err, image)
+		assert.Equal(t, expected, repository, image)
+	}
+
+	_, err := registryRepository("registry:5000", "Invalid Image")
+	assert.Error(t, err)
+}
+
+func TestRegistryConfig_Addresses(t *testing.T) {
+	shared := RegistryConfig{Address: "registry.internal:5000"}
+	assert.True(t, shared.Enabled())
+	assert.Equal(t, "registry.internal:5000", shared.pushAddress())
+	assert.Equal(t, "registry.internal:5000", shared.pullAddress("100.64.0.1"))
+
+	local := RegistryConfig{Local: true}
+	assert.Equal(t, "127.0.0.1:5000", local.pushAddress())
+	assert.Equal(t, "100.64.0.1:5000", local.pullAddress("100.64.0.1"))
+
+	assert.False(t, RegistryConfig{}.Enabled())
+
+	ref, err := pinnedReference(local.pullAddress("100.64.0.1"), "nginx:latest", "sha256:"+strings.Repeat("c", 64))
+	require.NoError(t, err)
+	assert.Equal(t, "100.64.0.1:5000/constellation/library/nginx@sha256:"+strings.Repeat("c", 64), ref)
+}
+
+func TestRegistryConfig_AuthOnlyForClusterRegistry(t *testing.T) {
+	config := RegistryConfig{Address: "registry.internal:5000", Username: "agent", Password: "secret"}
+
+	decode := func(encoded string) registry.AuthConfig {
+		data, err := base64.URLEncoding.DecodeString(encoded)
+		require.NoError(t, err)
+		var auth registry.AuthConfig
+		require.NoError(t, json.Unmarshal(data, &auth))
+		return auth
+	}
+
+	encoded, err := config.authFor("registry.internal:5000/constellation/library/nginx@sha256:" + strings.Repeat("d", 64))
+	require.NoError(t, err)
+	assert.Equal(t, "agent", decode(encoded).Username)
+
+	// Credentials are never sent to the registry an image originally came from
+	encoded, err = config.authFor("docker.io/library/nginx:latest")
+	require.NoError(t, err)
+	assert.Empty(t, decode(encoded).Username)
+}
+
+func TestReadPushDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("e", 64)
+	stream := `{"status":"The push refers to repository [127.0.0.1:5000/constellation/library/nginx]"}
+{"status":"Layer already exists","progressDetail":{},"id":"a1b2c3"}
+{"status":"abc123: digest: ` + digest + ` size: 1570"}
+{"progressDetail":{},"aux":{"Tag":"abc123","Digest":"` + digest + `","Size":1570}}
+`
+	result, err := readPushDigest(strings.NewReader(stream))
+	require.NoError(t, err)
+	assert.Equal(t, digest, result)
+
+	_, err = readPushDigest(strings.NewReader(`{"errorDetail":{"message":"denied"},"error":"denied: requested access to the resource is denied"}`))
+	assert.ErrorContains(t, err, "denied")
+
+	_, err = readPushDigest(strings.NewReader(`{"status":"Preparing"}`))
+	assert.Error(t, err)
+}
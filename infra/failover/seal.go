@@ -0,0 +1,97 @@
+package failover
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"cluster/infra/cluster/raft"
+)
+
+// Published workloads are replicated to every node through the Raft log, where they stay
+// until the log is compacted. Container environments often hold secrets, so they are
+// encrypted with a key derived from the cluster token before they are published.
+
+// envCipher returns the cipher environments are sealed with for a cluster token
+func envCipher(clusterToken string) (cipher.AEAD, error) {
+	if clusterToken == "" {
+		return nil, fmt.Errorf("no cluster token configured")
+	}
+	key := sha256.Sum256([]byte("constellation workload env\x00" + clusterToken))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealEnv encrypts a container environment with the cluster token
+func sealEnv(clusterToken string, env []string) ([]byte, error) {
+	aead, err := envCipher(clusterToken)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openEnv decrypts an environment sealed by sealEnv
+func openEnv(clusterToken string, sealed []byte) ([]string, error) {
+	aead, err := envCipher(clusterToken)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed environment too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt environment (cluster token differs?): %w", err)
+	}
+	var env []string
+	if err := json.Unmarshal(plaintext, &env); err != nil {
+		return nil, fmt.Errorf("invalid sealed environment: %w", err)
+	}
+	return env, nil
+}
+
+// publishSpec fills in the published container spec of a service. The environment is
+// sealed separately, or withheld without a cluster token. An unchanged environment keeps
+// the ciphertext previously published, so the workload is not rewritten for nothing.
+func publishSpec(service *raft.WorkloadService, config *ContainerConfig, clusterToken string, previous *raft.WorkloadService) error {
+	stripped := *config
+	stripped.Env = nil
+	spec, err := json.Marshal(&stripped)
+	if err != nil {
+		return err
+	}
+	service.Spec = spec
+
+	if len(config.Env) == 0 {
+		return nil
+	}
+	if clusterToken == "" {
+		service.EnvWithheld = true
+		return nil
+	}
+	if previous != nil && len(previous.SealedEnv) > 0 {
+		if env, err := openEnv(clusterToken, previous.SealedEnv); err == nil && slices.Equal(env, config.Env) {
+			service.SealedEnv = previous.SealedEnv
+			return nil
+		}
+	}
+	service.SealedEnv, err = sealEnv(clusterToken, config.Env)
+	return err
+}
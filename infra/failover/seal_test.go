@@ -0,0 +1,74 @@
+package failover
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cluster/infra/cluster/raft"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealEnv(t *testing.T) {
+	env := []string{"DB_PASSWORD=hunter2", "LOG_LEVEL=debug"}
+
+	sealed, err := sealEnv("cluster-token", env)
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "hunter2")
+
+	opened, err := openEnv("cluster-token", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, env, opened)
+
+	_, err = openEnv("other-token", sealed)
+	assert.Error(t, err)
+	_, err = openEnv("", sealed)
+	assert.Error(t, err)
+	_, err = openEnv("cluster-token", sealed[:4])
+	assert.Error(t, err)
+	_, err = sealEnv("", env)
+	assert.Error(t, err)
+}
+
+func TestPublishSpec(t *testing.T) {
+	config := &ContainerConfig{Version: ContainerSpecVersion, Image: "nginx", Env: []string{"API_KEY=secret"}}
+
+	// The environment is sealed apart from the spec
+	var service raft.WorkloadService
+	require.NoError(t, publishSpec(&service, config, "cluster-token", nil))
+	assert.NotContains(t, string(service.Spec), "secret")
+	assert.NotEmpty(t, service.SealedEnv)
+	assert.False(t, service.EnvWithheld)
+	assert.Equal(t, []string{"API_KEY=secret"}, config.Env, "the exported config is left alone")
+
+	recovered, err := recoverableSpec("node1", service, "cluster-token")
+	require.NoError(t, err)
+	assert.Equal(t, config, recovered)
+
+	// An unchanged environment keeps its ciphertext, so the workload is not rewritten
+	var republished raft.WorkloadService
+	require.NoError(t, publishSpec(&republished, config, "cluster-token", &service))
+	assert.Equal(t, service, republished)
+
+	changed := *config
+	changed.Env = []string{"API_KEY=rotated"}
+	republished = raft.WorkloadService{}
+	require.NoError(t, publishSpec(&republished, &changed, "cluster-token", &service))
+	assert.NotEqual(t, service.SealedEnv, republished.SealedEnv)
+
+	// Without a cluster token the environment is withheld
+	var withheld raft.WorkloadService
+	require.NoError(t, publishSpec(&withheld, config, "", nil))
+	assert.True(t, withheld.EnvWithheld)
+	assert.Empty(t, withheld.SealedEnv)
+	assert.NotContains(t, string(withheld.Spec), "secret")
+
+	// Nothing to seal
+	var plain raft.WorkloadService
+	require.NoError(t, publishSpec(&plain, &ContainerConfig{Image: "nginx"}, "", nil))
+	assert.False(t, plain.EnvWithheld)
+	var spec ContainerConfig
+	require.NoError(t, json.Unmarshal(plain.Spec, &spec))
+	assert.Equal(t, "nginx", spec.Image)
+}
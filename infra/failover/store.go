@@ -0,0 +1,140 @@
+package failover
+
+import (
+	"sort"
+	"sync"
+
+	"cluster/infra/cluster/raft"
+)
+
+// MigrationStore persists migration, node drain and node workload records so they
+// outlive the migrating process and can be queried from any node. The Raft consensus
+// manager implements it.
+type MigrationStore interface {
+	PutMigration(record *raft.MigrationRecord) error
+	GetMigration(id string) (*raft.MigrationRecord, bool)
+	ListMigrations(filter raft.MigrationFilter) ([]*raft.MigrationRecord, int)
+	PutDrain(drain *raft.DrainRecord) error
+	GetDrain(nodeName string) (*raft.DrainRecord, bool)
+	ListDrains() []*raft.DrainRecord
+	PutWorkload(workload *raft.NodeWorkload) error
+	GetWorkload(nodeName string) (*raft.NodeWorkload, bool)
+}
+
+// leaderStore is implemented by stores replicated with a leader; the leader coordinates
+// the evacuation of nodes that are down
+type leaderStore interface {
+	IsLeader() bool
+}
+
+// memoryMigrationStore is a process-local MigrationStore used when no
+// consensus store is configured (single node setups and tests)
+type memoryMigrationStore struct {
+	mu        sync.RWMutex
+	records   map[string]*raft.MigrationRecord
+	drains    map[string]*raft.DrainRecord
+	workloads map[string]*raft.NodeWorkload
+}
+
+// newMemoryMigrationStore creates an empty in-memory migration store
+func newMemoryMigrationStore() *memoryMigrationStore {
+	return &memoryMigrationStore{
+		records:   make(map[string]*raft.MigrationRecord),
+		drains:    make(map[string]*raft.DrainRecord),
+		workloads: make(map[string]*raft.NodeWorkload),
+	}
+}
+
+// PutMigration stores a copy of the record
+func (s *memoryMigrationStore) PutMigration(record *raft.MigrationRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.ID] = record.Copy()
+	return nil
+}
+
+// GetMigration returns a copy of the record with the given ID
+func (s *memoryMigrationStore) GetMigration(id string) (*raft.MigrationRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, exists := s.records[id]
+	if !exists {
+		return nil, false
+	}
+	return record.Copy(), true
+}
+
+// ListMigrations returns records matching the filter, newest first
+func (s *memoryMigrationStore) ListMigrations(filter raft.MigrationFilter) ([]*raft.MigrationRecord, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*raft.MigrationRecord, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	return raft.FilterMigrations(records, filter)
+}
+
+// PutDrain stores a copy of the drain record
+func (s *memoryMigrationStore) PutDrain(drain *raft.DrainRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.drains[drain.NodeName]; exists && existing.StartedAt.Equal(drain.StartedAt) &&
+		!existing.Cordoned() && drain.Cordoned() {
+		return raft.ErrDrainEnded
+	}
+	s.drains[drain.NodeName] = drain.Copy()
+	return nil
+}
+
+// GetDrain returns a copy of the drain record of a node
+func (s *memoryMigrationStore) GetDrain(nodeName string) (*raft.DrainRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	drain, exists := s.drains[nodeName]
+	if !exists {
+		return nil, false
+	}
+	return drain.Copy(), true
+}
+
+// ListDrains returns copies of the latest drain record of every node
+func (s *memoryMigrationStore) ListDrains() []*raft.DrainRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	drains := make([]*raft.DrainRecord, 0, len(s.drains))
+	for _, drain := range s.drains {
+		drains = append(drains, drain.Copy())
+	}
+	sort.Slice(drains, func(i, j int) bool {
+		return drains[i].NodeName < drains[j].NodeName
+	})
+	return drains
+}
+
+// PutWorkload stores a copy of a node's workload
+func (s *memoryMigrationStore) PutWorkload(workload *raft.NodeWorkload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.workloads[workload.NodeName] = workload.Copy()
+	return nil
+}
+
+// GetWorkload returns a copy of the workload of a node
+func (s *memoryMigrationStore) GetWorkload(nodeName string) (*raft.NodeWorkload, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workload, exists := s.workloads[nodeName]
+	if !exists {
+		return nil, false
+	}
+	return workload.Copy(), true
+}
@@ -0,0 +1,321 @@
+package failover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxUploadAttempts bounds how often a volume upload is resumed after a failure
+const maxUploadAttempts = 5
+
+// TargetClient talks to the migration receive API of another node's agent
+type TargetClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewTargetClient creates a client for the agent listening on host:port
+func NewTargetClient(host string, port int, token string) *TargetClient {
+	return &TargetClient{
+		baseURL: fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(port))),
+		token:   token,
+		// No overall timeout: image and volume streams can take a long time.
+		// Requests are bounded by their context instead.
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout:   10 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				ResponseHeaderTimeout: 10 * time.Minute,
+			},
+		},
+	}
+}
+
+// do sends a request to the receive API and returns the response for 2xx status codes
+func (tc *TargetClient) do(ctx context.Context, method, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, tc.baseURL+TransferPathPrefix+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+tc.token)
+
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &TargetError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message)), Header: resp.Header}
+	}
+	return resp, nil
+}
+
+// doJSON sends a JSON request and decodes a JSON response into out (if non-nil)
+func (tc *TargetClient) doJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	header := http.Header{}
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := tc.do(ctx, method, path, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// TargetError is a non-2xx response from the receive API
+type TargetError struct {
+	StatusCode int
+	Message    string
+	Header     http.Header
+}
+
+func (e *TargetError) Error() string {
+	return fmt.Sprintf("target agent returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Ping checks that the target agent is reachable and accepts the cluster token
+func (tc *TargetClient) Ping(ctx context.Context) error {
+	return tc.doJSON(ctx, http.MethodGet, "ping", nil, nil)
+}
+
+// LoadImage streams an image tarball to the target
+func (tc *TargetClient) LoadImage(ctx context.Context, imageReader io.Reader) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-tar")
+
+	resp, err := tc.do(ctx, http.MethodPost, "images", imageReader, header)
+	if err != nil {
+		return fmt.Errorf("failed to load image on target: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PullImage asks the target to pull an image from its registry
+func (tc *TargetClient) PullImage(ctx context.Context, image string) error {
+	if err := tc.doJSON(ctx, http.MethodPost, "images/pull", map[string]string{"image": image}, nil); err != nil {
+		return fmt.Errorf("failed to pull image on target: %w", err)
+	}
+	return nil
+}
+
+// PullPinnedImage asks the target to pull an image by digest reference and tag it with
+// its original name, and returns the image ID the target ended up with
+func (tc *TargetClient) PullPinnedImage(ctx context.Context, ref, tag string) (string, error) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := tc.doJSON(ctx, http.MethodPost, "images/pull", map[string]string{"image": ref, "tag": tag}, &resp); err != nil {
+		return "", fmt.Errorf("failed to pull image on target: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// UploadOffset returns how many bytes of an upload the target already has
+func (tc *TargetClient) UploadOffset(ctx context.Context, uploadID string) (int64, error) {
+	resp, err := tc.do(ctx, http.MethodHead, "uploads/"+uploadID, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return strconv.ParseInt(resp.Header.Get(UploadOffsetHeader), 10, 64)
+}
+
+// UploadFile uploads a local file, resuming from the target's offset after failures
+func (tc *TargetClient) UploadFile(ctx context.Context, uploadID, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	size := info.Size()
+
+	var lastErr error
+	for attempt := 1; attempt <= maxUploadAttempts; attempt++ {
+		offset, err := tc.UploadOffset(ctx, uploadID)
+		if err != nil {
+			lastErr = err
+		} else if offset == size {
+			return nil
+		} else if offset > size {
+			return fmt.Errorf("target has %d bytes of upload %s, more than the %d byte source", offset, uploadID, size)
+		} else {
+			if _, err := file.Seek(offset, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek %s: %w", path, err)
+			}
+
+			header := http.Header{}
+			header.Set("Content-Type", "application/offset+octet-stream")
+			header.Set(UploadOffsetHeader, strconv.FormatInt(offset, 10))
+			resp, err := tc.do(ctx, http.MethodPatch, "uploads/"+uploadID, io.NopCloser(file), header)
+			if err == nil {
+				resp.Body.Close()
+				continue // Confirm the final offset on the next iteration
+			}
+			lastErr = err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Warning: Upload %s interrupted (attempt %d/%d), resuming: %v", uploadID, attempt, maxUploadAttempts, lastErr)
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return fmt.Errorf("upload %s failed after %d attempts: %w", uploadID, maxUploadAttempts, lastErr)
+}
+
+// CommitVolume extracts a completed upload into a volume on the target
+func (tc *TargetClient) CommitVolume(ctx context.Context, uploadID string, commit VolumeCommit) error {
+	if err := tc.doJSON(ctx, http.MethodPost, "volumes/"+uploadID+"/commit", commit, nil); err != nil {
+		return fmt.Errorf("failed to commit volume on target: %w", err)
+	}
+	return nil
+}
+
+// PlanVolumeSync sends a volume's entries to the target and returns the files it needs
+func (tc *TargetClient) PlanVolumeSync(ctx context.Context, syncID string, req VolumeSyncRequest) (*VolumeSyncPlan, error) {
+	var plan VolumeSyncPlan
+	if err := tc.doJSON(ctx, http.MethodPost, "volumes/sync/"+syncID+"/plan", req, &plan); err != nil {
+		return nil, fmt.Errorf("failed to plan volume sync on target: %w", err)
+	}
+	return &plan, nil
+}
+
+// SendVolumeDelta streams the delta produced by writeDelta for one file and returns the bytes of block data sent
+func (tc *TargetClient) SendVolumeDelta(ctx context.Context, syncID, filePath string, writeDelta func(io.Writer) (int64, error)) (int64, error) {
+	pr, pw := io.Pipe()
+	sentCh := make(chan int64, 1)
+	go func() {
+		sent, err := writeDelta(pw)
+		sentCh <- sent
+		pw.CloseWithError(err)
+	}()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err := tc.do(ctx, http.MethodPut, "volumes/sync/"+syncID+"/files?path="+url.QueryEscape(filePath), pr, header)
+	// Unblock the writer if the request ended before reading the whole stream
+	pr.CloseWithError(io.ErrClosedPipe)
+	sent := <-sentCh
+	if err != nil {
+		return sent, err
+	}
+	resp.Body.Close()
+	return sent, nil
+}
+
+// FinalizeVolumeSync asks the target to apply metadata, remove stale files and verify every checksum
+func (tc *TargetClient) FinalizeVolumeSync(ctx context.Context, syncID string) (*VolumeSyncResult, error) {
+	var result VolumeSyncResult
+	if err := tc.doJSON(ctx, http.MethodPost, "volumes/sync/"+syncID+"/finalize", nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to finalize volume sync on target: %w", err)
+	}
+	return &result, nil
+}
+
+// Preflight asks the target whether it can run a container, without changing anything
+func (tc *TargetClient) Preflight(ctx context.Context, req PreflightRequest) (*PreflightResult, error) {
+	var result PreflightResult
+	if err := tc.doJSON(ctx, http.MethodPost, "preflight", req, &result); err != nil {
+		return nil, fmt.Errorf("failed to run preflight on target: %w", err)
+	}
+	return &result, nil
+}
+
+// CreateContainer creates a container on the target and returns its ID
+func (tc *TargetClient) CreateContainer(ctx context.Context, config *ContainerConfig) (string, error) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := tc.doJSON(ctx, http.MethodPost, "containers", config, &resp); err != nil {
+		return "", fmt.Errorf("failed to create container on target: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// StartContainer starts a container on the target
+func (tc *TargetClient) StartContainer(ctx context.Context, containerID string) error {
+	return tc.doJSON(ctx, http.MethodPost, "containers/"+containerID+"/start", nil, nil)
+}
+
+// StopContainer stops a container on the target
+func (tc *TargetClient) StopContainer(ctx context.Context, containerID string) error {
+	return tc.doJSON(ctx, http.MethodPost, "containers/"+containerID+"/stop", nil, nil)
+}
+
+// RemoveContainer force-removes a container on the target
+func (tc *TargetClient) RemoveContainer(ctx context.Context, containerID string) error {
+	return tc.doJSON(ctx, http.MethodDelete, "containers/"+containerID, nil, nil)
+}
+
+// ExecContainer runs a hook command inside a container on the target
+func (tc *TargetClient) ExecContainer(ctx context.Context, containerID string, hook MigrationHook) (*HookResult, error) {
+	var result HookResult
+	if err := tc.doJSON(ctx, http.MethodPost, "containers/"+containerID+"/exec", hook, &result); err != nil {
+		return nil, fmt.Errorf("failed to run hook on target: %w", err)
+	}
+	return &result, nil
+}
+
+// ContainerStatus returns the state of a container on the target
+func (tc *TargetClient) ContainerStatus(ctx context.Context, containerID string) (*ContainerStatus, error) {
+	var status ContainerStatus
+	if err := tc.doJSON(ctx, http.MethodGet, "containers/"+containerID, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// WaitHealthy polls a container on the target until it is healthy
+func (tc *TargetClient) WaitHealthy(ctx context.Context, containerID string, timeout time.Duration) error {
+	return waitContainerHealthy(ctx, timeout, func(ctx context.Context) (*ContainerStatus, error) {
+		return tc.ContainerStatus(ctx, containerID)
+	})
+}
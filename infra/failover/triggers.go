@@ -0,0 +1,152 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+
+	"cluster/infra/monitoring"
+)
+
+// triggerSampleMargin is kept beyond a trigger's longest sustained window so the
+// window can be proven to be fully covered
+const triggerSampleMargin = time.Minute
+
+// resourceTrigger holds the parsed expression and sample history of one rule
+type resourceTrigger struct {
+	expr   *monitoring.TriggerExpression
+	window *monitoring.SampleWindow
+}
+
+// resourceTriggerFor returns the trigger state of a rule, parsing its expression on
+// first use or when it changed. Callers hold mm.metricsMu.
+func (mm *MigrationManager) resourceTriggerFor(rule MigrationRule) (*resourceTrigger, error) {
+	source := strings.TrimSpace(rule.Trigger.ResourceThreshold)
+	if trigger, ok := mm.triggers[rule.ServiceName]; ok && trigger.expr.String() == source {
+		return trigger, nil
+	}
+
+	expr, err := monitoring.ParseTriggerExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	trigger := &resourceTrigger{
+		expr:   expr,
+		window: monitoring.NewSampleWindow(expr.MaxDuration() + triggerSampleMargin),
+	}
+	if mm.triggers == nil {
+		mm.triggers = make(map[string]*resourceTrigger)
+	}
+	mm.triggers[rule.ServiceName] = trigger
+	return trigger, nil
+}
+
+// collectNodeMetrics samples this node's resource usage and keeps it as the latest metrics
+func (mm *MigrationManager) collectNodeMetrics(ctx context.Context) (*monitoring.NodeMetrics, error) {
+	mm.metricsMu.Lock()
+	defer mm.metricsMu.Unlock()
+
+	metrics, err := mm.metricsCollector.CollectMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mm.lastMetrics = metrics
+	return metrics, nil
+}
+
+// evaluateResourceTrigger records a sample for the rule and evaluates its expression over
+// the rule's rolling window, so sustained conditions ("cpu>85% for 5m") ignore single spikes
+func (mm *MigrationManager) evaluateResourceTrigger(ctx context.Context, rule MigrationRule, metrics *monitoring.NodeMetrics) (bool, error) {
+	mm.metricsMu.Lock()
+	trigger, err := mm.resourceTriggerFor(rule)
+	mm.metricsMu.Unlock()
+	if err != nil {
+		return false, fmt.Errorf("invalid resource threshold: %w", err)
+	}
+
+	values := metrics.Values()
+	if trigger.expr.UsesContainerMetrics() {
+		containerValues, err := mm.containerMetrics(ctx, rule.ServiceName)
+		if err != nil {
+			log.Printf("Warning: Failed to collect container metrics for %s: %v", rule.ServiceName, err)
+		} else {
+			for name, value := range containerValues {
+				values[name] = value
+			}
+		}
+	}
+
+	trigger.window.Add(monitoring.Sample{Time: metrics.Timestamp, Values: values})
+	return trigger.expr.Evaluate(trigger.window, metrics.Timestamp)
+}
+
+// containerMetrics returns the resource usage of a service's running container by trigger
+// metric name, read from its cgroup v2 directory or, where that is unavailable, from Docker stats
+func (mm *MigrationManager) containerMetrics(ctx context.Context, serviceName string) (map[string]float64, error) {
+	if mm.dockerClient == nil {
+		return nil, fmt.Errorf("Docker client not available")
+	}
+
+	source, err := mm.findServiceContainer(ctx, serviceName, false)
+	if err != nil {
+		return nil, err
+	}
+	containerID := source.ID
+
+	mm.metricsMu.RLock()
+	collector := mm.metricsCollector
+	mm.metricsMu.RUnlock()
+	if metrics, err := collector.CollectContainerMetrics(ctx, containerID); err == nil {
+		return metrics.Values(), nil
+	}
+
+	// cgroup v1 hosts: Docker stats provide CPU and memory only, so expressions using
+	// container IO or pressure report those metrics as unavailable.
+	// A non-streaming request waits for a second sample so the CPU delta is meaningful.
+	resp, err := mm.dockerClient.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container stats: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var stats types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("failed to decode container stats: %w", err)
+	}
+
+	cpuPercent, memoryPercent := containerUsage(&stats)
+	return map[string]float64{
+		monitoring.MetricContainerCPU:    cpuPercent,
+		monitoring.MetricContainerMemory: memoryPercent,
+	}, nil
+}
+
+// containerUsage computes CPU and memory percentages from Docker stats, the way docker stats does
+func containerUsage(stats *types.StatsJSON) (cpuPercent, memoryPercent float64) {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpuPercent = cpuDelta / systemDelta * onlineCPUs * 100.0
+	}
+
+	// Page cache is reclaimable, so it does not count as used (cgroup v2: inactive_file, v1: cache)
+	used := float64(stats.MemoryStats.Usage)
+	if inactive, ok := stats.MemoryStats.Stats["inactive_file"]; ok && float64(inactive) < used {
+		used -= float64(inactive)
+	} else if cache, ok := stats.MemoryStats.Stats["cache"]; ok && float64(cache) < used {
+		used -= float64(cache)
+	}
+	if stats.MemoryStats.Limit > 0 {
+		memoryPercent = used / float64(stats.MemoryStats.Limit) * 100.0
+	}
+	return cpuPercent, memoryPercent
+}
@@ -0,0 +1,250 @@
+package failover
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cluster/infra/monitoring"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateResourceThreshold_Operators(t *testing.T) {
+	metrics := &monitoring.NodeMetrics{CPUPercent: 80, MemoryPercent: 50, DiskPercent: 91, Load1: 4.5}
+
+	cases := map[string]bool{
+		"cpu>80%":                        false,
+		"cpu>=80%":                       true,
+		"memory<=50%":                    true,
+		"memory<50":                      false,
+		"disk>90% && load1>4":            true,
+		"cpu>95% || memory>=50%":         true,
+		"cpu>95% || (disk>90 && mem>60)": false,
+	}
+	for expr, expected := range cases {
+		result, err := monitoring.EvaluateResourceThreshold(metrics, expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, expected, result, expr)
+	}
+
+	// A sustained condition never holds for a single sample
+	result, err := monitoring.EvaluateResourceThreshold(metrics, "cpu>50% for 1m")
+	require.NoError(t, err)
+	assert.False(t, result)
+}
+
+func TestParseTriggerExpression_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"gpu>50%",
+		"cpu=>50%",
+		"cpu>",
+		"cpu>50% for",
+		"cpu>50% for soon",
+		"(cpu>50%",
+		"cpu>50% memory>20%",
+		"cpu>50% & memory>20%",
+	} {
+		_, err := monitoring.ParseTriggerExpression(expr)
+		assert.Error(t, err, expr)
+	}
+
+	expr, err := monitoring.ParseTriggerExpression("net_rx>50MB/s for 2m || container_memory>95% for 5m")
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, expr.MaxDuration())
+	assert.True(t, expr.UsesContainerMetrics())
+	assert.Equal(t, []string{monitoring.MetricContainerMemory, monitoring.MetricNetRx}, expr.Metrics())
+}
+
+func TestTriggerExpression_SustainedWindow(t *testing.T) {
+	expr, err := monitoring.ParseTriggerExpression("cpu>85% for 5m")
+	require.NoError(t, err)
+
+	window := monitoring.NewSampleWindow(expr.MaxDuration() + time.Minute)
+	start := time.Now()
+	add := func(offset time.Duration, cpu float64) bool {
+		now := start.Add(offset)
+		window.Add(monitoring.Sample{Time: now, Values: map[string]float64{monitoring.MetricCPU: cpu}})
+		result, err := expr.Evaluate(window, now)
+		require.NoError(t, err)
+		return result
+	}
+
+	// High from the start, but not for five minutes yet
+	for i := 0; i < 10; i++ {
+		assert.False(t, add(time.Duration(i)*30*time.Second, 90))
+	}
+	assert.True(t, add(5*time.Minute, 90))
+
+	// One dip restarts the window
+	assert.False(t, add(5*time.Minute+30*time.Second, 40))
+	assert.False(t, add(10*time.Minute, 90))
+	assert.True(t, add(10*time.Minute+30*time.Second, 90))
+
+	// Old samples are pruned, keeping one before the retention
+	assert.LessOrEqual(t, window.Len(), 14)
+}
+
+func TestMigrationManager_EvaluateResourceTrigger(t *testing.T) {
+	manager, _ := createTestMigrationManager()
+	rule := MigrationRule{ServiceName: "svc", Trigger: MigrationTrigger{ResourceThreshold: "memory>90% for 1m"}}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		metrics := &monitoring.NodeMetrics{MemoryPercent: 95, Timestamp: start.Add(time.Duration(i) * 30 * time.Second)}
+		exceeded, err := manager.evaluateResourceTrigger(context.Background(), rule, metrics)
+		require.NoError(t, err)
+		assert.Equal(t, i == 2, exceeded)
+	}
+
+	// Changing the expression starts a new window
+	rule.Trigger.ResourceThreshold = "memory>90% for 2m"
+	exceeded, err := manager.evaluateResourceTrigger(context.Background(), rule,
+		&monitoring.NodeMetrics{MemoryPercent: 95, Timestamp: start.Add(90 * time.Second)})
+	require.NoError(t, err)
+	assert.False(t, exceeded)
+
+	// Container metrics are unavailable without Docker
+	rule.Trigger.ResourceThreshold = "container_cpu>50%"
+	_, err = manager.evaluateResourceTrigger(context.Background(), rule, &monitoring.NodeMetrics{Timestamp: start})
+	assert.Error(t, err)
+}
+
+func TestContainerUsage(t *testing.T) {
+	var stats types.StatsJSON
+	stats.CPUStats.CPUUsage.TotalUsage = 300
+	stats.PreCPUStats.CPUUsage.TotalUsage = 100
+	stats.CPUStats.SystemUsage = 2000
+	stats.PreCPUStats.SystemUsage = 1000
+	stats.CPUStats.OnlineCPUs = 4
+	stats.MemoryStats.Usage = 600
+	stats.MemoryStats.Limit = 1000
+	stats.MemoryStats.Stats = map[string]uint64{"inactive_file": 100}
+
+	cpu, memory := containerUsage(&stats)
+	assert.InDelta(t, 80.0, cpu, 0.001)
+	assert.InDelta(t, 50.0, memory, 0.001)
+}
+
+// writeHostFiles creates files under a fake host root
+func writeHostFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		require.NoError(t, os.WriteFile(full, []byte(content), 0644))
+	}
+}
+
+func TestMetricsCollector_NativeNodeMetrics(t *testing.T) {
+	root := t.TempDir()
+	writeHostFiles(t, root, map[string]string{
+		"proc/stat":            "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 100 0 100 700 100 0 0 0 0 0\n",
+		"proc/meminfo":         "MemTotal:       1000 kB\nMemFree:         100 kB\nMemAvailable:    250 kB\n",
+		"proc/loadavg":         "1.50 0.75 0.25 2/300 1234\n",
+		"proc/diskstats":       "   8       0 sda 10 0 100 5 20 0 200 5 0 100 10 0 0 0 0\n   8       1 sda1 10 0 100 5 20 0 200 5 0 100 10 0 0 0 0\n   7       0 loop0 10 0 999 5 20 0 999 5 0 999 10 0 0 0 0\n",
+		"proc/net/dev":         "Inter-|   Receive\n face |bytes\n    lo: 500 1 0 0 0 0 0 0 500 1 0 0 0 0 0 0\n  eth0: 1000 1 0 0 0 0 0 0 2000 1 0 0 0 0 0 0\n",
+		"proc/pressure/cpu":    "some avg10=12.50 avg60=5.00 avg300=1.00 total=100\n",
+		"proc/pressure/memory": "some avg10=3.00 avg60=1.00 avg300=0.00 total=10\nfull avg10=1.00 avg60=0.00 avg300=0.00 total=5\n",
+		"sys/block/sda/size":   "1000\n",
+	})
+
+	collector := monitoring.NewMetricsCollector()
+	collector.SetHostRoot(root)
+
+	// The first collection primes the counters itself; unchanged counters mean no usage
+	first, err := collector.CollectMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, first.CPUPercent)
+	assert.Equal(t, int64(1000*1024), first.MemoryTotal)
+	assert.Equal(t, int64(750*1024), first.MemoryUsed)
+	assert.InDelta(t, 75.0, first.MemoryPercent, 0.001)
+	assert.Equal(t, 1.5, first.Load1)
+
+	// 100 more ticks of which 25 idle: 75% busy. sda (not its partition or loop0)
+	// read 100 sectors and was busy for all of the interval.
+	writeHostFiles(t, root, map[string]string{
+		"proc/stat":      "cpu  150 0 125 720 105 0 0 0 0 0\n",
+		"proc/diskstats": "   8       0 sda 20 0 200 5 20 0 200 5 0 100000 10 0 0 0 0\n   8       1 sda1 20 0 9999 5 20 0 200 5 0 100 10 0 0 0 0\n",
+	})
+	second, err := collector.CollectMetrics(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, 75.0, second.CPUPercent, 0.001)
+	assert.Greater(t, second.IOReadBytesPerSec, 0.0)
+	assert.Equal(t, 0.0, second.IOWriteBytesPerSec)
+	assert.Equal(t, 100.0, second.IOUtilPercent)
+
+	// PSI files present are exposed; missing ones leave their metrics unavailable
+	require.NotNil(t, second.CPUPressure)
+	assert.Equal(t, 12.5, second.CPUPressure.Some)
+	require.NotNil(t, second.MemoryPressure)
+	assert.Equal(t, 1.0, second.MemoryPressure.Full)
+	assert.Nil(t, second.IOPressure)
+
+	values := second.Values()
+	assert.Equal(t, 12.5, values[monitoring.MetricPSICPU])
+	_, ok := values[monitoring.MetricPSIIO]
+	assert.False(t, ok)
+
+	result, err := monitoring.EvaluateResourceThreshold(second, "cpu>70% && psi_cpu>10")
+	require.NoError(t, err)
+	assert.True(t, result)
+	_, err = monitoring.EvaluateResourceThreshold(second, "psi_io>10")
+	assert.Error(t, err)
+
+	latest, ok := collector.LatestMetrics()
+	require.True(t, ok)
+	assert.Equal(t, second.CPUPercent, latest.CPUPercent)
+}
+
+func TestMetricsCollector_ContainerCgroupMetrics(t *testing.T) {
+	root := t.TempDir()
+	containerID := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	cgroup := filepath.Join("sys/fs/cgroup/system.slice", "docker-"+containerID+".scope")
+	writeHostFiles(t, root, map[string]string{
+		"proc/meminfo":                          "MemTotal:       4096 kB\nMemAvailable:   2048 kB\n",
+		"sys/fs/cgroup/cgroup.controllers":      "cpu io memory pids\n",
+		filepath.Join(cgroup, "cpu.stat"):       "usage_usec 1000000\nuser_usec 800000\nsystem_usec 200000\n",
+		filepath.Join(cgroup, "io.stat"):        "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n",
+		filepath.Join(cgroup, "memory.current"): "3145728\n",
+		filepath.Join(cgroup, "memory.stat"):    "anon 1048576\ninactive_file 1048576\n",
+		filepath.Join(cgroup, "memory.max"):     "max\n",
+		filepath.Join(cgroup, "io.pressure"):    "some avg10=40.00 avg60=10.00 avg300=2.00 total=100\nfull avg10=20.00 avg60=5.00 avg300=1.00 total=50\n",
+	})
+
+	collector := monitoring.NewMetricsCollector()
+	collector.SetHostRoot(root)
+
+	_, err := collector.CollectContainerMetrics(context.Background(), "missing")
+	assert.Error(t, err)
+
+	first, err := collector.CollectContainerMetrics(context.Background(), containerID)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, first.CPUPercent)
+	// 3MiB charged minus 1MiB inactive page cache, against node memory without a limit
+	assert.Equal(t, int64(2*1024*1024), first.MemoryUsed)
+	assert.Equal(t, int64(4096*1024), first.MemoryLimit)
+	assert.InDelta(t, 50.0, first.MemoryPercent, 0.001)
+
+	writeHostFiles(t, root, map[string]string{
+		filepath.Join(cgroup, "cpu.stat"):   "usage_usec 1500000\n",
+		filepath.Join(cgroup, "io.stat"):    "8:0 rbytes=4096 wbytes=1056768 rios=1 wios=9 dbytes=0 dios=0\n",
+		filepath.Join(cgroup, "memory.max"): "8388608\n",
+	})
+	second, err := collector.CollectContainerMetrics(context.Background(), containerID)
+	require.NoError(t, err)
+	assert.Greater(t, second.CPUPercent, 0.0)
+	assert.Equal(t, 0.0, second.IOReadBytesPerSec)
+	assert.Greater(t, second.IOWriteBytesPerSec, 0.0)
+	assert.InDelta(t, 25.0, second.MemoryPercent, 0.001)
+
+	values := second.Values()
+	assert.Equal(t, 40.0, values[monitoring.MetricContainerPSIIO])
+	_, ok := values[monitoring.MetricContainerPSICPU]
+	assert.False(t, ok)
+}
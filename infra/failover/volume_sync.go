@@ -0,0 +1,786 @@
+package failover
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// VolumeSyncBlockSize is the default block size used to compare file contents between nodes
+const VolumeSyncBlockSize = 128 * 1024
+
+const (
+	minVolumeSyncBlockSize = 4 * 1024
+	maxVolumeSyncBlockSize = 16 * 1024 * 1024
+	// volumeSyncSessionTTL is how long an idle sync session keeps its cached checksums
+	volumeSyncSessionTTL = time.Hour
+	// deltaTrailerIndex marks the trailer frame carrying the size and checksum of the sent file
+	deltaTrailerIndex = ^uint64(0)
+)
+
+// Volume entry types
+const (
+	VolumeEntryDir     = "dir"
+	VolumeEntryFile    = "file"
+	VolumeEntrySymlink = "symlink"
+)
+
+var (
+	// ErrSyncNotFound is returned for delta or finalize requests without a planned sync session
+	ErrSyncNotFound = errors.New("volume sync session not found")
+	// ErrVolumeChecksumMismatch is returned when synced files do not match the source checksums
+	ErrVolumeChecksumMismatch = errors.New("volume checksum verification failed")
+)
+
+// VolumeEntry describes a directory, file or symlink of a volume
+type VolumeEntry struct {
+	Path    string      `json:"path"` // Slash-separated, relative to the volume root ("." is the root)
+	Type    string      `json:"type"`
+	Mode    os.FileMode `json:"mode"`
+	Size    int64       `json:"size,omitempty"`
+	ModTime time.Time   `json:"mod_time"`
+	SHA256  string      `json:"sha256,omitempty"`
+	Link    string      `json:"link,omitempty"`
+	UID     int         `json:"uid"`
+	GID     int         `json:"gid"`
+}
+
+// VolumeSyncRequest plans a sync of a volume's entries to the target
+type VolumeSyncRequest struct {
+	Type      mount.Type    `json:"type"`   // bind or volume
+	Source    string        `json:"source"` // Host path for bind mounts, volume name for named volumes
+	BlockSize int           `json:"block_size"`
+	Entries   []VolumeEntry `json:"entries"`
+}
+
+// VolumeSyncPlan lists the files whose contents differ on the target
+type VolumeSyncPlan struct {
+	Files []FileSignature `json:"files"`
+}
+
+// FileSignature holds the block checksums of the target's current copy of a file.
+// Blocks is empty when the target has no copy, so the whole file is sent.
+type FileSignature struct {
+	Path   string   `json:"path"`
+	Blocks []string `json:"blocks,omitempty"`
+}
+
+// VolumeSyncResult reports the outcome of finalizing a volume sync
+type VolumeSyncResult struct {
+	Verified   int      `json:"verified"`
+	Removed    int      `json:"removed"`
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// volumeSyncSession is the target-side state of a volume sync.
+// Checksums are cached by size and modification time so repeated passes
+// (pre-copy, then final sync) only re-read files that changed.
+type volumeSyncSession struct {
+	mu        sync.Mutex
+	dest      string
+	blockSize int
+	entries   map[string]VolumeEntry
+	digests   map[string]*fileDigest
+	updatedAt time.Time
+}
+
+// fileDigest is the checksum of a file and of each of its blocks
+type fileDigest struct {
+	size    int64
+	modTime time.Time
+	sha256  string
+	blocks  []string
+}
+
+// hashFile computes the checksum of a file and of each of its blocks
+func hashFile(filePath string, blockSize int) (*fileDigest, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	sum, blocks, size, err := hashBlocks(file, blockSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return &fileDigest{size: size, modTime: info.ModTime(), sha256: sum, blocks: blocks}, nil
+}
+
+// hashBlocks reads r to the end, returning the checksum of all data and of each block
+func hashBlocks(r io.Reader, blockSize int) (string, []string, int64, error) {
+	whole := sha256.New()
+	buf := make([]byte, blockSize)
+	var blocks []string
+	var size int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			whole.Write(buf[:n])
+			blockSum := sha256.Sum256(buf[:n])
+			blocks = append(blocks, hex.EncodeToString(blockSum[:]))
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return hex.EncodeToString(whole.Sum(nil)), blocks, size, nil
+		}
+		if err != nil {
+			return "", nil, size, err
+		}
+	}
+}
+
+// fileSHA256 returns the checksum of a file
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// scanVolume walks a volume on this host and checksums its files. Checksums from
+// previous are reused for files whose size and modification time are unchanged.
+func scanVolume(root string, previous map[string]VolumeEntry) ([]VolumeEntry, error) {
+	var entries []VolumeEntry
+	err := filepath.WalkDir(root, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if walkPath != root && errors.Is(err, fs.ErrNotExist) {
+				return nil // Removed while scanning a running container
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(root, walkPath)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := VolumeEntry{
+			Path:    filepath.ToSlash(rel),
+			Mode:    info.Mode().Perm() | info.Mode()&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky),
+			ModTime: info.ModTime(),
+		}
+		entry.UID, entry.GID = fileOwner(info)
+
+		switch {
+		case info.IsDir():
+			entry.Type = VolumeEntryDir
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(walkPath)
+			if err != nil {
+				return fmt.Errorf("failed to read symlink %s: %w", walkPath, err)
+			}
+			entry.Type = VolumeEntrySymlink
+			entry.Link = link
+		case info.Mode().IsRegular():
+			entry.Type = VolumeEntryFile
+			entry.Size = info.Size()
+			if prev, ok := previous[entry.Path]; ok && prev.Type == VolumeEntryFile && prev.Size == entry.Size && prev.ModTime.Equal(entry.ModTime) {
+				entry.SHA256 = prev.SHA256
+			} else {
+				sum, err := fileSHA256(walkPath)
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				entry.SHA256 = sum
+			}
+		default:
+			log.Printf("Skipping %s during volume sync (unsupported file type %s)", walkPath, info.Mode().Type())
+			return nil
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return entries, nil
+}
+
+// writeDelta streams the blocks of a file that differ from the target's block checksums,
+// followed by a trailer with the size and checksum of the data read. Each frame is an
+// 8-byte block index and a 4-byte length followed by the block data.
+func writeDelta(w io.Writer, filePath string, blockSize int, remote []string) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	whole := sha256.New()
+	buf := make([]byte, blockSize)
+	var size, sent int64
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			block := buf[:n]
+			whole.Write(block)
+			size += int64(n)
+
+			blockSum := sha256.Sum256(block)
+			if index >= uint64(len(remote)) || remote[index] != hex.EncodeToString(blockSum[:]) {
+				if err := writeDeltaFrame(w, index, block); err != nil {
+					return sent, err
+				}
+				sent += int64(n)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return sent, fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+	}
+
+	trailer := make([]byte, 8, 8+sha256.Size)
+	binary.BigEndian.PutUint64(trailer, uint64(size))
+	trailer = whole.Sum(trailer)
+	return sent, writeDeltaFrame(w, deltaTrailerIndex, trailer)
+}
+
+// writeDeltaFrame writes one frame of a delta stream
+func writeDeltaFrame(w io.Writer, index uint64, data []byte) error {
+	var header [12]byte
+	binary.BigEndian.PutUint64(header[:8], index)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(data)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// applyDelta rebuilds a file from its current contents and a delta stream, verifies the
+// result against the trailer checksum and atomically replaces the file
+func applyDelta(target string, blockSize int, mode os.FileMode, r io.Reader) (*fileDigest, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", target, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".sync-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Start from the current copy so unchanged blocks are kept
+	if info, err := os.Lstat(target); err == nil && info.Mode().IsRegular() {
+		current, err := os.Open(target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", target, err)
+		}
+		_, err = io.Copy(tmp, current)
+		current.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", target, err)
+		}
+	}
+
+	var expectedSize int64
+	var expectedSum string
+	var header [12]byte
+	buf := make([]byte, blockSize)
+	for expectedSum == "" {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("delta stream ended early: %w", err)
+		}
+		index := binary.BigEndian.Uint64(header[:8])
+		length := int(binary.BigEndian.Uint32(header[8:]))
+
+		if index == deltaTrailerIndex {
+			if length != 8+sha256.Size {
+				return nil, fmt.Errorf("invalid delta trailer")
+			}
+			trailer := make([]byte, length)
+			if _, err := io.ReadFull(r, trailer); err != nil {
+				return nil, fmt.Errorf("delta stream ended early: %w", err)
+			}
+			expectedSize = int64(binary.BigEndian.Uint64(trailer[:8]))
+			expectedSum = hex.EncodeToString(trailer[8:])
+			continue
+		}
+
+		if length > blockSize {
+			return nil, fmt.Errorf("delta block %d is larger than the block size", index)
+		}
+		if _, err := io.ReadFull(r, buf[:length]); err != nil {
+			return nil, fmt.Errorf("delta stream ended early: %w", err)
+		}
+		if _, err := tmp.WriteAt(buf[:length], int64(index)*int64(blockSize)); err != nil {
+			return nil, fmt.Errorf("failed to write block %d: %w", index, err)
+		}
+	}
+
+	if err := tmp.Truncate(expectedSize); err != nil {
+		return nil, fmt.Errorf("failed to truncate %s: %w", tmp.Name(), err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek %s: %w", tmp.Name(), err)
+	}
+	sum, blocks, size, err := hashBlocks(tmp, blockSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify %s: %w", target, err)
+	}
+	if size != expectedSize || sum != expectedSum {
+		return nil, fmt.Errorf("%w: %s has checksum %s, expected %s", ErrVolumeChecksumMismatch, target, sum, expectedSum)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return nil, fmt.Errorf("failed to set mode of %s: %w", target, err)
+	}
+	tmp.Close()
+
+	if info, err := os.Lstat(target); err == nil && info.IsDir() {
+		os.RemoveAll(target)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return nil, fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+
+	return &fileDigest{size: size, sha256: sum, blocks: blocks}, nil
+}
+
+// volumePath maps a slash-separated path relative to a volume root to a host path,
+// rejecting paths that escape the root or resolve through symlinked directories
+func volumePath(root, rel string) (string, error) {
+	rel = path.Clean(filepath.ToSlash(rel))
+	if rel == "." {
+		return root, nil
+	}
+	if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("path %q escapes destination", rel)
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(rel))
+	if !strings.HasPrefix(target, filepath.Clean(root)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path %q escapes destination", rel)
+	}
+
+	// Refuse to write through symlinked parent directories
+	parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err == nil {
+		resolvedRoot, rootErr := filepath.EvalSymlinks(root)
+		if rootErr == nil && parent != resolvedRoot && !strings.HasPrefix(parent, resolvedRoot+string(os.PathSeparator)) {
+			return "", fmt.Errorf("path %q resolves outside destination", rel)
+		}
+	}
+
+	return target, nil
+}
+
+// digest returns the checksums of a file on the target, reusing the cached value while
+// the file's size and modification time are unchanged (caller must hold session.mu)
+func (s *volumeSyncSession) digest(rel, target string, info os.FileInfo) (*fileDigest, error) {
+	if cached, ok := s.digests[rel]; ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached, nil
+	}
+
+	digest, err := hashFile(target, s.blockSize)
+	if err != nil {
+		return nil, err
+	}
+	s.digests[rel] = digest
+	return digest, nil
+}
+
+// syncSession returns the session of a sync ID, locked for the caller
+func (r *MigrationReceiver) syncSession(syncID string) (*volumeSyncSession, error) {
+	r.mu.Lock()
+	session, exists := r.syncs[syncID]
+	r.mu.Unlock()
+	if !exists {
+		return nil, ErrSyncNotFound
+	}
+	if !session.mu.TryLock() {
+		return nil, ErrUploadBusy
+	}
+	session.updatedAt = time.Now()
+	return session, nil
+}
+
+// PlanVolumeSync records the source entries of a volume and returns the files whose
+// contents differ on this node, with the block checksums of the local copies
+func (r *MigrationReceiver) PlanVolumeSync(ctx context.Context, syncID string, req VolumeSyncRequest) (*VolumeSyncPlan, error) {
+	if !uploadIDPattern.MatchString(syncID) {
+		return nil, ErrInvalidUploadID
+	}
+	blockSize := req.BlockSize
+	if blockSize == 0 {
+		blockSize = VolumeSyncBlockSize
+	}
+	if blockSize < minVolumeSyncBlockSize || blockSize > maxVolumeSyncBlockSize {
+		return nil, fmt.Errorf("block size %d out of range", blockSize)
+	}
+
+	dest, err := r.volumeDestination(ctx, VolumeCommit{Type: req.Type, Source: req.Source})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+
+	entries := make(map[string]VolumeEntry, len(req.Entries))
+	for _, entry := range req.Entries {
+		if _, err := volumePath(dest, entry.Path); err != nil {
+			return nil, err
+		}
+		entries[path.Clean(entry.Path)] = entry
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	for id, session := range r.syncs {
+		if id != syncID && now.Sub(session.updatedAt) > volumeSyncSessionTTL && session.mu.TryLock() {
+			delete(r.syncs, id)
+			session.mu.Unlock()
+		}
+	}
+	session, exists := r.syncs[syncID]
+	if !exists || session.dest != dest || session.blockSize != blockSize {
+		// A new session drops checksums cached for another destination or block size
+		session = &volumeSyncSession{dest: dest, blockSize: blockSize, digests: make(map[string]*fileDigest)}
+		r.syncs[syncID] = session
+	}
+	r.mu.Unlock()
+
+	if !session.mu.TryLock() {
+		return nil, ErrUploadBusy
+	}
+	defer session.mu.Unlock()
+	session.entries = entries
+	session.updatedAt = now
+
+	plan := &VolumeSyncPlan{}
+	for _, entry := range req.Entries {
+		if entry.Type != VolumeEntryFile {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		target, _ := volumePath(dest, entry.Path)
+		info, err := os.Lstat(target)
+		if err != nil || !info.Mode().IsRegular() {
+			plan.Files = append(plan.Files, FileSignature{Path: entry.Path})
+			continue
+		}
+
+		digest, err := session.digest(path.Clean(entry.Path), target, info)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum %s: %w", target, err)
+		}
+		if digest.size != entry.Size || digest.sha256 != entry.SHA256 {
+			plan.Files = append(plan.Files, FileSignature{Path: entry.Path, Blocks: digest.blocks})
+		}
+	}
+
+	return plan, nil
+}
+
+// ApplyVolumeDelta applies a delta stream to a planned file and verifies its checksum
+func (r *MigrationReceiver) ApplyVolumeDelta(syncID, filePath string, body io.Reader) error {
+	session, err := r.syncSession(syncID)
+	if err != nil {
+		return err
+	}
+	defer session.mu.Unlock()
+
+	rel := path.Clean(filePath)
+	entry, exists := session.entries[rel]
+	if !exists || entry.Type != VolumeEntryFile {
+		return fmt.Errorf("%s is not a planned file", filePath)
+	}
+
+	target, err := volumePath(session.dest, rel)
+	if err != nil {
+		return err
+	}
+
+	digest, err := applyDelta(target, session.blockSize, entry.Mode.Perm(), body)
+	if err != nil {
+		delete(session.digests, rel)
+		return err
+	}
+
+	os.Lchown(target, entry.UID, entry.GID)
+	os.Chtimes(target, entry.ModTime, entry.ModTime)
+	if info, err := os.Lstat(target); err == nil {
+		digest.modTime = info.ModTime()
+	}
+	session.digests[rel] = digest
+	return nil
+}
+
+// FinalizeVolumeSync makes the volume match the planned entries exactly: extra files are
+// removed, directories and symlinks are created, metadata is applied and every file's
+// checksum is verified against the source
+func (r *MigrationReceiver) FinalizeVolumeSync(ctx context.Context, syncID string) (*VolumeSyncResult, error) {
+	session, err := r.syncSession(syncID)
+	if err != nil {
+		return nil, err
+	}
+	defer session.mu.Unlock()
+
+	result := &VolumeSyncResult{}
+	dest := session.dest
+
+	// Remove entries that no longer exist on the source or changed type
+	err = filepath.WalkDir(dest, func(walkPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if walkPath == dest {
+			return nil
+		}
+		rel, err := filepath.Rel(dest, walkPath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		entry, exists := session.entries[rel]
+		keep := exists && entryMatchesType(entry, d.Type())
+		if keep {
+			return nil
+		}
+		if err := os.RemoveAll(walkPath); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", walkPath, err)
+		}
+		delete(session.digests, rel)
+		result.Removed++
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune %s: %w", dest, err)
+	}
+
+	// Parents sort before their children
+	paths := make([]string, 0, len(session.entries))
+	for rel := range session.entries {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	for _, rel := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entry := session.entries[rel]
+		target, err := volumePath(dest, rel)
+		if err != nil {
+			return nil, err
+		}
+
+		switch entry.Type {
+		case VolumeEntryDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory %s: %w", target, err)
+			}
+			os.Chmod(target, entry.Mode)
+		case VolumeEntrySymlink:
+			if link, err := os.Readlink(target); err != nil || link != entry.Link {
+				os.Remove(target)
+				if err := os.Symlink(entry.Link, target); err != nil {
+					return nil, fmt.Errorf("failed to create symlink %s: %w", target, err)
+				}
+			}
+		case VolumeEntryFile:
+			info, err := os.Lstat(target)
+			if err != nil || !info.Mode().IsRegular() {
+				result.Mismatches = append(result.Mismatches, fmt.Sprintf("%s: missing", rel))
+				continue
+			}
+			digest, err := session.digest(rel, target, info)
+			if err != nil {
+				return nil, fmt.Errorf("failed to checksum %s: %w", target, err)
+			}
+			if digest.size != entry.Size || digest.sha256 != entry.SHA256 {
+				result.Mismatches = append(result.Mismatches, fmt.Sprintf("%s: checksum %s, expected %s", rel, digest.sha256, entry.SHA256))
+				continue
+			}
+			os.Chmod(target, entry.Mode)
+			result.Verified++
+		}
+
+		// Ownership is best effort: it fails when the agent does not run as root
+		os.Lchown(target, entry.UID, entry.GID)
+	}
+
+	// File timestamps, then directories deepest first since writing children updates them
+	for i := len(paths) - 1; i >= 0; i-- {
+		entry := session.entries[paths[i]]
+		if entry.Type == VolumeEntrySymlink {
+			continue
+		}
+		target, _ := volumePath(dest, paths[i])
+		os.Chtimes(target, entry.ModTime, entry.ModTime)
+		if entry.Type == VolumeEntryFile {
+			if info, err := os.Lstat(target); err == nil {
+				if digest, ok := session.digests[paths[i]]; ok {
+					digest.modTime = info.ModTime()
+				}
+			}
+		}
+	}
+
+	if len(result.Mismatches) > 0 {
+		return result, fmt.Errorf("%w: %d file(s) differ from the source", ErrVolumeChecksumMismatch, len(result.Mismatches))
+	}
+
+	r.mu.Lock()
+	delete(r.syncs, syncID)
+	r.mu.Unlock()
+
+	log.Printf("Verified volume sync %s: %d file(s) match the source, %d stale entries removed", syncID, result.Verified, result.Removed)
+	return result, nil
+}
+
+// entryMatchesType reports whether an existing file has the type of a source entry
+func entryMatchesType(entry VolumeEntry, fileType fs.FileMode) bool {
+	switch entry.Type {
+	case VolumeEntryDir:
+		return fileType.IsDir()
+	case VolumeEntrySymlink:
+		return fileType&fs.ModeSymlink != 0
+	case VolumeEntryFile:
+		return fileType.IsRegular()
+	}
+	return false
+}
+
+// localVolumePath returns where a mount's data lives on this host, as seen by the agent.
+// Only directories can be synced block by block; single-file mounts are copied in full.
+func localVolumePath(ctx context.Context, cli *client.Client, hostRoot string, vol mount.Mount) (string, error) {
+	var hostPath string
+	switch vol.Type {
+	case mount.TypeBind:
+		hostPath = vol.Source
+	case mount.TypeVolume:
+		v, err := cli.VolumeInspect(ctx, vol.Source)
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect volume %s: %w", vol.Source, err)
+		}
+		hostPath = v.Mountpoint
+	default:
+		return "", fmt.Errorf("unsupported mount type %q", vol.Type)
+	}
+
+	localPath := filepath.Join(hostRoot, hostPath)
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", fmt.Errorf("volume data not accessible at %s: %w", localPath, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", localPath)
+	}
+	return localPath, nil
+}
+
+// syncVolume synchronizes one directory to the target. In the pre-copy pass (final is
+// false) files that vanish or change while being sent are skipped and the target is not
+// finalized. The final pass runs with the source stopped and fails unless the target
+// verifies every file's checksum.
+func syncVolume(ctx context.Context, target *TargetClient, root, syncID string, vol mount.Mount, scans map[string]map[string]VolumeEntry, final bool) error {
+	entries, err := scanVolume(root, scans[syncID])
+	if err != nil {
+		return err
+	}
+	scanned := make(map[string]VolumeEntry, len(entries))
+	for _, entry := range entries {
+		scanned[entry.Path] = entry
+	}
+	scans[syncID] = scanned
+
+	plan, err := target.PlanVolumeSync(ctx, syncID, VolumeSyncRequest{
+		Type:      vol.Type,
+		Source:    vol.Source,
+		BlockSize: VolumeSyncBlockSize,
+		Entries:   entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	var sent int64
+	for _, file := range plan.Files {
+		localPath, err := volumePath(root, file.Path)
+		if err != nil {
+			return err
+		}
+
+		n, err := target.SendVolumeDelta(ctx, syncID, file.Path, func(w io.Writer) (int64, error) {
+			return writeDelta(w, localPath, VolumeSyncBlockSize, file.Blocks)
+		})
+		sent += n
+		if err != nil {
+			if final || ctx.Err() != nil {
+				return fmt.Errorf("failed to sync %s: %w", file.Path, err)
+			}
+			// The final pass picks up files that changed during the pre-copy
+			log.Printf("Warning: Pre-copy of %s skipped: %v", localPath, err)
+			delete(scanned, file.Path)
+		}
+	}
+
+	pass := "Pre-copied"
+	if final {
+		result, err := target.FinalizeVolumeSync(ctx, syncID)
+		if err != nil {
+			return err
+		}
+		pass = fmt.Sprintf("Synced and verified %d file(s) of", result.Verified)
+	}
+
+	log.Printf("%s %s volume %s: %d of %d entries changed, %d bytes sent", pass, vol.Type, vol.Source, len(plan.Files), len(entries), sent)
+	return nil
+}
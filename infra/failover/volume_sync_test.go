@@ -0,0 +1,127 @@
+package failover
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncPass runs one scan, plan and delta pass from source to the receiver and returns the bytes sent
+func syncPass(t *testing.T, receiver *MigrationReceiver, source, dest string, scans map[string]VolumeEntry) (map[string]VolumeEntry, int64) {
+	t.Helper()
+
+	entries, err := scanVolume(source, scans)
+	require.NoError(t, err)
+
+	plan, err := receiver.PlanVolumeSync(context.Background(), "m1-0", VolumeSyncRequest{
+		Type:      mount.TypeBind,
+		Source:    dest,
+		BlockSize: minVolumeSyncBlockSize,
+		Entries:   entries,
+	})
+	require.NoError(t, err)
+
+	var sent int64
+	for _, file := range plan.Files {
+		var delta bytes.Buffer
+		n, err := writeDelta(&delta, filepath.Join(source, filepath.FromSlash(file.Path)), minVolumeSyncBlockSize, file.Blocks)
+		require.NoError(t, err)
+		sent += n
+		require.NoError(t, receiver.ApplyVolumeDelta("m1-0", file.Path, &delta))
+	}
+
+	scanned := make(map[string]VolumeEntry, len(entries))
+	for _, entry := range entries {
+		scanned[entry.Path] = entry
+	}
+	return scanned, sent
+}
+
+func TestVolumeSync_IncrementalAndVerified(t *testing.T) {
+	receiver := newTestReceiver(t)
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "data")
+
+	large := bytes.Repeat([]byte("0123456789abcdef"), 4*minVolumeSyncBlockSize/16)
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "db"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "db", "large.bin"), large, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "config.yml"), []byte("a: 1\n"), 0600))
+	require.NoError(t, os.Symlink("db/large.bin", filepath.Join(source, "current")))
+
+	// Pre-copy sends everything
+	scans, sent := syncPass(t, receiver, source, dest, nil)
+	assert.Equal(t, int64(len(large)+5), sent)
+
+	// Change one block of the large file and remove a file
+	large[minVolumeSyncBlockSize+10] = 'X'
+	require.NoError(t, os.WriteFile(filepath.Join(source, "db", "large.bin"), large, 0644))
+	require.NoError(t, os.Remove(filepath.Join(source, "config.yml")))
+
+	_, sent = syncPass(t, receiver, source, dest, scans)
+	assert.Equal(t, int64(minVolumeSyncBlockSize), sent, "only the changed block is sent")
+
+	result, err := receiver.FinalizeVolumeSync(context.Background(), "m1-0")
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Verified)
+	assert.Equal(t, 1, result.Removed)
+
+	content, err := os.ReadFile(filepath.Join(dest, "db", "large.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, large, content)
+	_, err = os.Stat(filepath.Join(dest, "config.yml"))
+	assert.True(t, os.IsNotExist(err))
+	link, err := os.Readlink(filepath.Join(dest, "current"))
+	require.NoError(t, err)
+	assert.Equal(t, "db/large.bin", link)
+
+	// The session is closed after a successful finalize
+	_, err = receiver.FinalizeVolumeSync(context.Background(), "m1-0")
+	assert.ErrorIs(t, err, ErrSyncNotFound)
+}
+
+func TestVolumeSync_RejectsCorruptDelta(t *testing.T) {
+	receiver := newTestReceiver(t)
+	source := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(filepath.Join(source, "file.txt"), []byte("important data"), 0644))
+
+	entries, err := scanVolume(source, nil)
+	require.NoError(t, err)
+	_, err = receiver.PlanVolumeSync(context.Background(), "m1-0", VolumeSyncRequest{Type: mount.TypeBind, Source: dest, Entries: entries})
+	require.NoError(t, err)
+
+	var delta bytes.Buffer
+	_, err = writeDelta(&delta, filepath.Join(source, "file.txt"), VolumeSyncBlockSize, nil)
+	require.NoError(t, err)
+	corrupt := delta.Bytes()
+	corrupt[12] ^= 0xff // First byte of block data
+
+	err = receiver.ApplyVolumeDelta("m1-0", "file.txt", bytes.NewReader(corrupt))
+	assert.ErrorIs(t, err, ErrVolumeChecksumMismatch)
+	_, err = os.Stat(filepath.Join(dest, "file.txt"))
+	assert.True(t, os.IsNotExist(err), "a file failing verification is not written")
+
+	// Finalizing reports the missing file instead of accepting a partial volume
+	result, err := receiver.FinalizeVolumeSync(context.Background(), "m1-0")
+	assert.ErrorIs(t, err, ErrVolumeChecksumMismatch)
+	require.NotNil(t, result)
+	assert.Len(t, result.Mismatches, 1)
+}
+
+func TestVolumeSync_RejectsEscapingPaths(t *testing.T) {
+	receiver := newTestReceiver(t)
+	dest := filepath.Join(t.TempDir(), "data")
+
+	_, err := receiver.PlanVolumeSync(context.Background(), "m1-0", VolumeSyncRequest{
+		Type:    mount.TypeBind,
+		Source:  dest,
+		Entries: []VolumeEntry{{Path: "../outside", Type: VolumeEntryFile}},
+	})
+	assert.Error(t, err)
+}
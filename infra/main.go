@@ -23,6 +23,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	infraconfig "cluster/infra/config"
+	"cluster/infra/monitoring"
 	"cluster/infra/tailscale"
 )
 
@@ -240,12 +241,39 @@ func (infra *Infrastructure) EnsureNetworks() error {
 	return nil
 }
 
+// serviceHealthLabels returns the service's labels with those the agent's health
+// monitor reads: the service name and its dependencies with their conditions.
+// Labels set explicitly on the service are kept.
+func serviceHealthLabels(svc Service) map[string]string {
+	labels := make(map[string]string, len(svc.Labels)+2)
+	for k, v := range svc.Labels {
+		labels[k] = v
+	}
+
+	if _, ok := labels[monitoring.ServiceLabel]; !ok && svc.Name != "" {
+		labels[monitoring.ServiceLabel] = svc.Name
+	}
+	if _, ok := labels[monitoring.DependsOnLabel]; !ok && len(svc.DependsOn) > 0 {
+		entries := make([]string, 0, len(svc.DependsOn))
+		for _, dependency := range svc.DependsOn {
+			condition := svc.DependsOnConditions[dependency]
+			if condition == "" {
+				condition = monitoring.ConditionServiceStarted
+			}
+			entries = append(entries, dependency+":"+condition)
+		}
+		labels[monitoring.DependsOnLabel] = strings.Join(entries, ",")
+	}
+	return labels
+}
+
 // DeployService deploys a single service
 func (infra *Infrastructure) DeployService(svc Service) error {
 	log.Printf("Deploying service: %s", svc.Name)
 
 	// Ensure networks based on labels if not explicitly set
 	svc.Networks = assignNetworks(svc)
+	svc.Labels = serviceHealthLabels(svc)
 
 	// Check if container exists
 	containers, err := infra.client.ContainerList(infra.ctx, types.ContainerListOptions{
@@ -89,3 +89,34 @@ func TestEnvMapToSlice(t *testing.T) {
 		t.Error("envMapToSlice missing expected items")
 	}
 }
+
+func TestServiceHealthLabels(t *testing.T) {
+	svc := Service{
+		Name:      "firecrawl",
+		Labels:    map[string]string{"traefik.enable": "true"},
+		DependsOn: []string{"redis", "playwright-service"},
+		DependsOnConditions: map[string]string{
+			"redis": "service_healthy",
+		},
+	}
+
+	labels := serviceHealthLabels(svc)
+	if labels["constellation.service"] != "firecrawl" {
+		t.Errorf("constellation.service = %q, want firecrawl", labels["constellation.service"])
+	}
+	want := "redis:service_healthy,playwright-service:service_started"
+	if labels["constellation.depends_on"] != want {
+		t.Errorf("constellation.depends_on = %q, want %q", labels["constellation.depends_on"], want)
+	}
+	if labels["traefik.enable"] != "true" {
+		t.Error("serviceHealthLabels dropped an existing label")
+	}
+	if _, ok := svc.Labels["constellation.depends_on"]; ok {
+		t.Error("serviceHealthLabels modified the service's labels")
+	}
+
+	svc.Labels["constellation.depends_on"] = "redis"
+	if got := serviceHealthLabels(svc)["constellation.depends_on"]; got != "redis" {
+		t.Errorf("explicit constellation.depends_on overridden with %q", got)
+	}
+}
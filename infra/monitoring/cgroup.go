@@ -0,0 +1,252 @@
+package monitoring
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// containerCountersTTL is how long counters of a container that is no longer sampled are kept
+const containerCountersTTL = 10 * time.Minute
+
+// ContainerMetrics represents current resource usage of one container, read from its cgroup
+type ContainerMetrics struct {
+	ContainerID        string         `json:"container_id"`
+	CPUPercent         float64        `json:"cpu_percent"`    // Percent of one core
+	MemoryPercent      float64        `json:"memory_percent"` // Percent of its limit, or of node memory without one
+	MemoryUsed         int64          `json:"memory_used"`    // bytes, excluding inactive page cache
+	MemoryLimit        int64          `json:"memory_limit"`   // bytes
+	IOReadBytesPerSec  float64        `json:"io_read_bytes_per_sec"`
+	IOWriteBytesPerSec float64        `json:"io_write_bytes_per_sec"`
+	CPUPressure        *PressureStats `json:"cpu_pressure,omitempty"` // nil when the kernel has no PSI
+	MemoryPressure     *PressureStats `json:"memory_pressure,omitempty"`
+	IOPressure         *PressureStats `json:"io_pressure,omitempty"`
+	Timestamp          time.Time      `json:"timestamp"`
+}
+
+// Values returns the metrics by the names used in trigger expressions
+func (m *ContainerMetrics) Values() map[string]float64 {
+	values := map[string]float64{
+		MetricContainerCPU:     m.CPUPercent,
+		MetricContainerMemory:  m.MemoryPercent,
+		MetricContainerIORead:  m.IOReadBytesPerSec,
+		MetricContainerIOWrite: m.IOWriteBytesPerSec,
+	}
+	if m.CPUPressure != nil {
+		values[MetricContainerPSICPU] = m.CPUPressure.Some
+	}
+	if m.MemoryPressure != nil {
+		values[MetricContainerPSIMemory] = m.MemoryPressure.Some
+	}
+	if m.IOPressure != nil {
+		values[MetricContainerPSIIO] = m.IOPressure.Some
+	}
+	return values
+}
+
+// containerCounters are the cumulative cgroup counters of one collection
+type containerCounters struct {
+	at         time.Time
+	cpuUsec    uint64
+	readBytes  uint64
+	writeBytes uint64
+}
+
+// CollectContainerMetrics collects a container's resource usage from its cgroup v2
+// directory. CPU and IO usage are computed over the interval since the previous
+// collection for the same container.
+func (mc *MetricsCollector) CollectContainerMetrics(ctx context.Context, containerID string) (*ContainerMetrics, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	dir, err := mc.containerCgroupDir(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := readContainerCounters(dir)
+	if err != nil {
+		return nil, err
+	}
+	previous, ok := mc.containers[containerID]
+	if !ok {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(primeInterval):
+		}
+		previous = current
+		if current, err = readContainerCounters(dir); err != nil {
+			return nil, err
+		}
+	}
+	mc.containers[containerID] = current
+	mc.pruneContainerCounters(current.at)
+
+	metrics := &ContainerMetrics{ContainerID: containerID, Timestamp: current.at}
+	if elapsed := current.at.Sub(previous.at).Seconds(); elapsed > 0 {
+		if current.cpuUsec >= previous.cpuUsec {
+			metrics.CPUPercent = float64(current.cpuUsec-previous.cpuUsec) / (elapsed * 1e6) * 100.0
+		}
+		metrics.IOReadBytesPerSec = bytesPerSecond(previous.readBytes, current.readBytes, elapsed)
+		metrics.IOWriteBytesPerSec = bytesPerSecond(previous.writeBytes, current.writeBytes, elapsed)
+	}
+
+	if err := mc.readContainerMemory(dir, metrics); err != nil {
+		return nil, err
+	}
+
+	if pressure, ok := readPressure(filepath.Join(dir, "cpu.pressure")); ok {
+		metrics.CPUPressure = &pressure
+	}
+	if pressure, ok := readPressure(filepath.Join(dir, "memory.pressure")); ok {
+		metrics.MemoryPressure = &pressure
+	}
+	if pressure, ok := readPressure(filepath.Join(dir, "io.pressure")); ok {
+		metrics.IOPressure = &pressure
+	}
+
+	return metrics, nil
+}
+
+// containerCgroupDir finds a container's cgroup v2 directory for the systemd and
+// cgroupfs cgroup drivers
+func (mc *MetricsCollector) containerCgroupDir(containerID string) (string, error) {
+	root := mc.hostPath("/sys/fs/cgroup")
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 not available at %s", root)
+	}
+
+	candidates := []string{
+		filepath.Join(root, "system.slice", "docker-"+containerID+".scope"),
+		filepath.Join(root, "docker", containerID),
+	}
+	for _, dir := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, "cpu.stat")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("cgroup of container %s not found", shortContainerID(containerID))
+}
+
+// readContainerCounters reads the cumulative CPU and IO counters of a cgroup
+func readContainerCounters(dir string) (*containerCounters, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cgroup CPU statistics: %w", err)
+	}
+	stats := parseFlatKeyed(data)
+	cpuUsec, ok := stats["usage_usec"]
+	if !ok {
+		return nil, fmt.Errorf("usage_usec missing from cpu.stat")
+	}
+
+	counters := &containerCounters{at: time.Now(), cpuUsec: cpuUsec}
+	// io.stat is absent when the io controller is not enabled for the cgroup
+	if data, err := os.ReadFile(filepath.Join(dir, "io.stat")); err == nil {
+		counters.readBytes, counters.writeBytes = parseIOStat(data)
+	}
+	return counters, nil
+}
+
+// readContainerMemory fills in memory usage, with inactive page cache counted as free
+func (mc *MetricsCollector) readContainerMemory(dir string, metrics *ContainerMetrics) error {
+	data, err := os.ReadFile(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return fmt.Errorf("failed to read cgroup memory usage: %w", err)
+	}
+	used, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse memory.current: %w", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "memory.stat")); err == nil {
+		if inactive, ok := parseFlatKeyed(data)["inactive_file"]; ok && int64(inactive) < used {
+			used -= int64(inactive)
+		}
+	}
+	metrics.MemoryUsed = used
+
+	// Without a limit ("max") the container can use all node memory
+	if data, err := os.ReadFile(filepath.Join(dir, "memory.max")); err == nil {
+		if limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			metrics.MemoryLimit = limit
+		}
+	}
+	if metrics.MemoryLimit == 0 {
+		if data, err := os.ReadFile(mc.hostPath("/proc/meminfo")); err == nil {
+			metrics.MemoryLimit, _, _ = parseMeminfo(data)
+		}
+	}
+	if metrics.MemoryLimit > 0 {
+		metrics.MemoryPercent = float64(used) / float64(metrics.MemoryLimit) * 100.0
+	}
+	return nil
+}
+
+// pruneContainerCounters forgets containers that have not been sampled for a while
+func (mc *MetricsCollector) pruneContainerCounters(now time.Time) {
+	for id, counters := range mc.containers {
+		if now.Sub(counters.at) > containerCountersTTL {
+			delete(mc.containers, id)
+		}
+	}
+}
+
+// parseFlatKeyed parses cgroup "key value" files such as cpu.stat and memory.stat
+func parseFlatKeyed(data []byte) map[string]uint64 {
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+	return values
+}
+
+// parseIOStat sums read and written bytes over all devices of a cgroup's io.stat
+// ("8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0" per device)
+func parseIOStat(data []byte) (readBytes, writeBytes uint64) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				readBytes += n
+			case "wbytes":
+				writeBytes += n
+			}
+		}
+	}
+	return readBytes, writeBytes
+}
+
+// shortContainerID returns the 12 character form of a container ID
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
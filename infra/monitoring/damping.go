@@ -0,0 +1,165 @@
+package monitoring
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// HealthLabelPrefix prefixes the container labels that tune health damping
+	HealthLabelPrefix = "constellation.health."
+
+	// Health states reported for a service
+	HealthStateHealthy   = "healthy"
+	HealthStateDegraded  = "degraded" // Between thresholds; keeps its previous routing decision
+	HealthStateUnhealthy = "unhealthy"
+	HealthStateFlapping  = "flapping" // Held out of rotation after too many transitions
+
+	defaultRise          = 2
+	defaultFall          = 3
+	defaultFlapThreshold = 5
+	defaultFlapWindow    = 5 * time.Minute
+	defaultFlapHold      = 5 * time.Minute
+)
+
+// HealthDamping holds a service's hysteresis and flap thresholds, set through labels:
+//
+//	constellation.health.rise=2             Consecutive passing probes to return to rotation
+//	constellation.health.fall=3             Consecutive failing probes to leave rotation
+//	constellation.health.flap.threshold=5   Transitions within the window that hold a service out (0 disables)
+//	constellation.health.flap.window=5m
+//	constellation.health.flap.hold=5m
+//
+// Rise and fall count active probe results. Docker's own verdicts are taken as they are,
+// since Docker healthchecks already retry and a stopped container is down for certain.
+type HealthDamping struct {
+	Rise          int
+	Fall          int
+	FlapThreshold int
+	FlapWindow    time.Duration
+	FlapHold      time.Duration
+}
+
+// DefaultHealthDamping returns the damping of services without health labels
+func DefaultHealthDamping() HealthDamping {
+	return HealthDamping{
+		Rise:          defaultRise,
+		Fall:          defaultFall,
+		FlapThreshold: defaultFlapThreshold,
+		FlapWindow:    defaultFlapWindow,
+		FlapHold:      defaultFlapHold,
+	}
+}
+
+// ParseHealthDamping reads a service's damping from its labels, starting from the defaults
+func ParseHealthDamping(labels map[string]string) (HealthDamping, error) {
+	damping := DefaultHealthDamping()
+
+	counts := map[string]*int{
+		"rise":           &damping.Rise,
+		"fall":           &damping.Fall,
+		"flap.threshold": &damping.FlapThreshold,
+	}
+	for name, target := range counts {
+		value, ok := labels[HealthLabelPrefix+name]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || (n == 0 && name != "flap.threshold") {
+			return DefaultHealthDamping(), fmt.Errorf("invalid %s%s %q", HealthLabelPrefix, name, value)
+		}
+		*target = n
+	}
+
+	durations := map[string]*time.Duration{
+		"flap.window": &damping.FlapWindow,
+		"flap.hold":   &damping.FlapHold,
+	}
+	for name, target := range durations {
+		value, ok := labels[HealthLabelPrefix+name]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return DefaultHealthDamping(), fmt.Errorf("invalid %s%s %q", HealthLabelPrefix, name, value)
+		}
+		*target = d
+	}
+	return damping, nil
+}
+
+// healthDamper turns a container's raw health samples into a damped routing decision
+type healthDamper struct {
+	config      HealthDamping
+	initialized bool
+	routable    bool        // Routing decision before any flap hold
+	successes   int         // Consecutive passing samples
+	failures    int         // Consecutive failing samples
+	transitions []time.Time // Routing decision changes within the flap window
+	heldUntil   time.Time
+}
+
+// observe records a sample. Decisive samples change the routing decision at once;
+// others have to repeat rise or fall times in a row.
+func (d *healthDamper) observe(now time.Time, healthy, decisive bool) {
+	if healthy {
+		d.successes++
+		d.failures = 0
+	} else {
+		d.failures++
+		d.successes = 0
+	}
+
+	// The first sample has no history to damp against
+	if !d.initialized {
+		d.initialized = true
+		d.routable = healthy
+		return
+	}
+
+	routable := d.routable
+	if healthy && !routable && (decisive || d.successes >= d.config.Rise) {
+		routable = true
+	}
+	if !healthy && routable && (decisive || d.failures >= d.config.Fall) {
+		routable = false
+	}
+	if routable == d.routable {
+		return
+	}
+	d.routable = routable
+
+	if d.config.FlapThreshold <= 0 {
+		return
+	}
+	d.transitions = append(d.transitions, now)
+	for len(d.transitions) > 0 && now.Sub(d.transitions[0]) > d.config.FlapWindow {
+		d.transitions = d.transitions[1:]
+	}
+	if len(d.transitions) >= d.config.FlapThreshold {
+		d.heldUntil = now.Add(d.config.FlapHold)
+		d.transitions = nil
+	}
+}
+
+// held reports whether the service is held out of rotation for flapping
+func (d *healthDamper) held(now time.Time) bool {
+	return now.Before(d.heldUntil)
+}
+
+// state returns the damped state and whether the service should receive traffic
+func (d *healthDamper) state(now time.Time) (string, bool) {
+	switch {
+	case d.held(now):
+		return HealthStateFlapping, false
+	case d.routable && d.failures == 0:
+		return HealthStateHealthy, true
+	case !d.routable && d.successes == 0:
+		return HealthStateUnhealthy, false
+	default:
+		return HealthStateDegraded, d.routable
+	}
+}
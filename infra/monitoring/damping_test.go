@@ -0,0 +1,192 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dampingStep is a health sample at an offset from the start, and the damped state after it
+type dampingStep struct {
+	at       time.Duration
+	healthy  bool
+	decisive bool
+	state    string
+	routable bool
+}
+
+func TestHealthDamper(t *testing.T) {
+	flappy := HealthDamping{Rise: 2, Fall: 3, FlapThreshold: 3, FlapWindow: time.Minute, FlapHold: 5 * time.Minute}
+
+	tests := []struct {
+		name   string
+		config HealthDamping
+		steps  []dampingStep
+	}{
+		{
+			name:   "first sample is taken as is",
+			config: DefaultHealthDamping(),
+			steps: []dampingStep{
+				{healthy: false, state: HealthStateUnhealthy, routable: false},
+			},
+		},
+		{
+			name:   "rise passing probes return to rotation",
+			config: DefaultHealthDamping(),
+			steps: []dampingStep{
+				{healthy: false, decisive: true, state: HealthStateUnhealthy},
+				{at: time.Second, healthy: true, state: HealthStateDegraded, routable: false},
+				{at: 2 * time.Second, healthy: true, state: HealthStateHealthy, routable: true},
+			},
+		},
+		{
+			name:   "fall failing probes leave rotation",
+			config: DefaultHealthDamping(),
+			steps: []dampingStep{
+				{healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: time.Second, healthy: false, state: HealthStateDegraded, routable: true},
+				{at: 2 * time.Second, healthy: false, state: HealthStateDegraded, routable: true},
+				{at: 3 * time.Second, healthy: false, state: HealthStateUnhealthy, routable: false},
+			},
+		},
+		{
+			name:   "a pass in between restarts the fall count",
+			config: DefaultHealthDamping(),
+			steps: []dampingStep{
+				{healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: time.Second, healthy: false, state: HealthStateDegraded, routable: true},
+				{at: 2 * time.Second, healthy: false, state: HealthStateDegraded, routable: true},
+				{at: 3 * time.Second, healthy: true, state: HealthStateHealthy, routable: true},
+				{at: 4 * time.Second, healthy: false, state: HealthStateDegraded, routable: true},
+				{at: 5 * time.Second, healthy: false, state: HealthStateDegraded, routable: true},
+			},
+		},
+		{
+			name:   "decisive samples change the decision at once",
+			config: DefaultHealthDamping(),
+			steps: []dampingStep{
+				{healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: time.Second, healthy: false, decisive: true, state: HealthStateUnhealthy, routable: false},
+				{at: 2 * time.Second, healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+			},
+		},
+		{
+			name:   "threshold transitions within the window hold the service out",
+			config: flappy,
+			steps: []dampingStep{
+				{healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: 10 * time.Second, healthy: false, decisive: true, state: HealthStateUnhealthy},
+				{at: 20 * time.Second, healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: 30 * time.Second, healthy: false, decisive: true, state: HealthStateFlapping},
+				// Passing again does not end the hold
+				{at: 40 * time.Second, healthy: true, decisive: true, state: HealthStateFlapping},
+			},
+		},
+		{
+			name:   "transitions outside the window are forgotten",
+			config: flappy,
+			steps: []dampingStep{
+				{healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: 10 * time.Second, healthy: false, decisive: true, state: HealthStateUnhealthy},
+				{at: 20 * time.Second, healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: 2 * time.Minute, healthy: false, decisive: true, state: HealthStateUnhealthy},
+				{at: 2*time.Minute + 10*time.Second, healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+			},
+		},
+		{
+			name:   "damped samples that change nothing are not transitions",
+			config: flappy,
+			steps: []dampingStep{
+				{healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: 1 * time.Second, healthy: false, state: HealthStateDegraded, routable: true},
+				{at: 2 * time.Second, healthy: true, state: HealthStateHealthy, routable: true},
+				{at: 3 * time.Second, healthy: false, state: HealthStateDegraded, routable: true},
+				{at: 4 * time.Second, healthy: true, state: HealthStateHealthy, routable: true},
+			},
+		},
+		{
+			name:   "a zero threshold disables flap detection",
+			config: HealthDamping{Rise: 1, Fall: 1, FlapThreshold: 0, FlapWindow: time.Minute, FlapHold: time.Minute},
+			steps: []dampingStep{
+				{healthy: true, decisive: true, state: HealthStateHealthy, routable: true},
+				{at: 1 * time.Second, healthy: false, state: HealthStateUnhealthy},
+				{at: 2 * time.Second, healthy: true, state: HealthStateHealthy, routable: true},
+				{at: 3 * time.Second, healthy: false, state: HealthStateUnhealthy},
+				{at: 4 * time.Second, healthy: true, state: HealthStateHealthy, routable: true},
+				{at: 5 * time.Second, healthy: false, state: HealthStateUnhealthy},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			damper := healthDamper{config: tt.config}
+			for i, step := range tt.steps {
+				now := start.Add(step.at)
+				damper.observe(now, step.healthy, step.decisive)
+				state, routable := damper.state(now)
+				assert.Equal(t, step.state, state, "step %d", i)
+				assert.Equal(t, step.routable, routable, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestHealthDamper_HoldExpiry(t *testing.T) {
+	start := time.Now()
+	damper := healthDamper{config: HealthDamping{Rise: 2, Fall: 3, FlapThreshold: 2, FlapWindow: time.Minute, FlapHold: 5 * time.Minute}}
+
+	damper.observe(start, true, true)
+	damper.observe(start.Add(time.Second), false, true)
+	damper.observe(start.Add(2*time.Second), true, true)
+
+	heldUntil := start.Add(2*time.Second + 5*time.Minute)
+	assert.Equal(t, heldUntil, damper.heldUntil)
+	assert.True(t, damper.held(heldUntil.Add(-time.Nanosecond)))
+	state, routable := damper.state(heldUntil.Add(-time.Nanosecond))
+	assert.Equal(t, HealthStateFlapping, state)
+	assert.False(t, routable)
+
+	// Once the hold expires, the decision underneath applies again
+	assert.False(t, damper.held(heldUntil))
+	state, routable = damper.state(heldUntil)
+	assert.Equal(t, HealthStateHealthy, state)
+	assert.True(t, routable)
+
+	// The transitions that caused the hold do not count towards the next one
+	damper.observe(heldUntil.Add(time.Second), false, true)
+	assert.False(t, damper.held(heldUntil.Add(time.Second)))
+}
+
+func TestParseHealthDamping(t *testing.T) {
+	damping, err := ParseHealthDamping(map[string]string{
+		"constellation.health.rise":           "1",
+		"constellation.health.fall":           "5",
+		"constellation.health.flap.threshold": "0",
+		"constellation.health.flap.window":    "10m",
+		"constellation.health.flap.hold":      "30s",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, HealthDamping{Rise: 1, Fall: 5, FlapThreshold: 0, FlapWindow: 10 * time.Minute, FlapHold: 30 * time.Second}, damping)
+
+	damping, err = ParseHealthDamping(nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultHealthDamping(), damping)
+
+	for label, value := range map[string]string{
+		"rise":           "0",
+		"fall":           "-1",
+		"flap.threshold": "many",
+		"flap.window":    "soon",
+		"flap.hold":      "0s",
+	} {
+		damping, err := ParseHealthDamping(map[string]string{HealthLabelPrefix + label: value})
+		if assert.Error(t, err, label) {
+			assert.Contains(t, err.Error(), HealthLabelPrefix+label)
+		}
+		assert.Equal(t, DefaultHealthDamping(), damping, label)
+	}
+}
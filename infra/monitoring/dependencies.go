@@ -0,0 +1,205 @@
+package monitoring
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// DependsOnLabel declares the services a container needs, comma separated, each
+	// optionally with a condition: "redis,nuq-postgres:service_healthy"
+	DependsOnLabel = "constellation.depends_on"
+	// composeDependsOnLabel is set by docker compose: "redis:service_started:false,..."
+	composeDependsOnLabel = "com.docker.compose.depends_on"
+
+	// Dependency conditions, as in compose's depends_on
+	ConditionServiceHealthy = "service_healthy"
+	ConditionServiceStarted = "service_started"
+	conditionCompleted      = "service_completed_successfully"
+)
+
+// Dependency is a service a container needs to work
+type Dependency struct {
+	Service   string
+	Condition string // ConditionServiceHealthy or ConditionServiceStarted
+}
+
+// DependencyStatus is whether a dependency is met on this node
+type DependencyStatus struct {
+	Service   string
+	Condition string
+	Met       bool
+	Reason    string // Why the dependency is not met
+}
+
+// ParseDependencies reads a container's dependencies from constellation.depends_on,
+// falling back to the label docker compose sets from depends_on. Dependencies on
+// one-shot services (service_completed_successfully) are not tracked.
+func ParseDependencies(labels map[string]string) ([]Dependency, error) {
+	value, ok := labels[DependsOnLabel]
+	defaultCondition := ConditionServiceHealthy
+	if !ok {
+		value = labels[composeDependsOnLabel]
+		// Compose starts dependents once dependencies have started unless told otherwise
+		defaultCondition = ConditionServiceStarted
+	}
+
+	dependencies := make([]Dependency, 0)
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		dependency := Dependency{Service: parts[0], Condition: defaultCondition}
+		if len(parts) > 1 && parts[1] != "" {
+			dependency.Condition = parts[1]
+		}
+
+		switch dependency.Condition {
+		case ConditionServiceHealthy, ConditionServiceStarted:
+		case conditionCompleted:
+			continue
+		default:
+			return nil, fmt.Errorf("unknown condition %q for dependency %s", dependency.Condition, dependency.Service)
+		}
+		if dependency.Service == "" || seen[dependency.Service] {
+			continue
+		}
+		seen[dependency.Service] = true
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies, nil
+}
+
+// evaluateDependencies recomputes whether the dependencies of every tracked container
+// are met, following chains of dependencies, and returns the containers whose result
+// changed. The caller holds sm.mu.
+func (sm *ServiceMonitor) evaluateDependencies() map[string]bool {
+	changed := make(map[string]bool)
+
+	// A dependency's effective health can depend on another's, so iterate until stable;
+	// every pass settles at least one more link of the longest chain
+	for pass := 0; pass <= len(sm.containers); pass++ {
+		stable := true
+		for id, tracked := range sm.containers {
+			statuses := sm.dependencyStatuses(tracked)
+			if dependencyStatusesEqual(statuses, tracked.status.Dependencies) {
+				continue
+			}
+			tracked.status.Dependencies = statuses
+			changed[id] = true
+			stable = false
+		}
+		if stable {
+			break
+		}
+	}
+	return changed
+}
+
+// dependencyStatuses checks a container's dependencies against the containers on this node
+func (sm *ServiceMonitor) dependencyStatuses(tracked *trackedContainer) []DependencyStatus {
+	if len(tracked.dependencies) == 0 {
+		return nil
+	}
+
+	statuses := make([]DependencyStatus, 0, len(tracked.dependencies))
+	for _, dependency := range tracked.dependencies {
+		status := DependencyStatus{Service: dependency.Service, Condition: dependency.Condition}
+		candidates := sm.dependencyCandidates(dependency.Service, tracked.status.Service.Project)
+
+		switch {
+		case len(candidates) == 0:
+			status.Reason = "not running on this node"
+		case dependency.Condition == ConditionServiceStarted:
+			status.Reason = "not running"
+			for _, candidate := range candidates {
+				if candidate.status.Running {
+					status.Met, status.Reason = true, ""
+					break
+				}
+			}
+		default:
+			status.Reason = candidateReason(candidates[0])
+			for _, candidate := range candidates {
+				if candidate.status.EffectiveHealthy() {
+					status.Met, status.Reason = true, ""
+					break
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// dependencyCandidates returns the containers that can satisfy a dependency, preferring
+// those of the dependent's own compose project
+func (sm *ServiceMonitor) dependencyCandidates(service, project string) []*trackedContainer {
+	var sameProject, others []*trackedContainer
+	ids := make([]string, 0, len(sm.containers))
+	for id := range sm.containers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		candidate := sm.containers[id]
+		if candidate.status.Service.Name != service {
+			continue
+		}
+		if project != "" && candidate.status.Service.Project == project {
+			sameProject = append(sameProject, candidate)
+		} else {
+			others = append(others, candidate)
+		}
+	}
+	if len(sameProject) > 0 {
+		return sameProject
+	}
+	return others
+}
+
+// candidateReason explains why a dependency instance is not healthy
+func candidateReason(candidate *trackedContainer) string {
+	if !candidate.status.Healthy {
+		if candidate.status.State != "" {
+			return candidate.status.State
+		}
+		return "unhealthy"
+	}
+	for _, dependency := range candidate.status.Dependencies {
+		if !dependency.Met {
+			return fmt.Sprintf("blocked by its dependency %s", dependency.Service)
+		}
+	}
+	return "unhealthy"
+}
+
+// EffectiveHealthy reports whether the service is healthy and all its dependencies are met
+func (s *ServiceStatus) EffectiveHealthy() bool {
+	if !s.Healthy {
+		return false
+	}
+	for _, dependency := range s.Dependencies {
+		if !dependency.Met {
+			return false
+		}
+	}
+	return true
+}
+
+func dependencyStatusesEqual(a, b []DependencyStatus) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
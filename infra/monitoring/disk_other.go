@@ -0,0 +1,10 @@
+//go:build !unix
+
+package monitoring
+
+import "fmt"
+
+// diskUsagePercent is not supported on this platform
+func diskUsagePercent(path string) (float64, error) {
+	return 0, fmt.Errorf("disk usage not supported on this platform")
+}
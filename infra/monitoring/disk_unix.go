@@ -0,0 +1,23 @@
+//go:build unix
+
+package monitoring
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// diskUsagePercent returns how full the filesystem holding path is
+func diskUsagePercent(path string) (float64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("failed to stat filesystem %s: %w", path, err)
+	}
+	total := float64(stat.Blocks) * float64(stat.Bsize)
+	if total == 0 {
+		return 0, nil
+	}
+	// Like df, count space reserved for root as used
+	free := float64(stat.Bavail) * float64(stat.Bsize)
+	return (total - free) / total * 100.0, nil
+}
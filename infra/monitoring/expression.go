@@ -0,0 +1,413 @@
+package monitoring
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Metric names available in trigger expressions
+const (
+	MetricCPU           = "cpu"             // Node CPU usage, percent
+	MetricMemory        = "memory"          // Node memory usage, percent
+	MetricDisk          = "disk"            // Root filesystem usage, percent
+	MetricLoad1         = "load1"           // 1 minute load average
+	MetricLoad5         = "load5"           // 5 minute load average
+	MetricLoad15        = "load15"          // 15 minute load average
+	MetricNetRx         = "net_rx"          // Received bytes per second, all interfaces but loopback
+	MetricNetTx         = "net_tx"          // Transmitted bytes per second, all interfaces but loopback
+	MetricIORead        = "io_read"         // Bytes read per second, all whole disks
+	MetricIOWrite       = "io_write"        // Bytes written per second, all whole disks
+	MetricIOUtil        = "io_util"         // Busiest disk's share of time doing I/O, percent
+	MetricPSICPU        = "psi_cpu"         // Share of time some tasks stalled on CPU (10s average), percent
+	MetricPSIMemory     = "psi_memory"      // Share of time some tasks stalled on memory, percent
+	MetricPSIMemoryFull = "psi_memory_full" // Share of time all tasks stalled on memory, percent
+	MetricPSIIO         = "psi_io"          // Share of time some tasks stalled on I/O, percent
+	MetricPSIIOFull     = "psi_io_full"     // Share of time all tasks stalled on I/O, percent
+
+	MetricContainerCPU       = "container_cpu"        // Service container CPU usage, percent of one core
+	MetricContainerMemory    = "container_memory"     // Service container memory usage, percent of its limit
+	MetricContainerIORead    = "container_io_read"    // Service container bytes read per second
+	MetricContainerIOWrite   = "container_io_write"   // Service container bytes written per second
+	MetricContainerPSICPU    = "container_psi_cpu"    // Service container CPU pressure (some avg10), percent
+	MetricContainerPSIMemory = "container_psi_memory" // Service container memory pressure (some avg10), percent
+	MetricContainerPSIIO     = "container_psi_io"     // Service container I/O pressure (some avg10), percent
+)
+
+// containerMetricPrefix marks metrics sampled from the rule's service container
+const containerMetricPrefix = "container_"
+
+// knownMetrics lists the metric names accepted by the parser, with their aliases
+var knownMetrics = map[string]string{
+	MetricCPU:           MetricCPU,
+	MetricMemory:        MetricMemory,
+	"mem":               MetricMemory,
+	MetricDisk:          MetricDisk,
+	MetricLoad1:         MetricLoad1,
+	"load":              MetricLoad1,
+	MetricLoad5:         MetricLoad5,
+	MetricLoad15:        MetricLoad15,
+	MetricNetRx:         MetricNetRx,
+	MetricNetTx:         MetricNetTx,
+	MetricIORead:        MetricIORead,
+	MetricIOWrite:       MetricIOWrite,
+	MetricIOUtil:        MetricIOUtil,
+	MetricPSICPU:        MetricPSICPU,
+	MetricPSIMemory:     MetricPSIMemory,
+	MetricPSIMemoryFull: MetricPSIMemoryFull,
+	MetricPSIIO:         MetricPSIIO,
+	MetricPSIIOFull:     MetricPSIIOFull,
+
+	MetricContainerCPU:       MetricContainerCPU,
+	MetricContainerMemory:    MetricContainerMemory,
+	MetricContainerIORead:    MetricContainerIORead,
+	MetricContainerIOWrite:   MetricContainerIOWrite,
+	MetricContainerPSICPU:    MetricContainerPSICPU,
+	MetricContainerPSIMemory: MetricContainerPSIMemory,
+	MetricContainerPSIIO:     MetricContainerPSIIO,
+}
+
+// TriggerExpression is a parsed resource trigger such as
+// "cpu>85% for 5m || (memory>=90% && container_memory>95%)"
+type TriggerExpression struct {
+	source string
+	root   exprNode
+}
+
+// exprNode is a node of a parsed trigger expression
+type exprNode interface {
+	eval(window *SampleWindow, now time.Time) (bool, error)
+	walk(fn func(*comparison))
+}
+
+// binaryNode combines two expressions with && or ||
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(window *SampleWindow, now time.Time) (bool, error) {
+	left, err := n.left.eval(window, now)
+	if err != nil {
+		return false, err
+	}
+	if n.op == "&&" && !left {
+		return false, nil
+	}
+	if n.op == "||" && left {
+		return true, nil
+	}
+	return n.right.eval(window, now)
+}
+
+func (n *binaryNode) walk(fn func(*comparison)) {
+	n.left.walk(fn)
+	n.right.walk(fn)
+}
+
+// comparison compares one metric to a constant, optionally over a sustained window
+type comparison struct {
+	metric   string
+	op       string
+	value    float64
+	duration time.Duration // 0 = latest sample only
+}
+
+func (c *comparison) holds(value float64) bool {
+	switch c.op {
+	case ">":
+		return value > c.value
+	case ">=":
+		return value >= c.value
+	case "<":
+		return value < c.value
+	case "<=":
+		return value <= c.value
+	case "==":
+		return value == c.value
+	case "!=":
+		return value != c.value
+	}
+	return false
+}
+
+// eval checks the latest sample, or with a duration, that the comparison held in
+// every sample of the window and that the window covers the whole duration
+func (c *comparison) eval(window *SampleWindow, now time.Time) (bool, error) {
+	latest, ok := window.Latest()
+	if !ok {
+		return false, nil
+	}
+	value, ok := latest.Values[c.metric]
+	if !ok {
+		return false, fmt.Errorf("metric %s not available", c.metric)
+	}
+	if c.duration == 0 {
+		return c.holds(value), nil
+	}
+
+	since := now.Add(-c.duration)
+	covered := false
+	for _, sample := range window.snapshot() {
+		if sample.Time.After(since) {
+			value, ok := sample.Values[c.metric]
+			if !ok || !c.holds(value) {
+				return false, nil
+			}
+		} else {
+			covered = true
+		}
+	}
+	// Without a sample from before the window the condition has not held for long enough
+	return covered, nil
+}
+
+func (c *comparison) walk(fn func(*comparison)) {
+	fn(c)
+}
+
+// String returns the expression as written
+func (e *TriggerExpression) String() string {
+	return e.source
+}
+
+// Evaluate reports whether the expression holds for the samples in window
+func (e *TriggerExpression) Evaluate(window *SampleWindow, now time.Time) (bool, error) {
+	return e.root.eval(window, now)
+}
+
+// Metrics returns the metric names the expression refers to
+func (e *TriggerExpression) Metrics() []string {
+	seen := make(map[string]bool)
+	e.root.walk(func(c *comparison) { seen[c.metric] = true })
+
+	metrics := make([]string, 0, len(seen))
+	for metric := range seen {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	return metrics
+}
+
+// UsesContainerMetrics reports whether evaluating the expression needs container samples
+func (e *TriggerExpression) UsesContainerMetrics() bool {
+	uses := false
+	e.root.walk(func(c *comparison) {
+		if strings.HasPrefix(c.metric, containerMetricPrefix) {
+			uses = true
+		}
+	})
+	return uses
+}
+
+// MaxDuration returns the longest sustained window in the expression
+func (e *TriggerExpression) MaxDuration() time.Duration {
+	var max time.Duration
+	e.root.walk(func(c *comparison) {
+		if c.duration > max {
+			max = c.duration
+		}
+	})
+	return max
+}
+
+// ParseTriggerExpression parses a resource trigger expression.
+//
+//	expr       = and { "||" and }
+//	and        = primary { "&&" primary }
+//	primary    = "(" expr ")" | comparison
+//	comparison = metric op number [unit] [ "for" duration ]
+//	op         = ">" | ">=" | "<" | "<=" | "==" | "!="
+//	unit       = "%" | "K" | "M" | "G" (optionally followed by "B" and "/s"), factors of 1024
+func ParseTriggerExpression(source string) (*TriggerExpression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty trigger expression")
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+
+	return &TriggerExpression{source: strings.TrimSpace(source), root: root}, nil
+}
+
+type token struct {
+	text string
+	pos  int
+}
+
+// tokenize splits an expression into identifiers, numbers with units, operators and parentheses
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, token{text: string(r), pos: i})
+			i++
+		case strings.ContainsRune("<>=!&|", r):
+			start := i
+			for i < len(runes) && strings.ContainsRune("<>=!&|", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{text: string(runes[start:i]), pos: start})
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("._%/", runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{text: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{text: "end of expression", pos: -1}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for !p.done() && p.peek().text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for !p.done() && p.peek().text == "&&" {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (exprNode, error) {
+	if p.done() {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	if p.peek().text == "(" {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.text != ")" {
+			return nil, fmt.Errorf("expected ) at position %d, got %q", closing.pos, closing.text)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (exprNode, error) {
+	name := p.next()
+	metric, ok := knownMetrics[strings.ToLower(name.text)]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q at position %d", name.text, name.pos)
+	}
+
+	op := p.next()
+	switch op.text {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return nil, fmt.Errorf("invalid operator %q after %s at position %d", op.text, name.text, op.pos)
+	}
+
+	valueToken := p.next()
+	value, err := parseValue(valueToken.text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q at position %d: %w", valueToken.text, valueToken.pos, err)
+	}
+
+	c := &comparison{metric: metric, op: op.text, value: value}
+	if !p.done() && strings.EqualFold(p.peek().text, "for") {
+		p.next()
+		durationToken := p.next()
+		duration, err := time.ParseDuration(durationToken.text)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid duration %q at position %d", durationToken.text, durationToken.pos)
+		}
+		c.duration = duration
+	}
+	return c, nil
+}
+
+// parseValue parses a number with an optional percent or byte unit (K, M, G, KB/s, MiB/s, ...)
+func parseValue(text string) (float64, error) {
+	upper := strings.ToUpper(text)
+	upper = strings.TrimSuffix(upper, "/S")
+	upper = strings.TrimSuffix(upper, "%")
+	upper = strings.TrimSuffix(upper, "IB")
+	upper = strings.TrimSuffix(upper, "B")
+
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(upper, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(upper, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(upper, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		upper = upper[:len(upper)-1]
+	}
+
+	value, err := strconv.ParseFloat(upper, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a number")
+	}
+	return value * multiplier, nil
+}
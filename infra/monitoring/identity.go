@@ -0,0 +1,102 @@
+package monitoring
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// ServiceLabel names the service a container belongs to, overriding compose and swarm labels
+	ServiceLabel = "constellation.service"
+	// InstanceLabel distinguishes containers of the same service on one node
+	InstanceLabel = "constellation.instance"
+	// EnableLabel opts a container in to (true) or out of (false) service health monitoring
+	EnableLabel = "constellation.enable"
+
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	composeNumberLabel  = "com.docker.compose.container-number"
+	swarmServiceLabel   = "com.docker.swarm.service.name"
+	swarmSlotLabel      = "com.docker.swarm.task.slot"
+	stackNamespaceLabel = "com.docker.stack.namespace"
+)
+
+// ServiceIdentity identifies the service a container is an instance of
+type ServiceIdentity struct {
+	Name     string // Service name, as used in hostnames and gossip
+	Project  string // Compose project or swarm stack, if any
+	Instance string // Replica index; empty for the first or only replica
+}
+
+// ResolveServiceIdentity derives a container's service from its labels, in order:
+// constellation.service, the compose service (within its project), the swarm service
+// (without its stack prefix), and finally the container name. Infrastructure containers
+// (constellation-*, traefik*, warp-*) and containers labeled constellation.enable=false
+// are not services; constellation.enable=true monitors a container regardless of its name.
+func ResolveServiceIdentity(containerName string, labels map[string]string) (ServiceIdentity, bool) {
+	containerName = strings.TrimPrefix(containerName, "/")
+
+	switch strings.ToLower(labels[EnableLabel]) {
+	case "false", "0", "no":
+		return ServiceIdentity{}, false
+	case "true", "1", "yes":
+	default:
+		if isInfrastructureContainer(containerName) {
+			return ServiceIdentity{}, false
+		}
+	}
+
+	identity := ServiceIdentity{}
+	switch {
+	case labels[ServiceLabel] != "":
+		identity.Name = labels[ServiceLabel]
+		identity.Project = labels[composeProjectLabel]
+		identity.Instance = replicaInstance(labels[composeNumberLabel])
+	case labels[composeServiceLabel] != "":
+		identity.Name = labels[composeServiceLabel]
+		identity.Project = labels[composeProjectLabel]
+		identity.Instance = replicaInstance(labels[composeNumberLabel])
+	case labels[swarmServiceLabel] != "":
+		identity.Project = labels[stackNamespaceLabel]
+		identity.Name = labels[swarmServiceLabel]
+		if identity.Project != "" {
+			identity.Name = strings.TrimPrefix(identity.Name, identity.Project+"_")
+		}
+		identity.Instance = replicaInstance(labels[swarmSlotLabel])
+	default:
+		identity.Name = containerName
+	}
+	if instance := labels[InstanceLabel]; instance != "" {
+		identity.Instance = instance
+	}
+
+	if identity.Name == "" {
+		return ServiceIdentity{}, false
+	}
+	return identity, true
+}
+
+// Key identifies the service instance on a node
+func (id ServiceIdentity) Key() string {
+	if id.Instance == "" {
+		return id.Name
+	}
+	return id.Name + "#" + id.Instance
+}
+
+// replicaInstance returns the instance of a compose container number or swarm slot,
+// leaving the first replica unnumbered so single-replica services keep a plain identity
+func replicaInstance(number string) string {
+	if n, err := strconv.Atoi(number); err == nil && n <= 1 {
+		return ""
+	}
+	return number
+}
+
+// isInfrastructureContainer reports whether a container is part of the cluster itself
+func isInfrastructureContainer(containerName string) bool {
+	return containerName == "" ||
+		strings.HasPrefix(containerName, "constellation-") ||
+		strings.HasPrefix(containerName, "traefik") ||
+		strings.HasPrefix(containerName, "warp-")
+}
@@ -3,194 +3,263 @@ package monitoring
 import (
 	"context"
 	"fmt"
-	"os/exec"
-	"strconv"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+// primeInterval is how long the first collection waits for a second sample, since
+// CPU and IO usage are deltas between two readings of cumulative counters
+const primeInterval = 250 * time.Millisecond
+
 // NodeMetrics represents current resource usage on a node
 type NodeMetrics struct {
-	CPUPercent    float64
-	MemoryPercent float64
-	MemoryUsed    int64 // bytes
-	MemoryTotal   int64 // bytes
-	Timestamp     time.Time
+	CPUPercent         float64        `json:"cpu_percent"`
+	MemoryPercent      float64        `json:"memory_percent"`
+	MemoryUsed         int64          `json:"memory_used"`  // bytes, excluding reclaimable caches
+	MemoryTotal        int64          `json:"memory_total"` // bytes
+	DiskPercent        float64        `json:"disk_percent"`
+	Load1              float64        `json:"load1"`
+	Load5              float64        `json:"load5"`
+	Load15             float64        `json:"load15"`
+	NetRxBytesPerSec   float64        `json:"net_rx_bytes_per_sec"`
+	NetTxBytesPerSec   float64        `json:"net_tx_bytes_per_sec"`
+	IOReadBytesPerSec  float64        `json:"io_read_bytes_per_sec"`  // All whole disks
+	IOWriteBytesPerSec float64        `json:"io_write_bytes_per_sec"` // All whole disks
+	IOUtilPercent      float64        `json:"io_util_percent"`        // Busiest disk's share of time doing I/O
+	CPUPressure        *PressureStats `json:"cpu_pressure,omitempty"` // nil when the kernel has no PSI
+	MemoryPressure     *PressureStats `json:"memory_pressure,omitempty"`
+	IOPressure         *PressureStats `json:"io_pressure,omitempty"`
+	Timestamp          time.Time      `json:"timestamp"`
+}
+
+// Values returns the metrics by the names used in trigger expressions
+func (m *NodeMetrics) Values() map[string]float64 {
+	values := map[string]float64{
+		MetricCPU:     m.CPUPercent,
+		MetricMemory:  m.MemoryPercent,
+		MetricDisk:    m.DiskPercent,
+		MetricLoad1:   m.Load1,
+		MetricLoad5:   m.Load5,
+		MetricLoad15:  m.Load15,
+		MetricNetRx:   m.NetRxBytesPerSec,
+		MetricNetTx:   m.NetTxBytesPerSec,
+		MetricIORead:  m.IOReadBytesPerSec,
+		MetricIOWrite: m.IOWriteBytesPerSec,
+		MetricIOUtil:  m.IOUtilPercent,
+	}
+	// Without PSI the pressure metrics are left out, so expressions using them report
+	// the metric as unavailable instead of silently never firing
+	if m.CPUPressure != nil {
+		values[MetricPSICPU] = m.CPUPressure.Some
+	}
+	if m.MemoryPressure != nil {
+		values[MetricPSIMemory] = m.MemoryPressure.Some
+		values[MetricPSIMemoryFull] = m.MemoryPressure.Full
+	}
+	if m.IOPressure != nil {
+		values[MetricPSIIO] = m.IOPressure.Some
+		values[MetricPSIIOFull] = m.IOPressure.Full
+	}
+	return values
 }
 
-// MetricsCollector collects node resource metrics
+// MetricsCollector collects node and container resource metrics from /proc and cgroup v2
 type MetricsCollector struct {
 	checkInterval time.Duration
+	hostRoot      string // Prefix for host paths when the agent runs in a container (e.g. /host)
+
+	mu         sync.Mutex
+	last       *nodeCounters // Previous node counters, for deltas
+	latest     *NodeMetrics
+	containers map[string]*containerCounters // container ID -> previous cgroup counters
+}
+
+// nodeCounters are the cumulative node counters of one collection
+type nodeCounters struct {
+	at    time.Time
+	cpu   cpuTimes
+	disks map[string]diskCounters
+	net   *netCounters // nil when /proc/net/dev is unreadable
 }
 
 // NewMetricsCollector creates a new metrics collector
 func NewMetricsCollector() *MetricsCollector {
 	return &MetricsCollector{
 		checkInterval: 10 * time.Second,
+		containers:    make(map[string]*containerCounters),
 	}
 }
 
-// CollectMetrics collects current node metrics using system commands
-func (mc *MetricsCollector) CollectMetrics(ctx context.Context) (*NodeMetrics, error) {
-	metrics := &NodeMetrics{
-		Timestamp: time.Now(),
+// SetHostRoot makes the collector read /proc, /sys and the root filesystem under root,
+// for agents running in a container with the host filesystem mounted
+func (mc *MetricsCollector) SetHostRoot(root string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.hostRoot = root
+}
+
+// hostPath returns path under the host root, or path itself when its top-level
+// directory (/proc, /sys) is not mounted there
+func (mc *MetricsCollector) hostPath(path string) string {
+	if mc.hostRoot == "" {
+		return path
+	}
+	top, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if _, err := os.Stat(filepath.Join(mc.hostRoot, top)); err != nil {
+		return path
 	}
+	return filepath.Join(mc.hostRoot, path)
+}
 
-	// Collect CPU usage
-	cpuPercent, err := mc.getCPUPercent(ctx)
+// CollectMetrics collects current node metrics. CPU, IO and network usage are
+// computed over the interval since the previous collection.
+func (mc *MetricsCollector) CollectMetrics(ctx context.Context) (*NodeMetrics, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	current, err := mc.readNodeCounters()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get CPU percent: %w", err)
+		return nil, err
+	}
+	previous := mc.last
+	if previous == nil {
+		// Nothing to compare with yet; take a second sample shortly after
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(primeInterval):
+		}
+		previous = current
+		if current, err = mc.readNodeCounters(); err != nil {
+			return nil, err
+		}
+	}
+	mc.last = current
+
+	metrics := &NodeMetrics{
+		CPUPercent: cpuPercent(previous.cpu, current.cpu),
+		Timestamp:  current.at,
 	}
-	metrics.CPUPercent = cpuPercent
 
-	// Collect memory usage
-	memPercent, memUsed, memTotal, err := mc.getMemoryUsage(ctx)
+	data, err := os.ReadFile(mc.hostPath("/proc/meminfo"))
 	if err != nil {
+		return nil, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	if metrics.MemoryTotal, metrics.MemoryUsed, err = parseMeminfo(data); err != nil {
 		return nil, fmt.Errorf("failed to get memory usage: %w", err)
 	}
-	metrics.MemoryPercent = memPercent
-	metrics.MemoryUsed = memUsed
-	metrics.MemoryTotal = memTotal
-
-	return metrics, nil
-}
+	metrics.MemoryPercent = float64(metrics.MemoryUsed) / float64(metrics.MemoryTotal) * 100.0
 
-// getCPUPercent gets CPU usage percentage using top/htop or /proc/stat
-func (mc *MetricsCollector) getCPUPercent(ctx context.Context) (float64, error) {
-	// Try using top command first (more accurate)
-	cmd := exec.CommandContext(ctx, "sh", "-c", "top -bn1 | grep 'Cpu(s)' | sed 's/.*, *\\([0-9.]*\\)%* id.*/\\1/' | awk '{print 100 - $1}'")
-	output, err := cmd.Output()
-	if err == nil {
-		// Parse output
-		lines := strings.TrimSpace(string(output))
-		if len(lines) > 0 {
-			parts := strings.Fields(lines)
-			if len(parts) > 0 {
-				if cpu, err := strconv.ParseFloat(parts[0], 64); err == nil {
-					return cpu, nil
-				}
-			}
+	// Everything else is best effort: a failure leaves the value at zero
+	elapsed := current.at.Sub(previous.at).Seconds()
+	mc.diskRates(metrics, previous.disks, current.disks, elapsed)
+	if previous.net != nil && current.net != nil {
+		metrics.NetRxBytesPerSec = bytesPerSecond(previous.net.rx, current.net.rx, elapsed)
+		metrics.NetTxBytesPerSec = bytesPerSecond(previous.net.tx, current.net.tx, elapsed)
+	}
+	if diskPercent, err := diskUsagePercent(mc.hostPath("/")); err == nil {
+		metrics.DiskPercent = diskPercent
+	}
+	if data, err := os.ReadFile(mc.hostPath("/proc/loadavg")); err == nil {
+		if load1, load5, load15, err := parseLoadavg(data); err == nil {
+			metrics.Load1, metrics.Load5, metrics.Load15 = load1, load5, load15
 		}
 	}
-
-	// Fallback to /proc/stat method
-	cmd = exec.CommandContext(ctx, "sh", "-c", "grep 'cpu ' /proc/stat | awk '{usage=($2+$4)*100/($2+$3+$4+$5)} END {print usage}'")
-	output, err = cmd.Output()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get CPU usage: %w", err)
+	if pressure, ok := readPressure(mc.hostPath("/proc/pressure/cpu")); ok {
+		metrics.CPUPressure = &pressure
 	}
-
-	cpuStr := strings.TrimSpace(string(output))
-	cpu, err := strconv.ParseFloat(cpuStr, 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse CPU usage: %w", err)
+	if pressure, ok := readPressure(mc.hostPath("/proc/pressure/memory")); ok {
+		metrics.MemoryPressure = &pressure
+	}
+	if pressure, ok := readPressure(mc.hostPath("/proc/pressure/io")); ok {
+		metrics.IOPressure = &pressure
 	}
 
-	return cpu, nil
+	mc.latest = metrics
+	return metrics, nil
 }
 
-// getMemoryUsage gets memory usage using free command
-func (mc *MetricsCollector) getMemoryUsage(ctx context.Context) (percent float64, used int64, total int64, err error) {
-	cmd := exec.CommandContext(ctx, "free", "-b")
-	output, err := cmd.Output()
-	if err != nil {
-		return 0, 0, 0, fmt.Errorf("failed to get memory info: %w", err)
-	}
+// LatestMetrics returns a copy of the most recently collected node metrics
+func (mc *MetricsCollector) LatestMetrics() (*NodeMetrics, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
 
-	lines := strings.Split(string(output), "\n")
-	if len(lines) < 2 {
-		return 0, 0, 0, fmt.Errorf("unexpected free output format")
-	}
-
-	// Parse Mem: line
-	memLine := lines[1]
-	fields := strings.Fields(memLine)
-	if len(fields) < 3 {
-		return 0, 0, 0, fmt.Errorf("unexpected free output format")
+	if mc.latest == nil {
+		return nil, false
 	}
+	metrics := *mc.latest
+	return &metrics, true
+}
 
-	total, err = strconv.ParseInt(fields[1], 10, 64)
+// readNodeCounters reads the cumulative CPU, disk and network counters
+func (mc *MetricsCollector) readNodeCounters() (*nodeCounters, error) {
+	data, err := os.ReadFile(mc.hostPath("/proc/stat"))
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("failed to parse total memory: %w", err)
+		return nil, fmt.Errorf("failed to read CPU statistics: %w", err)
 	}
-
-	used, err = strconv.ParseInt(fields[2], 10, 64)
+	cpu, err := parseProcStat(data)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("failed to parse used memory: %w", err)
+		return nil, fmt.Errorf("failed to get CPU usage: %w", err)
 	}
 
-	if total > 0 {
-		percent = float64(used) / float64(total) * 100.0
+	counters := &nodeCounters{at: time.Now(), cpu: cpu}
+	if data, err := os.ReadFile(mc.hostPath("/proc/diskstats")); err == nil {
+		counters.disks = parseDiskstats(data, wholeDiskFilter(mc.hostPath("/sys")))
+	}
+	if data, err := os.ReadFile(mc.hostPath("/proc/net/dev")); err == nil {
+		net := parseNetDev(data)
+		counters.net = &net
 	}
+	return counters, nil
+}
 
-	return percent, used, total, nil
+// diskRates sums read and write throughput over all disks and reports the utilization
+// of the busiest one, which is what saturates first
+func (mc *MetricsCollector) diskRates(metrics *NodeMetrics, previous, current map[string]diskCounters, elapsed float64) {
+	if elapsed <= 0 {
+		return
+	}
+	for name, now := range current {
+		before, ok := previous[name]
+		if !ok {
+			continue
+		}
+		metrics.IOReadBytesPerSec += bytesPerSecond(before.readBytes, now.readBytes, elapsed)
+		metrics.IOWriteBytesPerSec += bytesPerSecond(before.writeBytes, now.writeBytes, elapsed)
+		if now.ioTimeMS >= before.ioTimeMS {
+			util := float64(now.ioTimeMS-before.ioTimeMS) / (elapsed * 1000) * 100.0
+			if util > 100 {
+				util = 100
+			}
+			if util > metrics.IOUtilPercent {
+				metrics.IOUtilPercent = util
+			}
+		}
+	}
 }
 
-// EvaluateResourceThreshold evaluates if a resource threshold is exceeded
-// threshold format: "cpu>80%" or "memory>90%"
+// EvaluateResourceThreshold evaluates a trigger expression (e.g. "cpu>80%" or
+// "memory>=90% && disk>85%") against a single sample. Sustained conditions
+// ("cpu>85% for 5m") need a SampleWindow and never hold for a single sample.
 func EvaluateResourceThreshold(metrics *NodeMetrics, threshold string) (bool, error) {
-	threshold = strings.TrimSpace(threshold)
-	if threshold == "" {
+	if strings.TrimSpace(threshold) == "" {
 		return false, nil
 	}
 
-	// Parse threshold (e.g., "cpu>80%" or "memory>90%")
-	var resource string
-	var operator string
-	var valueStr string
-
-	// Extract resource type
-	if strings.HasPrefix(strings.ToLower(threshold), "cpu") {
-		resource = "cpu"
-		threshold = threshold[3:]
-	} else if strings.HasPrefix(strings.ToLower(threshold), "memory") {
-		resource = "memory"
-		threshold = threshold[6:]
-	} else {
-		return false, fmt.Errorf("unknown resource type in threshold: %s", threshold)
-	}
-
-	// Extract operator and value
-	if strings.HasPrefix(threshold, ">") {
-		operator = ">"
-		valueStr = strings.TrimSuffix(threshold[1:], "%")
-	} else if strings.HasPrefix(threshold, "<") {
-		operator = "<"
-		valueStr = strings.TrimSuffix(threshold[1:], "%")
-	} else if strings.HasPrefix(threshold, ">=") {
-		operator = ">="
-		valueStr = strings.TrimSuffix(threshold[2:], "%")
-	} else if strings.HasPrefix(threshold, "<=") {
-		operator = "<="
-		valueStr = strings.TrimSuffix(threshold[2:], "%")
-	} else {
-		return false, fmt.Errorf("invalid operator in threshold: %s", threshold)
-	}
-
-	value, err := strconv.ParseFloat(valueStr, 64)
+	expr, err := ParseTriggerExpression(threshold)
 	if err != nil {
-		return false, fmt.Errorf("failed to parse threshold value: %w", err)
-	}
-
-	// Get current resource usage
-	var currentValue float64
-	if resource == "cpu" {
-		currentValue = metrics.CPUPercent
-	} else if resource == "memory" {
-		currentValue = metrics.MemoryPercent
-	}
-
-	// Evaluate threshold
-	switch operator {
-	case ">":
-		return currentValue > value, nil
-	case "<":
-		return currentValue < value, nil
-	case ">=":
-		return currentValue >= value, nil
-	case "<=":
-		return currentValue <= value, nil
-	default:
-		return false, fmt.Errorf("unsupported operator: %s", operator)
+		return false, err
+	}
+
+	timestamp := metrics.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
 	}
+	window := NewSampleWindow(0)
+	window.Add(Sample{Time: timestamp, Values: metrics.Values()})
+	return expr.Evaluate(window, timestamp)
 }
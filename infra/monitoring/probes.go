@@ -0,0 +1,402 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// ProbeLabelPrefix prefixes the container labels that declare an active probe
+	ProbeLabelPrefix = "constellation.probe."
+
+	// Probe types, each declared by the label of the same name (e.g. constellation.probe.http=/healthz)
+	ProbeHTTP  = "http"
+	ProbeTCP   = "tcp"
+	ProbeGRPC  = "grpc"
+	ProbeRedis = "redis"
+
+	defaultProbeInterval = 10 * time.Second
+	defaultProbeTimeout  = 2 * time.Second
+	// maxProbeBody limits how much of an HTTP response is searched for the expected body
+	maxProbeBody = 64 << 10
+)
+
+// ProbeSpec is an active health probe declared through container labels:
+//
+//	constellation.probe.http=/healthz      HTTP GET of a path
+//	constellation.probe.tcp=6379           TCP connect
+//	constellation.probe.grpc=50051         grpc.health.v1 Check (constellation.probe.grpc.service names the service)
+//	constellation.probe.redis=6379         Redis PING
+//	constellation.probe.port=8080          Port of HTTP probes, and of others without one in their label
+//	constellation.probe.interval=10s
+//	constellation.probe.timeout=2s
+//	constellation.probe.expect.status=2xx  HTTP status codes or classes, comma separated (default 200-399)
+//	constellation.probe.expect.body=ok     Substring the HTTP response body must contain
+type ProbeSpec struct {
+	Type         string        `json:"type"`
+	Port         int           `json:"port"`
+	Path         string        `json:"path,omitempty"`
+	GRPCService  string        `json:"grpc_service,omitempty"`
+	Interval     time.Duration `json:"interval"`
+	Timeout      time.Duration `json:"timeout"`
+	ExpectStatus string        `json:"expect_status,omitempty"`
+	ExpectBody   string        `json:"expect_body,omitempty"`
+}
+
+// ProbeResult is the outcome of one probe run
+type ProbeResult struct {
+	Type      string        `json:"type"`
+	Target    string        `json:"target"`
+	Healthy   bool          `json:"healthy"`
+	Message   string        `json:"message,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// ParseProbeSpec reads the probe declared in a container's labels. It returns nil when
+// the container declares none. defaultPort is used when no label names a port.
+func ParseProbeSpec(labels map[string]string, defaultPort int) (*ProbeSpec, error) {
+	spec := &ProbeSpec{
+		Interval: defaultProbeInterval,
+		Timeout:  defaultProbeTimeout,
+		Port:     defaultPort,
+	}
+
+	typePort := false
+	for _, probeType := range []string{ProbeHTTP, ProbeTCP, ProbeGRPC, ProbeRedis} {
+		value, ok := labels[ProbeLabelPrefix+probeType]
+		if !ok {
+			continue
+		}
+		if spec.Type != "" {
+			return nil, fmt.Errorf("both %s and %s probes declared", spec.Type, probeType)
+		}
+		spec.Type = probeType
+
+		value = strings.TrimSpace(value)
+		if probeType == ProbeHTTP {
+			spec.Path = value
+			if spec.Path == "" {
+				spec.Path = "/"
+			}
+			if !strings.HasPrefix(spec.Path, "/") {
+				spec.Path = "/" + spec.Path
+			}
+		} else if value != "" && value != "true" {
+			port, err := strconv.Atoi(value)
+			if err != nil || !validPort(port) {
+				return nil, fmt.Errorf("invalid %s probe port %q", probeType, value)
+			}
+			spec.Port = port
+			typePort = true
+		}
+	}
+	if spec.Type == "" {
+		return nil, nil
+	}
+
+	if value, ok := labels[ProbeLabelPrefix+"port"]; ok {
+		port, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || !validPort(port) {
+			return nil, fmt.Errorf("invalid probe port %q", value)
+		}
+		if !typePort {
+			spec.Port = port
+		}
+	}
+	if value, ok := labels[ProbeLabelPrefix+"interval"]; ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid probe interval %q", value)
+		}
+		spec.Interval = interval
+	}
+	if value, ok := labels[ProbeLabelPrefix+"timeout"]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid probe timeout %q", value)
+		}
+		spec.Timeout = timeout
+	}
+	spec.GRPCService = labels[ProbeLabelPrefix+"grpc.service"]
+	spec.ExpectBody = labels[ProbeLabelPrefix+"expect.body"]
+	spec.ExpectStatus = labels[ProbeLabelPrefix+"expect.status"]
+	if spec.ExpectStatus != "" {
+		if _, err := statusMatches(spec.ExpectStatus, http.StatusOK); err != nil {
+			return nil, err
+		}
+	}
+
+	if !validPort(spec.Port) {
+		return nil, fmt.Errorf("%s probe has no port: set %sport or expose one", spec.Type, ProbeLabelPrefix)
+	}
+	return spec, nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// key identifies a probe and its target, so a probe is restarted when either changes
+func (p *ProbeSpec) key(host string) string {
+	return fmt.Sprintf("%+v@%s", *p, host)
+}
+
+// Run probes the service at host once
+func (p *ProbeSpec) Run(ctx context.Context, host string) ProbeResult {
+	target := net.JoinHostPort(host, strconv.Itoa(p.Port))
+	result := ProbeResult{Type: p.Type, Target: target}
+
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	switch p.Type {
+	case ProbeHTTP:
+		result.Target = "http://" + target + p.Path
+		err = p.probeHTTP(ctx, result.Target)
+	case ProbeTCP:
+		err = probeTCP(ctx, target)
+	case ProbeGRPC:
+		err = probeGRPC(ctx, target, p.GRPCService)
+	case ProbeRedis:
+		err = probeRedis(ctx, target)
+	default:
+		err = fmt.Errorf("unknown probe type %s", p.Type)
+	}
+	result.Latency = time.Since(start)
+	result.CheckedAt = time.Now()
+	result.Healthy = err == nil
+	if err != nil {
+		result.Message = err.Error()
+	}
+	return result
+}
+
+// probeHTTP requires an expected status and, when configured, body substring
+func (p *ProbeSpec) probeHTTP(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create probe request: %w", err)
+	}
+	req.Header.Set("User-Agent", "constellation-probe")
+
+	client := &http.Client{
+		// Redirects are judged by their own status
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 400
+	if p.ExpectStatus != "" {
+		ok, _ = statusMatches(p.ExpectStatus, resp.StatusCode)
+	}
+	if !ok {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if p.ExpectBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		if !bytes.Contains(body, []byte(p.ExpectBody)) {
+			return fmt.Errorf("response does not contain %q", p.ExpectBody)
+		}
+	}
+	return nil
+}
+
+// statusMatches checks a status code against a list such as "200,204" or "2xx,301"
+func statusMatches(expected string, status int) (bool, error) {
+	code := strconv.Itoa(status)
+	matched := false
+	for _, pattern := range strings.Split(expected, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if len(pattern) != 3 {
+			return false, fmt.Errorf("invalid expected status %q", pattern)
+		}
+		if strings.HasSuffix(pattern, "xx") {
+			if pattern[0] < '1' || pattern[0] > '5' {
+				return false, fmt.Errorf("invalid expected status %q", pattern)
+			}
+			matched = matched || code[0] == pattern[0]
+			continue
+		}
+		if _, err := strconv.Atoi(pattern); err != nil {
+			return false, fmt.Errorf("invalid expected status %q", pattern)
+		}
+		matched = matched || code == pattern
+	}
+	return matched, nil
+}
+
+func probeTCP(ctx context.Context, target string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func probeRedis(ctx context.Context, target string) error {
+	client := redis.NewClient(&redis.Options{Addr: target, MaxRetries: -1})
+	defer client.Close()
+
+	pong, err := client.Ping(ctx).Result()
+	if err != nil {
+		return fmt.Errorf("PING failed: %w", err)
+	}
+	if pong != "PONG" {
+		return fmt.Errorf("unexpected PING reply %q", pong)
+	}
+	return nil
+}
+
+// probeGRPC calls the standard grpc.health.v1.Health/Check method over cleartext HTTP/2
+func probeGRPC(ctx context.Context, target, service string) error {
+	// HealthCheckRequest{service = 1}, in a gRPC length-prefixed message
+	var request []byte
+	if service != "" {
+		request = append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(service)))...)
+		request = append(request, service...)
+	}
+	frame := make([]byte, 5, 5+len(request))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(request)))
+	frame = append(frame, request...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+target+"/grpc.health.v1.Health/Check", bytes.NewReader(frame))
+	if err != nil {
+		return fmt.Errorf("failed to create probe request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	transport := &http.Transport{Protocols: protocols}
+	defer transport.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Errors come as trailers, or as headers in trailers-only responses
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+	}
+	if grpcStatus != "" && grpcStatus != "0" {
+		return fmt.Errorf("health check failed: grpc status %s %s", grpcStatus, resp.Trailer.Get("Grpc-Message"))
+	}
+
+	status, err := parseHealthCheckResponse(body)
+	if err != nil {
+		return err
+	}
+	if status != grpcServing {
+		return fmt.Errorf("service is not serving (status %d)", status)
+	}
+	return nil
+}
+
+// grpcServing is HealthCheckResponse.ServingStatus SERVING
+const grpcServing = 1
+
+// parseHealthCheckResponse reads the status of a length-prefixed HealthCheckResponse
+func parseHealthCheckResponse(body []byte) (uint64, error) {
+	if len(body) < 5 {
+		return 0, fmt.Errorf("short health check response")
+	}
+	message := body[5:]
+	length := int(binary.BigEndian.Uint32(body[1:5]))
+	if length > len(message) {
+		return 0, fmt.Errorf("truncated health check response")
+	}
+	message = message[:length]
+
+	// An empty message is status UNKNOWN (0)
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, fmt.Errorf("malformed health check response")
+		}
+		message = message[n:]
+		if tag&7 != 0 {
+			return 0, fmt.Errorf("unexpected field in health check response")
+		}
+		value, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, fmt.Errorf("malformed health check response")
+		}
+		message = message[n:]
+		if tag>>3 == 1 {
+			return value, nil
+		}
+	}
+	return 0, nil
+}
+
+// probeHost returns the address probes reach a container at: its IP on the first of its
+// networks (by name), or loopback for containers on the host network
+func probeHost(containerJSON types.ContainerJSON) string {
+	if containerJSON.HostConfig != nil && containerJSON.HostConfig.NetworkMode.IsHost() {
+		return "127.0.0.1"
+	}
+	if containerJSON.NetworkSettings == nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(containerJSON.NetworkSettings.Networks))
+	for name := range containerJSON.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if endpoint := containerJSON.NetworkSettings.Networks[name]; endpoint != nil && endpoint.IPAddress != "" {
+			return endpoint.IPAddress
+		}
+	}
+	return containerJSON.NetworkSettings.IPAddress
+}
+
+// defaultProbePort returns the lowest TCP port a container exposes, or 0
+func defaultProbePort(containerJSON types.ContainerJSON) int {
+	if containerJSON.Config == nil {
+		return 0
+	}
+	lowest := 0
+	for port := range containerJSON.Config.ExposedPorts {
+		if port.Proto() != "tcp" {
+			continue
+		}
+		if n := port.Int(); n > 0 && (lowest == 0 || n < lowest) {
+			lowest = n
+		}
+	}
+	return lowest
+}
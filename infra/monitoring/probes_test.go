@@ -0,0 +1,144 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProbeSpec(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		defaultPort int
+		want        *ProbeSpec
+		wantErr     string
+	}{
+		{name: "no probe", labels: map[string]string{"constellation.health.rise": "1"}, defaultPort: 80},
+		{
+			name:        "http on the exposed port",
+			labels:      map[string]string{"constellation.probe.http": "healthz"},
+			defaultPort: 8080,
+			want:        &ProbeSpec{Type: ProbeHTTP, Port: 8080, Path: "/healthz", Interval: defaultProbeInterval, Timeout: defaultProbeTimeout},
+		},
+		{
+			name: "http with every option",
+			labels: map[string]string{
+				"constellation.probe.http":          "/ready",
+				"constellation.probe.port":          "9000",
+				"constellation.probe.interval":      "30s",
+				"constellation.probe.timeout":       "500ms",
+				"constellation.probe.expect.status": "2xx, 301",
+				"constellation.probe.expect.body":   "ok",
+			},
+			defaultPort: 8080,
+			want: &ProbeSpec{
+				Type: ProbeHTTP, Port: 9000, Path: "/ready", Interval: 30 * time.Second, Timeout: 500 * time.Millisecond,
+				ExpectStatus: "2xx, 301", ExpectBody: "ok",
+			},
+		},
+		{
+			name:        "the type label's port wins over the port label",
+			labels:      map[string]string{"constellation.probe.redis": "6380", "constellation.probe.port": "6379"},
+			defaultPort: 6379,
+			want:        &ProbeSpec{Type: ProbeRedis, Port: 6380, Interval: defaultProbeInterval, Timeout: defaultProbeTimeout},
+		},
+		{
+			name:   "grpc service",
+			labels: map[string]string{"constellation.probe.grpc": "true", "constellation.probe.port": "50051", "constellation.probe.grpc.service": "api.v1"},
+			want:   &ProbeSpec{Type: ProbeGRPC, Port: 50051, GRPCService: "api.v1", Interval: defaultProbeInterval, Timeout: defaultProbeTimeout},
+		},
+		{
+			name:    "two probe types",
+			labels:  map[string]string{"constellation.probe.http": "/", "constellation.probe.tcp": "80"},
+			wantErr: "both http and tcp probes declared",
+		},
+		{
+			name:    "type port not a number",
+			labels:  map[string]string{"constellation.probe.tcp": "redis"},
+			wantErr: `invalid tcp probe port "redis"`,
+		},
+		{
+			name:    "type port out of range",
+			labels:  map[string]string{"constellation.probe.tcp": "70000"},
+			wantErr: `invalid tcp probe port "70000"`,
+		},
+		{
+			name:        "port label not a number",
+			labels:      map[string]string{"constellation.probe.http": "/", "constellation.probe.port": "http"},
+			defaultPort: 80,
+			wantErr:     `invalid probe port "http"`,
+		},
+		{
+			name:        "port label out of range",
+			labels:      map[string]string{"constellation.probe.http": "/", "constellation.probe.port": "0"},
+			defaultPort: 80,
+			wantErr:     `invalid probe port "0"`,
+		},
+		{
+			name:    "no port anywhere",
+			labels:  map[string]string{"constellation.probe.redis": "true"},
+			wantErr: "redis probe has no port",
+		},
+		{
+			name:        "bad interval",
+			labels:      map[string]string{"constellation.probe.tcp": "80", "constellation.probe.interval": "often"},
+			defaultPort: 80,
+			wantErr:     `invalid probe interval "often"`,
+		},
+		{
+			name:        "negative timeout",
+			labels:      map[string]string{"constellation.probe.tcp": "80", "constellation.probe.timeout": "-1s"},
+			defaultPort: 80,
+			wantErr:     `invalid probe timeout "-1s"`,
+		},
+		{
+			name:        "bad status class",
+			labels:      map[string]string{"constellation.probe.http": "/", "constellation.probe.expect.status": "6xx"},
+			defaultPort: 80,
+			wantErr:     `invalid expected status "6xx"`,
+		},
+		{
+			name:        "bad status code",
+			labels:      map[string]string{"constellation.probe.http": "/", "constellation.probe.expect.status": "200,ok"},
+			defaultPort: 80,
+			wantErr:     `invalid expected status "ok"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := ParseProbeSpec(tt.labels, tt.defaultPort)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Nil(t, spec)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, spec)
+		})
+	}
+}
+
+func TestStatusMatches(t *testing.T) {
+	tests := []struct {
+		expected string
+		status   int
+		want     bool
+	}{
+		{"200", 200, true},
+		{"200", 204, false},
+		{"2xx", 204, true},
+		{"2XX,3xx", 302, true},
+		{"2xx, 404", 404, true},
+		{"2xx", 500, false},
+	}
+	for _, tt := range tests {
+		matched, err := statusMatches(tt.expected, tt.status)
+		require.NoError(t, err, tt.expected)
+		assert.Equal(t, tt.want, matched, "%s against %d", tt.expected, tt.status)
+	}
+}
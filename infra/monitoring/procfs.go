@@ -0,0 +1,265 @@
+package monitoring
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sectorSize is the unit of the sector counters in /proc/diskstats
+const sectorSize = 512
+
+// cpuTimes holds the aggregate counters of the "cpu" line of /proc/stat, in clock ticks
+type cpuTimes struct {
+	idle  uint64 // idle + iowait
+	total uint64
+}
+
+// parseProcStat reads the aggregate CPU counters from /proc/stat
+func parseProcStat(data []byte) (cpuTimes, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var times cpuTimes
+		// user nice system idle iowait irq softirq steal guest guest_nice;
+		// guest time is already included in user and nice
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return cpuTimes{}, fmt.Errorf("failed to parse /proc/stat: %w", err)
+			}
+			times.total += value
+			if i == 3 || i == 4 {
+				times.idle += value
+			}
+		}
+		return times, nil
+	}
+	return cpuTimes{}, fmt.Errorf("no cpu line in /proc/stat")
+}
+
+// cpuPercent returns the busy share of CPU time between two samples
+func cpuPercent(previous, current cpuTimes) float64 {
+	if current.total <= previous.total || current.idle < previous.idle {
+		return 0
+	}
+	total := float64(current.total - previous.total)
+	idle := float64(current.idle - previous.idle)
+	if idle > total {
+		return 0
+	}
+	return (total - idle) / total * 100.0
+}
+
+// parseMeminfo returns total and used memory in bytes from /proc/meminfo.
+// Used memory excludes reclaimable caches (MemTotal - MemAvailable).
+func parseMeminfo(data []byte) (total, used int64, err error) {
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			value *= 1024
+		}
+		values[key] = value
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok || total == 0 {
+		return 0, 0, fmt.Errorf("MemTotal missing from /proc/meminfo")
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14 do not report MemAvailable
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	used = total - available
+	if used < 0 {
+		used = 0
+	}
+	return total, used, nil
+}
+
+// parseLoadavg returns the 1, 5 and 15 minute load averages from /proc/loadavg
+func parseLoadavg(data []byte) (load1, load5, load15 float64, err error) {
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("unexpected /proc/loadavg format")
+	}
+	values := make([]float64, 3)
+	for i := range values {
+		if values[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to parse load average: %w", err)
+		}
+	}
+	return values[0], values[1], values[2], nil
+}
+
+// diskCounters are the cumulative counters of one block device
+type diskCounters struct {
+	readBytes  uint64
+	writeBytes uint64
+	ioTimeMS   uint64 // Milliseconds spent doing I/O
+}
+
+// parseDiskstats returns the counters of the devices accepted by include from /proc/diskstats
+func parseDiskstats(data []byte, include func(name string) bool) map[string]diskCounters {
+	disks := make(map[string]diskCounters)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// major minor name reads merged sectors_read ms_reading writes merged sectors_written ms_writing in_flight ms_io weighted_ms ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 || !include(fields[2]) {
+			continue
+		}
+		sectorsRead, err1 := strconv.ParseUint(fields[5], 10, 64)
+		sectorsWritten, err2 := strconv.ParseUint(fields[9], 10, 64)
+		ioTime, err3 := strconv.ParseUint(fields[12], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		disks[fields[2]] = diskCounters{
+			readBytes:  sectorsRead * sectorSize,
+			writeBytes: sectorsWritten * sectorSize,
+			ioTimeMS:   ioTime,
+		}
+	}
+	return disks
+}
+
+// wholeDiskFilter returns a filter accepting whole disks (not partitions or virtual
+// loop and ram devices), using /sys/block when available
+func wholeDiskFilter(sysRoot string) func(name string) bool {
+	entries, err := os.ReadDir(filepath.Join(sysRoot, "block"))
+	if err != nil {
+		return func(name string) bool {
+			return !strings.HasPrefix(name, "loop") && !strings.HasPrefix(name, "ram")
+		}
+	}
+
+	disks := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+		disks[name] = true
+	}
+	return func(name string) bool {
+		return disks[name]
+	}
+}
+
+// netCounters are cumulative byte counters of all non-loopback interfaces
+type netCounters struct {
+	rx, tx uint64
+}
+
+// parseNetDev sums the byte counters of all non-loopback interfaces from /proc/net/dev
+func parseNetDev(data []byte) netCounters {
+	var counters netCounters
+	for _, line := range strings.Split(string(data), "\n") {
+		name, stats, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(stats)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			continue
+		}
+		counters.rx += rx
+		counters.tx += tx
+	}
+	return counters
+}
+
+// PressureStats is the share of time (percent, 10s average) in which some or all
+// tasks were stalled on a resource, from Linux pressure stall information (PSI)
+type PressureStats struct {
+	Some float64 `json:"some"`
+	Full float64 `json:"full"`
+}
+
+// parsePressure parses a PSI file (/proc/pressure/* or a cgroup's *.pressure)
+func parsePressure(data []byte) (PressureStats, error) {
+	var stats PressureStats
+	found := false
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			value, ok := strings.CutPrefix(field, "avg10=")
+			if !ok {
+				continue
+			}
+			avg, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return PressureStats{}, fmt.Errorf("failed to parse pressure: %w", err)
+			}
+			switch fields[0] {
+			case "some":
+				stats.Some = avg
+				found = true
+			case "full":
+				stats.Full = avg
+			}
+		}
+	}
+	if !found {
+		return PressureStats{}, fmt.Errorf("no pressure data")
+	}
+	return stats, nil
+}
+
+// readPressure reads a PSI file, returning zero values when PSI is unavailable
+func readPressure(path string) (PressureStats, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PressureStats{}, false
+	}
+	stats, err := parsePressure(data)
+	if err != nil {
+		return PressureStats{}, false
+	}
+	return stats, true
+}
+
+// bytesPerSecond returns the rate of a cumulative counter, or 0 when it went backwards
+func bytesPerSecond(previous, current uint64, seconds float64) float64 {
+	if seconds <= 0 || current < previous {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
@@ -0,0 +1,524 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// DefaultServiceResyncInterval is how often the service monitor lists all containers
+	// as a safety net for events it may have missed
+	DefaultServiceResyncInterval = 5 * time.Minute
+	// minEventsReconnectDelay is the first backoff between Docker events reconnects,
+	// doubled on every failure in a row
+	minEventsReconnectDelay = time.Second
+	// maxEventsReconnectDelay caps the backoff between Docker events reconnects
+	maxEventsReconnectDelay = 30 * time.Second
+)
+
+// routingLabelPrefixes select the container labels gossiped for cluster-wide routing:
+// Traefik's own, the middleware chain of the service's routers, its TCP or UDP port and
+// what its routers serve while it is down
+var routingLabelPrefixes = []string{"traefik.", "constellation.middlewares", "constellation.transport.", "constellation.fallback"}
+
+// ServiceDockerClient is the Docker API used by the service monitor
+type ServiceDockerClient interface {
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
+}
+
+// ServiceStatus is the observed state of a service container on this node
+type ServiceStatus struct {
+	ContainerID   string
+	Service       ServiceIdentity
+	Healthy       bool              // In rotation: Docker and the active probe, if any, pass, damped by HealthDamping
+	State         string            // One of the HealthState constants
+	HeldUntil     time.Time         // End of a flap hold, zero when not held
+	Running       bool              // Container is running, whatever its health
+	DockerHealthy bool              // Running, and passing its Docker healthcheck if it has one
+	DockerStatus  string            // Docker healthcheck status while running, otherwise the container state
+	Endpoints     map[string]string // port -> host binding
+	Networks      []string
+	Labels        map[string]string  // Routing labels, for the routers served cluster-wide
+	Probe         *ProbeResult       // Latest active probe result; nil without a probe or before its first run
+	Dependencies  []DependencyStatus // Declared dependencies and whether each is met on this node
+}
+
+// trackedContainer is a service container the monitor has reported
+type trackedContainer struct {
+	status       ServiceStatus
+	probeKey     string // Probe and target the running probe was started for
+	cancelProbe  context.CancelFunc
+	damper       healthDamper
+	dependencies []Dependency
+}
+
+// ServiceMonitor tracks the health of service containers from the Docker events stream,
+// so a crashed container is reported as soon as Docker sees it. A periodic full resync
+// catches anything the event stream missed. Containers declaring an active probe
+// (see ProbeSpec) are also probed while running.
+type ServiceMonitor struct {
+	dockerClient   ServiceDockerClient
+	resyncInterval time.Duration
+	onUpdate       func(status ServiceStatus)
+
+	minReconnectDelay time.Duration
+	maxReconnectDelay time.Duration
+
+	mu         sync.Mutex
+	containers map[string]*trackedContainer // container ID -> last reported state
+	lastEvent  time.Time                    // Time of the last event received, to replay missed events on reconnect
+}
+
+// NewServiceMonitor creates a service monitor that calls onUpdate whenever a service
+// container's state is observed
+func NewServiceMonitor(dockerClient ServiceDockerClient, onUpdate func(status ServiceStatus)) *ServiceMonitor {
+	return &ServiceMonitor{
+		dockerClient:   dockerClient,
+		resyncInterval: DefaultServiceResyncInterval,
+		onUpdate:       onUpdate,
+		containers:     make(map[string]*trackedContainer),
+
+		minReconnectDelay: minEventsReconnectDelay,
+		maxReconnectDelay: maxEventsReconnectDelay,
+	}
+}
+
+// SetResyncInterval sets how often all containers are listed regardless of events
+func (sm *ServiceMonitor) SetResyncInterval(interval time.Duration) {
+	if interval > 0 {
+		sm.resyncInterval = interval
+	}
+}
+
+// Start watches Docker events until ctx is cancelled. The event stream is reopened
+// with backoff when it fails, replaying events since the last one received, and all
+// containers are resynced after every reconnect.
+func (sm *ServiceMonitor) Start(ctx context.Context) {
+	sm.resync(ctx)
+
+	resync := time.NewTicker(sm.resyncInterval)
+	defer resync.Stop()
+
+	reconnectDelay := sm.minReconnectDelay
+	for {
+		streamCtx, cancelStream := context.WithCancel(ctx)
+		messages, errs := sm.dockerClient.Events(streamCtx, sm.eventsOptions())
+
+		err := sm.consume(ctx, messages, errs, resync.C, &reconnectDelay)
+		cancelStream()
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("service monitor: Docker events stream failed: %v (reconnecting in %s)", err, reconnectDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+		reconnectDelay = min(reconnectDelay*2, sm.maxReconnectDelay)
+
+		// Events older than the daemon's buffer are lost, so reconcile everything
+		sm.resync(ctx)
+	}
+}
+
+// consume handles events until the stream fails, resyncing on every resync tick
+func (sm *ServiceMonitor) consume(ctx context.Context, messages <-chan events.Message, errs <-chan error, resync <-chan time.Time, reconnectDelay *time.Duration) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resync:
+			sm.resync(ctx)
+		case err, ok := <-errs:
+			if !ok || err == nil {
+				return fmt.Errorf("stream closed")
+			}
+			return err
+		case message, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("stream closed")
+			}
+			*reconnectDelay = sm.minReconnectDelay
+			if message.TimeNano > 0 {
+				sm.lastEvent = time.Unix(0, message.TimeNano)
+			}
+			sm.handleEvent(ctx, message)
+		}
+	}
+}
+
+// eventsOptions subscribes to the container lifecycle, health and network attachment
+// events that change a service's state
+func (sm *ServiceMonitor) eventsOptions() types.EventsOptions {
+	options := types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", events.ContainerEventType),
+			filters.Arg("type", events.NetworkEventType),
+			filters.Arg("event", "start"),
+			filters.Arg("event", "die"),
+			filters.Arg("event", "health_status"),
+			filters.Arg("event", "destroy"),
+			filters.Arg("event", "rename"),
+			filters.Arg("event", "connect"),
+			filters.Arg("event", "disconnect"),
+		),
+	}
+	if !sm.lastEvent.IsZero() {
+		options.Since = fmt.Sprintf("%d.%09d", sm.lastEvent.Unix(), sm.lastEvent.Nanosecond())
+	}
+	return options
+}
+
+// handleEvent re-inspects the container an event refers to and reports its state
+func (sm *ServiceMonitor) handleEvent(ctx context.Context, message events.Message) {
+	containerID := message.Actor.ID
+	if message.Type == events.NetworkEventType {
+		// Network events are about the network; the container is an attribute
+		containerID = message.Actor.Attributes["container"]
+	}
+	if containerID == "" {
+		return
+	}
+
+	if message.Action == "destroy" {
+		sm.forget(containerID)
+		return
+	}
+	sm.inspect(ctx, containerID)
+}
+
+// resync reports every service container and forgets containers that no longer exist
+func (sm *ServiceMonitor) resync(ctx context.Context) {
+	containers, err := sm.dockerClient.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		log.Printf("service monitor: failed to list containers for health check: %v", err)
+		return
+	}
+
+	present := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		present[container.ID] = true
+		if len(container.Names) == 0 {
+			continue
+		}
+		if _, ok := ResolveServiceIdentity(container.Names[0], container.Labels); !ok {
+			continue
+		}
+		sm.inspect(ctx, container.ID)
+	}
+
+	sm.mu.Lock()
+	gone := make([]string, 0)
+	for containerID := range sm.containers {
+		if !present[containerID] {
+			gone = append(gone, containerID)
+		}
+	}
+	sm.mu.Unlock()
+	for _, containerID := range gone {
+		sm.forget(containerID)
+	}
+}
+
+// inspect reports the current state of a container
+func (sm *ServiceMonitor) inspect(ctx context.Context, containerID string) {
+	containerJSON, err := sm.dockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			sm.forget(containerID)
+			return
+		}
+		log.Printf("service monitor: failed to inspect container %s: %v", shortContainerID(containerID), err)
+		return
+	}
+	if containerJSON.ContainerJSONBase == nil {
+		return
+	}
+
+	var labels map[string]string
+	if containerJSON.Config != nil {
+		labels = containerJSON.Config.Labels
+	}
+	identity, ok := ResolveServiceIdentity(containerJSON.Name, labels)
+	if !ok {
+		sm.forget(containerID)
+		return
+	}
+	status := serviceStatusFromInspect(containerJSON)
+	status.Service = identity
+
+	// Only running containers are probed
+	probeKey := ""
+	var probe *ProbeSpec
+	host := probeHost(containerJSON)
+	if containerJSON.State != nil && containerJSON.State.Running && containerJSON.Config != nil && host != "" {
+		spec, err := ParseProbeSpec(containerJSON.Config.Labels, defaultProbePort(containerJSON))
+		if err != nil {
+			log.Printf("service monitor: ignoring invalid probe of %s: %v", identity.Key(), err)
+		} else if spec != nil {
+			probe = spec
+			probeKey = spec.key(host)
+		}
+	}
+
+	damping := DefaultHealthDamping()
+	if containerJSON.Config != nil {
+		if damping, err = ParseHealthDamping(containerJSON.Config.Labels); err != nil {
+			log.Printf("service monitor: using default health damping for %s: %v", identity.Key(), err)
+		}
+	}
+	dependencies, err := ParseDependencies(labels)
+	if err != nil {
+		log.Printf("service monitor: ignoring dependencies of %s: %v", identity.Key(), err)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	tracked, exists := sm.containers[containerID]
+	if exists && tracked.status.Service != identity {
+		// Renamed; the old identity is gone
+		sm.forgetLocked(containerID)
+		exists = false
+	}
+	if !exists {
+		tracked = &trackedContainer{}
+		sm.containers[containerID] = tracked
+	}
+	if probeKey != tracked.probeKey {
+		if tracked.cancelProbe != nil {
+			tracked.cancelProbe()
+			tracked.cancelProbe = nil
+		}
+		tracked.probeKey = probeKey
+		tracked.status.Probe = nil
+		if probe != nil {
+			probeCtx, cancel := context.WithCancel(ctx)
+			tracked.cancelProbe = cancel
+			go sm.runProbe(probeCtx, containerID, probeKey, probe, host)
+		}
+	}
+
+	status.Probe = tracked.status.Probe
+	status.HeldUntil = tracked.status.HeldUntil
+	status.Dependencies = tracked.status.Dependencies
+	tracked.damper.config = damping
+	tracked.dependencies = dependencies
+
+	// Docker's verdict is a sample of its own only when it is down or there is no probe
+	// to count; otherwise the probe results are the samples
+	now := time.Now()
+	switch {
+	case !status.DockerHealthy || probe == nil:
+		tracked.damper.observe(now, status.DockerHealthy, true)
+	case !tracked.damper.initialized:
+		tracked.damper.observe(now, true, true)
+	}
+	tracked.status = status
+	sm.applyDamping(containerID, tracked, now)
+	sm.publish(containerID)
+}
+
+// runProbe probes a container at its interval until ctx is cancelled
+func (sm *ServiceMonitor) runProbe(ctx context.Context, containerID, probeKey string, probe *ProbeSpec, host string) {
+	ticker := time.NewTicker(probe.Interval)
+	defer ticker.Stop()
+
+	for {
+		result := probe.Run(ctx, host)
+		if ctx.Err() != nil {
+			return
+		}
+		sm.updateProbe(containerID, probeKey, result)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateProbe records a probe result, reporting the service when the probe's verdict changes
+func (sm *ServiceMonitor) updateProbe(containerID, probeKey string, result ProbeResult) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	tracked, ok := sm.containers[containerID]
+	if !ok || tracked.probeKey != probeKey {
+		return
+	}
+	previous := tracked.status
+	tracked.status.Probe = &result
+	now := time.Now()
+	if tracked.status.DockerHealthy {
+		tracked.damper.observe(now, result.Healthy, false)
+	}
+	sm.applyDamping(containerID, tracked, now)
+
+	probeChanged := previous.Probe == nil || previous.Probe.Healthy != result.Healthy
+	if !probeChanged && previous.State == tracked.status.State && previous.Healthy == tracked.status.Healthy {
+		return
+	}
+	if probeChanged && !result.Healthy {
+		log.Printf("service monitor: %s probe of %s failed: %s", result.Type, tracked.status.Service.Key(), result.Message)
+	}
+	sm.publish(containerID)
+}
+
+// applyDamping sets a container's reported health from its damper, and re-evaluates it
+// when a flap hold that just started expires
+func (sm *ServiceMonitor) applyDamping(containerID string, tracked *trackedContainer, now time.Time) {
+	previousHold := tracked.status.HeldUntil
+
+	tracked.status.State, tracked.status.Healthy = tracked.damper.state(now)
+	tracked.status.HeldUntil = time.Time{}
+	if !tracked.damper.held(now) {
+		return
+	}
+	tracked.status.HeldUntil = tracked.damper.heldUntil
+	if tracked.damper.heldUntil.Equal(previousHold) {
+		return
+	}
+
+	log.Printf("service monitor: %s is flapping, holding it out of rotation until %s",
+		tracked.status.Service.Key(), tracked.damper.heldUntil.Format(time.RFC3339))
+	time.AfterFunc(tracked.damper.heldUntil.Sub(now), func() {
+		sm.releaseHold(containerID)
+	})
+}
+
+// releaseHold reports a container again once its flap hold has expired
+func (sm *ServiceMonitor) releaseHold(containerID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	tracked, ok := sm.containers[containerID]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if tracked.damper.held(now) {
+		// Held again since; the new hold has its own release
+		return
+	}
+	sm.applyDamping(containerID, tracked, now)
+	sm.publish(containerID)
+}
+
+// forget reports a removed container's service instance as unhealthy, unless another
+// container with the same identity is still tracked
+func (sm *ServiceMonitor) forget(containerID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.forgetLocked(containerID)
+}
+
+func (sm *ServiceMonitor) forgetLocked(containerID string) {
+	tracked, ok := sm.containers[containerID]
+	if !ok {
+		return
+	}
+	if tracked.cancelProbe != nil {
+		tracked.cancelProbe()
+	}
+	delete(sm.containers, containerID)
+
+	identity := tracked.status.Service
+	replaced := false
+	for _, other := range sm.containers {
+		if other.status.Service == identity {
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		sm.report(ServiceStatus{ContainerID: containerID, Service: identity, State: HealthStateUnhealthy, DockerStatus: "removed"})
+	}
+	// Its dependents may have lost a dependency
+	sm.publish("")
+}
+
+// publish reports a container, if given, followed by every container whose dependencies
+// changed as a result. The caller holds sm.mu.
+func (sm *ServiceMonitor) publish(containerID string) {
+	changed := sm.evaluateDependencies()
+	if tracked, ok := sm.containers[containerID]; ok {
+		sm.report(tracked.status)
+	}
+	for id := range changed {
+		if id == containerID {
+			continue
+		}
+		sm.report(sm.containers[id].status)
+	}
+}
+
+func (sm *ServiceMonitor) report(status ServiceStatus) {
+	if sm.onUpdate != nil {
+		sm.onUpdate(status)
+	}
+}
+
+// serviceStatusFromInspect derives health, published endpoints and networks from inspect output
+func serviceStatusFromInspect(containerJSON types.ContainerJSON) ServiceStatus {
+	status := ServiceStatus{
+		ContainerID: containerJSON.ID,
+		Endpoints:   make(map[string]string),
+	}
+
+	if containerJSON.State != nil {
+		status.Running = containerJSON.State.Running
+		status.DockerHealthy = containerJSON.State.Running
+		status.DockerStatus = containerJSON.State.Status
+		if containerJSON.State.Running && containerJSON.State.Health != nil {
+			status.DockerHealthy = containerJSON.State.Health.Status == types.Healthy
+			status.DockerStatus = containerJSON.State.Health.Status
+		}
+	}
+	status.Healthy = status.DockerHealthy
+
+	if containerJSON.NetworkSettings != nil {
+		for port, bindings := range containerJSON.NetworkSettings.Ports {
+			if len(bindings) > 0 {
+				status.Endpoints[string(port)] = bindings[0].HostIP + ":" + bindings[0].HostPort
+			}
+		}
+		status.Networks = make([]string, 0, len(containerJSON.NetworkSettings.Networks))
+		for netName := range containerJSON.NetworkSettings.Networks {
+			status.Networks = append(status.Networks, netName)
+		}
+		// Map order is random, and a reordering must not look like a routing change
+		sort.Strings(status.Networks)
+	}
+
+	if containerJSON.Config != nil {
+		for key, value := range containerJSON.Config.Labels {
+			for _, prefix := range routingLabelPrefixes {
+				if !strings.HasPrefix(key, prefix) {
+					continue
+				}
+				if status.Labels == nil {
+					status.Labels = make(map[string]string)
+				}
+				status.Labels[key] = value
+			}
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,307 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEventsClient is a Docker client whose containers and event streams the test controls
+type fakeEventsClient struct {
+	mu         sync.Mutex
+	containers map[string]types.ContainerJSON
+	listCalls  int
+
+	streams chan *fakeEventStream // Every Events call, in order
+}
+
+// fakeEventStream is one Events subscription
+type fakeEventStream struct {
+	options  types.EventsOptions
+	openedAt time.Time
+	messages chan events.Message
+	errs     chan error
+}
+
+func newFakeEventsClient() *fakeEventsClient {
+	return &fakeEventsClient{
+		containers: make(map[string]types.ContainerJSON),
+		streams:    make(chan *fakeEventStream, 16),
+	}
+}
+
+func (f *fakeEventsClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.listCalls++
+	containers := make([]types.Container, 0, len(f.containers))
+	for id, containerJSON := range f.containers {
+		containers = append(containers, types.Container{
+			ID:     id,
+			Names:  []string{containerJSON.Name},
+			Labels: containerJSON.Config.Labels,
+		})
+	}
+	return containers, nil
+}
+
+func (f *fakeEventsClient) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	containerJSON, ok := f.containers[containerID]
+	if !ok {
+		return types.ContainerJSON{}, errdefs.NotFound(fmt.Errorf("no such container: %s", containerID))
+	}
+	return containerJSON, nil
+}
+
+func (f *fakeEventsClient) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	stream := &fakeEventStream{
+		options:  options,
+		openedAt: time.Now(),
+		messages: make(chan events.Message),
+		errs:     make(chan error, 1),
+	}
+	f.streams <- stream
+	return stream.messages, stream.errs
+}
+
+// setContainer adds or replaces a running or stopped service container
+func (f *fakeEventsClient) setContainer(id, name string, running bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := "exited"
+	if running {
+		status = "running"
+	}
+	f.containers[id] = types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    id,
+			Name:  "/" + name,
+			State: &types.ContainerState{Running: running, Status: status},
+		},
+		Config:          &container.Config{Labels: map[string]string{}},
+		NetworkSettings: &types.NetworkSettings{},
+	}
+}
+
+func (f *fakeEventsClient) removeContainer(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.containers, id)
+}
+
+func (f *fakeEventsClient) lists() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.listCalls
+}
+
+// nextStream waits for the monitor to open an event stream
+func (f *fakeEventsClient) nextStream(t *testing.T) *fakeEventStream {
+	t.Helper()
+	select {
+	case stream := <-f.streams:
+		return stream
+	case <-time.After(5 * time.Second):
+		t.Fatal("the monitor did not open an event stream")
+		return nil
+	}
+}
+
+// startTestMonitor runs a service monitor against the fake client until the test ends
+func startTestMonitor(t *testing.T, dockerClient *fakeEventsClient, configure func(sm *ServiceMonitor)) <-chan ServiceStatus {
+	updates := make(chan ServiceStatus, 64)
+	sm := NewServiceMonitor(dockerClient, func(status ServiceStatus) {
+		updates <- status
+	})
+	sm.minReconnectDelay = 10 * time.Millisecond
+	sm.maxReconnectDelay = 10 * time.Millisecond
+	if configure != nil {
+		configure(sm)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sm.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return updates
+}
+
+// awaitStatus waits for a report matching match, skipping others
+func awaitStatus(t *testing.T, updates <-chan ServiceStatus, match func(ServiceStatus) bool) ServiceStatus {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case status := <-updates:
+			if match(status) {
+				return status
+			}
+		case <-timeout:
+			t.Fatal("no matching service status was reported")
+			return ServiceStatus{}
+		}
+	}
+}
+
+func TestServiceMonitor_ReconnectsWithBackoff(t *testing.T) {
+	dockerClient := newFakeEventsClient()
+	startTestMonitor(t, dockerClient, func(sm *ServiceMonitor) {
+		sm.minReconnectDelay = 50 * time.Millisecond
+		sm.maxReconnectDelay = 150 * time.Millisecond
+	})
+
+	// Each failure in a row doubles the delay, up to the cap
+	previous := dockerClient.nextStream(t)
+	for _, delay := range []time.Duration{50, 100, 150, 150} {
+		previous.errs <- errors.New("connection reset")
+		stream := dockerClient.nextStream(t)
+		assert.GreaterOrEqual(t, stream.openedAt.Sub(previous.openedAt), delay*time.Millisecond)
+		previous = stream
+	}
+
+	// An event resets the backoff
+	previous.messages <- events.Message{Type: events.ContainerEventType, Action: "start", Actor: events.Actor{ID: "unknown"}}
+	previous.errs <- errors.New("connection reset")
+	stream := dockerClient.nextStream(t)
+	assert.Less(t, stream.openedAt.Sub(previous.openedAt), 150*time.Millisecond)
+
+	// A closed stream counts as a failure too
+	close(stream.messages)
+	dockerClient.nextStream(t)
+
+	// The initial resync, then one after every reconnect
+	assert.Eventually(t, func() bool { return dockerClient.lists() == 7 }, time.Second, 5*time.Millisecond)
+}
+
+func TestServiceMonitor_ReplaysSinceLastEvent(t *testing.T) {
+	dockerClient := newFakeEventsClient()
+	dockerClient.setContainer("c1", "web", true)
+	updates := startTestMonitor(t, dockerClient, nil)
+
+	first := dockerClient.nextStream(t)
+	assert.Empty(t, first.options.Since)
+	awaitStatus(t, updates, func(status ServiceStatus) bool { return status.Service.Name == "web" })
+
+	// The container dies and the event is delivered
+	dockerClient.setContainer("c1", "web", false)
+	eventTime := time.Unix(1700000000, 123456789)
+	first.messages <- events.Message{
+		Type:     events.ContainerEventType,
+		Action:   "die",
+		Actor:    events.Actor{ID: "c1"},
+		TimeNano: eventTime.UnixNano(),
+	}
+	status := awaitStatus(t, updates, func(status ServiceStatus) bool { return status.Service.Name == "web" })
+	assert.False(t, status.Running)
+	assert.False(t, status.Healthy)
+
+	// The reconnect asks for the events since the last one received
+	first.errs <- errors.New("connection reset")
+	second := dockerClient.nextStream(t)
+	require.Equal(t, "1700000000.123456789", second.options.Since)
+	assert.True(t, second.options.Filters.ExactMatch("type", events.ContainerEventType))
+
+	// Replayed events are handled like live ones
+	dockerClient.setContainer("c1", "web", true)
+	second.messages <- events.Message{
+		Type:     events.ContainerEventType,
+		Action:   "start",
+		Actor:    events.Actor{ID: "c1"},
+		TimeNano: eventTime.Add(time.Second).UnixNano(),
+	}
+	status = awaitStatus(t, updates, func(status ServiceStatus) bool { return status.Service.Name == "web" && status.Running })
+	assert.True(t, status.Healthy)
+}
+
+func TestServiceMonitor_ResyncsMissedContainers(t *testing.T) {
+	t.Run("after a reconnect", func(t *testing.T) {
+		dockerClient := newFakeEventsClient()
+		dockerClient.setContainer("c1", "web", true)
+		updates := startTestMonitor(t, dockerClient, nil)
+
+		stream := dockerClient.nextStream(t)
+		awaitStatus(t, updates, func(status ServiceStatus) bool { return status.Service.Name == "web" })
+
+		// While the stream is down, one container starts and another is removed
+		dockerClient.setContainer("c2", "api", true)
+		dockerClient.removeContainer("c1")
+		stream.errs <- errors.New("connection reset")
+		dockerClient.nextStream(t)
+
+		status := awaitStatus(t, updates, func(status ServiceStatus) bool { return status.Service.Name == "api" })
+		assert.True(t, status.Healthy)
+		status = awaitStatus(t, updates, func(status ServiceStatus) bool { return status.Service.Name == "web" })
+		assert.Equal(t, "removed", status.DockerStatus)
+		assert.False(t, status.Healthy)
+	})
+
+	t.Run("on the resync interval", func(t *testing.T) {
+		dockerClient := newFakeEventsClient()
+		updates := startTestMonitor(t, dockerClient, func(sm *ServiceMonitor) {
+			sm.SetResyncInterval(20 * time.Millisecond)
+		})
+		dockerClient.nextStream(t)
+
+		// No event is ever delivered for it
+		dockerClient.setContainer("c1", "web", true)
+		status := awaitStatus(t, updates, func(status ServiceStatus) bool { return status.Service.Name == "web" })
+		assert.Equal(t, "c1", status.ContainerID)
+		assert.True(t, status.Running)
+	})
+
+	t.Run("infrastructure containers are skipped", func(t *testing.T) {
+		dockerClient := newFakeEventsClient()
+		dockerClient.setContainer("c1", "traefik", true)
+		dockerClient.setContainer("c2", "web", true)
+		updates := startTestMonitor(t, dockerClient, nil)
+
+		status := awaitStatus(t, updates, func(ServiceStatus) bool { return true })
+		assert.Equal(t, "web", status.Service.Name)
+	})
+}
+
+func TestServiceStatusFromInspect_SortsNetworks(t *testing.T) {
+	containerJSON := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "c1",
+			Name:  "/web",
+			State: &types.ContainerState{Running: true, Status: "running"},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"monitoring": {},
+				"backend":    {},
+				"frontend":   {},
+				"bridge":     {},
+			},
+		},
+	}
+
+	// Map iteration order differs between calls, the reported order must not
+	for i := 0; i < 20; i++ {
+		status := serviceStatusFromInspect(containerJSON)
+		assert.Equal(t, []string{"backend", "bridge", "frontend", "monitoring"}, status.Networks)
+	}
+}
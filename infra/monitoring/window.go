@@ -0,0 +1,75 @@
+package monitoring
+
+import (
+	"sync"
+	"time"
+)
+
+// Sample is a set of metric values taken at one point in time
+type Sample struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// SampleWindow keeps the samples of a rolling time window, oldest first
+type SampleWindow struct {
+	mu        sync.Mutex
+	retention time.Duration
+	samples   []Sample
+}
+
+// NewSampleWindow creates a window that keeps samples for the given retention
+func NewSampleWindow(retention time.Duration) *SampleWindow {
+	return &SampleWindow{retention: retention}
+}
+
+// SetRetention changes how long samples are kept
+func (w *SampleWindow) SetRetention(retention time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.retention = retention
+}
+
+// Add appends a sample and drops samples that fell out of the window.
+// One sample older than the retention is kept so a full window can be proven.
+func (w *SampleWindow) Add(sample Sample) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples = append(w.samples, sample)
+
+	cutoff := sample.Time.Add(-w.retention)
+	drop := 0
+	for drop+1 < len(w.samples) && !w.samples[drop+1].Time.After(cutoff) {
+		drop++
+	}
+	w.samples = w.samples[drop:]
+}
+
+// Latest returns the most recent sample
+func (w *SampleWindow) Latest() (Sample, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) == 0 {
+		return Sample{}, false
+	}
+	return w.samples[len(w.samples)-1], true
+}
+
+// Len returns the number of samples in the window
+func (w *SampleWindow) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.samples)
+}
+
+// snapshot returns a copy of the samples, oldest first
+func (w *SampleWindow) snapshot() []Sample {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]Sample(nil), w.samples...)
+}
@@ -309,7 +309,7 @@ func (sp *SmartProxy) getHealthyBackends(serviceName string) []*Backend {
 
 	for _, nodeName := range healthyNodes {
 		health, exists := sp.gossipState.GetServiceHealth(serviceName, nodeName)
-		if !exists || !health.Healthy {
+		if !exists || !health.EffectiveHealthy() {
 			continue
 		}
 
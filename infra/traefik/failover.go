@@ -0,0 +1,121 @@
+package traefik
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"cluster/infra/cluster/gossip"
+)
+
+const (
+	// defaultNodePriority is assumed for nodes whose metadata has not arrived yet
+	defaultNodePriority = 100
+	// unmeasuredRTT is assumed for nodes this node has not probed yet
+	unmeasuredRTT = 50 * time.Millisecond
+	// rttBucket rounds round trips so that jitter does not change the weights
+	rttBucket = 5 * time.Millisecond
+	// maxNodeWeight is the weight of a node with priority 0 and no round trip
+	maxNodeWeight = 1000
+)
+
+// addFailoverService adds the load-balanced service of the <service>.<domain> router as
+// this node sees it: replicas on this node serve every request while any is up, and
+// replicas on other nodes are the fallback, weighted by node priority and round trip.
+// Each node's provider serves its own copy of this service.
+func (s *HTTPProviderServer) addFailoverService(config *HTTPConfig, serviceName string, entries []*gossip.ServiceHealth) {
+	serviceNameFailover := fmt.Sprintf("%s-with-failover", serviceName)
+
+	local := make([]*gossip.ServiceHealth, 0)
+	remote := make(map[string][]*gossip.ServiceHealth) // node name -> replicas
+	for _, health := range entries {
+		if health.NodeName == s.localNodeName {
+			local = append(local, health)
+		} else {
+			remote[health.NodeName] = append(remote[health.NodeName], health)
+		}
+	}
+
+	// Load balancer options come from the labels of the first entry (replicas share
+	// their labels)
+	labels, _ := parseHTTPLabels(entries[0].Labels)
+	options := labels.loadBalancer("")
+
+	if len(remote) == 0 {
+		config.Services[serviceNameFailover] = &Service{LoadBalancer: s.replicaPool(local, labels)}
+		return
+	}
+
+	fallback := &WeightedService{
+		Services:    make([]WeightedServiceRef, 0, len(remote)),
+		HealthCheck: &ServiceHealthCheck{},
+	}
+	for _, nodeName := range sortedKeys(remote) {
+		poolName := fmt.Sprintf("%s-%s-fallback", serviceName, nodeName)
+		config.Services[poolName] = &Service{LoadBalancer: s.replicaPool(remote[nodeName], labels)}
+		fallback.Services = append(fallback.Services, WeightedServiceRef{
+			Name:   poolName,
+			Weight: s.nodeWeight(nodeName),
+		})
+	}
+	if options != nil && options.Sticky != nil {
+		// Keep a client on the node it landed on, as within a pool
+		fallback.Sticky = config.Services[fallback.Services[0].Name].LoadBalancer.Sticky
+	}
+
+	if len(local) == 0 {
+		config.Services[serviceNameFailover] = &Service{Weighted: fallback}
+		return
+	}
+
+	serviceNameLocal := fmt.Sprintf("%s-local", serviceName)
+	serviceNameRemote := fmt.Sprintf("%s-remote", serviceName)
+	config.Services[serviceNameLocal] = &Service{LoadBalancer: s.replicaPool(local, labels)}
+	config.Services[serviceNameRemote] = &Service{Weighted: fallback}
+	config.Services[serviceNameFailover] = &Service{
+		Failover: &FailoverService{
+			Service:  serviceNameLocal,
+			Fallback: serviceNameRemote,
+		},
+	}
+}
+
+// replicaPool balances over replicas on one node. Its health check is what lets a
+// failover or weighted service notice the node's replicas are down.
+func (s *HTTPProviderServer) replicaPool(entries []*gossip.ServiceHealth, labels *httpLabels) *LoadBalancer {
+	servers := make([]Server, 0, len(entries))
+	for _, health := range entries {
+		httpEndpoint := health.Endpoints["http"]
+		if httpEndpoint == "" {
+			httpEndpoint = s.labelServerURL(health, labels, "")
+		}
+		servers = appendUnique(servers, Server{URL: httpEndpoint})
+	}
+
+	loadBalancer := &LoadBalancer{
+		Servers:     servers,
+		HealthCheck: defaultHealthCheck(entries[0]),
+		Method:      "wrr", // Weighted round robin
+	}
+	labels.loadBalancer("").apply(loadBalancer)
+	return loadBalancer
+}
+
+// nodeWeight weighs another node's replicas in the fallback: the weight halves as the
+// node's priority number grows by 100 and for every 10ms of round trip from this node,
+// down to 1
+func (s *HTTPProviderServer) nodeWeight(nodeName string) int {
+	priority := defaultNodePriority
+	if node, ok := s.gossipState.GetNode(nodeName); ok {
+		priority = max(node.Priority, 0)
+	}
+	rtt, ok := s.gossipState.GetRTT(nodeName)
+	if !ok {
+		rtt = unmeasuredRTT
+	}
+	rtt = rtt.Round(rttBucket)
+
+	halvings := float64(priority)/100 + float64(rtt.Milliseconds())/10
+	weight := maxNodeWeight * math.Pow(0.5, halvings)
+	return max(int(math.Round(weight)), 1)
+}
@@ -0,0 +1,115 @@
+package traefik
+
+import (
+	"testing"
+	"time"
+
+	"cluster/infra/cluster/gossip"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeWeight(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority int
+		rtt      time.Duration // Zero leaves the node unmeasured
+		node     string
+		want     int
+	}{
+		{name: "preferred and close", priority: 0, rtt: time.Millisecond, want: 1000},
+		{name: "priority 100 halves", priority: 100, rtt: time.Millisecond, want: 500},
+		{name: "priority 200 quarters", priority: 200, rtt: time.Millisecond, want: 250},
+		{name: "10ms halves", priority: 0, rtt: 10 * time.Millisecond, want: 500},
+		{name: "priority and round trip compound", priority: 100, rtt: 20 * time.Millisecond, want: 125},
+		{name: "round trips are rounded to 5ms", priority: 0, rtt: 11 * time.Millisecond, want: 500},
+		{name: "negative priority counts as 0", priority: -50, rtt: time.Millisecond, want: 1000},
+		{name: "unmeasured counts as 50ms", priority: 0, want: 31},
+		{name: "unknown node", node: "node9", want: 16},
+		{name: "never below 1", priority: 1000, rtt: 200 * time.Millisecond, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTransportTestServer()
+			nodeName := "node2"
+			if tt.node != "" {
+				nodeName = tt.node
+			} else {
+				server.gossipState.UpdateNode(&gossip.NodeMetadata{Name: nodeName, Priority: tt.priority})
+				if tt.rtt > 0 {
+					server.gossipState.RecordRTT(nodeName, tt.rtt)
+				}
+			}
+			assert.Equal(t, tt.want, server.nodeWeight(nodeName))
+		})
+	}
+}
+
+func TestAddFailoverService(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    []string
+		services []string // Expected services besides <service>-with-failover
+		check    func(t *testing.T, config *HTTPConfig)
+	}{
+		{
+			name:  "local replicas only",
+			nodes: []string{"node1"},
+			check: func(t *testing.T, config *HTTPConfig) {
+				service := config.Services["web-with-failover"]
+				require.NotNil(t, service.LoadBalancer)
+				assert.Equal(t, []Server{{URL: "http://web-node1:8080"}}, service.LoadBalancer.Servers)
+			},
+		},
+		{
+			name:     "remote replicas only",
+			nodes:    []string{"node3", "node2"},
+			services: []string{"web-node2-fallback", "web-node3-fallback"},
+			check: func(t *testing.T, config *HTTPConfig) {
+				service := config.Services["web-with-failover"]
+				require.NotNil(t, service.Weighted)
+				assert.Equal(t, []WeightedServiceRef{
+					{Name: "web-node2-fallback", Weight: 500},
+					{Name: "web-node3-fallback", Weight: 125},
+				}, service.Weighted.Services)
+				assert.NotNil(t, service.Weighted.HealthCheck)
+				assert.Equal(t, []Server{{URL: "http://web-node3:8080"}}, config.Services["web-node3-fallback"].LoadBalancer.Servers)
+			},
+		},
+		{
+			name:     "local and remote replicas",
+			nodes:    []string{"node1", "node2"},
+			services: []string{"web-local", "web-remote", "web-node2-fallback"},
+			check: func(t *testing.T, config *HTTPConfig) {
+				assert.Equal(t, &FailoverService{Service: "web-local", Fallback: "web-remote"}, config.Services["web-with-failover"].Failover)
+				assert.Equal(t, []Server{{URL: "http://web-node1:8080"}}, config.Services["web-local"].LoadBalancer.Servers)
+				assert.Equal(t, []WeightedServiceRef{{Name: "web-node2-fallback", Weight: 500}}, config.Services["web-remote"].Weighted.Services)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTransportTestServer()
+			server.gossipState.UpdateNode(&gossip.NodeMetadata{Name: "node2", Priority: 100})
+			server.gossipState.UpdateNode(&gossip.NodeMetadata{Name: "node3", Priority: 100})
+			server.gossipState.RecordRTT("node2", time.Millisecond)
+			server.gossipState.RecordRTT("node3", 20*time.Millisecond)
+
+			entries := make([]*gossip.ServiceHealth, 0, len(tt.nodes))
+			for _, nodeName := range tt.nodes {
+				health := webService("web", nodeName, true)
+				health.Endpoints["http"] = "http://web-" + nodeName + ":8080"
+				entries = append(entries, health)
+			}
+			config := &HTTPConfig{Services: make(map[string]*Service)}
+			server.addFailoverService(config, "web", entries)
+
+			want := append([]string{"web-with-failover"}, tt.services...)
+			assert.ElementsMatch(t, want, sortedKeys(config.Services))
+			tt.check(t, config)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package traefik
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"cluster/infra/cluster/gossip"
+)
+
+const (
+	// FallbackLabel sets what a service's routers serve while no replica is healthy:
+	// FallbackUnavailable, FallbackNone, the URL of a maintenance page, or
+	// "service:<name>" for another Traefik service such as an error-pages container
+	FallbackLabel = "constellation.fallback"
+	// FallbackRetryAfterLabel sets the Retry-After seconds of a FallbackUnavailable response
+	FallbackRetryAfterLabel = "constellation.fallback.retry_after"
+
+	// FallbackUnavailable answers 503 Service Unavailable with a Retry-After header
+	FallbackUnavailable = "503"
+	// FallbackNone drops the routers of a service that is down
+	FallbackNone = "none"
+
+	// DefaultFallbackRetryAfter is the Retry-After, in seconds, of FallbackUnavailable
+	DefaultFallbackRetryAfter = 30
+
+	fallbackServicePrefix = "service:"
+	// unavailableService has no servers, so Traefik answers 503 for it
+	unavailableService = "service-unavailable"
+)
+
+// fallbackRoute is what the routers of a service that is down are pointed at
+type fallbackRoute struct {
+	service     string
+	middlewares []string // Appended to the routers' chain
+	description string   // Reported by the API
+	// A service:<name> fallback, checked once the configuration is built; the 503 with
+	// retryAfter is served instead if the service is not defined
+	named      bool
+	retryAfter int
+}
+
+// SetFallback sets what the routers of a service serve while no replica is healthy,
+// unless the service's labels choose otherwise
+func (s *HTTPProviderServer) SetFallback(fallback string, retryAfter int) error {
+	if _, _, err := parseFallback(fallback); err != nil {
+		return err
+	}
+	if retryAfter < 0 {
+		return fmt.Errorf("invalid fallback Retry-After %d", retryAfter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = fallback
+	s.fallbackRetryAfter = retryAfter
+	s.snapshot = nil
+	return nil
+}
+
+// ServingFallback returns what this node serves in place of a service that is down, if
+// anything
+func (s *HTTPProviderServer) ServingFallback(serviceName string) (string, bool) {
+	description, ok := s.currentSnapshot().fallbacks[serviceName]
+	return description, ok
+}
+
+// parseFallback returns the kind of a fallback (FallbackUnavailable, FallbackNone, "url"
+// or "service") and its target
+func parseFallback(fallback string) (string, string, error) {
+	switch {
+	case fallback == "" || fallback == FallbackUnavailable:
+		return FallbackUnavailable, "", nil
+	case fallback == FallbackNone:
+		return FallbackNone, "", nil
+	case strings.HasPrefix(fallback, fallbackServicePrefix):
+		if service := strings.TrimPrefix(fallback, fallbackServicePrefix); service != "" {
+			return "service", service, nil
+		}
+	default:
+		if target, err := url.Parse(fallback); err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != "" {
+			return "url", fallback, nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid fallback %q (503, none, an http(s) URL or service:<name>)", fallback)
+}
+
+// fallbackRoute adds what a service that is down falls back to, from its labels or the
+// global setting, and returns where its routers should point; nil to drop them
+func (s *HTTPProviderServer) fallbackRoute(config *HTTPConfig, serviceName string, health *gossip.ServiceHealth) *fallbackRoute {
+	s.mu.RLock()
+	fallback, retryAfter := s.fallback, s.fallbackRetryAfter
+	s.mu.RUnlock()
+
+	if value, ok := health.Labels[FallbackLabel]; ok {
+		if _, _, err := parseFallback(value); err != nil {
+			s.warnOnce("Warning: ignoring fallback of %s: %v", serviceName, err)
+		} else {
+			fallback = value
+		}
+	}
+	if value, ok := health.Labels[FallbackRetryAfterLabel]; ok {
+		if seconds, err := strconv.Atoi(value); err != nil || seconds < 0 {
+			s.warnOnce("Warning: ignoring fallback Retry-After %q of %s", value, serviceName)
+		} else {
+			retryAfter = seconds
+		}
+	}
+
+	kind, target, _ := parseFallback(fallback)
+	switch kind {
+	case FallbackNone:
+		return nil
+	case "service":
+		return &fallbackRoute{service: target, description: "service " + target, named: true, retryAfter: retryAfter}
+	case "url":
+		name := fmt.Sprintf("%s-fallback", serviceName)
+		passHostHeader := false
+		config.Services[name] = &Service{
+			LoadBalancer: &LoadBalancer{
+				Servers:        []Server{{URL: target}},
+				PassHostHeader: &passHostHeader, // The page is served for its own host
+			},
+		}
+		return &fallbackRoute{service: name, description: target}
+	}
+	return unavailableRoute(config, retryAfter)
+}
+
+// unavailableRoute adds the built-in 503 fallback, with a Retry-After header unless
+// retryAfter is 0
+func unavailableRoute(config *HTTPConfig, retryAfter int) *fallbackRoute {
+	if _, ok := config.Services[unavailableService]; !ok {
+		config.Services[unavailableService] = &Service{
+			LoadBalancer: &LoadBalancer{Servers: []Server{}},
+		}
+	}
+	route := &fallbackRoute{service: unavailableService, description: "503 Service Unavailable"}
+	if retryAfter > 0 {
+		name := fmt.Sprintf("retry-after-%d", retryAfter)
+		config.Middlewares[name] = &Middleware{
+			Headers: &HeadersMiddleware{
+				CustomResponseHeaders: map[string]string{"Retry-After": strconv.Itoa(retryAfter)},
+			},
+		}
+		route.middlewares = []string{name}
+		route.description += fmt.Sprintf(", Retry-After %ds", retryAfter)
+	}
+	return route
+}
+
+// checkFallbackServices points the routers of a service that is down at the built-in 503
+// when its service:<name> fallback is not defined in the configuration, since Traefik
+// would otherwise reject them. Services of other providers (error-pages@docker) are
+// Traefik's to resolve.
+func (s *HTTPProviderServer) checkFallbackServices(config *HTTPConfig, fallbacks map[string]*fallbackRoute, owners map[string]string) {
+	for _, serviceName := range sortedKeys(fallbacks) {
+		route := fallbacks[serviceName]
+		if !route.named {
+			continue
+		}
+		name, provider, qualified := strings.Cut(route.service, "@")
+		if qualified && provider != thisProvider {
+			continue
+		}
+		if _, ok := config.Services[name]; ok {
+			continue
+		}
+
+		s.warnOnce("Warning: fallback service %s of %s is not defined, serving 503 instead", route.service, serviceName)
+		unavailable := unavailableRoute(config, route.retryAfter)
+		for routerName, owner := range owners {
+			router, ok := config.Routers[routerName]
+			if !ok || owner != serviceName || router.Service != route.service {
+				continue
+			}
+			router.Service = unavailable.service
+			router.Middlewares = append(router.Middlewares, unavailable.middlewares...)
+		}
+		fallbacks[serviceName] = unavailable
+	}
+}
+
+// addFallbackRouters keeps the generated routers of a service that is down in place,
+// pointing at its fallback, so clients get a meaningful answer instead of a 404
+func (s *HTTPProviderServer) addFallbackRouters(config *HTTPConfig, serviceName string, entries []*gossip.ServiceHealth, route *fallbackRoute, owners map[string]string) {
+	for _, health := range entries {
+		routerName := fmt.Sprintf("%s-%s-direct", serviceName, health.NodeName)
+		if _, ok := config.Routers[routerName]; ok {
+			continue // Another replica on the node
+		}
+		owners[routerName] = serviceName
+		config.Routers[routerName] = &Router{
+			Rule:        fmt.Sprintf("Host(`%s.%s.%s`)", serviceName, health.NodeName, s.domain),
+			Service:     route.service,
+			EntryPoints: []string{"websecure"},
+			TLS: &TLS{
+				CertResolver: "letsencrypt",
+			},
+			Middlewares: s.middlewareChain(health, route.middlewares),
+		}
+	}
+
+	routerName := fmt.Sprintf("%s-with-failover", serviceName)
+	owners[routerName] = serviceName
+	config.Routers[routerName] = &Router{
+		Rule:        fmt.Sprintf("Host(`%s.%s`)", serviceName, s.domain),
+		Service:     route.service,
+		EntryPoints: []string{"websecure"},
+		TLS: &TLS{
+			CertResolver: "letsencrypt",
+		},
+		Middlewares: s.middlewareChain(entries[0], route.middlewares),
+	}
+}
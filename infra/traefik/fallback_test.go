@@ -0,0 +1,86 @@
+package traefik
+
+import (
+	"testing"
+
+	"cluster/infra/cluster/gossip"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFallbackServices(t *testing.T) {
+	errorPages := webService("error-pages", "node2", true)
+	errorPages.Labels = map[string]string{
+		"traefik.http.routers.error-pages.rule":                      "Host(`errors.example.com`)",
+		"traefik.http.services.error-pages.loadbalancer.server.port": "8080",
+	}
+
+	tests := []struct {
+		name        string
+		fallback    string
+		services    []*gossip.ServiceHealth
+		wantService string
+		wantStatus  string
+	}{
+		{
+			name:        "label service",
+			fallback:    "service:error-pages",
+			services:    []*gossip.ServiceHealth{errorPages},
+			wantService: "error-pages",
+			wantStatus:  "service error-pages",
+		},
+		{
+			name:        "generated service",
+			fallback:    "service:api-with-failover",
+			services:    []*gossip.ServiceHealth{webService("api", "node1", true)},
+			wantService: "api-with-failover",
+			wantStatus:  "service api-with-failover",
+		},
+		{
+			name:        "another provider's service",
+			fallback:    "service:error-pages@docker",
+			wantService: "error-pages@docker",
+			wantStatus:  "service error-pages@docker",
+		},
+		{
+			name:        "undefined service",
+			fallback:    "service:error-pages",
+			wantService: unavailableService,
+			wantStatus:  "503 Service Unavailable, Retry-After 30s",
+		},
+		{
+			name:        "undefined service of this provider",
+			fallback:    "service:error-pages@http",
+			wantService: unavailableService,
+			wantStatus:  "503 Service Unavailable, Retry-After 30s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			web := webService("web", "node1", false)
+			web.Labels = map[string]string{
+				FallbackLabel:                    tt.fallback,
+				"traefik.http.routers.blog.rule": "Host(`blog.example.com`)",
+			}
+			server := newTransportTestServer(append(tt.services, web)...)
+			require.NoError(t, server.SetFallback(FallbackUnavailable, DefaultFallbackRetryAfter))
+
+			config := server.currentSnapshot().config.HTTP
+			for _, routerName := range []string{"web-with-failover", "web-node1-direct", "blog"} {
+				require.Contains(t, config.Routers, routerName)
+				router := config.Routers[routerName]
+				assert.Equal(t, tt.wantService, router.Service, routerName)
+				if tt.wantService == unavailableService {
+					assert.Contains(t, router.Middlewares, "retry-after-30", routerName)
+					assert.Contains(t, config.Services, unavailableService)
+				}
+			}
+
+			status, ok := server.ServingFallback("web")
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantStatus, status)
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package traefik
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// configHistoryLimit is how many distinct generated configurations are kept
+const configHistoryLimit = 100
+
+// ConfigRevision is a distinct configuration the provider generated
+type ConfigRevision struct {
+	ID            uint64                `json:"id"` // The X-Config-Index it was served with
+	Timestamp     time.Time             `json:"timestamp"`
+	GossipVersion uint64                `json:"gossip_version"` // Gossip state version that produced it
+	Config        *TraefikDynamicConfig `json:"config,omitempty"`
+}
+
+// ConfigChange is reported when the generated configuration changes
+type ConfigChange struct {
+	Revision ConfigRevision // Without its config
+	Diff     *ConfigDiff    // Against the previous revision; nil for the first
+}
+
+// ConfigDiff lists what changed between two revisions
+type ConfigDiff struct {
+	From uint64            `json:"from"`
+	To   uint64            `json:"to"`
+	HTTP HTTPSectionDiff   `json:"http"`
+	TCP  StreamSectionDiff `json:"tcp"`
+	UDP  StreamSectionDiff `json:"udp"`
+}
+
+// HTTPSectionDiff lists the changed HTTP routers, services and middlewares
+type HTTPSectionDiff struct {
+	Routers     NameDiff `json:"routers"`
+	Services    NameDiff `json:"services"`
+	Middlewares NameDiff `json:"middlewares"`
+}
+
+// StreamSectionDiff lists the changed TCP or UDP routers and services
+type StreamSectionDiff struct {
+	Routers  NameDiff `json:"routers"`
+	Services NameDiff `json:"services"`
+}
+
+// NameDiff lists the names of added, removed and changed definitions
+type NameDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// SetChangeHandler registers a callback invoked whenever the generated configuration
+// changes
+func (s *HTTPProviderServer) SetChangeHandler(handler func(ConfigChange)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.changeHandler = handler
+}
+
+// WatchChanges recomputes the configuration whenever the gossip state changes, until
+// ctx is cancelled, so every revision is recorded and reported as it happens rather
+// than when Traefik next polls
+func (s *HTTPProviderServer) WatchChanges(ctx context.Context) {
+	refresh := time.NewTicker(weightRefreshInterval)
+	defer refresh.Stop()
+
+	for {
+		snapshot := s.currentSnapshot()
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.gossipState.VersionChanged(snapshot.version):
+		case <-refresh.C:
+		}
+	}
+}
+
+// recordRevision adds a new configuration to the history, dropping the oldest beyond
+// configHistoryLimit, and returns the change to report. The caller holds s.mu.
+func (s *HTTPProviderServer) recordRevision(snapshot *configSnapshot) ConfigChange {
+	revision := ConfigRevision{
+		ID:            snapshot.index,
+		Timestamp:     time.Now(),
+		GossipVersion: snapshot.version,
+		Config:        snapshot.config,
+	}
+
+	change := ConfigChange{Revision: revision}
+	change.Revision.Config = nil
+	if len(s.history) > 0 {
+		change.Diff = diffRevisions(s.history[len(s.history)-1], revision)
+	}
+
+	s.history = append(s.history, revision)
+	if len(s.history) > configHistoryLimit {
+		s.history = s.history[len(s.history)-configHistoryLimit:]
+	}
+	return change
+}
+
+// revision returns a revision from the history; id 0 is the latest
+func (s *HTTPProviderServer) revision(id uint64) (ConfigRevision, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.history) == 0 {
+		return ConfigRevision{}, false
+	}
+	if id == 0 {
+		return s.history[len(s.history)-1], true
+	}
+	for _, revision := range s.history {
+		if revision.ID == id {
+			return revision, true
+		}
+	}
+	return ConfigRevision{}, false
+}
+
+// handleHistory lists the configurations in the history, oldest first
+func (s *HTTPProviderServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Make sure the current configuration is in the history
+	s.currentSnapshot()
+
+	s.mu.RLock()
+	revisions := make([]ConfigRevision, 0, len(s.history))
+	for _, revision := range s.history {
+		revision.Config = nil
+		revisions = append(revisions, revision)
+	}
+	s.mu.RUnlock()
+
+	s.writeJSON(w, revisions)
+}
+
+// handleHistoryEntry returns one configuration of the history
+func (s *HTTPProviderServer) handleHistoryEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.URL.Path[len("/history/"):], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid revision id", http.StatusBadRequest)
+		return
+	}
+	revision, ok := s.revision(id)
+	if !ok || id == 0 {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	s.writeJSON(w, revision)
+}
+
+// handleDiff compares two configurations of the history. Without to, the latest is
+// used; without from, the one before to.
+func (s *HTTPProviderServer) handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.currentSnapshot()
+
+	query := r.URL.Query()
+	fromID, err := parseRevisionID(query.Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from revision id", http.StatusBadRequest)
+		return
+	}
+	toID, err := parseRevisionID(query.Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid to revision id", http.StatusBadRequest)
+		return
+	}
+
+	to, ok := s.revision(toID)
+	if !ok {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	if fromID == 0 {
+		fromID = to.ID - 1
+	}
+	from, ok := s.revision(fromID)
+	if !ok || fromID == 0 {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	s.writeJSON(w, diffRevisions(from, to))
+}
+
+// parseRevisionID parses an optional revision id; 0 when absent
+func parseRevisionID(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err == nil && id == 0 {
+		err = strconv.ErrRange
+	}
+	return id, err
+}
+
+// diffRevisions compares the configurations of two revisions
+func diffRevisions(from, to ConfigRevision) *ConfigDiff {
+	a, b := sectionsOf(from.Config), sectionsOf(to.Config)
+	return &ConfigDiff{
+		From: from.ID,
+		To:   to.ID,
+		HTTP: HTTPSectionDiff{
+			Routers:     diffNames(a.HTTP.Routers, b.HTTP.Routers),
+			Services:    diffNames(a.HTTP.Services, b.HTTP.Services),
+			Middlewares: diffNames(a.HTTP.Middlewares, b.HTTP.Middlewares),
+		},
+		TCP: StreamSectionDiff{
+			Routers:  diffNames(a.TCP.Routers, b.TCP.Routers),
+			Services: diffNames(a.TCP.Services, b.TCP.Services),
+		},
+		UDP: StreamSectionDiff{
+			Routers:  diffNames(a.UDP.Routers, b.UDP.Routers),
+			Services: diffNames(a.UDP.Services, b.UDP.Services),
+		},
+	}
+}
+
+// sectionsOf returns a configuration with every section present
+func sectionsOf(config *TraefikDynamicConfig) TraefikDynamicConfig {
+	sections := TraefikDynamicConfig{HTTP: &HTTPConfig{}, TCP: &TCPConfig{}, UDP: &UDPConfig{}}
+	if config == nil {
+		return sections
+	}
+	if config.HTTP != nil {
+		sections.HTTP = config.HTTP
+	}
+	if config.TCP != nil {
+		sections.TCP = config.TCP
+	}
+	if config.UDP != nil {
+		sections.UDP = config.UDP
+	}
+	return sections
+}
+
+// diffNames compares two sets of named definitions
+func diffNames[V any](from, to map[string]V) NameDiff {
+	diff := NameDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for _, name := range sortedKeys(to) {
+		previous, existed := from[name]
+		switch {
+		case !existed:
+			diff.Added = append(diff.Added, name)
+		case !reflect.DeepEqual(previous, to[name]):
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for _, name := range sortedKeys(from) {
+		if _, exists := to[name]; !exists {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	return diff
+}
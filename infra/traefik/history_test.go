@@ -0,0 +1,166 @@
+package traefik
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchChanges_RecordsWithoutPolling(t *testing.T) {
+	server := newTransportTestServer(webService("web", "node1", true))
+	changes := make(chan ConfigChange, 8)
+	server.SetChangeHandler(func(change ConfigChange) {
+		changes <- change
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.WatchChanges(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	first := awaitChange(t, changes)
+	assert.Equal(t, uint64(1), first.Revision.ID)
+	assert.Nil(t, first.Diff)
+
+	// Nobody polls the provider, yet the change is recorded and reported
+	server.gossipState.UpdateServiceHealth(webService("api", "node1", true))
+	second := awaitChange(t, changes)
+	assert.Equal(t, uint64(2), second.Revision.ID)
+	require.NotNil(t, second.Diff)
+	assert.Contains(t, second.Diff.HTTP.Services.Added, "api-with-failover")
+
+	revision, ok := server.revision(0)
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), revision.ID)
+}
+
+func TestRecordRevision_KeepsTheLatest(t *testing.T) {
+	server := newTransportTestServer()
+
+	server.mu.Lock()
+	for index := uint64(1); index <= configHistoryLimit+50; index++ {
+		server.recordRevision(&configSnapshot{config: &TraefikDynamicConfig{}, index: index, version: index})
+	}
+	server.mu.Unlock()
+
+	require.Len(t, server.history, configHistoryLimit)
+	assert.Equal(t, uint64(51), server.history[0].ID)
+	assert.Equal(t, uint64(configHistoryLimit+50), server.history[configHistoryLimit-1].ID)
+
+	_, ok := server.revision(50)
+	assert.False(t, ok)
+	revision, ok := server.revision(51)
+	require.True(t, ok)
+	assert.Equal(t, uint64(51), revision.GossipVersion)
+}
+
+func TestHandleHistory(t *testing.T) {
+	server := newTransportTestServer(webService("web", "node1", true))
+	server.currentSnapshot()
+	server.gossipState.UpdateServiceHealth(webService("api", "node1", true))
+
+	// The listing records the current configuration and leaves configs out
+	response := getHistory(server.handleHistory, "/history")
+	require.Equal(t, http.StatusOK, response.Code)
+	var revisions []ConfigRevision
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &revisions))
+	require.Len(t, revisions, 2)
+	assert.Equal(t, uint64(1), revisions[0].ID)
+	assert.Equal(t, uint64(2), revisions[1].ID)
+	assert.Less(t, revisions[0].GossipVersion, revisions[1].GossipVersion)
+	assert.Nil(t, revisions[1].Config)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/history/1", http.StatusOK},
+		{"/history/2", http.StatusOK},
+		{"/history/3", http.StatusNotFound},
+		{"/history/0", http.StatusNotFound},
+		{"/history/latest", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, getHistory(server.handleHistoryEntry, tt.path).Code, tt.path)
+	}
+
+	response = getHistory(server.handleHistoryEntry, "/history/2")
+	var revision ConfigRevision
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &revision))
+	require.NotNil(t, revision.Config)
+	assert.Contains(t, revision.Config.HTTP.Services, "api-with-failover")
+}
+
+func TestHandleDiff(t *testing.T) {
+	server := newTransportTestServer(webService("web", "node1", true))
+	server.currentSnapshot()
+	server.gossipState.UpdateServiceHealth(webService("api", "node1", true))
+	server.currentSnapshot()
+	server.gossipState.UpdateServiceHealth(webService("web", "node2", true))
+
+	// Latest against the one before
+	response := getHistory(server.handleDiff, "/diff")
+	require.Equal(t, http.StatusOK, response.Code)
+	var diff ConfigDiff
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &diff))
+	assert.Equal(t, uint64(2), diff.From)
+	assert.Equal(t, uint64(3), diff.To)
+	assert.Contains(t, diff.HTTP.Services.Changed, "web-with-failover")
+	assert.Contains(t, diff.HTTP.Services.Added, "web-node2-fallback")
+	assert.Empty(t, diff.HTTP.Services.Removed)
+
+	// Any two revisions, in either direction
+	response = getHistory(server.handleDiff, "/diff?from=2&to=1")
+	require.Equal(t, http.StatusOK, response.Code)
+	diff = ConfigDiff{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &diff))
+	assert.Contains(t, diff.HTTP.Services.Removed, "api-with-failover")
+	assert.Empty(t, diff.HTTP.Services.Added)
+	assert.Empty(t, diff.TCP.Routers.Added)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/diff?from=1", http.StatusOK},
+		{"/diff?to=1", http.StatusNotFound}, // Nothing before the first
+		{"/diff?from=9", http.StatusNotFound},
+		{"/diff?to=9", http.StatusNotFound},
+		{"/diff?from=0", http.StatusBadRequest},
+		{"/diff?to=latest", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, getHistory(server.handleDiff, tt.path).Code, tt.path)
+	}
+}
+
+// getHistory calls a history handler with a GET of path
+func getHistory(handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+// awaitChange waits for the next reported configuration change
+func awaitChange(t *testing.T, changes <-chan ConfigChange) ConfigChange {
+	t.Helper()
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("no configuration change was reported")
+		return ConfigChange{}
+	}
+}
@@ -1,10 +1,14 @@
 package traefik
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,9 +23,41 @@ type HTTPProviderServer struct {
 	localNodeName string
 	server        *http.Server
 	mu            sync.RWMutex
-	lastConfig    *TraefikDynamicConfig
-	lastUpdate    time.Time
-}
+	snapshot      *configSnapshot // Latest computed configuration
+	configIndex   uint64          // Moves whenever the computed configuration changes
+	computeMu     sync.Mutex      // Held while recomputing, so concurrent polls compute once
+	warnings      sync.Map        // Configuration problems already logged
+	history       []ConfigRevision
+	changeHandler func(ConfigChange)
+
+	defaultMiddlewares []string // Chain every router starts with
+	fallback           string   // What routers of a service that is down serve
+	fallbackRetryAfter int      // Retry-After seconds of the 503 fallback
+}
+
+// configSnapshot is the configuration computed from one version of the gossip state
+type configSnapshot struct {
+	config    *TraefikDynamicConfig
+	fallbacks map[string]string            // Service that is down -> fallback served in its place
+	dropped   map[string]map[string]string // Service -> router left out of the configuration -> why
+	// Dedicated TCP and UDP entrypoints, including those of services that are down
+	entrypoints map[string]*Entrypoint
+	body        []byte // As served by /api/dynamic
+	etag        string
+	index       uint64
+	version     uint64 // Gossip state version the configuration was computed from
+	// Gossip metrics version the fallback weights were computed from
+	metricsVersion uint64
+	computedAt     time.Time
+}
+
+const (
+	// maxLongPollWait caps how long /api/dynamic?wait= holds a request
+	maxLongPollWait = 5 * time.Minute
+	// weightRefreshInterval is how often the fallback weights follow round trip
+	// changes while nothing routing depends on changes
+	weightRefreshInterval = 30 * time.Second
+)
 
 // TraefikDynamicConfig represents the Traefik dynamic configuration format
 type TraefikDynamicConfig struct {
@@ -61,15 +97,43 @@ type Router struct {
 
 // Service represents an HTTP service
 type Service struct {
-	LoadBalancer *LoadBalancer `json:"loadBalancer,omitempty"`
+	LoadBalancer *LoadBalancer    `json:"loadBalancer,omitempty"`
+	Weighted     *WeightedService `json:"weighted,omitempty"`
+	Failover     *FailoverService `json:"failover,omitempty"`
+}
+
+// WeightedService spreads requests over other services in proportion to their weights
+type WeightedService struct {
+	Services    []WeightedServiceRef `json:"services"`
+	Sticky      *Sticky              `json:"sticky,omitempty"`
+	HealthCheck *ServiceHealthCheck  `json:"healthCheck,omitempty"`
+}
+
+// WeightedServiceRef is a service of a weighted service
+type WeightedServiceRef struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
 }
 
+// FailoverService sends requests to its fallback while its main service is down
+type FailoverService struct {
+	Service     string              `json:"service"`
+	Fallback    string              `json:"fallback"`
+	HealthCheck *ServiceHealthCheck `json:"healthCheck,omitempty"`
+}
+
+// ServiceHealthCheck, set on a weighted or failover service, makes it skip children
+// whose health checks fail and report its own status to its parent
+type ServiceHealthCheck struct{}
+
 // LoadBalancer represents a load balancer configuration
 type LoadBalancer struct {
-	Servers     []Server      `json:"servers"`
-	HealthCheck *HealthCheck  `json:"healthCheck,omitempty"`
-	Method      string        `json:"method,omitempty"`
-	Sticky      *StickyCookie `json:"sticky,omitempty"`
+	Servers          []Server     `json:"servers"`
+	HealthCheck      *HealthCheck `json:"healthCheck,omitempty"`
+	Method           string       `json:"method,omitempty"`
+	Sticky           *Sticky      `json:"sticky,omitempty"`
+	PassHostHeader   *bool        `json:"passHostHeader,omitempty"`
+	ServersTransport string       `json:"serversTransport,omitempty"`
 }
 
 // Server represents a backend server
@@ -79,9 +143,16 @@ type Server struct {
 
 // HealthCheck represents a health check configuration
 type HealthCheck struct {
-	Path     string `json:"path,omitempty"`
-	Interval string `json:"interval,omitempty"`
-	Timeout  string `json:"timeout,omitempty"`
+	Scheme          string            `json:"scheme,omitempty"`
+	Path            string            `json:"path,omitempty"`
+	Method          string            `json:"method,omitempty"`
+	Status          int               `json:"status,omitempty"` // Expected status; any 2xx or 3xx when unset
+	Port            int               `json:"port,omitempty"`
+	Interval        string            `json:"interval,omitempty"`
+	Timeout         string            `json:"timeout,omitempty"`
+	Hostname        string            `json:"hostname,omitempty"`
+	FollowRedirects *bool             `json:"followRedirects,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
 }
 
 // TLS represents TLS configuration
@@ -105,6 +176,24 @@ type Middleware struct {
 	StripPrefix *StripPrefixMiddleware `json:"stripPrefix,omitempty"`
 	RateLimit   *RateLimitMiddleware   `json:"rateLimit,omitempty"`
 	Compress    *CompressMiddleware    `json:"compress,omitempty"`
+
+	RedirectRegex  *RedirectRegexMiddleware  `json:"redirectRegex,omitempty"`
+	RedirectScheme *RedirectSchemeMiddleware `json:"redirectScheme,omitempty"`
+	ForwardAuth    *ForwardAuthMiddleware    `json:"forwardAuth,omitempty"`
+	Errors         *ErrorsMiddleware         `json:"errors,omitempty"`
+
+	// Further middlewares services declare in labels
+	AddPrefix        *AddPrefixMiddleware        `json:"addPrefix,omitempty"`
+	Buffering        *BufferingMiddleware        `json:"buffering,omitempty"`
+	Chain            *ChainMiddleware            `json:"chain,omitempty"`
+	CircuitBreaker   *CircuitBreakerMiddleware   `json:"circuitBreaker,omitempty"`
+	InFlightReq      *InFlightReqMiddleware      `json:"inFlightReq,omitempty"`
+	IPAllowList      *IPAllowListMiddleware      `json:"ipAllowList,omitempty"`
+	IPWhiteList      *IPAllowListMiddleware      `json:"ipWhiteList,omitempty"` // Name before Traefik v3
+	ReplacePath      *ReplacePathMiddleware      `json:"replacePath,omitempty"`
+	ReplacePathRegex *ReplacePathRegexMiddleware `json:"replacePathRegex,omitempty"`
+	Retry            *RetryMiddleware            `json:"retry,omitempty"`
+	StripPrefixRegex *StripPrefixRegexMiddleware `json:"stripPrefixRegex,omitempty"`
 }
 
 // BasicAuthMiddleware represents basic authentication middleware
@@ -133,6 +222,35 @@ type RedirectMiddleware struct {
 	Port      string `json:"port,omitempty"`
 }
 
+// RedirectRegexMiddleware represents regex redirect middleware
+type RedirectRegexMiddleware struct {
+	Regex       string `json:"regex,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	Permanent   bool   `json:"permanent,omitempty"`
+}
+
+// RedirectSchemeMiddleware represents scheme redirect middleware
+type RedirectSchemeMiddleware struct {
+	Scheme    string `json:"scheme,omitempty"`
+	Port      string `json:"port,omitempty"`
+	Permanent bool   `json:"permanent,omitempty"`
+}
+
+// ForwardAuthMiddleware represents forward authentication middleware
+type ForwardAuthMiddleware struct {
+	Address             string   `json:"address,omitempty"`
+	TrustForwardHeader  bool     `json:"trustForwardHeader,omitempty"`
+	AuthResponseHeaders []string `json:"authResponseHeaders,omitempty"`
+	AuthRequestHeaders  []string `json:"authRequestHeaders,omitempty"`
+}
+
+// ErrorsMiddleware represents error pages middleware
+type ErrorsMiddleware struct {
+	Status  []string `json:"status,omitempty"`
+	Service string   `json:"service,omitempty"`
+	Query   string   `json:"query,omitempty"`
+}
+
 // StripPrefixMiddleware represents strip prefix middleware
 type StripPrefixMiddleware struct {
 	Prefixes []string `json:"prefixes,omitempty"`
@@ -150,7 +268,79 @@ type CompressMiddleware struct {
 	ExcludedContentTypes []string `json:"excludedContentTypes,omitempty"`
 }
 
-// StickyCookie represents sticky session configuration
+// AddPrefixMiddleware represents add prefix middleware
+type AddPrefixMiddleware struct {
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// BufferingMiddleware represents request and response buffering middleware
+type BufferingMiddleware struct {
+	MaxRequestBodyBytes  int64  `json:"maxRequestBodyBytes,omitempty"`
+	MemRequestBodyBytes  int64  `json:"memRequestBodyBytes,omitempty"`
+	MaxResponseBodyBytes int64  `json:"maxResponseBodyBytes,omitempty"`
+	MemResponseBodyBytes int64  `json:"memResponseBodyBytes,omitempty"`
+	RetryExpression      string `json:"retryExpression,omitempty"`
+}
+
+// ChainMiddleware represents a chain of other middlewares
+type ChainMiddleware struct {
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+// CircuitBreakerMiddleware represents circuit breaker middleware
+type CircuitBreakerMiddleware struct {
+	Expression       string `json:"expression,omitempty"`
+	CheckPeriod      string `json:"checkPeriod,omitempty"`
+	FallbackDuration string `json:"fallbackDuration,omitempty"`
+	RecoveryDuration string `json:"recoveryDuration,omitempty"`
+	ResponseCode     int    `json:"responseCode,omitempty"`
+}
+
+// InFlightReqMiddleware represents in-flight request limiting middleware
+type InFlightReqMiddleware struct {
+	Amount int64 `json:"amount,omitempty"`
+}
+
+// IPAllowListMiddleware represents client IP filtering middleware
+type IPAllowListMiddleware struct {
+	SourceRange []string    `json:"sourceRange,omitempty"`
+	IPStrategy  *IPStrategy `json:"ipStrategy,omitempty"`
+}
+
+// IPStrategy selects the client IP checked by IP filtering middlewares
+type IPStrategy struct {
+	Depth       int      `json:"depth,omitempty"`
+	ExcludedIPs []string `json:"excludedIPs,omitempty"`
+}
+
+// ReplacePathMiddleware represents replace path middleware
+type ReplacePathMiddleware struct {
+	Path string `json:"path,omitempty"`
+}
+
+// ReplacePathRegexMiddleware represents regex replace path middleware
+type ReplacePathRegexMiddleware struct {
+	Regex       string `json:"regex,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// RetryMiddleware represents retry middleware
+type RetryMiddleware struct {
+	Attempts        int    `json:"attempts,omitempty"`
+	InitialInterval string `json:"initialInterval,omitempty"`
+}
+
+// StripPrefixRegexMiddleware represents regex strip prefix middleware
+type StripPrefixRegexMiddleware struct {
+	Regex []string `json:"regex,omitempty"`
+}
+
+// Sticky represents sticky session configuration
+type Sticky struct {
+	Cookie *StickyCookie `json:"cookie,omitempty"`
+}
+
+// StickyCookie represents the cookie of sticky sessions
 type StickyCookie struct {
 	Name     string `json:"name,omitempty"`
 	Secure   bool   `json:"secure,omitempty"`
@@ -163,7 +353,15 @@ type TCPRouter struct {
 	Rule        string   `json:"rule"`
 	Service     string   `json:"service"`
 	EntryPoints []string `json:"entryPoints,omitempty"`
-	TLS         *TLS     `json:"tls,omitempty"`
+	TLS         *TCPTLS  `json:"tls,omitempty"`
+}
+
+// TCPTLS is the TLS configuration of a TCP router: passed through to the backend, or
+// terminated by Traefik with a certificate from the resolver
+type TCPTLS struct {
+	Passthrough  bool     `json:"passthrough,omitempty"`
+	CertResolver string   `json:"certResolver,omitempty"`
+	Domains      []Domain `json:"domains,omitempty"`
 }
 
 // TCPService represents a TCP service
@@ -209,6 +407,9 @@ func NewHTTPProviderServer(gossipState *gossip.ClusterState, port int, domain, l
 		port:          port,
 		domain:        domain,
 		localNodeName: localNodeName,
+
+		fallback:           FallbackUnavailable,
+		fallbackRetryAfter: DefaultFallbackRetryAfter,
 	}
 }
 
@@ -224,10 +425,16 @@ func (s *HTTPProviderServer) Start() error {
 	mux.HandleFunc("/api/tcp/services", s.handleTCPServices)
 	mux.HandleFunc("/api/udp/routers", s.handleUDPRouters)
 	mux.HandleFunc("/api/udp/services", s.handleUDPServices)
+	mux.HandleFunc("/api/entrypoints", s.handleEntrypoints)
 
 	// Legacy single endpoint (for compatibility)
 	mux.HandleFunc("/api/dynamic", s.handleDynamicConfig)
 
+	// Generated configuration history
+	mux.HandleFunc("/history", s.handleHistory)
+	mux.HandleFunc("/history/", s.handleHistoryEntry)
+	mux.HandleFunc("/diff", s.handleDiff)
+
 	// Health check
 	mux.HandleFunc("/health", s.handleHealth)
 
@@ -235,7 +442,7 @@ func (s *HTTPProviderServer) Start() error {
 		Addr:         fmt.Sprintf(":%d", s.port),
 		Handler:      mux,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: maxLongPollWait + 10*time.Second, // Long-polls hold the response
 	}
 
 	log.Printf("Starting Traefik HTTP provider server on :%d", s.port)
@@ -257,9 +464,93 @@ func (s *HTTPProviderServer) handleDynamicConfig(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Compute config from gossip state
-	config := s.computeConfig()
-	s.writeJSON(w, config)
+	wait, index, hasIndex, err := parseLongPoll(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ifNoneMatch := r.Header.Get("If-None-Match")
+
+	snapshot := s.currentSnapshot()
+	if wait > 0 && (hasIndex || ifNoneMatch != "") {
+		// Block until the configuration differs from the one the client has
+		snapshot = s.waitForChange(r.Context(), wait, func(current *configSnapshot) bool {
+			if hasIndex {
+				return current.index == index
+			}
+			return etagMatches(ifNoneMatch, current.etag)
+		})
+	}
+
+	w.Header().Set("ETag", snapshot.etag)
+	w.Header().Set("X-Config-Index", strconv.FormatUint(snapshot.index, 10))
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(ifNoneMatch, snapshot.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(snapshot.body)
+}
+
+// parseLongPoll reads the long-poll parameters of a request: how long to wait, up to
+// maxLongPollWait, and the index of the configuration the client already has
+func parseLongPoll(r *http.Request) (time.Duration, uint64, bool, error) {
+	query := r.URL.Query()
+	var wait time.Duration
+	if value := query.Get("wait"); value != "" {
+		var err error
+		if wait, err = time.ParseDuration(value); err != nil || wait < 0 {
+			return 0, 0, false, fmt.Errorf("invalid wait %q", value)
+		}
+		wait = min(wait, maxLongPollWait)
+	}
+
+	value := query.Get("index")
+	if value == "" {
+		return wait, 0, false, nil
+	}
+	index, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("invalid index %q", value)
+	}
+	return wait, index, true, nil
+}
+
+// waitForChange waits up to wait for a configuration the client does not have yet,
+// recomputing only when the gossip state changes or the weights are due a refresh
+func (s *HTTPProviderServer) waitForChange(ctx context.Context, wait time.Duration, unchanged func(*configSnapshot) bool) *configSnapshot {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	refresh := time.NewTicker(weightRefreshInterval)
+	defer refresh.Stop()
+
+	for {
+		snapshot := s.currentSnapshot()
+		if !unchanged(snapshot) {
+			return snapshot
+		}
+		select {
+		case <-s.gossipState.VersionChanged(snapshot.version):
+		case <-refresh.C:
+		case <-timer.C:
+			return snapshot
+		case <-ctx.Done():
+			return snapshot
+		}
+	}
+}
+
+// etagMatches reports whether an If-None-Match header lists the entity tag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
 }
 
 // handleHealth handles health check requests
@@ -394,6 +685,17 @@ func (s *HTTPProviderServer) handleUDPServices(w http.ResponseWriter, r *http.Re
 	s.writeJSON(w, config.UDP.Services)
 }
 
+// handleEntrypoints lists the entrypoints Traefik's static configuration must define
+// for the generated TCP and UDP routers
+func (s *HTTPProviderServer) handleEntrypoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeJSON(w, s.currentSnapshot().entrypoints)
+}
+
 // writeJSON writes a JSON response
 func (s *HTTPProviderServer) writeJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -410,29 +712,87 @@ func (s *HTTPProviderServer) writeJSON(w http.ResponseWriter, data interface{})
 
 // computeConfig computes the Traefik dynamic configuration from gossip state
 func (s *HTTPProviderServer) computeConfig() *TraefikDynamicConfig {
-	// Check if we have a recent cached config
+	return s.currentSnapshot().config
+}
+
+// currentSnapshot returns the configuration for the current gossip state version,
+// computing it only if the state changed since the last computation. Resource and
+// round trip changes are picked up at most every weightRefreshInterval.
+func (s *HTTPProviderServer) currentSnapshot() *configSnapshot {
 	s.mu.RLock()
-	if s.lastConfig != nil && time.Since(s.lastUpdate) < 5*time.Second {
-		config := s.lastConfig
-		s.mu.RUnlock()
-		return config
+	snapshot := s.snapshot
+	s.mu.RUnlock()
+	if s.fresh(snapshot) {
+		return snapshot
 	}
+
+	s.computeMu.Lock()
+	defer s.computeMu.Unlock()
+
+	// Another poll may have computed it meanwhile
+	s.mu.RLock()
+	snapshot = s.snapshot
 	s.mu.RUnlock()
+	if s.fresh(snapshot) {
+		return snapshot
+	}
+	version := s.gossipState.GetVersion()
+	metricsVersion := s.gossipState.GetMetricsVersion()
 
 	// Compute new config
+	httpConfig, fallbacks, dropped := s.computeHTTPConfig()
+	claims := s.transportClaims()
 	config := &TraefikDynamicConfig{
-		HTTP: s.computeHTTPConfig(),
-		TCP:  s.computeTCPConfig(),
-		UDP:  s.computeUDPConfig(),
+		HTTP: httpConfig,
+		TCP:  s.computeTCPConfig(claims),
+		UDP:  s.computeUDPConfig(claims),
+	}
+	body, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode dynamic configuration: %v", err)
 	}
+	sum := sha256.Sum256(body)
 
 	// Cache the config
 	s.mu.Lock()
-	s.lastConfig = config
-	s.lastUpdate = time.Now()
+	snapshot = &configSnapshot{
+		config:      config,
+		fallbacks:   fallbacks,
+		dropped:     dropped,
+		entrypoints: requiredEntrypoints(claims),
+		body:        body,
+		etag:        fmt.Sprintf(`"%x"`, sum[:16]),
+		version:     version,
+
+		metricsVersion: metricsVersion,
+		computedAt:     time.Now(),
+	}
+	changed := s.snapshot == nil || s.snapshot.etag != snapshot.etag
+	var change ConfigChange
+	if changed {
+		s.configIndex++
+		snapshot.index = s.configIndex
+		change = s.recordRevision(snapshot)
+	} else {
+		snapshot.index = s.configIndex
+	}
+	s.snapshot = snapshot
+	handler := s.changeHandler
 	s.mu.Unlock()
 
-	return config
+	if changed && handler != nil {
+		handler(change)
+	}
+	return snapshot
+}
+
+// fresh reports whether a snapshot can be served as is
+func (s *HTTPProviderServer) fresh(snapshot *configSnapshot) bool {
+	if snapshot == nil || snapshot.version != s.gossipState.GetVersion() {
+		return false
+	}
+	return snapshot.metricsVersion == s.gossipState.GetMetricsVersion() ||
+		time.Since(snapshot.computedAt) < weightRefreshInterval
 }
 
 // computeHTTPConfig is implemented in routers.go
@@ -0,0 +1,147 @@
+package traefik
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"cluster/infra/cluster/gossip"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleDynamicConfig_ETag(t *testing.T) {
+	server := newTransportTestServer(webService("web", "node1", true))
+
+	first := getDynamic(server, "", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.NotEmpty(t, first.Body.Bytes())
+
+	// Same configuration: not modified, no body
+	second := getDynamic(server, "", etag)
+	assert.Equal(t, http.StatusNotModified, second.Code)
+	assert.Empty(t, second.Body.Bytes())
+	assert.Equal(t, etag, second.Header().Get("ETag"))
+
+	// Weak and listed tags match too
+	assert.Equal(t, http.StatusNotModified, getDynamic(server, "", `"other", W/`+etag).Code)
+
+	// A routing change produces a new tag
+	server.gossipState.UpdateServiceHealth(webService("web", "node1", false))
+	third := getDynamic(server, "", etag)
+	assert.Equal(t, http.StatusOK, third.Code)
+	assert.NotEqual(t, etag, third.Header().Get("ETag"))
+}
+
+func TestHandleDynamicConfig_LongPollWakesOnChange(t *testing.T) {
+	server := newTransportTestServer(webService("web", "node1", true))
+
+	first := getDynamic(server, "", "")
+	index := first.Header().Get("X-Config-Index")
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- getDynamic(server, "wait=10s&index="+index, "")
+	}()
+
+	// The request blocks while the configuration is unchanged
+	select {
+	case <-done:
+		t.Fatal("long poll returned before the configuration changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.gossipState.UpdateServiceHealth(webService("api", "node1", true))
+
+	select {
+	case response := <-done:
+		assert.Equal(t, http.StatusOK, response.Code)
+		next, err := strconv.ParseUint(response.Header().Get("X-Config-Index"), 10, 64)
+		require.NoError(t, err)
+		previous, _ := strconv.ParseUint(index, 10, 64)
+		assert.Greater(t, next, previous)
+		assert.Contains(t, response.Body.String(), "api-with-failover")
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll did not wake on a configuration change")
+	}
+}
+
+func TestHandleDynamicConfig_LongPollTimeout(t *testing.T) {
+	server := newTransportTestServer(webService("web", "node1", true))
+
+	first := getDynamic(server, "", "")
+	index := first.Header().Get("X-Config-Index")
+	etag := first.Header().Get("ETag")
+
+	start := time.Now()
+	response := getDynamic(server, "wait=100ms&index="+index, "")
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, index, response.Header().Get("X-Config-Index"))
+
+	// With the tag instead of the index, a timeout is not modified
+	response = getDynamic(server, "wait=100ms", etag)
+	assert.Equal(t, http.StatusNotModified, response.Code)
+
+	assert.Equal(t, http.StatusBadRequest, getDynamic(server, "wait=soon", "").Code)
+	assert.Equal(t, http.StatusBadRequest, getDynamic(server, "wait=1s&index=latest", "").Code)
+}
+
+func TestCurrentSnapshot_IgnoresNonRoutingChanges(t *testing.T) {
+	web := webService("web", "node1", true)
+	web.Networks = []string{"backend", "frontend", "monitoring"}
+	server := newTransportTestServer(web)
+	state := server.gossipState
+
+	snapshot := server.currentSnapshot()
+	version := state.GetVersion()
+	metricsVersion := state.GetMetricsVersion()
+
+	// Repeated health checks with the same outcome, on networks listed in another order
+	recheck := webService("web", "node1", true)
+	recheck.Networks = []string{"monitoring", "backend", "frontend"}
+	state.UpdateServiceHealth(recheck)
+
+	// Resource usage and round trips
+	node, _ := state.GetNode("node2")
+	updated := *node
+	updated.Resources = &gossip.NodeResources{CPUPercent: 42, CollectedAt: time.Now()}
+	state.UpdateNode(&updated)
+	state.RecordRTT("node2", 20*time.Millisecond)
+
+	assert.Equal(t, version, state.GetVersion())
+	assert.Greater(t, state.GetMetricsVersion(), metricsVersion)
+	assert.Same(t, snapshot, server.currentSnapshot())
+
+	// Priority is routing relevant
+	prioritized := updated
+	prioritized.Priority = 5
+	state.UpdateNode(&prioritized)
+	assert.Greater(t, state.GetVersion(), version)
+}
+
+// getDynamic requests the dynamic configuration with the given query and If-None-Match
+func getDynamic(server *HTTPProviderServer, query, ifNoneMatch string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/api/dynamic?"+query, nil)
+	if ifNoneMatch != "" {
+		request.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	recorder := httptest.NewRecorder()
+	server.handleDynamicConfig(recorder, request)
+	return recorder
+}
+
+// webService returns an instance of an HTTP service
+func webService(serviceName, nodeName string, healthy bool) *gossip.ServiceHealth {
+	return &gossip.ServiceHealth{
+		ServiceName: serviceName,
+		NodeName:    nodeName,
+		Healthy:     healthy,
+		Endpoints:   map[string]string{"http": "http://" + serviceName + ":8080"},
+	}
+}
@@ -0,0 +1,278 @@
+package traefik
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxLabelIndex bounds list indexes in labels, such as tls.domains[3], so a typo
+	// cannot allocate a huge list
+	maxLabelIndex = 100
+
+	// httpLabelPrefix starts the labels Traefik's Docker provider reads HTTP configuration from
+	httpLabelPrefix = "traefik.http."
+	enableLabel     = "traefik.enable"
+)
+
+// httpLabels is the HTTP configuration a container declares through Traefik labels
+type httpLabels struct {
+	Routers     map[string]*Router       `json:"routers"`
+	Services    map[string]*labelService `json:"services"`
+	Middlewares map[string]*Middleware   `json:"middlewares"`
+}
+
+// labelService is a service as declared in labels: the container's own port and scheme,
+// from which a server is derived for every replica
+type labelService struct {
+	LoadBalancer *labelLoadBalancer `json:"loadBalancer"`
+}
+
+// labelLoadBalancer holds the load balancer options of a label service
+type labelLoadBalancer struct {
+	Server           *labelServer `json:"server"`
+	HealthCheck      *HealthCheck `json:"healthCheck"`
+	Sticky           *Sticky      `json:"sticky"`
+	PassHostHeader   *bool        `json:"passHostHeader"`
+	ServersTransport string       `json:"serversTransport"`
+}
+
+// labelServer is the port and scheme a replica serves on
+type labelServer struct {
+	Port   string `json:"port"`
+	Scheme string `json:"scheme"`
+}
+
+// parseHTTPLabels decodes traefik.http.* labels the way Traefik's Docker provider does:
+// "traefik.http.routers.api.rule" sets the rule of router "api". Option names are
+// matched case-insensitively; labels that do not decode are skipped and reported.
+func parseHTTPLabels(labels map[string]string) (*httpLabels, error) {
+	config := &httpLabels{}
+	if strings.EqualFold(labels[enableLabel], "false") {
+		return config, nil
+	}
+
+	var errs []error
+	for _, key := range sortedKeys(labels) {
+		if !strings.HasPrefix(strings.ToLower(key), httpLabelPrefix) {
+			continue
+		}
+		path := strings.Split(key[len(httpLabelPrefix):], ".")
+		if err := setLabel(reflect.ValueOf(config).Elem(), path, labels[key]); err != nil {
+			errs = append(errs, fmt.Errorf("label %s: %w", key, err))
+		}
+	}
+	return config, errors.Join(errs...)
+}
+
+// serverAddress returns the scheme and port a label service declares; with no name,
+// those of the container's only service
+func (l *httpLabels) serverAddress(serviceName string) (string, string) {
+	if serviceName == "" && len(l.Services) == 1 {
+		serviceName = sortedKeys(l.Services)[0]
+	}
+	scheme, port := "http", ""
+	service := l.Services[serviceName]
+	if service != nil && service.LoadBalancer != nil && service.LoadBalancer.Server != nil {
+		if service.LoadBalancer.Server.Scheme != "" {
+			scheme = service.LoadBalancer.Server.Scheme
+		}
+		port = service.LoadBalancer.Server.Port
+	}
+	return scheme, port
+}
+
+// loadBalancer returns the load balancer options of a label service; with no name,
+// those of the container's only service
+func (l *httpLabels) loadBalancer(serviceName string) *labelLoadBalancer {
+	if serviceName == "" && len(l.Services) == 1 {
+		serviceName = sortedKeys(l.Services)[0]
+	}
+	if service := l.Services[serviceName]; service != nil {
+		return service.LoadBalancer
+	}
+	return nil
+}
+
+// apply sets the options declared in labels on a generated load balancer, keeping
+// its defaults for everything the labels leave out
+func (options *labelLoadBalancer) apply(lb *LoadBalancer) {
+	if options == nil {
+		return
+	}
+	if options.HealthCheck != nil {
+		lb.HealthCheck = mergeHealthCheck(lb.HealthCheck, options.HealthCheck)
+	}
+	if options.Sticky != nil {
+		sticky := *options.Sticky
+		if sticky.Cookie == nil {
+			// sticky=true asks for a cookie with Traefik's defaults
+			sticky.Cookie = &StickyCookie{}
+		}
+		lb.Sticky = &sticky
+	}
+	if options.PassHostHeader != nil {
+		lb.PassHostHeader = options.PassHostHeader
+	}
+	if options.ServersTransport != "" {
+		lb.ServersTransport = options.ServersTransport
+	}
+}
+
+// mergeHealthCheck overlays the options set in override on base
+func mergeHealthCheck(base, override *HealthCheck) *HealthCheck {
+	if base == nil {
+		merged := *override
+		return &merged
+	}
+	merged := *base
+	overrides := reflect.ValueOf(override).Elem()
+	target := reflect.ValueOf(&merged).Elem()
+	for i := 0; i < overrides.NumField(); i++ {
+		if !overrides.Field(i).IsZero() {
+			target.Field(i).Set(overrides.Field(i))
+		}
+	}
+	return &merged
+}
+
+// setLabel sets the option at path below v from a label value
+func setLabel(v reflect.Value, path []string, value string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if len(path) == 0 && v.Type().Elem().Kind() == reflect.Struct && strings.EqualFold(value, "false") {
+			// tls=false and the like leave a section disabled
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setLabel(v.Elem(), path, value)
+
+	case reflect.Struct:
+		// A bare option enables a section with its defaults, e.g. middlewares.gzip.compress=true
+		if len(path) == 0 {
+			return nil
+		}
+		name, index, hasIndex, err := splitIndex(path[0])
+		if err != nil {
+			return err
+		}
+		field, ok := fieldByJSONName(v, name)
+		if !ok {
+			return fmt.Errorf("unknown option %q", name)
+		}
+		if !hasIndex {
+			return setLabel(field, path[1:], value)
+		}
+		if field.Kind() != reflect.Slice {
+			return fmt.Errorf("option %q is not a list", name)
+		}
+		if index > maxLabelIndex {
+			return fmt.Errorf("index %d of %q is above %d", index, name, maxLabelIndex)
+		}
+		if field.Len() <= index {
+			grown := reflect.MakeSlice(field.Type(), index+1, index+1)
+			reflect.Copy(grown, field)
+			field.Set(grown)
+		}
+		return setLabel(field.Index(index), path[1:], value)
+
+	case reflect.Map:
+		if len(path) == 0 {
+			return fmt.Errorf("missing name")
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(path[0])
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(key); existing.IsValid() {
+			elem.Set(existing)
+		}
+		if err := setLabel(elem, path[1:], value); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+	}
+
+	if len(path) > 0 {
+		return fmt.Errorf("unknown option %q", path[0])
+	}
+	return setScalar(v, value)
+}
+
+// setScalar converts a label value to a string, bool, number or comma separated list
+func setScalar(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		items := strings.Split(value, ",")
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setScalar(list.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		v.Set(list)
+	default:
+		return fmt.Errorf("unsupported option type %s", v.Type())
+	}
+	return nil
+}
+
+// splitIndex splits a list element reference such as "domains[0]"
+func splitIndex(segment string) (string, int, bool, error) {
+	open := strings.Index(segment, "[")
+	if open < 0 || !strings.HasSuffix(segment, "]") {
+		return segment, 0, false, nil
+	}
+	index, err := strconv.Atoi(segment[open+1 : len(segment)-1])
+	if err != nil || index < 0 {
+		return "", 0, false, fmt.Errorf("invalid index in %q", segment)
+	}
+	if index > maxLabelIndex {
+		return "", 0, false, fmt.Errorf("index in %q is above %d", segment, maxLabelIndex)
+	}
+	return segment[:open], index, true, nil
+}
+
+// fieldByJSONName finds a struct field by its JSON name, ignoring case
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if strings.EqualFold(tag, name) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// sortedKeys returns the keys of a map in order, for a stable generated config
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,195 @@
+package traefik
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHTTPLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		check   func(t *testing.T, config *httpLabels)
+		wantErr string
+	}{
+		{
+			name: "option names ignore case",
+			labels: map[string]string{
+				"traefik.http.routers.api.rule":                           "Host(`api.example.com`)",
+				"Traefik.HTTP.Routers.api.EntryPoints":                    "websecure",
+				"traefik.http.services.api.loadbalancer.server.port":      "8080",
+				"traefik.http.services.api.loadBalancer.healthcheck.path": "/healthz",
+			},
+			check: func(t *testing.T, config *httpLabels) {
+				require.Contains(t, config.Routers, "api")
+				assert.Equal(t, "Host(`api.example.com`)", config.Routers["api"].Rule)
+				assert.Equal(t, []string{"websecure"}, config.Routers["api"].EntryPoints)
+				scheme, port := config.serverAddress("api")
+				assert.Equal(t, "http", scheme)
+				assert.Equal(t, "8080", port)
+				assert.Equal(t, "/healthz", config.loadBalancer("api").HealthCheck.Path)
+			},
+		},
+		{
+			name: "indexed lists",
+			labels: map[string]string{
+				"traefik.http.routers.web.tls.domains[1].main": "www.example.com",
+				"traefik.http.routers.web.tls.domains[0].main": "example.com",
+				"traefik.http.routers.web.tls.domains[0].sans": "a.example.com, b.example.com",
+			},
+			check: func(t *testing.T, config *httpLabels) {
+				require.NotNil(t, config.Routers["web"].TLS)
+				assert.Equal(t, []Domain{
+					{Main: "example.com", SANs: []string{"a.example.com", "b.example.com"}},
+					{Main: "www.example.com"},
+				}, config.Routers["web"].TLS.Domains)
+			},
+		},
+		{
+			name: "comma separated lists",
+			labels: map[string]string{
+				"traefik.http.routers.web.middlewares":                          "auth, compress",
+				"traefik.http.middlewares.auth.basicauth.users":                 "admin:hash1,ops:hash2",
+				"traefik.http.middlewares.office.ipallowlist.sourcerange":       "10.0.0.0/8,192.168.0.0/16",
+				"traefik.http.middlewares.office.ipallowlist.ipstrategy.depth":  "1",
+				"traefik.http.middlewares.stack.chain.middlewares":              "office,auth",
+				"traefik.http.middlewares.flaky.retry.attempts":                 "3",
+				"traefik.http.middlewares.prefixed.addprefix.prefix":            "/api",
+				"traefik.http.middlewares.limited.inflightreq.amount":           "50",
+				"traefik.http.middlewares.breaker.circuitbreaker.expression":    "NetworkErrorRatio() > 0.5",
+				"traefik.http.middlewares.versioned.stripprefixregex.regex":     "/v[0-9]+",
+				"traefik.http.middlewares.legacy.ipwhitelist.sourcerange":       "127.0.0.1/32",
+				"traefik.http.middlewares.rewrite.replacepathregex.regex":       "^/old/(.*)",
+				"traefik.http.middlewares.rewrite.replacepathregex.replacement": "/new/$1",
+			},
+			check: func(t *testing.T, config *httpLabels) {
+				assert.Equal(t, []string{"auth", "compress"}, config.Routers["web"].Middlewares)
+				assert.Equal(t, []string{"admin:hash1", "ops:hash2"}, config.Middlewares["auth"].BasicAuth.Users)
+				assert.Equal(t, []string{"10.0.0.0/8", "192.168.0.0/16"}, config.Middlewares["office"].IPAllowList.SourceRange)
+				assert.Equal(t, 1, config.Middlewares["office"].IPAllowList.IPStrategy.Depth)
+				assert.Equal(t, []string{"office", "auth"}, config.Middlewares["stack"].Chain.Middlewares)
+				assert.Equal(t, 3, config.Middlewares["flaky"].Retry.Attempts)
+				assert.Equal(t, "/api", config.Middlewares["prefixed"].AddPrefix.Prefix)
+				assert.Equal(t, int64(50), config.Middlewares["limited"].InFlightReq.Amount)
+				assert.Equal(t, "NetworkErrorRatio() > 0.5", config.Middlewares["breaker"].CircuitBreaker.Expression)
+				assert.Equal(t, []string{"/v[0-9]+"}, config.Middlewares["versioned"].StripPrefixRegex.Regex)
+				assert.Equal(t, []string{"127.0.0.1/32"}, config.Middlewares["legacy"].IPWhiteList.SourceRange)
+				assert.Equal(t, "/new/$1", config.Middlewares["rewrite"].ReplacePathRegex.Replacement)
+			},
+		},
+		{
+			name: "tls=false leaves tls disabled",
+			labels: map[string]string{
+				"traefik.http.routers.web.rule": "Host(`example.com`)",
+				"traefik.http.routers.web.tls":  "false",
+			},
+			check: func(t *testing.T, config *httpLabels) {
+				assert.Nil(t, config.Routers["web"].TLS)
+			},
+		},
+		{
+			name: "bare sections enable their defaults",
+			labels: map[string]string{
+				"traefik.http.routers.web.tls":                          "true",
+				"traefik.http.middlewares.gzip.compress":                "true",
+				"traefik.http.services.web.loadbalancer.sticky":         "true",
+				"traefik.http.services.web.loadbalancer.server.port":    "80",
+				"traefik.http.services.web.loadbalancer.passhostheader": "false",
+			},
+			check: func(t *testing.T, config *httpLabels) {
+				assert.Equal(t, &TLS{}, config.Routers["web"].TLS)
+				assert.Equal(t, &CompressMiddleware{}, config.Middlewares["gzip"].Compress)
+
+				lb := &LoadBalancer{}
+				config.loadBalancer("web").apply(lb)
+				require.NotNil(t, lb.Sticky)
+				assert.NotNil(t, lb.Sticky.Cookie)
+				require.NotNil(t, lb.PassHostHeader)
+				assert.False(t, *lb.PassHostHeader)
+			},
+		},
+		{
+			name:   "disabled container",
+			labels: map[string]string{enableLabel: "false", "traefik.http.routers.web.rule": "Host(`example.com`)"},
+			check: func(t *testing.T, config *httpLabels) {
+				assert.Empty(t, config.Routers)
+			},
+		},
+		{
+			name: "bad boolean",
+			labels: map[string]string{
+				"traefik.http.routers.web.rule":                         "Host(`example.com`)",
+				"traefik.http.services.web.loadbalancer.passhostheader": "yes please",
+			},
+			wantErr: `invalid boolean "yes please"`,
+		},
+		{
+			name:    "bad number",
+			labels:  map[string]string{"traefik.http.routers.web.priority": "high"},
+			wantErr: `invalid number "high"`,
+		},
+		{
+			name:    "unknown option",
+			labels:  map[string]string{"traefik.http.routers.web.rules": "Host(`example.com`)"},
+			wantErr: `unknown option "rules"`,
+		},
+		{
+			name:    "index above the cap",
+			labels:  map[string]string{"traefik.http.routers.web.tls.domains[1000000000].main": "example.com"},
+			wantErr: "is above 100",
+		},
+		{
+			name:    "negative index",
+			labels:  map[string]string{"traefik.http.routers.web.tls.domains[-1].main": "example.com"},
+			wantErr: "invalid index",
+		},
+		{
+			name:    "index on an option that is not a list",
+			labels:  map[string]string{"traefik.http.routers.web.rule[0]": "Host(`example.com`)"},
+			wantErr: "is not a list",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseHTTPLabels(tt.labels)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestParseHTTPLabels_SkipsOnlyBadLabels(t *testing.T) {
+	config, err := parseHTTPLabels(map[string]string{
+		"traefik.http.routers.web.rule":     "Host(`example.com`)",
+		"traefik.http.routers.web.priority": "high",
+	})
+
+	require.Error(t, err)
+	require.Contains(t, config.Routers, "web")
+	assert.Equal(t, "Host(`example.com`)", config.Routers["web"].Rule)
+	assert.Zero(t, config.Routers["web"].Priority)
+}
+
+func TestSplitIndex(t *testing.T) {
+	name, index, hasIndex, err := splitIndex("domains[100]")
+	require.NoError(t, err)
+	assert.Equal(t, "domains", name)
+	assert.Equal(t, 100, index)
+	assert.True(t, hasIndex)
+
+	_, _, _, err = splitIndex("domains[101]")
+	assert.Error(t, err)
+
+	name, _, hasIndex, err = splitIndex("domains")
+	require.NoError(t, err)
+	assert.Equal(t, "domains", name)
+	assert.False(t, hasIndex)
+}
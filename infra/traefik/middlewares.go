@@ -0,0 +1,121 @@
+package traefik
+
+import (
+	"fmt"
+	"strings"
+
+	"cluster/infra/cluster/gossip"
+)
+
+const (
+	// MiddlewaresLabel appends middlewares to the chain of a service's routers
+	MiddlewaresLabel = "constellation.middlewares"
+	// MiddlewareDefaultsLabel set to false leaves the global defaults out of the chain
+	MiddlewareDefaultsLabel = "constellation.middlewares.defaults"
+
+	// thisProvider is the provider name Traefik gives the configuration served here
+	thisProvider = "http"
+)
+
+// SetDefaultMiddlewares sets the middlewares every router starts its chain with, such as
+// "crowdsec@file" from the Traefik configuration. Unqualified names must be middlewares
+// this provider defines itself.
+func (s *HTTPProviderServer) SetDefaultMiddlewares(middlewares []string) error {
+	common := &HTTPConfig{Middlewares: make(map[string]*Middleware)}
+	s.generateCommonMiddlewares(common)
+	for _, middleware := range middlewares {
+		name, provider, qualified := strings.Cut(middleware, "@")
+		if qualified && provider != thisProvider {
+			continue
+		}
+		if _, ok := common.Middlewares[name]; !ok {
+			return fmt.Errorf("default middleware %q is not defined", middleware)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultMiddlewares = middlewares
+	s.snapshot = nil
+	return nil
+}
+
+// middlewareChain composes the chain of a service's router: the global defaults unless
+// the service opts out, the service's constellation.middlewares, then the router's own
+func (s *HTTPProviderServer) middlewareChain(health *gossip.ServiceHealth, own []string) []string {
+	chain := make([]string, 0)
+	if !strings.EqualFold(health.Labels[MiddlewareDefaultsLabel], "false") {
+		s.mu.RLock()
+		chain = append(chain, s.defaultMiddlewares...)
+		s.mu.RUnlock()
+	}
+	for _, middleware := range strings.Split(health.Labels[MiddlewaresLabel], ",") {
+		if middleware = strings.TrimSpace(middleware); middleware != "" {
+			chain = append(chain, middleware)
+		}
+	}
+	return append(chain, own...)
+}
+
+// resolveMiddlewares checks that every middleware the routers reference exists, keeping
+// the first occurrence of each in a chain. Names defined here resolve to this provider,
+// also when qualified with @docker, since the Docker provider only knows the labels of
+// its own node. Other providers (crowdsec@file) are Traefik's to resolve; an unqualified
+// name matching one of the default middlewares resolves to its provider.
+//
+// Routers referencing an undefined middleware are dropped, since serving them without
+// it could skip authentication. They are returned by the service owning them, with
+// the reason.
+func (s *HTTPProviderServer) resolveMiddlewares(config *HTTPConfig, owners map[string]string) map[string]map[string]string {
+	s.mu.RLock()
+	external := make(map[string]string)
+	for _, middleware := range s.defaultMiddlewares {
+		if name, provider, qualified := strings.Cut(middleware, "@"); qualified && provider != thisProvider {
+			external[name] = middleware
+		}
+	}
+	s.mu.RUnlock()
+
+	dropped := make(map[string]map[string]string)
+	for _, routerName := range sortedKeys(config.Routers) {
+		router := config.Routers[routerName]
+		resolved := make([]string, 0, len(router.Middlewares))
+		for _, middleware := range router.Middlewares {
+			reference, err := resolveMiddleware(config, external, middleware)
+			if err != nil {
+				s.warnOnce("Warning: dropping router %s: %v", routerName, err)
+				delete(config.Routers, routerName)
+				owner := owners[routerName]
+				if dropped[owner] == nil {
+					dropped[owner] = make(map[string]string)
+				}
+				dropped[owner][routerName] = err.Error()
+				break
+			}
+			resolved = appendUnique(resolved, reference)
+		}
+		router.Middlewares = resolved
+	}
+	return dropped
+}
+
+// DroppedRouters returns the routers of a service this node's configuration leaves out
+// for referencing an undefined middleware, with the reason
+func (s *HTTPProviderServer) DroppedRouters(serviceName string) map[string]string {
+	return s.currentSnapshot().dropped[serviceName]
+}
+
+// resolveMiddleware returns the reference a router should use for a middleware
+func resolveMiddleware(config *HTTPConfig, external map[string]string, middleware string) (string, error) {
+	name, provider, qualified := strings.Cut(middleware, "@")
+	if _, defined := config.Middlewares[name]; defined && (!qualified || provider == thisProvider || provider == "docker") {
+		return name, nil
+	}
+	switch {
+	case qualified && provider != thisProvider:
+		return middleware, nil
+	case !qualified && external[name] != "":
+		return external[name], nil
+	}
+	return "", fmt.Errorf("middleware %q is not defined", middleware)
+}
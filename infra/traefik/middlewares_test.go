@@ -0,0 +1,42 @@
+package traefik
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveMiddlewares_DropsRoutersWithUndefinedMiddlewares(t *testing.T) {
+	web := webService("web", "node1", true)
+	web.Labels = map[string]string{MiddlewaresLabel: "auth"}
+	api := webService("api", "node1", true)
+	api.Labels = map[string]string{MiddlewaresLabel: "crowdsec, compress"}
+	blog := webService("blog", "node1", true)
+	blog.Labels = map[string]string{
+		"traefik.http.routers.blog.rule":        "Host(`blog.example.com`)",
+		"traefik.http.routers.blog.middlewares": "missing",
+	}
+
+	server := newTransportTestServer(web, api, blog)
+	require.NoError(t, server.SetDefaultMiddlewares([]string{"crowdsec@file"}))
+	config := server.currentSnapshot().config.HTTP
+
+	// Every router of web is dropped, and reported against it
+	assert.NotContains(t, config.Routers, "web-with-failover")
+	assert.NotContains(t, config.Routers, "web-node1-direct")
+	assert.Equal(t, map[string]string{
+		"web-with-failover": `middleware "auth" is not defined`,
+		"web-node1-direct":  `middleware "auth" is not defined`,
+	}, server.DroppedRouters("web"))
+
+	// Defined and external middlewares resolve
+	require.Contains(t, config.Routers, "api-with-failover")
+	assert.Equal(t, []string{"crowdsec@file", "compress"}, config.Routers["api-with-failover"].Middlewares)
+	assert.Empty(t, server.DroppedRouters("api"))
+
+	// A label router is reported against the service declaring it
+	assert.NotContains(t, config.Routers, "blog")
+	assert.Contains(t, config.Routers, "blog-with-failover")
+	assert.Equal(t, map[string]string{"blog": `middleware "missing" is not defined`}, server.DroppedRouters("blog"))
+}
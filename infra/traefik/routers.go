@@ -2,13 +2,20 @@ package traefik
 
 import (
 	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 
 	"cluster/infra/cluster/gossip"
 )
 
-// computeHTTPConfig computes HTTP/HTTPS routers and services from gossip state
-func (s *HTTPProviderServer) computeHTTPConfig() *HTTPConfig {
+// computeHTTPConfig computes HTTP/HTTPS routers and services from gossip state, the
+// fallback served for each service that is down, and the routers of each service left
+// out of the configuration with the reason
+func (s *HTTPProviderServer) computeHTTPConfig() (*HTTPConfig, map[string]string, map[string]map[string]string) {
 	config := &HTTPConfig{
 		Routers:     make(map[string]*Router),
 		Services:    make(map[string]*Service),
@@ -35,19 +42,36 @@ func (s *HTTPProviderServer) computeHTTPConfig() *HTTPConfig {
 		allServices[serviceName] = append(allServices[serviceName], health)
 	}
 
+	// Routers declared in labels, from every healthy replica and the replicas of
+	// services that are down
+	labelEntries := make([]*gossip.ServiceHealth, 0)
+	fallbacks := make(map[string]*fallbackRoute)
+	owners := make(map[string]string) // Router -> service it was generated for
+
 	// For each service, create routers and services
-	for serviceName, healthEntries := range allServices {
-		// Filter to only healthy services
+	for _, serviceName := range sortedKeys(allServices) {
+		healthEntries := allServices[serviceName]
+		// Filter to services that are healthy with their dependencies met
 		healthyEntries := make([]*gossip.ServiceHealth, 0)
 		for _, health := range healthEntries {
-			if health.Healthy {
+			if health.EffectiveHealthy() {
 				healthyEntries = append(healthyEntries, health)
 			}
 		}
 
 		if len(healthyEntries) == 0 {
-			continue // Skip services with no healthy instances
+			// Keep the routers in place, pointing at the service's fallback
+			sort.Slice(healthEntries, func(i, j int) bool { return healthEntries[i].Key() < healthEntries[j].Key() })
+			route := s.fallbackRoute(config, serviceName, healthEntries[0])
+			if route == nil {
+				continue
+			}
+			fallbacks[serviceName] = route
+			s.addFallbackRouters(config, serviceName, healthEntries, route, owners)
+			labelEntries = append(labelEntries, healthEntries...)
+			continue
 		}
+		sort.Slice(healthyEntries, func(i, j int) bool { return healthyEntries[i].Key() < healthyEntries[j].Key() })
 
 		// Create direct router: <service>.<node>.domain
 		for _, health := range healthyEntries {
@@ -57,6 +81,7 @@ func (s *HTTPProviderServer) computeHTTPConfig() *HTTPConfig {
 			// Create router rule
 			rule := fmt.Sprintf("Host(`%s.%s.%s`)", serviceName, health.NodeName, s.domain)
 
+			owners[routerName] = serviceName
 			config.Routers[routerName] = &Router{
 				Rule:        rule,
 				Service:     serviceNameDirect,
@@ -64,20 +89,30 @@ func (s *HTTPProviderServer) computeHTTPConfig() *HTTPConfig {
 				TLS: &TLS{
 					CertResolver: "letsencrypt",
 				},
+				Middlewares: s.middlewareChain(health, nil),
 			}
 
 			// Create direct service (points to local service)
 			httpEndpoint := health.Endpoints["http"]
 			if httpEndpoint == "" {
-				// Fallback: construct from service name
-				httpEndpoint = fmt.Sprintf("http://%s:8080", serviceName)
+				// Fallback: construct from service name and the port its labels declare
+				labels, _ := parseHTTPLabels(health.Labels)
+				scheme, port := labels.serverAddress("")
+				if port == "" {
+					port = "8080"
+				}
+				httpEndpoint = fmt.Sprintf("%s://%s:%s", scheme, serviceName, port)
+			}
+
+			// Further replicas on the node join its direct service
+			servers := []Server{{URL: httpEndpoint}}
+			if existing, ok := config.Services[serviceNameDirect]; ok {
+				servers = appendUnique(existing.LoadBalancer.Servers, Server{URL: httpEndpoint})
 			}
 
 			config.Services[serviceNameDirect] = &Service{
 				LoadBalancer: &LoadBalancer{
-					Servers: []Server{
-						{URL: httpEndpoint},
-					},
+					Servers: servers,
 				},
 			}
 		}
@@ -89,6 +124,7 @@ func (s *HTTPProviderServer) computeHTTPConfig() *HTTPConfig {
 
 			rule := fmt.Sprintf("Host(`%s.%s`)", serviceName, s.domain)
 
+			owners[routerName] = serviceName
 			config.Routers[routerName] = &Router{
 				Rule:        rule,
 				Service:     serviceNameFailover,
@@ -96,45 +132,197 @@ func (s *HTTPProviderServer) computeHTTPConfig() *HTTPConfig {
 				TLS: &TLS{
 					CertResolver: "letsencrypt",
 				},
+				Middlewares: s.middlewareChain(healthyEntries[0], nil),
 			}
 
-			// Create failover service with all healthy backends
-			servers := make([]Server, 0, len(healthyEntries))
-			for _, health := range healthyEntries {
-				httpEndpoint := health.Endpoints["http"]
-				if httpEndpoint == "" {
-					// Construct endpoint from service name and node
-					// For cross-node access, use the node-specific domain
-					httpEndpoint = fmt.Sprintf("https://%s.%s.%s", serviceName, health.NodeName, s.domain)
+			// Create failover service preferring this node's healthy backends
+			// Degraded instances only receive traffic when no instance is fully healthy
+			balancedEntries := preferHealthy(healthyEntries)
+			s.addFailoverService(config, serviceName, balancedEntries)
+
+			labelEntries = append(labelEntries, balancedEntries...)
+		}
+	}
+
+	// Generate common middlewares
+	s.generateCommonMiddlewares(config)
+
+	s.addLabelRouters(config, labelEntries, fallbacks, owners)
+	s.checkFallbackServices(config, fallbacks, owners)
+	dropped := s.resolveMiddlewares(config, owners)
+
+	descriptions := make(map[string]string, len(fallbacks))
+	for serviceName, route := range fallbacks {
+		descriptions[serviceName] = route.description
+	}
+	return config, descriptions, dropped
+}
+
+// addLabelRouters serves the routers, services and middlewares declared in traefik.http.*
+// labels cluster-wide. A label service gets a server for every replica declaring it, on
+// any node. Traefik's Docker provider only sees the replicas on its own node. Routers of
+// a service that is down point at its fallback instead.
+func (s *HTTPProviderServer) addLabelRouters(config *HTTPConfig, entries []*gossip.ServiceHealth, fallbacks map[string]*fallbackRoute, owners map[string]string) {
+	for _, health := range entries {
+		if len(health.Labels) == 0 {
+			continue
+		}
+		labels, err := parseHTTPLabels(health.Labels)
+		if err != nil {
+			s.warnOnce("Warning: skipping invalid Traefik labels of %s: %v", health.ServiceName, err)
+		}
+
+		// Like the Docker provider, routers without a service use the container's only
+		// service; without any, the generated load-balanced service
+		fallback := fallbacks[health.ServiceName]
+		defaultService := fmt.Sprintf("%s-with-failover", health.ServiceName)
+		if len(labels.Services) == 1 {
+			defaultService = sortedKeys(labels.Services)[0]
+		}
+
+		for _, name := range sortedKeys(labels.Routers) {
+			router := labels.Routers[name]
+			if router.Rule == "" {
+				s.warnOnce("Warning: router %s of %s has no rule", name, health.ServiceName)
+				continue
+			}
+			if router.Service == "" {
+				if len(labels.Services) > 1 {
+					s.warnOnce("Warning: router %s of %s must name one of its services", name, health.ServiceName)
+					continue
 				}
-				servers = append(servers, Server{URL: httpEndpoint})
+				router.Service = defaultService
+			}
+			if len(router.EntryPoints) == 0 {
+				router.EntryPoints = []string{"websecure"}
+				if router.TLS == nil {
+					router.TLS = &TLS{CertResolver: "letsencrypt"}
+				}
+			}
+			if _, own := labels.Services[router.Service]; fallback != nil && (own || router.Service == defaultService) {
+				router.Service = fallback.service
+				router.Middlewares = append(router.Middlewares, fallback.middlewares...)
+			}
+			router.Middlewares = s.middlewareChain(health, router.Middlewares)
+			if router.Priority == 0 {
+				// Take precedence over the copy of the router the Docker provider serves
+				// with only this node's replicas
+				router.Priority = len(router.Rule) + 1
 			}
 
-			// Get health check config from first healthy entry (they should be similar)
-			var healthCheck *HealthCheck
-			if len(healthyEntries) > 0 {
-				// Extract health check path from labels or use default
-				healthCheck = &HealthCheck{
-					Path:     "/",
-					Interval: "30s",
-					Timeout:  "10s",
+			if existing, ok := config.Routers[name]; ok {
+				if !reflect.DeepEqual(existing, router) {
+					s.warnOnce("Warning: router %s of %s conflicts with another definition, keeping the first", name, health.ServiceName)
 				}
+				continue
 			}
+			config.Routers[name] = router
+			owners[name] = health.ServiceName
+		}
 
-			config.Services[serviceNameFailover] = &Service{
-				LoadBalancer: &LoadBalancer{
-					Servers:     servers,
-					HealthCheck: healthCheck,
-					Method:      "wrr", // Weighted round robin
-				},
+		for _, name := range sortedKeys(labels.Services) {
+			if fallback != nil {
+				break // No replica to serve them
 			}
+			server := Server{URL: s.labelServerURL(health, labels, name)}
+			if existing, ok := config.Services[name]; ok {
+				if existing.LoadBalancer != nil {
+					existing.LoadBalancer.Servers = appendUnique(existing.LoadBalancer.Servers, server)
+				}
+				continue
+			}
+			loadBalancer := &LoadBalancer{
+				Servers: []Server{server},
+			}
+			labels.loadBalancer(name).apply(loadBalancer)
+			config.Services[name] = &Service{
+				LoadBalancer: loadBalancer,
+			}
+		}
+
+		for _, name := range sortedKeys(labels.Middlewares) {
+			middleware := labels.Middlewares[name]
+			if existing, ok := config.Middlewares[name]; ok {
+				if !reflect.DeepEqual(existing, middleware) {
+					s.warnOnce("Warning: middleware %s of %s conflicts with another definition, keeping the first", name, health.ServiceName)
+				}
+				continue
+			}
+			config.Middlewares[name] = middleware
 		}
 	}
+}
+
+// labelServerURL returns the URL a replica serves a label service on: the container
+// itself on this node, its published port over Tailscale on other nodes, and otherwise
+// the node-direct router of the replica's node
+func (s *HTTPProviderServer) labelServerURL(health *gossip.ServiceHealth, labels *httpLabels, serviceName string) string {
+	scheme, port := labels.serverAddress(serviceName)
+	if port == "" {
+		port = "8080"
+	}
+	if health.NodeName == s.localNodeName {
+		return fmt.Sprintf("%s://%s:%s", scheme, health.ServiceName, port)
+	}
 
-	// Generate common middlewares
-	s.generateCommonMiddlewares(config)
+	if binding, ok := health.Endpoints[port+"/tcp"]; ok {
+		node, exists := s.gossipState.GetNode(health.NodeName)
+		if _, hostPort, err := net.SplitHostPort(binding); err == nil && exists && node.TailscaleIP != "" {
+			return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(node.TailscaleIP, hostPort))
+		}
+	}
+	return fmt.Sprintf("https://%s.%s.%s", health.ServiceName, health.NodeName, s.domain)
+}
 
-	return config
+// warnOnce logs a configuration problem the first time it is seen, since the
+// configuration is recomputed on every poll
+func (s *HTTPProviderServer) warnOnce(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if _, seen := s.warnings.LoadOrStore(message, true); !seen {
+		log.Print(message)
+	}
+}
+
+// defaultHealthCheck is how Traefik checks the servers of a generated load-balanced
+// service whose labels set no health check: the path of the service's active HTTP
+// probe, if it declares one, since "/" may well redirect or require a login
+func defaultHealthCheck(health *gossip.ServiceHealth) *HealthCheck {
+	healthCheck := &HealthCheck{
+		Path:     "/",
+		Interval: "30s",
+		Timeout:  "10s",
+	}
+	if health.Probe != nil && health.Probe.Type == "http" {
+		if target, err := url.Parse(health.Probe.Target); err == nil && target.Path != "" {
+			healthCheck.Path = target.RequestURI()
+		}
+	}
+	return healthCheck
+}
+
+// appendUnique appends a server unless replicas on the same node already added it
+func appendUnique[T comparable](servers []T, server T) []T {
+	for _, existing := range servers {
+		if existing == server {
+			return servers
+		}
+	}
+	return append(servers, server)
+}
+
+// preferHealthy drops degraded instances while any instance is fully healthy
+func preferHealthy(entries []*gossip.ServiceHealth) []*gossip.ServiceHealth {
+	healthy := make([]*gossip.ServiceHealth, 0, len(entries))
+	for _, health := range entries {
+		// Agents that predate health states report none
+		if health.State == "" || health.State == "healthy" {
+			healthy = append(healthy, health)
+		}
+	}
+	if len(healthy) == 0 {
+		return entries
+	}
+	return healthy
 }
 
 // generateCommonMiddlewares generates common middleware configurations
@@ -2,208 +2,217 @@ package traefik
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 
 	"cluster/infra/cluster/gossip"
 )
 
-// computeTCPConfig computes TCP routers and services from gossip state
-func (s *HTTPProviderServer) computeTCPConfig() *TCPConfig {
-	config := &TCPConfig{
-		Routers:  make(map[string]*TCPRouter),
-		Services: make(map[string]*TCPService),
-	}
+const (
+	// TransportPortLabel declares the TCP or UDP port a container serves on
+	TransportPortLabel = "constellation.transport.port"
+	// TransportProtocolLabel is tcp (the default) or udp
+	TransportProtocolLabel = "constellation.transport.protocol"
+	// TransportListenLabel is the port Traefik listens on; the container port by default
+	TransportListenLabel = "constellation.transport.listen"
+	// TransportTLSLabel is how a TCP service handles TLS: TLSModeNone (the default),
+	// TLSModePassthrough or TLSModeTerminate
+	TransportTLSLabel = "constellation.transport.tls"
+
+	// TLSModeNone forwards plain TCP, as Redis, Postgres and MongoDB clients speak it
+	TLSModeNone = "none"
+	// TLSModePassthrough forwards TLS connections to the service, which terminates them
+	TLSModePassthrough = "passthrough"
+	// TLSModeTerminate has Traefik terminate TLS and forward plain TCP
+	TLSModeTerminate = "terminate"
+)
 
-	// Get all service health entries
-	serviceHealthMap := s.gossipState.GetAllServiceHealth()
+// transport is the TCP or UDP port a service declares in labels
+type transport struct {
+	Protocol string // tcp or udp
+	Port     int    // Container port
+	Listen   int    // Port of the entrypoint
+	TLS      string // TCP only
+}
 
-	// Group services by name
-	allServices := make(map[string][]*gossip.ServiceHealth)
-	for key, health := range serviceHealthMap {
-		parts := strings.Split(key, "@")
-		if len(parts) != 2 {
-			continue
-		}
-		serviceName := parts[0]
+// parseTransport reads a service's transport labels; nil when it declares no port
+func parseTransport(labels map[string]string) (*transport, error) {
+	value, ok := labels[TransportPortLabel]
+	if !ok {
+		return nil, nil
+	}
+	t := &transport{Protocol: "tcp", TLS: TLSModeNone}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid %s %q", TransportPortLabel, value)
+	}
+	t.Port, t.Listen = port, port
 
-		// Only include services that have TCP endpoints
-		if _, hasTCP := health.Endpoints["tcp"]; hasTCP || isTCPService(serviceName) {
-			if allServices[serviceName] == nil {
-				allServices[serviceName] = make([]*gossip.ServiceHealth, 0)
-			}
-			allServices[serviceName] = append(allServices[serviceName], health)
+	if value, ok := labels[TransportListenLabel]; ok {
+		listen, err := strconv.Atoi(value)
+		if err != nil || listen < 1 || listen > 65535 {
+			return nil, fmt.Errorf("invalid %s %q", TransportListenLabel, value)
 		}
+		t.Listen = listen
 	}
-
-	// For each TCP service, create routers and services
-	for serviceName, healthEntries := range allServices {
-		// Filter to only healthy services
-		healthyEntries := make([]*gossip.ServiceHealth, 0)
-		for _, health := range healthEntries {
-			if health.Healthy {
-				healthyEntries = append(healthyEntries, health)
-			}
+	if value, ok := labels[TransportProtocolLabel]; ok {
+		t.Protocol = strings.ToLower(value)
+		if t.Protocol != "tcp" && t.Protocol != "udp" {
+			return nil, fmt.Errorf("invalid %s %q (tcp or udp)", TransportProtocolLabel, value)
 		}
-
-		if len(healthyEntries) == 0 {
-			continue
+	}
+	if value, ok := labels[TransportTLSLabel]; ok {
+		t.TLS = strings.ToLower(value)
+		switch {
+		case t.TLS != TLSModeNone && t.TLS != TLSModePassthrough && t.TLS != TLSModeTerminate:
+			return nil, fmt.Errorf("invalid %s %q (none, passthrough or terminate)", TransportTLSLabel, value)
+		case t.Protocol == "udp" && t.TLS != TLSModeNone:
+			return nil, fmt.Errorf("%s is not supported for udp", TransportTLSLabel)
 		}
+	}
+	return t, nil
+}
 
-		// Get TCP port from endpoints or default
-		tcpPort := getTCPPort(healthyEntries[0])
-
-		// Create direct router: <service>.<node>.domain
-		for _, health := range healthyEntries {
-			routerName := fmt.Sprintf("%s-%s-tcp-direct", serviceName, health.NodeName)
-			serviceNameDirect := fmt.Sprintf("%s-%s-tcp-direct", serviceName, health.NodeName)
-
-			// Create router rule using HostSNI for TLS passthrough
-			rule := fmt.Sprintf("HostSNI(`%s.%s.%s`) || HostSNI(`%s.%s`)", serviceName, health.NodeName, s.domain, serviceName, s.domain)
-
-			config.Routers[routerName] = &TCPRouter{
-				Rule:        rule,
-				Service:     serviceNameDirect,
-				EntryPoints: []string{"websecure"},
-				TLS: &TLS{
-					CertResolver: "letsencrypt",
-				},
-			}
-
-			// Create direct TCP service
-			tcpEndpoint := health.Endpoints["tcp"]
-			if tcpEndpoint == "" {
-				// Construct from service name and port
-				tcpEndpoint = fmt.Sprintf("%s:%d", serviceName, tcpPort)
-			}
+// entrypoint is the name of the entrypoint a transport is served on, e.g. tcp-5432
+func (t *transport) entrypoint() string {
+	return fmt.Sprintf("%s-%d", t.Protocol, t.Listen)
+}
 
-			// Parse address:port
-			address := parseTCPAddress(tcpEndpoint)
+// transportClaims returns the transport each service declares in labels, taken from
+// every known instance whatever its health, so entrypoints do not come and go as
+// services fail. Each entrypoint serves one service; later claims are skipped with a warning.
+func (s *HTTPProviderServer) transportClaims() map[string]*transport {
+	serviceHealthMap := s.gossipState.GetAllServiceHealth()
 
-			config.Services[serviceNameDirect] = &TCPService{
-				LoadBalancer: &TCPLoadBalancer{
-					Servers: []TCPServer{
-						{Address: address},
-					},
-				},
-			}
+	transports := make(map[string]*transport)
+	for _, key := range sortedKeys(serviceHealthMap) {
+		health := serviceHealthMap[key]
+		t, err := parseTransport(health.Labels)
+		if err != nil {
+			s.warnOnce("Warning: skipping transport labels of %s: %v", health.ServiceName, err)
+			continue
 		}
-
-		// Create load-balanced router: <service>.domain (with failover)
-		if len(healthyEntries) > 0 {
-			routerName := fmt.Sprintf("%s-tcp-with-failover", serviceName)
-			serviceNameFailover := fmt.Sprintf("%s-tcp-with-failover", serviceName)
-
-			rule := fmt.Sprintf("HostSNI(`%s.%s`)", serviceName, s.domain)
-
-			config.Routers[routerName] = &TCPRouter{
-				Rule:        rule,
-				Service:     serviceNameFailover,
-				EntryPoints: []string{"websecure"},
-				TLS: &TLS{
-					CertResolver: "letsencrypt",
-				},
-			}
-
-			// Create failover TCP service with all healthy backends
-			servers := make([]TCPServer, 0, len(healthyEntries))
-			for _, health := range healthyEntries {
-				tcpEndpoint := health.Endpoints["tcp"]
-				if tcpEndpoint == "" {
-					// Use Tailscale IP for cross-node access if available
-					node, exists := s.gossipState.GetNode(health.NodeName)
-					if exists && node.TailscaleIP != "" {
-						// Use Tailscale IP for direct node access
-						tcpEndpoint = fmt.Sprintf("%s:%d", node.TailscaleIP, tcpPort)
-					} else {
-						// Fallback to service name (same network)
-						tcpEndpoint = fmt.Sprintf("%s:%d", serviceName, tcpPort)
-					}
-				}
-
-				address := parseTCPAddress(tcpEndpoint)
-				servers = append(servers, TCPServer{Address: address})
-			}
-
-			config.Services[serviceNameFailover] = &TCPService{
-				LoadBalancer: &TCPLoadBalancer{
-					Servers: servers,
-				},
-			}
+		if t == nil {
+			continue
+		}
+		if existing, ok := transports[health.ServiceName]; ok && *existing != *t {
+			s.warnOnce("Warning: replicas of %s declare different transports, keeping the first", health.ServiceName)
+			continue
 		}
+		transports[health.ServiceName] = t
 	}
 
-	return config
-}
-
-// computeUDPConfig computes UDP routers and services from gossip state
-func (s *HTTPProviderServer) computeUDPConfig() *UDPConfig {
-	config := &UDPConfig{
-		Routers:  make(map[string]*UDPRouter),
-		Services: make(map[string]*UDPService),
+	claimed := make(map[string]string) // entrypoint -> service
+	for _, serviceName := range sortedKeys(transports) {
+		entrypoint := transports[serviceName].entrypoint()
+		if owner, ok := claimed[entrypoint]; ok {
+			s.warnOnce("Warning: entrypoint %s is already used by %s, skipping %s", entrypoint, owner, serviceName)
+			delete(transports, serviceName)
+			continue
+		}
+		claimed[entrypoint] = serviceName
 	}
+	return transports
+}
 
-	// Get all service health entries
+// transportReplicas returns the healthy replicas serving the claimed transports of the
+// given protocol: those on this node while any is healthy, since connections to a
+// database should not cross nodes needlessly, otherwise all of them
+func (s *HTTPProviderServer) transportReplicas(claims map[string]*transport, protocol string) map[string][]*gossip.ServiceHealth {
 	serviceHealthMap := s.gossipState.GetAllServiceHealth()
 
-	// Group services by name
 	allServices := make(map[string][]*gossip.ServiceHealth)
-	for key, health := range serviceHealthMap {
-		parts := strings.Split(key, "@")
-		if len(parts) != 2 {
+	for _, key := range sortedKeys(serviceHealthMap) {
+		health := serviceHealthMap[key]
+		claim, ok := claims[health.ServiceName]
+		// Only include services that are healthy with their dependencies met
+		if !ok || claim.Protocol != protocol || !health.EffectiveHealthy() {
 			continue
 		}
-		serviceName := parts[0]
-
-		// Only include services that have UDP endpoints
-		if _, hasUDP := health.Endpoints["udp"]; hasUDP || isUDPService(serviceName) {
-			if allServices[serviceName] == nil {
-				allServices[serviceName] = make([]*gossip.ServiceHealth, 0)
-			}
-			allServices[serviceName] = append(allServices[serviceName], health)
+		if t, err := parseTransport(health.Labels); err != nil || t == nil || *t != *claim {
+			continue
 		}
+		allServices[health.ServiceName] = append(allServices[health.ServiceName], health)
 	}
 
-	// For each UDP service, create routers and services
-	for serviceName, healthEntries := range allServices {
-		// Filter to only healthy services
-		healthyEntries := make([]*gossip.ServiceHealth, 0)
-		for _, health := range healthEntries {
-			if health.Healthy {
-				healthyEntries = append(healthyEntries, health)
+	for serviceName, entries := range allServices {
+		// Degraded instances only receive traffic when no instance is fully healthy
+		entries = preferHealthy(entries)
+		local := make([]*gossip.ServiceHealth, 0)
+		for _, health := range entries {
+			if health.NodeName == s.localNodeName {
+				local = append(local, health)
 			}
 		}
-
-		if len(healthyEntries) == 0 {
-			continue
+		if len(local) > 0 {
+			entries = local
 		}
+		allServices[serviceName] = entries
+	}
+	return allServices
+}
 
-		// Get UDP port from endpoints or default
-		udpPort := getUDPPort(healthyEntries[0])
+// transportAddress returns the address a replica serves a transport on: the container
+// itself on this node, and its published port over Tailscale on other nodes
+func (s *HTTPProviderServer) transportAddress(health *gossip.ServiceHealth, t *transport) (string, bool) {
+	if health.NodeName == s.localNodeName {
+		return net.JoinHostPort(health.ServiceName, strconv.Itoa(t.Port)), true
+	}
 
-		// Create UDP router
-		routerName := fmt.Sprintf("%s-udp", serviceName)
-		serviceNameUDP := fmt.Sprintf("%s-udp", serviceName)
+	binding, ok := health.Endpoints[fmt.Sprintf("%d/%s", t.Port, t.Protocol)]
+	if !ok {
+		return "", false
+	}
+	node, exists := s.gossipState.GetNode(health.NodeName)
+	_, hostPort, err := net.SplitHostPort(binding)
+	if err != nil || !exists || node.TailscaleIP == "" {
+		return "", false
+	}
+	return net.JoinHostPort(node.TailscaleIP, hostPort), true
+}
 
-		config.Routers[routerName] = &UDPRouter{
-			EntryPoints: []string{"websecure"},
-			Service:     serviceNameUDP,
-		}
+// computeTCPConfig computes TCP routers and services for the services declaring a TCP
+// port in labels. Each is served on its own entrypoint with HostSNI(`*`), which plain
+// TCP clients match without sending SNI.
+func (s *HTTPProviderServer) computeTCPConfig(claims map[string]*transport) *TCPConfig {
+	config := &TCPConfig{
+		Routers:  make(map[string]*TCPRouter),
+		Services: make(map[string]*TCPService),
+	}
 
-		// Create UDP service with all healthy backends
-		servers := make([]UDPServer, 0, len(healthyEntries))
-		for _, health := range healthyEntries {
-			udpEndpoint := health.Endpoints["udp"]
-			if udpEndpoint == "" {
-				udpEndpoint = fmt.Sprintf("%s:%d", serviceName, udpPort)
+	allServices := s.transportReplicas(claims, "tcp")
+	for _, serviceName := range sortedKeys(allServices) {
+		t := claims[serviceName]
+		servers := make([]TCPServer, 0)
+		for _, health := range allServices[serviceName] {
+			if address, ok := s.transportAddress(health, t); ok {
+				servers = appendUnique(servers, TCPServer{Address: address})
 			}
-
-			address := parseUDPAddress(udpEndpoint)
-			servers = append(servers, UDPServer{Address: address})
+		}
+		if len(servers) == 0 {
+			s.warnOnce("Warning: no replica of %s publishes port %d/tcp to other nodes", serviceName, t.Port)
+			continue
 		}
 
-		config.Services[serviceNameUDP] = &UDPService{
-			LoadBalancer: &UDPLoadBalancer{
+		name := fmt.Sprintf("%s-tcp", serviceName)
+		router := &TCPRouter{
+			Rule:        "HostSNI(`*`)",
+			Service:     name,
+			EntryPoints: []string{t.entrypoint()},
+		}
+		switch t.TLS {
+		case TLSModePassthrough:
+			router.TLS = &TCPTLS{Passthrough: true}
+		case TLSModeTerminate:
+			router.TLS = &TCPTLS{
+				CertResolver: "letsencrypt",
+				Domains:      []Domain{{Main: fmt.Sprintf("%s.%s", serviceName, s.domain)}},
+			}
+		}
+		config.Routers[name] = router
+		config.Services[name] = &TCPService{
+			LoadBalancer: &TCPLoadBalancer{
 				Servers: servers,
 			},
 		}
@@ -212,105 +221,65 @@ func (s *HTTPProviderServer) computeUDPConfig() *UDPConfig {
 	return config
 }
 
-// Helper functions
-
-// isTCPService checks if a service is known to be a TCP service
-func isTCPService(serviceName string) bool {
-	tcpServices := []string{"mongodb", "redis", "postgres", "mysql"}
-	for _, name := range tcpServices {
-		if strings.Contains(strings.ToLower(serviceName), name) {
-			return true
-		}
+// computeUDPConfig computes UDP routers and services for the services declaring a UDP
+// port in labels, each on its own entrypoint
+func (s *HTTPProviderServer) computeUDPConfig(claims map[string]*transport) *UDPConfig {
+	config := &UDPConfig{
+		Routers:  make(map[string]*UDPRouter),
+		Services: make(map[string]*UDPService),
 	}
-	return false
-}
 
-// isUDPService checks if a service is known to be a UDP service
-func isUDPService(serviceName string) bool {
-	udpServices := []string{"dns", "ntp"}
-	for _, name := range udpServices {
-		if strings.Contains(strings.ToLower(serviceName), name) {
-			return true
+	allServices := s.transportReplicas(claims, "udp")
+	for _, serviceName := range sortedKeys(allServices) {
+		t := claims[serviceName]
+		servers := make([]UDPServer, 0)
+		for _, health := range allServices[serviceName] {
+			if address, ok := s.transportAddress(health, t); ok {
+				servers = appendUnique(servers, UDPServer{Address: address})
+			}
 		}
-	}
-	return false
-}
-
-// getTCPPort extracts TCP port from service health or returns default
-func getTCPPort(health *gossip.ServiceHealth) int {
-	if tcpEndpoint, ok := health.Endpoints["tcp"]; ok {
-		if port := parsePort(tcpEndpoint); port > 0 {
-			return port
+		if len(servers) == 0 {
+			s.warnOnce("Warning: no replica of %s publishes port %d/udp to other nodes", serviceName, t.Port)
+			continue
 		}
-	}
 
-	// Default ports for common services
-	defaultPorts := map[string]int{
-		"mongodb":  27017,
-		"redis":    6379,
-		"postgres": 5432,
-		"mysql":    3306,
-	}
-
-	for serviceName, port := range defaultPorts {
-		if strings.Contains(strings.ToLower(health.ServiceName), serviceName) {
-			return port
+		name := fmt.Sprintf("%s-udp", serviceName)
+		config.Routers[name] = &UDPRouter{
+			EntryPoints: []string{t.entrypoint()},
+			Service:     name,
 		}
-	}
-
-	return 8080 // Default fallback
-}
-
-// getUDPPort extracts UDP port from service health or returns default
-func getUDPPort(health *gossip.ServiceHealth) int {
-	if udpEndpoint, ok := health.Endpoints["udp"]; ok {
-		if port := parsePort(udpEndpoint); port > 0 {
-			return port
+		config.Services[name] = &UDPService{
+			LoadBalancer: &UDPLoadBalancer{
+				Servers: servers,
+			},
 		}
 	}
 
-	return 53 // Default DNS port
-}
-
-// parsePort extracts port number from address:port string
-func parsePort(address string) int {
-	parts := strings.Split(address, ":")
-	if len(parts) < 2 {
-		return 0
-	}
-
-	port, err := strconv.Atoi(parts[len(parts)-1])
-	if err != nil {
-		return 0
-	}
-
-	return port
+	return config
 }
 
-// parseTCPAddress parses TCP address from endpoint string
-func parseTCPAddress(endpoint string) string {
-	// Remove protocol prefix if present
-	endpoint = strings.TrimPrefix(endpoint, "tcp://")
-	endpoint = strings.TrimPrefix(endpoint, "tcp:")
-
-	// If no port specified, add default
-	if !strings.Contains(endpoint, ":") {
-		return endpoint + ":8080"
-	}
-
-	return endpoint
+// Entrypoint is an entrypoint Traefik's static configuration must define for the
+// generated TCP and UDP routers
+type Entrypoint struct {
+	Address  string   `json:"address"` // As in the static configuration: ":5432" or ":53/udp"
+	Services []string `json:"services"`
 }
 
-// parseUDPAddress parses UDP address from endpoint string
-func parseUDPAddress(endpoint string) string {
-	// Remove protocol prefix if present
-	endpoint = strings.TrimPrefix(endpoint, "udp://")
-	endpoint = strings.TrimPrefix(endpoint, "udp:")
-
-	// If no port specified, add default
-	if !strings.Contains(endpoint, ":") {
-		return endpoint + ":53"
+// requiredEntrypoints lists the dedicated entrypoints of the claimed transports. Services
+// that are down keep theirs, so Traefik's static configuration does not have to change
+// when they fail.
+func requiredEntrypoints(claims map[string]*transport) map[string]*Entrypoint {
+	entrypoints := make(map[string]*Entrypoint)
+	for _, serviceName := range sortedKeys(claims) {
+		t := claims[serviceName]
+		entrypoint := &Entrypoint{
+			Address:  fmt.Sprintf(":%d", t.Listen),
+			Services: []string{fmt.Sprintf("%s-%s", serviceName, t.Protocol)},
+		}
+		if t.Protocol == "udp" {
+			entrypoint.Address += "/udp"
+		}
+		entrypoints[t.entrypoint()] = entrypoint
 	}
-
-	return endpoint
+	return entrypoints
 }
@@ -0,0 +1,196 @@
+package traefik
+
+import (
+	"testing"
+
+	"cluster/infra/cluster/gossip"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    *transport
+		wantErr string
+	}{
+		{name: "no port", labels: map[string]string{"traefik.enable": "true"}},
+		{
+			name:   "tcp defaults",
+			labels: map[string]string{TransportPortLabel: "5432"},
+			want:   &transport{Protocol: "tcp", Port: 5432, Listen: 5432, TLS: TLSModeNone},
+		},
+		{
+			name: "udp with listen port",
+			labels: map[string]string{
+				TransportPortLabel:     "53",
+				TransportProtocolLabel: "UDP",
+				TransportListenLabel:   "5353",
+			},
+			want: &transport{Protocol: "udp", Port: 53, Listen: 5353, TLS: TLSModeNone},
+		},
+		{
+			name:   "tls passthrough",
+			labels: map[string]string{TransportPortLabel: "443", TransportTLSLabel: "Passthrough"},
+			want:   &transport{Protocol: "tcp", Port: 443, Listen: 443, TLS: TLSModePassthrough},
+		},
+		{name: "port not a number", labels: map[string]string{TransportPortLabel: "redis"}, wantErr: "invalid " + TransportPortLabel},
+		{name: "port out of range", labels: map[string]string{TransportPortLabel: "70000"}, wantErr: "invalid " + TransportPortLabel},
+		{
+			name:    "listen out of range",
+			labels:  map[string]string{TransportPortLabel: "6379", TransportListenLabel: "0"},
+			wantErr: "invalid " + TransportListenLabel,
+		},
+		{
+			name:    "unknown protocol",
+			labels:  map[string]string{TransportPortLabel: "6379", TransportProtocolLabel: "sctp"},
+			wantErr: "invalid " + TransportProtocolLabel,
+		},
+		{
+			name:    "unknown tls mode",
+			labels:  map[string]string{TransportPortLabel: "6379", TransportTLSLabel: "mutual"},
+			wantErr: "invalid " + TransportTLSLabel,
+		},
+		{
+			name: "tls on udp",
+			labels: map[string]string{
+				TransportPortLabel:     "53",
+				TransportProtocolLabel: "udp",
+				TransportTLSLabel:      TLSModeTerminate,
+			},
+			wantErr: "not supported for udp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTransport(tt.labels)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTransportClaims(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []*gossip.ServiceHealth
+		want     map[string]string // service -> entrypoint
+	}{
+		{
+			name: "separate entrypoints",
+			services: []*gossip.ServiceHealth{
+				transportService("postgres", "node1", true, "5432", "tcp"),
+				transportService("redis", "node1", true, "6379", "tcp"),
+			},
+			want: map[string]string{"postgres": "tcp-5432", "redis": "tcp-6379"},
+		},
+		{
+			name: "first service by name keeps a contested entrypoint",
+			services: []*gossip.ServiceHealth{
+				transportService("redis-b", "node1", true, "6379", "tcp"),
+				transportService("redis-a", "node2", true, "6379", "tcp"),
+			},
+			want: map[string]string{"redis-a": "tcp-6379"},
+		},
+		{
+			name: "same port over tcp and udp",
+			services: []*gossip.ServiceHealth{
+				transportService("dns", "node1", true, "53", "udp"),
+				transportService("dns-tcp", "node1", true, "53", "tcp"),
+			},
+			want: map[string]string{"dns": "udp-53", "dns-tcp": "tcp-53"},
+		},
+		{
+			name: "unhealthy services still claim their entrypoint",
+			services: []*gossip.ServiceHealth{
+				transportService("postgres", "node1", false, "5432", "tcp"),
+				transportService("postgres-copy", "node2", true, "5432", "tcp"),
+			},
+			want: map[string]string{"postgres": "tcp-5432"},
+		},
+		{
+			name: "replicas declaring different transports keep the first",
+			services: []*gossip.ServiceHealth{
+				transportService("redis", "node1", true, "6379", "tcp"),
+				transportService("redis", "node2", true, "6380", "tcp"),
+			},
+			want: map[string]string{"redis": "tcp-6379"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTransportTestServer(tt.services...)
+
+			claims := server.transportClaims()
+			got := make(map[string]string, len(claims))
+			for serviceName, claim := range claims {
+				got[serviceName] = claim.entrypoint()
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRequiredEntrypoints_ServiceDown(t *testing.T) {
+	server := newTransportTestServer(
+		transportService("postgres", "node1", false, "5432", "tcp"),
+		transportService("dns", "node1", true, "53", "udp"),
+	)
+
+	snapshot := server.currentSnapshot()
+
+	// The service that is down has no router, but keeps its entrypoint
+	assert.NotContains(t, snapshot.config.TCP.Routers, "postgres-tcp")
+	assert.Contains(t, snapshot.config.UDP.Routers, "dns-udp")
+	assert.Equal(t, map[string]*Entrypoint{
+		"tcp-5432": {Address: ":5432", Services: []string{"postgres-tcp"}},
+		"udp-53":   {Address: ":53/udp", Services: []string{"dns-udp"}},
+	}, snapshot.entrypoints)
+}
+
+func TestComputeTCPConfig_PrefersLocalReplicas(t *testing.T) {
+	server := newTransportTestServer(
+		transportService("postgres", "node1", true, "5432", "tcp"),
+		transportService("postgres", "node2", true, "5432", "tcp"),
+		transportService("postgres", "node3", false, "5432", "tcp"),
+	)
+
+	config := server.computeTCPConfig(server.transportClaims())
+	require.Contains(t, config.Services, "postgres-tcp")
+	assert.Equal(t, []TCPServer{{Address: "postgres:5432"}}, config.Services["postgres-tcp"].LoadBalancer.Servers)
+}
+
+// newTransportTestServer returns a provider on node1 with the given service instances
+func newTransportTestServer(services ...*gossip.ServiceHealth) *HTTPProviderServer {
+	state := gossip.NewClusterState()
+	for _, node := range []string{"node1", "node2", "node3"} {
+		state.UpdateNode(&gossip.NodeMetadata{Name: node, TailscaleIP: "100.64.0." + node[len(node)-1:]})
+	}
+	for _, health := range services {
+		state.UpdateServiceHealth(health)
+	}
+	return NewHTTPProviderServer(state, 0, "example.com", "node1")
+}
+
+// transportService returns an instance of a service declaring a transport port
+func transportService(serviceName, nodeName string, healthy bool, port, protocol string) *gossip.ServiceHealth {
+	return &gossip.ServiceHealth{
+		ServiceName: serviceName,
+		NodeName:    nodeName,
+		Healthy:     healthy,
+		Endpoints:   map[string]string{port + "/" + protocol: "0.0.0.0:" + port},
+		Labels: map[string]string{
+			TransportPortLabel:     port,
+			TransportProtocolLabel: protocol,
+		},
+	}
+}